@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"os"
+	"strings"
+)
+
+// commands are admin subcommands operating on the database,
+// the explorer must be stopped while they run except snapshot.
+var commands = map[string]func(args []string) error{
+	"reset":    resetCommand,
+	"rewind":   rewindCommand,
+	"verify":   verifyCommand,
+	"snapshot": snapshotCommand,
+}
+
+// taskAliases are short names of tasks accepted by commands.
+var taskAliases = map[string]string{
+	"balance": "balance_history",
+}
+
+// runCommand runs the subcommand named by args[0], it returns false if there is no such command.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if err := cmd(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	return true
+}
+
+// newFlagSet returns flags of the subcommand with the config flags.
+func newFlagSet(name string, usage string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: neo_explorer %s\n\n%s\n\n", name, usage)
+		fs.PrintDefaults()
+	}
+
+	configFile := fs.String("config", "", "path of the config file, ./config.json by default")
+	profile := fs.String("profile", "", "name of the profile in the config file to use, e.g. testnet")
+
+	return fs, configFile, profile
+}
+
+// openDB loads config, connects to the database and loads asset ids used by rollbacks.
+func openDB(configFile string, profile string) (*db.SQLStore, error) {
+	log.Init()
+	if err := config.LoadFile(configFile, profile); err != nil {
+		return nil, err
+	}
+
+	store := db.NewStore()
+	cache.LoadAssetsInfo(store.GetAssetInfo())
+	return store, nil
+}
+
+func parseTask(name string) (string, error) {
+	if task, ok := taskAliases[name]; ok {
+		name = task
+	}
+
+	for _, task := range db.Tasks() {
+		if task == name {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown task '%s', must be one of: %s, balance", name, strings.Join(db.Tasks(), ", "))
+}
+
+func resetCommand(args []string) error {
+	fs, configFile, profile := newFlagSet("reset --task TASK",
+		"Removes all records of the task and resets its counters, the task starts from\n"+
+			"the first transaction on next start. Resetting nep5 resets nep5 addr_tx as well.")
+	taskName := fs.String("task", "", "task to reset: "+strings.Join(db.Tasks(), ", ")+" or balance")
+	fs.Parse(args)
+
+	task, err := parseTask(*taskName)
+	if err != nil {
+		return err
+	}
+	store, err := openDB(*configFile, *profile)
+	if err != nil {
+		return err
+	}
+
+	report, err := store.ResetTask(task)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset task %s, it had handled transactions up to pk %d\n", task, report.LastTxPk)
+	printReport(report)
+	return nil
+}
+
+func rewindCommand(args []string) error {
+	fs, configFile, profile := newFlagSet("rewind --task TASK --to-tx-pk N | rewind --blocks-to HEIGHT",
+		"With --task, reverts records of the task created by transactions whose pk > N,\n"+
+			"the task continues from transaction N+1 on next start.\n"+
+			"With --blocks-to, removes blocks higher than HEIGHT and reverts every record derived from them.")
+	taskName := fs.String("task", "", "task to rewind: "+strings.Join(db.Tasks(), ", ")+" or balance")
+	toTxPk := fs.Int64("to-tx-pk", -1, "pk of the last transaction kept for the task")
+	blocksTo := fs.Int("blocks-to", -2, "index of the last block kept, -1 removes all blocks")
+	fs.Parse(args)
+
+	switch {
+	case *taskName != "" && *blocksTo != -2:
+		return fmt.Errorf("--task and --blocks-to can not be used together")
+	case *taskName != "":
+		task, err := parseTask(*taskName)
+		if err != nil {
+			return err
+		}
+		if *toTxPk < 0 {
+			return fmt.Errorf("--to-tx-pk must be set to a pk >= 0")
+		}
+		store, err := openDB(*configFile, *profile)
+		if err != nil {
+			return err
+		}
+
+		report, err := store.RewindTask(task, uint(*toTxPk))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Rewound task %s to transaction pk %d, reverted pk %d-%d\n", task, *toTxPk, report.FirstTxPk, report.LastTxPk)
+		printReport(report)
+	case *blocksTo >= -1:
+		store, err := openDB(*configFile, *profile)
+		if err != nil {
+			return err
+		}
+
+		if height := store.GetLastHeight(); *blocksTo >= height {
+			return fmt.Errorf("the highest stored block is %d", height)
+		}
+
+		report, err := store.RollbackBlocks(*blocksTo + 1)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed blocks %d-%d\n", report.FromHeight, report.ToHeight)
+		if report.FirstTxPk > 0 {
+			fmt.Printf("\tremoved transactions: pk %d-%d\n", report.FirstTxPk, report.LastTxPk)
+		}
+		printReport(report)
+	default:
+		fs.Usage()
+		return fmt.Errorf("either --task with --to-tx-pk or --blocks-to must be set")
+	}
+
+	return nil
+}
+
+func verifyCommand(args []string) error {
+	fs, configFile, profile := newFlagSet("verify [--repair]",
+		"Compares balances in addr_asset with unspent utxos, and available amount of assets\n"+
+			"with their issued outputs. Exits with status 2 if any mismatch is left.")
+	repair := fs.Bool("repair", false, "set mismatched balances to the values computed from utxo")
+	fs.Parse(args)
+
+	store, err := openDB(*configFile, *profile)
+	if err != nil {
+		return err
+	}
+
+	report, err := store.VerifyBalances(false)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checked %d address balances\n", report.Checked)
+	for _, m := range report.Balances {
+		if m.Balance == nil {
+			fmt.Printf("\taddress_id %d, asset_id %d: addr_asset missing, utxo %s\n", m.AddressId, m.AssetId, m.UTXO.Text('f', 8))
+			continue
+		}
+		fmt.Printf("\taddress_id %d, asset_id %d: addr_asset %s, utxo %s\n", m.AddressId, m.AssetId, m.Balance.Text('f', 8), m.UTXO.Text('f', 8))
+	}
+	for _, m := range report.Available {
+		fmt.Printf("\tasset %s: available %s, issued %s\n", m.AssetID, m.Available.Text('f', 8), m.Issued.Text('f', 8))
+	}
+
+	if report.OK() {
+		fmt.Println("No mismatch found")
+		return nil
+	}
+
+	missing := 0
+	for _, m := range report.Balances {
+		if m.Balance == nil {
+			missing++
+		}
+	}
+
+	if *repair {
+		repaired, err := store.RepairBalances(report)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Repaired %d records\n", repaired)
+
+		if missing == 0 {
+			return nil
+		}
+	}
+
+	if missing > 0 {
+		fmt.Printf("%d addr_asset records are missing, run 'neo_explorer reset --task tx' to rebuild them\n", missing)
+	}
+	os.Exit(2)
+	return nil
+}
+
+// snapshotOutput is the json output of the snapshot command.
+type snapshotOutput struct {
+	Asset string `json:"asset"`
+	*db.Snapshot
+	Balances []db.SnapshotBalance `json:"balances"`
+}
+
+func snapshotCommand(args []string) error {
+	fs, configFile, profile := newFlagSet("snapshot --asset ASSET --height HEIGHT [--format csv|json] [--out FILE]",
+		"Computes balances of all holders of the asset as of block HEIGHT, from tx_vout and tx_vin for\n"+
+			"global assets or by replaying nep5_tx transfers for nep5 assets. The snapshot is stored in\n"+
+			"the database chunk by chunk, running the command again resumes an interrupted snapshot.")
+	assetName := fs.String("asset", "", "asset id, asset name or nep5 contract hash")
+	height := fs.Int64("height", -1, "block index of the snapshot")
+	format := fs.String("format", "csv", "output format: csv or json")
+	out := fs.String("out", "", "output file, stdout by default")
+	fs.Parse(args)
+
+	if *assetName == "" || *height < 0 {
+		fs.Usage()
+		return fmt.Errorf("--asset and --height must be set")
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unsupported format '%s', must be csv or json", *format)
+	}
+	store, err := openDB(*configFile, *profile)
+	if err != nil {
+		return err
+	}
+
+	assetId, _, err := store.ResolveAsset(*assetName)
+	if err != nil {
+		return err
+	}
+	if assetId == 0 {
+		return fmt.Errorf("asset %s not found", *assetName)
+	}
+
+	s, err := store.CreateSnapshot(assetId, uint(*height))
+	if err != nil {
+		return err
+	}
+
+	err = store.BuildSnapshot(s, func(s *db.Snapshot) {
+		fmt.Fprintf(os.Stderr, "Replayed records up to pk %d/%d\n", s.LastPk, s.EndPk)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s, err = store.GetSnapshot(assetId, uint(*height)); err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "json" {
+		output := snapshotOutput{Asset: *assetName, Snapshot: s, Balances: []db.SnapshotBalance{}}
+		err = store.ScanSnapshotBalances(s.Id, func(b db.SnapshotBalance) error {
+			output.Balances = append(output.Balances, b)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(w).Encode(output); err != nil {
+			return err
+		}
+	} else {
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"address", "balance"}); err != nil {
+			return err
+		}
+		err = store.ScanSnapshotBalances(s.Id, func(b db.SnapshotBalance) error {
+			return cw.Write([]string{b.Address, b.Balance})
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Snapshot of asset %s at height %d: %d holders, total %s\n", *assetName, s.Height, s.Holders, s.Total)
+	return nil
+}
+
+func printReport(report *db.RollbackReport) {
+	for _, rows := range report.Rows {
+		fmt.Printf("\t%s: %d rows %s\n", rows.Table, rows.Rows, rows.Action)
+	}
+	for _, note := range report.Notes {
+		fmt.Printf("\tnote: %s\n", note)
+	}
+
+	fmt.Println("In-memory caches are rebuilt from database when the explorer starts.")
+}
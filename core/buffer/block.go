@@ -54,6 +54,16 @@ func (b *BlockBuffer) GetNextPending() int {
 	return b.nextHeight
 }
 
+// ReservePending reserves the next n fetching block indexes and returns the first one.
+func (b *BlockBuffer) ReservePending(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	first := b.nextHeight + 1
+	b.nextHeight += n
+	return first
+}
+
 // Put adds the given block into buffer and update maxHeight.
 func (b *BlockBuffer) Put(block *rpc.RawBlock) {
 	b.mu.Lock()
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"math/big"
 	"neo_explorer/neo/addr"
 	"sync"
@@ -114,14 +115,16 @@ func (cache *AddrCacheItem) UpdateLastTxTime(lastTxTime uint64) bool {
 
 // GetAddrAsset returns AddrAssetCacheItem by AssetMap.
 func (cache *AddrCacheItem) GetAddrAsset(assetID string) (*AddrAssetCacheItem, bool) {
+	assetLock.RLock()
+	assetId, ok := AssetMap[assetID]
+	assetLock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
 	addrCacheLock.RLock()
 	defer addrCacheLock.RUnlock()
 
-	assetId, err := GetAssetId(assetID)
-	if err != nil {
-		panic(err)
-	}
-
 	addrAssetCache, ok := cache.AddrAssetCache[assetId]
 	return addrAssetCache, ok
 }
@@ -162,6 +165,23 @@ func (addrAssetCache *AddrAssetCacheItem) UpdateBalance(balance *big.Float, bloc
 	return false
 }
 
+// GetBalance returns balance of address asset.
+func (addrAssetCache *AddrAssetCacheItem) GetBalance() *big.Float {
+	addrCacheLock.RLock()
+	defer addrCacheLock.RUnlock()
+
+	return addrAssetCache.Balance
+}
+
+// SetBalance replaces balance of address asset regardless of its block index,
+// it is used to repair cached balances.
+func (addrAssetCache *AddrAssetCacheItem) SetBalance(balance *big.Float) {
+	addrCacheLock.Lock()
+	defer addrCacheLock.Unlock()
+
+	addrAssetCache.Balance = balance
+}
+
 // AddBalance increases balance at the given blockIndex.
 func (addrAssetCache *AddrAssetCacheItem) AddBalance(delta *big.Float, blockIndex uint) bool {
 	if delta.Cmp(big.NewFloat(0)) == 0 {
@@ -200,29 +220,35 @@ func (addrAssetCache *AddrAssetCacheItem) SubtractBalance(delta *big.Float, bloc
 	return true
 }
 
-// CreateAddrAsset creates address asset cache.
-func CreateAddrAsset(addressId uint, assetId uint, balance *big.Float, blockIndex uint) {
+// CreateAddrAsset creates address asset cache, the address must be cached first.
+func CreateAddrAsset(addressId uint, assetId uint, balance *big.Float, blockIndex uint) error {
 	addrCacheLock.Lock()
 	defer addrCacheLock.Unlock()
 
-	cache := getAddrCache(addressId)
+	cache, ok := addrCache[addressId]
+	if !ok {
+		return fmt.Errorf("address %d is not cached, make sure address data is cached first", addressId)
+	}
+
 	cache.AddrAssetCache[assetId] = &AddrAssetCacheItem{
 		Balance:    balance,
 		BlockIndex: blockIndex,
 	}
-}
-
-func getAddrCache(addressId uint) *AddrCacheItem {
-	cache, ok := addrCache[addressId]
-	if !ok {
-		panic("Falied to find target addrCache. Make sure address data is cached first")
-	}
 
-	return cache
+	return nil
 }
 
 // MigrateNEP5 handles nep5 contract migration.
-func MigrateNEP5(newAssetAdminId uint, oldAssetID, newAssetID string) (uint, uint) {
+func MigrateNEP5(newAssetAdminId uint, oldAssetID, newAssetID string) (uint, uint, error) {
+	newAssetId, err := GetAssetId(newAssetID)
+	if err != nil {
+		return 0, 0, err
+	}
+	oldAssetId, err := GetAssetId(oldAssetID)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	addrCacheLock.Lock()
 	defer addrCacheLock.Unlock()
 
@@ -230,19 +256,11 @@ func MigrateNEP5(newAssetAdminId uint, oldAssetID, newAssetID string) (uint, uin
 	holdingAddrs := uint(0)
 
 	for addr, item := range addrCache {
-		newAssetId, err := GetAssetId(newAssetID)
-		if err != nil {
-			panic(err)
-		}
 		if addr == newAssetAdminId {
 			if _, ok := addrCache[newAssetAdminId].AddrAssetCache[newAssetId]; ok {
 				continue
 			}
 		}
-		oldAssetId, err := GetAssetId(oldAssetID)
-		if err != nil {
-			panic(err)
-		}
 		if old, ok := item.AddrAssetCache[oldAssetId]; ok {
 			item.AddrAssetCache[newAssetId] = &AddrAssetCacheItem{
 				Balance:    new(big.Float).Copy(old.Balance),
@@ -258,5 +276,5 @@ func MigrateNEP5(newAssetAdminId uint, oldAssetID, newAssetID string) (uint, uin
 		}
 	}
 
-	return addrs, holdingAddrs
+	return addrs, holdingAddrs, nil
 }
@@ -10,7 +10,6 @@ import (
 
 func TestLoadAddrAssetInfo(t *testing.T) {
 	config.Load()
-	db.Init()
-	addrAssetInfo := db.GetAddrAssetInfo()
+	addrAssetInfo := db.NewStore().GetAddrAssetInfo()
 	cache.LoadAddrAssetInfo(addrAssetInfo)
 }
@@ -62,3 +62,12 @@ func setAsset(asset asset.Asset) bool {
 func GetAssetMaxID() uint {
 	return assetMaxID
 }
+
+// LookupAssetId returns the cached id of the given asset_id without creating one.
+func LookupAssetId(asset_id string) (uint, bool) {
+	assetLock.Lock()
+	defer assetLock.Unlock()
+
+	assetId, ok := AssetMap[asset_id]
+	return assetId, ok
+}
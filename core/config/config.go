@@ -3,87 +3,370 @@ package config
 import (
 	"errors"
 	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"neo_explorer/core/log"
 	"net"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"time"
+)
+
+// Supported database drivers.
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
 )
 
 type config struct {
-	// MySQL configs.
-	User     string
-	Password string
-	Hostname string
-	Port     string
-	Database string
+	// Driver selects the database, "mysql" if empty.
+	Driver string `mapstructure:"db_driver"`
+	// DbPath is the database file of sqlite.
+	DbPath string `mapstructure:"db_path"`
+
+	// MySQL and PostgreSQL configs.
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	// PasswordFile is read as Password if set, e.g. a mounted secret.
+	PasswordFile string `mapstructure:"password_file"`
+	Hostname     string `mapstructure:"hostname"`
+	Port         string `mapstructure:"port"`
+	Database     string `mapstructure:"database"`
+	// SSLMode is the sslmode of PostgreSQL connection, "disable" if empty.
+	SSLMode string `mapstructure:"sslmode"`
 
 	// Label sets log output prefix.
-	Label string
+	Label string `mapstructure:"label"`
 
 	RPCs []string `mapstructure:"rpc_url"`
+	// RPCBatchSize is how many blocks or application logs are requested in a single
+	// JSON-RPC batch call, 20 if not set. Set it to 1 to disable batch calls.
+	RPCBatchSize int `mapstructure:"rpc_batch_size"`
+	// Discovery finds more rpc servers from peers of configured ones.
+	Discovery Discovery `mapstructure:"rpc_discovery"`
 
 	// Workers sets the number of goroutines that will be created for data processing.
 	// Recommend value: 3.
-	Workers int
+	Workers int `mapstructure:"workers"`
+
+	// APIAddr is the listen address of the http query api, e.g. ":8080".
+	// The api is disabled if empty.
+	APIAddr string `mapstructure:"api_addr"`
+	// AdminToken enables admin endpoints of the api,
+	// requests must carry it in header 'Authorization: Bearer <token>'.
+	AdminToken string `mapstructure:"admin_token"`
+	// AdminTokenFile is read as AdminToken if set.
+	AdminTokenFile string `mapstructure:"admin_token_file"`
+
+	// Verify configures the periodic balance verification.
+	Verify Verify `mapstructure:"verify"`
+	// Nep5Reconcile configures the periodic reconciliation of nep5 balances.
+	Nep5Reconcile Nep5Reconcile `mapstructure:"nep5_reconcile"`
+	// BalanceHistory configures buckets of the balance history of addresses.
+	BalanceHistory BalanceHistory `mapstructure:"balance_history"`
+	// RichList configures the periodic computation of rich lists of assets.
+	RichList RichList `mapstructure:"rich_list"`
+
+	// Profiles are named settings, e.g. of mainnet and testnet, the selected one
+	// overrides the fields above.
+	Profiles map[string]interface{} `mapstructure:"profiles"`
+}
+
+// Discovery configures discovery of rpc servers.
+type Discovery struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxServers limits the number of discovered servers, 20 if not set.
+	MaxServers int `mapstructure:"max_servers"`
+	// Ports are probed on every peer address, 10332 and 20332 if not set.
+	// Ports 443, 10331 and 20331 are requested with https.
+	Ports []int `mapstructure:"ports"`
+	// Allow lists IPs or CIDRs of discovered servers, all public addresses are allowed if empty.
+	Allow []string `mapstructure:"allow"`
+	// Deny lists IPs or CIDRs never added.
+	Deny []string `mapstructure:"deny"`
+}
+
+// Verify configures the periodic verification of balances against utxo.
+type Verify struct {
+	// Interval between verifications, e.g. "24h". Verification is disabled if not set.
+	Interval time.Duration `mapstructure:"interval"`
+	// Repair fixes mismatched balances found by verification.
+	Repair bool `mapstructure:"repair"`
+}
+
+// Nep5Reconcile configures the periodic reconciliation of nep5 balances with contract state.
+type Nep5Reconcile struct {
+	// Interval between reconciliations, e.g. "168h". Reconciliation is disabled if not set.
+	Interval time.Duration `mapstructure:"interval"`
+	// BatchSize is how many balanceOf calls are sent in one invokescript, 100 if not set.
+	BatchSize int `mapstructure:"batch_size"`
 }
 
-var cfg config
+// Buckets of the balance history.
+const (
+	BucketDay  = "day"
+	BucketHour = "hour"
+)
+
+// BalanceHistory configures how balance changes of addresses are grouped by time.
+// Existing history must be rebuilt after it is changed.
+type BalanceHistory struct {
+	// Bucket is "day" or "hour", "day" if not set.
+	Bucket string `mapstructure:"bucket"`
+	// TimeZone is the IANA name of the time zone buckets start in, e.g. "Asia/Shanghai", "UTC" if not set.
+	TimeZone string `mapstructure:"time_zone"`
+}
+
+// MaxRichListTop is the maximum number of top holders kept in rich lists.
+const MaxRichListTop = 1000
+
+// RichList configures the periodic computation of rich lists and holder distribution of assets.
+type RichList struct {
+	// Interval between computations, e.g. "1h". Computation is disabled if not set.
+	Interval time.Duration `mapstructure:"interval"`
+	// Top is how many top holders are kept for every asset, 100 if not set.
+	Top int `mapstructure:"top"`
+}
 
+// MaxWorkers is the maximum number of goroutines fetching blocks.
+const MaxWorkers = 255
+
+var (
+	cfg config
+	// profile is the name of the selected profile.
+	profile string
+	mu      sync.RWMutex
+	// reloadHooks are called after config reloaded.
+	reloadHooks []func()
+)
+
+func get() config {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return cfg
+}
+
+// Load reads config.json in the working directory, it panics if the config is invalid.
 func Load() {
-	viper.SetConfigName("config") // 设置配置文件名
-	viper.AddConfigPath(".")      // 第一个搜索路径
-	err := viper.ReadInConfig()   // 读取配置数据
-	if err != nil {
+	if err := LoadFile("", ""); err != nil {
 		panic(err)
 	}
+}
 
-	err = viper.Unmarshal(&cfg) // 将配置信息绑定到结构体上
+// LoadFile reads the config file at path and applies the named profile in it,
+// environment variables NEO_EXPLORER_CONFIG and NEO_EXPLORER_PROFILE are used if they are empty.
+// Without a path, config.json in the working directory is read if it exists.
+// Every field can be overridden by environment variables, see envName.
+func LoadFile(path string, profileName string) error {
+	if path == "" {
+		path = os.Getenv(envPrefix + "_CONFIG")
+	}
+	if profileName == "" {
+		profileName = os.Getenv(envPrefix + "_PROFILE")
+	}
+
+	bindEnv()
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.SetConfigName("config") // 设置配置文件名
+		viper.AddConfigPath(".")      // 第一个搜索路径
+	}
+
+	err := viper.ReadInConfig() // 读取配置数据
+	if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+		// All fields are set by environment variables.
+		err = nil
+	}
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	err = check() // check config
+	mu.Lock()
+	profile = profileName
+	mu.Unlock()
+
+	c, err := read()
 	if err != nil {
-		panic(err)
+		return err
 	}
+
+	mu.Lock()
+	cfg = c
+	mu.Unlock()
+
+	return nil
+}
+
+// OnReload registers fn to be called after config reloaded.
+func OnReload(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// Watch reloads config when the config file changes.
+// Changes of 'rpc_url', 'workers', 'label', 'admin_token' and other rpc settings take effect at once,
+// database and api settings require restart, 'balance_history' is kept. Invalid config is ignored.
+func Watch() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		if err := Reload(); err != nil {
+			log.Error.Printf("Failed to reload config %s: %v\n", e.Name, err)
+		}
+	})
+	viper.WatchConfig()
+}
+
+// Reload reads config again, the current config is kept if the new one is invalid.
+func Reload() error {
+	c, err := read()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	old := cfg
+	// Existing history would be bucketed differently, keep the settings it was built with.
+	bucketChanged := c.BalanceHistory != old.BalanceHistory
+	c.BalanceHistory = old.BalanceHistory
+	cfg = c
+	hooks := append([]func(){}, reloadHooks...)
+	mu.Unlock()
+
+	if bucketChanged {
+		log.Printf("Balance history settings changed, rebuild history and restart to apply them\n")
+	}
+	if old.Driver != c.Driver || old.DbPath != c.DbPath || old.User != c.User ||
+		old.Password != c.Password || old.Hostname != c.Hostname || old.Port != c.Port ||
+		old.Database != c.Database || old.SSLMode != c.SSLMode || old.APIAddr != c.APIAddr {
+		log.Printf("Database or api settings changed, restart to apply them\n")
+	}
+	log.Printf("Config reloaded\n")
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	return nil
 }
 
-func check() error {
-	if cfg.Workers < 1 {
-		return errors.New("value of 'goroutine' must greater than or equal to 1")
+func (c *config) check() error {
+	if c.Workers < 1 || c.Workers > MaxWorkers {
+		return fmt.Errorf("value of 'workers' must be between 1 and %d", MaxWorkers)
+	}
+
+	if len(c.RPCs) < 1 {
+		return errors.New("at least 1 rpc server url must be set in 'rpc_url'")
+	}
+
+	if c.RPCBatchSize < 0 {
+		return errors.New("value of 'rpc_batch_size' must not be negative")
+	}
+
+	if c.Discovery.MaxServers < 0 {
+		return errors.New("value of 'rpc_discovery.max_servers' must not be negative")
+	}
+
+	for _, port := range c.Discovery.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port in 'rpc_discovery.ports': %d", port)
+		}
+	}
+
+	for _, addrs := range [][]string{c.Discovery.Allow, c.Discovery.Deny} {
+		if _, err := ParseNets(addrs); err != nil {
+			return err
+		}
 	}
 
-	if len(cfg.RPCs) < 1 {
-		return errors.New("at least 1 rpc server url must be set")
+	if c.Verify.Interval < 0 {
+		return errors.New("value of 'verify.interval' must not be negative")
 	}
 
-	for _, rpc := range cfg.RPCs {
+	if c.Nep5Reconcile.Interval < 0 {
+		return errors.New("value of 'nep5_reconcile.interval' must not be negative")
+	}
+
+	if c.Nep5Reconcile.BatchSize < 0 {
+		return errors.New("value of 'nep5_reconcile.batch_size' must not be negative")
+	}
+
+	switch c.BalanceHistory.Bucket {
+	case "", BucketDay, BucketHour:
+	default:
+		return fmt.Errorf("unsupported 'balance_history.bucket': %s", c.BalanceHistory.Bucket)
+	}
+
+	if _, err := time.LoadLocation(c.BalanceHistory.TimeZone); err != nil {
+		return fmt.Errorf("invalid 'balance_history.time_zone': %v", err)
+	}
+
+	if c.RichList.Interval < 0 {
+		return errors.New("value of 'rich_list.interval' must not be negative")
+	}
+
+	if c.RichList.Top < 0 || c.RichList.Top > MaxRichListTop {
+		return fmt.Errorf("value of 'rich_list.top' must be between 1 and %d", MaxRichListTop)
+	}
+
+	switch c.Driver {
+	case "", DriverMySQL, DriverPostgres:
+	case DriverSQLite:
+		if c.DbPath == "" {
+			return errors.New("'db_path' must be set for sqlite")
+		}
+	default:
+		return fmt.Errorf("unsupported 'db_driver': %s", c.Driver)
+	}
+
+	for _, rpc := range c.RPCs {
 		if strings.HasPrefix(rpc, "http") {
 			u, err := url.Parse(rpc)
 			if err != nil {
-				return err
+				return fmt.Errorf("invalid url in 'rpc_url': %v", err)
 			}
 			rpc = u.Host
 		}
 
 		_, _, err := net.SplitHostPort(rpc)
 		if err != nil {
-			return err
+			return fmt.Errorf("invalid url in 'rpc_url': %v", err)
 		}
 	}
 
 	return nil
 }
 
+// GetDbDriver returns the database driver.
+func GetDbDriver() string {
+	c := get()
+	if c.Driver == "" {
+		return DriverMySQL
+	}
+
+	return c.Driver
+}
+
+// GetDbPath returns the sqlite database file.
+func GetDbPath() string {
+	return get().DbPath
+}
+
 // GetDbConnStr returns mysql connection string.
 func GetDbConnStr() string {
+	c := get()
 	str := fmt.Sprintf(
 		"%s:%s@tcp(%s:%s)/%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Hostname,
-		cfg.Port,
-		cfg.Database,
+		c.User,
+		c.Password,
+		c.Hostname,
+		c.Port,
+		c.Database,
 	)
 
 	params := []string{
@@ -101,17 +384,137 @@ func GetDbConnStr() string {
 	return str
 }
 
+// GetPostgresConnStr returns postgresql connection string.
+func GetPostgresConnStr() string {
+	c := get()
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Hostname, c.Port),
+		Path:     c.Database,
+		RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+	}
+
+	return u.String()
+}
+
 // GetLabel returns custome label as console output prefix.
 func GetLabel() string {
-	return cfg.Label
+	return get().Label
 }
 
 // GetRPCs returns all rpc urls from config.
 func GetRPCs() []string {
-	return cfg.RPCs
+	return get().RPCs
+}
+
+// GetRPCBatchSize returns the number of requests in a single rpc batch call.
+func GetRPCBatchSize() int {
+	c := get()
+	if c.RPCBatchSize == 0 {
+		return 20
+	}
+
+	return c.RPCBatchSize
+}
+
+// GetRPCDiscovery returns config of rpc server discovery with defaults filled.
+func GetRPCDiscovery() Discovery {
+	d := get().Discovery
+	if d.MaxServers == 0 {
+		d.MaxServers = 20
+	}
+	if len(d.Ports) == 0 {
+		d.Ports = []int{10332, 20332}
+	}
+
+	return d
+}
+
+// ParseNets parses IPs or CIDRs, an IP is a network of itself.
+func ParseNets(addrs []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+
+	for _, addr := range addrs {
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP: %s", addr)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
 }
 
 // GetGoroutines returns the number of working goroutines.
 func GetGoroutines() int {
-	return cfg.Workers
+	return get().Workers
+}
+
+// GetAPIAddr returns listen address of the http query api.
+func GetAPIAddr() string {
+	return get().APIAddr
+}
+
+// GetAdminToken returns the token of admin endpoints, which are disabled if empty.
+func GetAdminToken() string {
+	return get().AdminToken
+}
+
+// GetVerify returns config of the periodic balance verification.
+func GetVerify() Verify {
+	return get().Verify
+}
+
+// GetBalanceHistory returns config of the balance history with defaults filled.
+func GetBalanceHistory() BalanceHistory {
+	b := get().BalanceHistory
+	if b.Bucket == "" {
+		b.Bucket = BucketDay
+	}
+	if b.TimeZone == "" {
+		b.TimeZone = "UTC"
+	}
+
+	return b
+}
+
+// GetRichList returns config of the periodic rich list computation with defaults filled.
+func GetRichList() RichList {
+	r := get().RichList
+	if r.Top == 0 {
+		r.Top = 100
+	}
+
+	return r
+}
+
+// GetNep5Reconcile returns config of the periodic nep5 reconciliation with defaults filled.
+func GetNep5Reconcile() Nep5Reconcile {
+	r := get().Nep5Reconcile
+	if r.BatchSize == 0 {
+		r.BatchSize = 100
+	}
+
+	return r
 }
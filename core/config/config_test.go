@@ -2,10 +2,171 @@ package config
 
 import (
 	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
 	Load()
 	fmt.Printf("%+v", cfg)
 }
+
+func TestReload(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	f, err := ioutil.TempFile("", "config*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	write := func(content string) {
+		if err := ioutil.WriteFile(f.Name(), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := viper.ReadInConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	viper.SetConfigFile(f.Name())
+	write(`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 2, "label": "mainnet"}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := 0
+	OnReload(func() { reloaded++ })
+
+	write(`{"rpc_url": ["http://127.0.0.1:10332", "http://127.0.0.1:20332"], "workers": 5, "label": "testnet",
+		"balance_history": {"bucket": "hour"}}`)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if GetGoroutines() != 5 || GetLabel() != "testnet" || len(GetRPCs()) != 2 || reloaded != 1 {
+		t.Errorf("reloaded config = %+v, hooks called %d times", get(), reloaded)
+	}
+	if b := GetBalanceHistory(); b.Bucket != BucketDay {
+		t.Errorf("balance_history = %+v after reload, want kept", b)
+	}
+
+	write(`{"rpc_url": [], "workers": 0}`)
+	if err := Reload(); err == nil {
+		t.Error("invalid config reloaded")
+	}
+	if GetGoroutines() != 5 || reloaded != 1 {
+		t.Errorf("config = %+v after invalid reload, want kept", get())
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "config*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	if err := ioutil.WriteFile(f.Name(), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func setEnv(t *testing.T, key, value string) {
+	os.Setenv(key, value)
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfig(t, `{
+		"user": "root",
+		"password": "root",
+		"database": "blockchain_neo",
+		"rpc_url": ["http://127.0.0.1:10332"],
+		"workers": 2,
+		"verify": {"interval": "24h"},
+		"balance_history": {"bucket": "hour"},
+		"rich_list": {"interval": "1h"},
+		"profiles": {
+			"testnet": {
+				"database": "blockchain_neo_testnet",
+				"rpc_url": ["http://127.0.0.1:20332"],
+				"rpc_discovery": {"ports": [20332]}
+			}
+		}
+	}`)
+	password := writeConfig(t, "secret\n")
+
+	setEnv(t, "NEO_EXPLORER_WORKERS", "5")
+	setEnv(t, "NEO_EXPLORER_DB_PASSWORD_FILE", password)
+	setEnv(t, "NEO_EXPLORER_RPC_DISCOVERY_ENABLED", "true")
+	setEnv(t, "NEO_EXPLORER_VERIFY_REPAIR", "true")
+
+	if err := LoadFile(path, "testnet"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := get()
+	if c.Database != "blockchain_neo_testnet" || c.User != "root" || c.Label != "testnet" {
+		t.Errorf("profile not applied: %+v", c)
+	}
+	if len(c.RPCs) != 1 || c.RPCs[0] != "http://127.0.0.1:20332" {
+		t.Errorf("rpc_url = %v, want the one of profile", c.RPCs)
+	}
+	if c.Workers != 5 || c.Password != "secret" {
+		t.Errorf("workers = %d, password = %q, want them from environment", c.Workers, c.Password)
+	}
+	if d := GetRPCDiscovery(); !d.Enabled || len(d.Ports) != 1 || d.Ports[0] != 20332 {
+		t.Errorf("rpc_discovery = %+v", d)
+	}
+	if v := GetVerify(); v.Interval != 24*time.Hour || !v.Repair {
+		t.Errorf("verify = %+v", v)
+	}
+	if b := GetBalanceHistory(); b.Bucket != BucketHour || b.TimeZone != "UTC" {
+		t.Errorf("balance_history = %+v, want hourly buckets in UTC", b)
+	}
+	if r := GetRichList(); r.Interval != time.Hour || r.Top != 100 {
+		t.Errorf("rich_list = %+v, want hourly top 100", r)
+	}
+
+	setEnv(t, "NEO_EXPLORER_RPC_URL", "http://127.0.0.1:10332,http://127.0.0.1:30332")
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(GetRPCs()) != 2 {
+		t.Errorf("rpc_url = %v, want the ones from environment", GetRPCs())
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		profile string
+		field   string
+	}{
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "wokers": 2}`, "", "wokers"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": "many"}`, "", "workers"},
+		{`{"rpc_url": ["127.0.0.1"], "workers": 1}`, "", "rpc_url"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "db_driver": "oracle"}`, "", "db_driver"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "verify": {"interval": "-1h"}}`, "", "verify.interval"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "balance_history": {"bucket": "week"}}`, "", "balance_history.bucket"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "balance_history": {"time_zone": "Mars/Olympus"}}`, "", "balance_history.time_zone"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "rich_list": {"top": 1001}}`, "", "rich_list.top"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1}`, "privnet", "privnet"},
+		{`{"rpc_url": ["http://127.0.0.1:10332"], "workers": 1, "password_file": "/nonexistent"}`, "", "password_file"},
+	} {
+		viper.Reset()
+		err := LoadFile(writeConfig(t, test.content), test.profile)
+		if err == nil || !strings.Contains(err.Error(), test.field) {
+			t.Errorf("LoadFile(%s) = %v, want error of %s", test.content, err, test.field)
+		}
+	}
+	viper.Reset()
+}
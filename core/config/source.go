@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// envPrefix is the prefix of environment variables overriding config fields.
+const envPrefix = "NEO_EXPLORER"
+
+// dbEnvNames are names of environment variables of database fields without envPrefix.
+var dbEnvNames = map[string]string{
+	"user":          "DB_USER",
+	"password":      "DB_PASSWORD",
+	"password_file": "DB_PASSWORD_FILE",
+	"hostname":      "DB_HOST",
+	"port":          "DB_PORT",
+	"database":      "DB_NAME",
+	"sslmode":       "DB_SSLMODE",
+}
+
+// bindEnv binds every config field to its environment variable.
+func bindEnv() {
+	for _, key := range configKeys(reflect.TypeOf(config{}), "") {
+		viper.BindEnv(key, envName(key))
+	}
+}
+
+// configKeys returns keys of fields of t, keys of nested fields are joined by '.'.
+// Maps are skipped.
+func configKeys(t reflect.Type, prefix string) []string {
+	keys := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get("mapstructure")
+
+		switch f.Type.Kind() {
+		case reflect.Map:
+		case reflect.Struct:
+			keys = append(keys, configKeys(f.Type, prefix+key+".")...)
+		default:
+			keys = append(keys, prefix+key)
+		}
+	}
+
+	return keys
+}
+
+// envName returns the environment variable of the config key, which is the key in upper case
+// with '.' replaced by '_' and prefixed by NEO_EXPLORER_, e.g. NEO_EXPLORER_RPC_DISCOVERY_ENABLED.
+// Database fields are prefixed by NEO_EXPLORER_DB_, e.g. NEO_EXPLORER_DB_PASSWORD.
+// Lists are separated by ',', e.g. NEO_EXPLORER_RPC_URL=http://127.0.0.1:10332,http://127.0.0.1:20332.
+func envName(key string) string {
+	if name, ok := dbEnvNames[key]; ok {
+		return envPrefix + "_" + name
+	}
+
+	return envPrefix + "_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// read decodes and checks the config with the selected profile applied and secret files read.
+func read() (config, error) {
+	mu.RLock()
+	name := profile
+	mu.RUnlock()
+
+	if name != "" {
+		if err := applyProfile(name); err != nil {
+			return config{}, err
+		}
+	}
+
+	c := config{}
+	if err := viper.UnmarshalExact(&c); err != nil {
+		return config{}, fmt.Errorf("invalid config: %v", err)
+	}
+
+	if c.Label == "" {
+		c.Label = name
+	}
+	if err := readSecret(&c.Password, "password_file", c.PasswordFile); err != nil {
+		return config{}, err
+	}
+	if err := readSecret(&c.AdminToken, "admin_token_file", c.AdminTokenFile); err != nil {
+		return config{}, err
+	}
+
+	if err := c.check(); err != nil {
+		return config{}, err
+	}
+
+	return c, nil
+}
+
+// applyProfile merges fields of the named profile into the config,
+// environment variables still take precedence.
+func applyProfile(name string) error {
+	p, ok := viper.GetStringMap("profiles")[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("profile '%s' not found in 'profiles'", name)
+	}
+
+	fields, ok := p.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("value of 'profiles.%s' must be an object", name)
+	}
+
+	return viper.MergeConfigMap(fields)
+}
+
+// readSecret sets value to the content of the file at path if path is not empty.
+// Trailing newlines are removed.
+func readSecret(value *string, key string, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %v", key, err)
+	}
+	*value = strings.TrimRight(string(b), "\r\n")
+
+	return nil
+}
@@ -0,0 +1,294 @@
+// Package metrics exposes gauges, counters and histograms
+// in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the default histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+	// fn computes value of the gauge when scraped.
+	fn func() float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	mu     sync.Mutex
+	labels []string
+	value  float64
+	// Histogram only.
+	counts []uint64
+	count  uint64
+}
+
+func register(f *family) *family {
+	f.series = make(map[string]*series)
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, existing := range registry.families {
+		if existing.name == f.name {
+			panic(fmt.Errorf("metric %s registered twice", f.name))
+		}
+	}
+	registry.families = append(registry.families, f)
+
+	return f
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Errorf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.buckets != nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// Counter is a value which only goes up.
+type Counter struct{ s *series }
+
+// Inc adds 1 to the counter.
+func (c Counter) Inc() { c.Add(1) }
+
+// Add adds delta, which must not be negative, to the counter.
+func (c Counter) Add(delta float64) {
+	c.s.mu.Lock()
+	c.s.value += delta
+	c.s.mu.Unlock()
+}
+
+// CounterVec is a set of counters partitioned by labels.
+type CounterVec struct{ f *family }
+
+// NewCounterVec registers a counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) CounterVec {
+	return CounterVec{register(&family{name: name, help: help, typ: "counter", labels: labels})}
+}
+
+// With returns the counter of the given label values.
+func (v CounterVec) With(values ...string) Counter { return Counter{v.f.with(values)} }
+
+// Gauge is a value which can go up and down.
+type Gauge struct{ s *series }
+
+// Set sets the gauge to value.
+func (g Gauge) Set(value float64) {
+	g.s.mu.Lock()
+	g.s.value = value
+	g.s.mu.Unlock()
+}
+
+// Add adds delta to the gauge.
+func (g Gauge) Add(delta float64) {
+	g.s.mu.Lock()
+	g.s.value += delta
+	g.s.mu.Unlock()
+}
+
+// GaugeVec is a set of gauges partitioned by labels.
+type GaugeVec struct{ f *family }
+
+// NewGaugeVec registers a gauge with the given label names.
+func NewGaugeVec(name, help string, labels ...string) GaugeVec {
+	return GaugeVec{register(&family{name: name, help: help, typ: "gauge", labels: labels})}
+}
+
+// With returns the gauge of the given label values.
+func (v GaugeVec) With(values ...string) Gauge { return Gauge{v.f.with(values)} }
+
+// NewGauge registers a gauge without labels.
+func NewGauge(name, help string) Gauge {
+	return NewGaugeVec(name, help).With()
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn when scraped.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&family{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// Histogram counts observed values in buckets.
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+// Observe adds a single observation.
+func (h Histogram) Observe(value float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.s.counts[i]++
+		}
+	}
+	h.s.count++
+	h.s.value += value
+}
+
+// ObserveSince observes seconds elapsed since start.
+func (h Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// HistogramVec is a set of histograms partitioned by labels.
+type HistogramVec struct{ f *family }
+
+// NewHistogramVec registers a histogram with the given buckets and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return HistogramVec{register(&family{name: name, help: help, typ: "histogram", labels: labels, buckets: buckets})}
+}
+
+// With returns the histogram of the given label values.
+func (v HistogramVec) With(values ...string) Histogram {
+	return Histogram{s: v.f.with(values), buckets: v.f.buckets}
+}
+
+// NewHistogram registers a histogram without labels.
+func NewHistogram(name, help string, buckets []float64) Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
+
+// WriteTo writes all registered metrics to w in the Prometheus text format.
+func WriteTo(w io.Writer) error {
+	registry.mu.Lock()
+	families := append([]*family(nil), registry.families...)
+	registry.mu.Unlock()
+
+	b := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(b)
+	}
+
+	return b.Flush()
+}
+
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatValue(f.fn()))
+		return
+	}
+
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labels, "\xff") < strings.Join(all[j].labels, "\xff")
+	})
+
+	for _, s := range all {
+		s.mu.Lock()
+		labels := formatLabels(f.labels, s.labels)
+
+		if f.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels, formatValue(s.value))
+			s.mu.Unlock()
+			continue
+		}
+
+		names := append(append([]string(nil), f.labels...), "le")
+		values := append(append([]string(nil), s.labels...), "")
+		for i, upper := range f.buckets {
+			values[len(values)-1] = formatValue(upper)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(names, values), s.counts[i])
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, formatLabels(names, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels, formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels, s.count)
+		s.mu.Unlock()
+	}
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escape(values[i], true))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quoted {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+
+	return s
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	rows := NewCounterVec("test_rows_total", "Rows written.", "table")
+	rows.With("tx").Add(3)
+	rows.With("block").Inc()
+
+	NewGauge("test_height", "Stored height.").Set(42)
+	NewGaugeFunc("test_buffer", "Buffered blocks.", func() float64 { return 7 })
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "server")
+	latency.With(`http://a"b`).Observe(0.05)
+	latency.With(`http://a"b`).Observe(0.5)
+
+	var b bytes.Buffer
+	if err := WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"# HELP test_rows_total Rows written.",
+		"# TYPE test_rows_total counter",
+		`test_rows_total{table="block"} 1`,
+		`test_rows_total{table="tx"} 3`,
+		"# HELP test_height Stored height.",
+		"# TYPE test_height gauge",
+		"test_height 42",
+		"# HELP test_buffer Buffered blocks.",
+		"# TYPE test_buffer gauge",
+		"test_buffer 7",
+		"# HELP test_latency_seconds Latency.",
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{server="http://a\"b",le="0.1"} 1`,
+		`test_latency_seconds_bucket{server="http://a\"b",le="1"} 2`,
+		`test_latency_seconds_bucket{server="http://a\"b",le="+Inf"} 2`,
+		`test_latency_seconds_sum{server="http://a\"b"} 0.55`,
+		`test_latency_seconds_count{server="http://a\"b"} 2`,
+		"",
+	}, "\n")
+
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -3,8 +3,12 @@ module neo_explorer
 go 1.14
 
 require (
+	github.com/PuerkitoBio/goquery v1.5.1 // indirect
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-errors/errors v1.0.2
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/spf13/viper v1.6.3
 	github.com/valyala/fasthttp v1.12.0
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
@@ -1,21 +1,81 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"neo_explorer/core/config"
 	"neo_explorer/core/log"
+	"neo_explorer/neo/api"
 	"neo_explorer/neo/db"
 	"neo_explorer/neo/rpc"
 	"neo_explorer/neo/tasks"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	configFile = flag.String("config", "", "path of the config file, ./config.json by default")
+	profile    = flag.String("profile", "", "name of the profile in the config file to use, e.g. testnet")
 )
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+	flag.Parse()
+
 	log.Init()
-	config.Load()
-	db.Init()
+	if err := config.LoadFile(*configFile, *profile); err != nil {
+		log.Error.Fatalf("Failed to load config: %v\n", err)
+	}
+	log.UpdatePrefix(config.GetLabel())
+	watchConfig()
+	store := db.NewStore()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handleSignals(cancel)
+
+	go rpc.TraceBestHeight(ctx)
+
+	api.Run(ctx, store)
+
+	// Blocks until all tasks stopped.
+	tasks.Run(ctx, store)
+
+	log.Println("All tasks stopped, bye")
+}
+
+// watchConfig applies changes of config file at runtime.
+func watchConfig() {
+	workers := config.GetGoroutines()
+
+	config.OnReload(func() {
+		log.UpdatePrefix(config.GetLabel())
+
+		if n := config.GetGoroutines(); n != workers {
+			workers = n
+			if err := tasks.SetWorkers(n); err != nil {
+				log.Error.Println(err)
+			}
+		}
+	})
+	config.Watch()
+}
 
-	go rpc.TraceBestHeight()
+// handleSignals cancels tasks on the first SIGINT or SIGTERM,
+// and quits immediately on the second one.
+func handleSignals(cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-	tasks.Run()
+	go func() {
+		sig := <-sigs
+		log.Printf("Received %s, waiting for tasks to finish their work\n", sig)
+		cancel()
 
-	select {}
+		sig = <-sigs
+		log.Printf("Received %s again, force quit\n", sig)
+		os.Exit(1)
+	}()
 }
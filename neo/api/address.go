@@ -0,0 +1,164 @@
+package api
+
+import (
+	"neo_explorer/neo/db"
+	"net/http"
+	"strconv"
+)
+
+// handleAddress serves:
+//
+//	/address/{addr}/utxo
+//	/address/{addr}/balances
+//	/address/{addr}/history?asset=
+//	/address/{addr}/gas
+//	/address/{addr}/balance_history?asset=&from=&to=
+func (srv *server) handleAddress(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/address/")
+	if len(params) != 2 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	addr, ok := resolveAddress(params[0])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid address or script hash: %s", params[0])
+		return
+	}
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	addressId, err := srv.store.FindAddrID(addr)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if addressId == 0 {
+		writeError(w, http.StatusNotFound, "address %s not found", addr)
+		return
+	}
+
+	switch params[1] {
+	case "utxo":
+		utxos, total, err := srv.store.GetAddrUTXOs(addressId, p.Size, p.offset())
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		p.Total = total
+		writeData(w, utxos, p)
+	case "balances":
+		balances, total, err := srv.store.GetAddrBalances(addressId, p.Size, p.offset())
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		p.Total = total
+		writeData(w, balances, p)
+	case "history":
+		srv.handleAddrHistory(w, r, addr, addressId, p)
+	case "gas":
+		gas, err := srv.store.GetAddrGas(addressId)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		writeData(w, gas, nil)
+	case "balance_history":
+		srv.handleAddrBalanceHistory(w, r, addressId, p)
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+}
+
+// handleAddrHistory returns asset_tx records of utxo assets,
+// or nep5_tx records if 'asset' is a nep5 contract hash.
+func (srv *server) handleAddrHistory(w http.ResponseWriter, r *http.Request, addr string, addressId uint, p *paging) {
+	asset := r.URL.Query().Get("asset")
+	assetId := uint(0)
+	isNep5 := false
+
+	if asset != "" {
+		var err error
+		assetId, isNep5, err = srv.store.ResolveAsset(asset)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if assetId == 0 {
+			writeError(w, http.StatusNotFound, "asset %s not found", asset)
+			return
+		}
+	}
+
+	var records []db.HistoryRecord
+	var total uint64
+	var err error
+
+	if isNep5 {
+		records, total, err = srv.store.GetAddrNep5History(addr, assetId, p.Size, p.offset())
+	} else {
+		records, total, err = srv.store.GetAddrAssetHistory(addressId, assetId, p.Size, p.offset())
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = total
+	writeData(w, records, p)
+}
+
+// handleAddrBalanceHistory returns balances of the address for 'asset' in buckets starting
+// between unix times 'from' and 'to', both are optional.
+func (srv *server) handleAddrBalanceHistory(w http.ResponseWriter, r *http.Request, addressId uint, p *paging) {
+	query := r.URL.Query()
+
+	asset := query.Get("asset")
+	if asset == "" {
+		writeError(w, http.StatusBadRequest, "missing asset")
+		return
+	}
+
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || t < 0 {
+			writeError(w, http.StatusBadRequest, "invalid %s: %s", name, value)
+			return
+		}
+		bounds[i] = t
+	}
+
+	assetId, _, err := srv.store.ResolveAsset(asset)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if assetId == 0 {
+		writeError(w, http.StatusNotFound, "asset %s not found", asset)
+		return
+	}
+
+	records, total, err := srv.store.GetAddrBalanceHistory(addressId, assetId, bounds[0], bounds[1], p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = total
+	writeData(w, records, p)
+}
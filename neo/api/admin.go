@@ -0,0 +1,128 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"neo_explorer/core/config"
+	"neo_explorer/neo/rpc"
+	"neo_explorer/neo/tasks"
+	"net/http"
+	"strings"
+)
+
+// serverRequest is the request body of admin endpoints of rpc servers.
+type serverRequest struct {
+	URL string `json:"url"`
+}
+
+// workersInfo is the request and response body of /admin/workers.
+type workersInfo struct {
+	Running int `json:"running"`
+	Workers int `json:"workers"`
+}
+
+// requireAdmin checks the admin token of the request.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := config.GetAdminToken()
+	if token == "" {
+		writeError(w, http.StatusForbidden, "admin endpoints are disabled, set 'admin_token' to enable them")
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+
+	return true
+}
+
+// handleAdminServers serves /admin/servers, GET lists rpc servers, POST {"url": ...} adds a rpc server
+// and DELETE ?url=... removes one. POST {"url": ...} to /admin/servers/disable or /admin/servers/enable
+// stops or resumes sending requests to the server.
+func handleAdminServers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/admin/servers")
+
+	switch {
+	case len(params) == 0 && r.Method == http.MethodGet:
+		writeData(w, rpc.ServerStatuses(), nil)
+	case len(params) == 0 && r.Method == http.MethodPost:
+		req, ok := readServerRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := rpc.AddServer(r.Context(), req.URL); err != nil {
+			writeError(w, http.StatusBadRequest, "failed to add rpc server %s: %v", req.URL, err)
+			return
+		}
+		writeData(w, rpc.ServerStatuses(), nil)
+	case len(params) == 0 && r.Method == http.MethodDelete:
+		if err := rpc.RemoveServer(r.URL.Query().Get("url")); err != nil {
+			writeError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeData(w, rpc.ServerStatuses(), nil)
+	case len(params) == 1 && (params[0] == "disable" || params[0] == "enable"):
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+			return
+		}
+		req, ok := readServerRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := rpc.DisableServer(req.URL, params[0] == "disable"); err != nil {
+			writeError(w, http.StatusNotFound, "%v", err)
+			return
+		}
+		writeData(w, rpc.ServerStatuses(), nil)
+	case len(params) == 0:
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+}
+
+func readServerRequest(w http.ResponseWriter, r *http.Request) (*serverRequest, bool) {
+	req := &serverRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.URL == "" {
+		writeError(w, http.StatusBadRequest, `request body must be {"url": "<rpc url>"}`)
+		return nil, false
+	}
+
+	return req, true
+}
+
+// handleAdminWorkers serves /admin/workers, GET returns the number of workers fetching blocks
+// and PUT {"workers": n} changes it.
+func handleAdminWorkers(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		req := workersInfo{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, `request body must be {"workers": <number>}`)
+			return
+		}
+		if err := tasks.SetWorkers(req.Workers); err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+
+	running, target := tasks.Workers()
+	writeData(w, workersInfo{Running: running, Workers: target}, nil)
+}
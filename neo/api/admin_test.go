@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setAdminToken(t *testing.T, token string) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	viper.Set("rpc_url", []string{"http://127.0.0.1:10332"})
+	viper.Set("workers", 1)
+	viper.Set("admin_token", token)
+	if err := config.Reload(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	setAdminToken(t, "")
+	w := httptest.NewRecorder()
+	(&server{}).newRouter().ServeHTTP(w, httptest.NewRequest("GET", "/admin/workers", nil))
+	if w.Code != 403 {
+		t.Errorf("status = %d without admin token configured, want 403", w.Code)
+	}
+
+	setAdminToken(t, "secret")
+	for _, auth := range []string{"", "secret", "Bearer wrong"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/admin/workers", nil)
+		r.Header.Set("Authorization", auth)
+		(&server{}).newRouter().ServeHTTP(w, r)
+		if w.Code != 401 {
+			t.Errorf("status = %d with Authorization %q, want 401", w.Code, auth)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/admin/workers", strings.NewReader(`{"workers": 3}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	(&server{}).newRouter().ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("status = %d with admin token, want 200", w.Code)
+	}
+
+	resp := struct {
+		Data workersInfo `json:"data"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Workers != 3 {
+		t.Errorf("workers = %+v, want 3", resp.Data)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/db"
+	"net/http"
+	"strings"
+)
+
+// handleAsset serves /asset/{id}.
+func (srv *server) handleAsset(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/asset/")
+	if len(params) != 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	assetID, ok := normalizeHash(params[0], 32)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid asset id: %s", params[0])
+		return
+	}
+
+	detail, err := srv.store.GetAssetDetail(assetID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if detail == nil {
+		writeError(w, http.StatusNotFound, "asset %s not found", assetID)
+		return
+	}
+
+	writeData(w, detail, nil)
+}
+
+// nep5Info is the response of /nep5/{contract}.
+type nep5Info struct {
+	*db.Nep5Detail
+	Transfers []db.Nep5Transfer `json:"transfer_list"`
+}
+
+// handleNep5 serves /nep5/{contract} with paged transfers.
+func (srv *server) handleNep5(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/nep5/")
+	if len(params) != 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	contract, ok := normalizeHash(params[0], 20)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid contract hash: %s", params[0])
+		return
+	}
+	contract = strings.TrimPrefix(contract, "0x")
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	assetId, ok := cache.LookupAssetId(contract)
+	if !ok {
+		writeError(w, http.StatusNotFound, "nep5 %s not found", contract)
+		return
+	}
+
+	detail, err := srv.store.GetNep5Detail(assetId)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if detail == nil {
+		writeError(w, http.StatusNotFound, "nep5 %s not found", contract)
+		return
+	}
+
+	transfers, total, err := srv.store.GetNep5Transfers(assetId, p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = total
+	writeData(w, nep5Info{Nep5Detail: detail, Transfers: transfers}, p)
+}
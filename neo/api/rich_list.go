@@ -0,0 +1,61 @@
+package api
+
+import (
+	"neo_explorer/neo/db"
+	"net/http"
+)
+
+// richListInfo is the response of /rich_list/{asset}.
+type richListInfo struct {
+	*db.AssetDistribution
+	Holders []db.RichListEntry `json:"top_holders"`
+}
+
+// handleRichList serves /rich_list/{asset} with the distribution and paged top holders of the asset.
+func (srv *server) handleRichList(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/rich_list/")
+	if len(params) != 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	assetId, ok := srv.resolveAssetId(w, params[0])
+	if !ok {
+		return
+	}
+
+	d, err := srv.store.GetAssetDistribution(assetId)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if d == nil {
+		writeError(w, http.StatusNotFound, "rich list of asset %s is not computed yet, it is computed every 'rich_list.interval'", params[0])
+		return
+	}
+
+	holders, err := srv.store.GetRichList(assetId, p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	size, err := srv.store.GetRichListSize(assetId)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = size
+	writeData(w, richListInfo{AssetDistribution: d, Holders: holders}, p)
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"neo_explorer/core/metrics"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/db"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxOffset bounds offsets of pages, which fit in int of every platform and database.
+	maxOffset = math.MaxInt32
+)
+
+// errorBody is the response body of all failed requests.
+type errorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// dataBody is the response body of all succeeded requests.
+type dataBody struct {
+	Data   interface{} `json:"data"`
+	Paging *paging     `json:"paging,omitempty"`
+}
+
+type paging struct {
+	Page  int    `json:"page"`
+	Size  int    `json:"size"`
+	Total uint64 `json:"total"`
+}
+
+// server answers api requests with data of store.
+type server struct {
+	store db.APIStore
+}
+
+// Run starts the http query api of store if 'api_addr' is set in config,
+// the server is shut down when ctx is done.
+func Run(ctx context.Context, store db.APIStore) {
+	addr := config.GetAPIAddr()
+	if addr == "" {
+		return
+	}
+
+	srv := &server{store: store}
+	httpServer := &http.Server{
+		Addr:         addr,
+		Handler:      srv.newRouter(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Query api listening on %s\n", addr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error.Println(err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Error.Println(err)
+		}
+	}()
+}
+
+func (srv *server) newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/address/", srv.handleAddress)
+	mux.HandleFunc("/tx/", srv.handleTx)
+	mux.HandleFunc("/block/", srv.handleBlock)
+	mux.HandleFunc("/asset/", srv.handleAsset)
+	mux.HandleFunc("/nep5/", srv.handleNep5)
+	mux.HandleFunc("/snapshot/", srv.handleSnapshot)
+	mux.HandleFunc("/rich_list/", srv.handleRichList)
+	mux.HandleFunc("/stats/daily", srv.handleDailyStats)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/admin/servers", handleAdminServers)
+	mux.HandleFunc("/admin/servers/", handleAdminServers)
+	mux.HandleFunc("/admin/workers", handleAdminWorkers)
+	mux.HandleFunc("/admin/snapshots", srv.handleAdminSnapshots)
+	mux.HandleFunc("/admin/watches", srv.handleAdminWatches)
+	mux.HandleFunc("/admin/watches/", srv.handleAdminWatches)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	})
+
+	return mux
+}
+
+// pathParams splits the request path after the given prefix.
+func pathParams(r *http.Request, prefix string) []string {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// getPaging reads 'page'(starts from 1) and 'size' from query string.
+func getPaging(r *http.Request) (*paging, error) {
+	p := &paging{Page: 1, Size: defaultPageSize}
+	q := r.URL.Query()
+
+	if v := q.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("invalid page: %s", v)
+		}
+		p.Page = page
+	}
+
+	if v := q.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 || size > maxPageSize {
+			return nil, fmt.Errorf("invalid size: %s, must be between 1 and %d", v, maxPageSize)
+		}
+		p.Size = size
+	}
+
+	if p.Page-1 > maxOffset/p.Size {
+		return nil, fmt.Errorf("invalid page: %d, must be at most %d with size %d", p.Page, maxOffset/p.Size+1, p.Size)
+	}
+
+	return p, nil
+}
+
+func (p *paging) offset() int {
+	return (p.Page - 1) * p.Size
+}
+
+// resolveAddress accepts a base58 address or a big-endian script hash(with or without '0x'),
+// and returns its base58 address.
+func resolveAddress(s string) (string, bool) {
+	if util.AddressValid(s) {
+		return s, true
+	}
+
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	if len(s) != 40 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+
+	addr := util.GetAddressFromScriptHash(util.GetScriptHashFromAssetID(s))
+	return addr, util.AddressValid(addr)
+}
+
+// resolveAssetId returns pk of the asset, or writes an error response if it is not found.
+func (srv *server) resolveAssetId(w http.ResponseWriter, asset string) (uint, bool) {
+	assetId, _, err := srv.store.ResolveAsset(asset)
+	if err != nil {
+		writeDBError(w, err)
+		return 0, false
+	}
+	if assetId == 0 {
+		writeError(w, http.StatusNotFound, "asset %s not found", asset)
+		return 0, false
+	}
+
+	return assetId, true
+}
+
+// normalizeHash returns lower-cased 0x-prefixed hash if s is a hex string of the given byte size.
+func normalizeHash(s string, size int) (string, bool) {
+	s = strings.TrimPrefix(strings.ToLower(s), "0x")
+	if len(s) != size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+
+	return "0x" + s, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error.Println(err)
+	}
+}
+
+func writeData(w http.ResponseWriter, data interface{}, p *paging) {
+	writeJSON(w, http.StatusOK, dataBody{Data: data, Paging: p})
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	body := errorBody{}
+	body.Error.Code = status
+	body.Error.Message = fmt.Sprintf(format, args...)
+	writeJSON(w, status, body)
+}
+
+func writeDBError(w http.ResponseWriter, err error) {
+	log.Error.Println(err)
+	writeError(w, http.StatusInternalServerError, "database error")
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return false
+	}
+
+	return true
+}
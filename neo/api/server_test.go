@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/db"
+	"net/http/httptest"
+	"testing"
+)
+
+// blockStore serves a single block without a real database.
+type blockStore struct {
+	db.APIStore
+}
+
+func (blockStore) GetBlockDetail(index int, hash string) (*db.BlockDetail, error) {
+	if index != 10 {
+		return nil, nil
+	}
+	return &db.BlockDetail{Index: 10, Hash: "0xabc"}, nil
+}
+
+func TestResolveAddress(t *testing.T) {
+	const addr = "AKvZWVG75aHUiESRE9v6YkkJmjxTYFnRQb"
+
+	got, ok := resolveAddress(addr)
+	if !ok || got != addr {
+		t.Fatalf("resolveAddress(%s) = %s, %v", addr, got, ok)
+	}
+
+	scriptHash := "0x" + util.GetAssetIDFromScriptHash(util.GetScriptHashFromAddress(addr))
+	got, ok = resolveAddress(scriptHash)
+	if !ok || got != addr {
+		t.Fatalf("resolveAddress(%s) = %s, %v, want %s", scriptHash, got, ok, addr)
+	}
+
+	for _, invalid := range []string{"", "AKvZWVG75aHUiESRE9v6YkkJmjxTYFnRQc", "0x1234", hex.EncodeToString(make([]byte, 19))} {
+		if _, ok := resolveAddress(invalid); ok {
+			t.Errorf("resolveAddress(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestGetPaging(t *testing.T) {
+	p, err := getPaging(httptest.NewRequest("GET", "/address/x/utxo", nil))
+	if err != nil || p.Page != 1 || p.Size != defaultPageSize || p.offset() != 0 {
+		t.Fatalf("default paging = %+v, %v", p, err)
+	}
+
+	p, err = getPaging(httptest.NewRequest("GET", "/address/x/utxo?page=3&size=10", nil))
+	if err != nil || p.offset() != 20 {
+		t.Fatalf("paging = %+v, %v", p, err)
+	}
+
+	p, err = getPaging(httptest.NewRequest("GET", "/address/x/utxo?page=107374183", nil))
+	if err != nil || p.offset() != 2147483640 {
+		t.Fatalf("paging of the last page = %+v, %v", p, err)
+	}
+
+	for _, q := range []string{"page=0", "page=a", "size=0", "size=101", "page=9223372036854775807&size=100", "page=107374184"} {
+		if _, err := getPaging(httptest.NewRequest("GET", "/address/x/utxo?"+q, nil)); err == nil {
+			t.Errorf("getPaging(%s) should fail", q)
+		}
+	}
+}
+
+func TestUnknownEndpoint(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&server{}).newRouter().ServeHTTP(w, httptest.NewRequest("GET", "/address/AKvZWVG75aHUiESRE9v6YkkJmjxTYFnRQb/unknown/x", nil))
+
+	if w.Code != 404 {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestBlockFromStore(t *testing.T) {
+	router := (&server{store: blockStore{}}).newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/block/10", nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var resp struct {
+		Data db.BlockDetail `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Data.Hash != "0xabc" {
+		t.Errorf("block = %+v, %v, want hash 0xabc", resp.Data, err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/block/11", nil))
+	if w.Code != 404 {
+		t.Errorf("status = %d of a missing block, want 404", w.Code)
+	}
+}
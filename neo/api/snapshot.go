@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// snapshotRequest is the request body of /admin/snapshots.
+type snapshotRequest struct {
+	Asset  string `json:"asset"`
+	Height *uint  `json:"height"`
+}
+
+// snapshotInfo is the response of /snapshot/{asset}/{height}.
+type snapshotInfo struct {
+	*db.Snapshot
+	Balances []db.SnapshotBalance `json:"balances"`
+}
+
+var (
+	// building holds pks of snapshots being built in background.
+	building   = make(map[uint]bool)
+	buildingMu sync.Mutex
+)
+
+// handleSnapshot serves /snapshot/{asset}/{height} with paged holders in descending order of balances.
+func (srv *server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/snapshot/")
+	if len(params) != 2 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	height, err := strconv.ParseUint(params[1], 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid height: %s", params[1])
+		return
+	}
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	assetId, ok := srv.resolveAssetId(w, params[0])
+	if !ok {
+		return
+	}
+
+	s, err := srv.store.GetSnapshot(assetId, uint(height))
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if s == nil {
+		writeError(w, http.StatusNotFound, "snapshot of asset %s at height %d not found, create it by POST /admin/snapshots", params[0], height)
+		return
+	}
+
+	balances, err := srv.store.GetSnapshotBalances(s.Id, p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = s.Holders
+	writeData(w, snapshotInfo{Snapshot: s, Balances: balances}, p)
+}
+
+// handleAdminSnapshots serves /admin/snapshots, POST {"asset": ..., "height": ...} creates the snapshot
+// and builds it in background, or resumes building it if it was interrupted.
+func (srv *server) handleAdminSnapshots(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+
+	req := snapshotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Asset == "" || req.Height == nil {
+		writeError(w, http.StatusBadRequest, `request body must be {"asset": "<asset>", "height": <height>}`)
+		return
+	}
+
+	assetId, ok := srv.resolveAssetId(w, req.Asset)
+	if !ok {
+		return
+	}
+
+	s, err := srv.store.CreateSnapshot(assetId, *req.Height)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	if !s.Finished {
+		srv.buildSnapshot(s)
+	}
+
+	writeJSON(w, http.StatusAccepted, dataBody{Data: s})
+}
+
+// buildSnapshot builds the snapshot in background unless it is being built.
+func (srv *server) buildSnapshot(s *db.Snapshot) {
+	buildingMu.Lock()
+	defer buildingMu.Unlock()
+
+	if building[s.Id] {
+		return
+	}
+	building[s.Id] = true
+
+	go func() {
+		defer func() {
+			buildingMu.Lock()
+			delete(building, s.Id)
+			buildingMu.Unlock()
+		}()
+
+		log.Printf("Building snapshot of asset %d at height %d\n", s.AssetId, s.Height)
+		if err := srv.store.BuildSnapshot(s, nil); err != nil {
+			log.Error.Printf("Failed to build snapshot of asset %d at height %d: %v\n", s.AssetId, s.Height, err)
+			return
+		}
+		log.Printf("Built snapshot of asset %d at height %d\n", s.AssetId, s.Height)
+	}()
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleDailyStats serves /stats/daily?from=&to= with paged network stats of days in ascending order,
+// from and to are unix times of the start of days.
+func (srv *server) handleDailyStats(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var bounds [2]int64
+	for i, name := range []string{"from", "to"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		t, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || t < 0 {
+			writeError(w, http.StatusBadRequest, "invalid %s: %s", name, value)
+			return
+		}
+		bounds[i] = t
+	}
+
+	stats, total, err := srv.store.GetDailyStats(bounds[0], bounds[1], p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = total
+	writeData(w, stats, p)
+}
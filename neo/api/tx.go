@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleTx serves /tx/{txid}.
+func (srv *server) handleTx(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/tx/")
+	if len(params) != 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	txid, ok := normalizeHash(params[0], 32)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid txid: %s", params[0])
+		return
+	}
+
+	detail, err := srv.store.GetTxDetail(txid)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if detail == nil {
+		writeError(w, http.StatusNotFound, "transaction %s not found", txid)
+		return
+	}
+
+	writeData(w, detail, nil)
+}
+
+// handleBlock serves /block/{height|hash}.
+func (srv *server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/block/")
+	if len(params) != 1 {
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+		return
+	}
+
+	index := -1
+	hash := ""
+
+	if height, err := strconv.ParseUint(params[0], 10, 31); err == nil {
+		index = int(height)
+	} else if h, ok := normalizeHash(params[0], 32); ok {
+		hash = h
+	} else {
+		writeError(w, http.StatusBadRequest, "invalid block height or hash: %s", params[0])
+		return
+	}
+
+	detail, err := srv.store.GetBlockDetail(index, hash)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if detail == nil {
+		writeError(w, http.StatusNotFound, "block %s not found", params[0])
+		return
+	}
+
+	writeData(w, detail, nil)
+}
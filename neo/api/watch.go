@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxWebhookLength is the length of the `webhook` column.
+const maxWebhookLength = 512
+
+// watchRequest is the request body of POST /admin/watches, one of address and contract is given.
+type watchRequest struct {
+	Address  string `json:"address"`
+	Contract string `json:"contract"`
+	Webhook  string `json:"webhook"`
+}
+
+// handleAdminWatches serves /admin/watches, GET lists watches, POST {"address"|"contract": ..., "webhook": ...}
+// watches movements of the address or transfers of the nep5 contract, and DELETE /admin/watches/{id} removes one.
+// GET /admin/watches/{id}/deliveries returns the paged delivery log of the watch.
+func (srv *server) handleAdminWatches(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	params := pathParams(r, "/admin/watches")
+
+	switch {
+	case len(params) == 0 && r.Method == http.MethodGet:
+		srv.writeWatches(w)
+	case len(params) == 0 && r.Method == http.MethodPost:
+		srv.createWatch(w, r)
+	case len(params) == 0:
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	case len(params) == 1 && r.Method == http.MethodDelete:
+		id, ok := parseWatchId(w, params[0])
+		if !ok {
+			return
+		}
+		deleted, err := srv.store.DeleteWatch(id)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if !deleted {
+			writeError(w, http.StatusNotFound, "watch %d not found", id)
+			return
+		}
+		srv.writeWatches(w)
+	case len(params) == 1:
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	case len(params) == 2 && params[1] == "deliveries":
+		if !allowGet(w, r) {
+			return
+		}
+		srv.listWebhookDeliveries(w, r, params[0])
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint %s", r.URL.Path)
+	}
+}
+
+func (srv *server) writeWatches(w http.ResponseWriter) {
+	watches, err := srv.store.GetWatches()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeData(w, watches, nil)
+}
+
+func (srv *server) createWatch(w http.ResponseWriter, r *http.Request) {
+	req := watchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Address == "") == (req.Contract == "") {
+		writeError(w, http.StatusBadRequest, `request body must be {"address": "<address>", "webhook": "<url>"} or {"contract": "<nep5 contract>", "webhook": "<url>"}`)
+		return
+	}
+
+	u, err := url.Parse(req.Webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.Webhook) > maxWebhookLength {
+		writeError(w, http.StatusBadRequest, "invalid webhook: %s, must be a http(s) url of at most %d characters", req.Webhook, maxWebhookLength)
+		return
+	}
+
+	var address string
+	var assetId uint
+	if req.Address != "" {
+		var ok bool
+		if address, ok = resolveAddress(req.Address); !ok {
+			writeError(w, http.StatusBadRequest, "invalid address: %s", req.Address)
+			return
+		}
+	} else {
+		var nep5 bool
+		if assetId, nep5, err = srv.store.ResolveAsset(req.Contract); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if assetId == 0 || !nep5 {
+			writeError(w, http.StatusNotFound, "nep5 contract %s not found", req.Contract)
+			return
+		}
+	}
+
+	watch, err := srv.store.CreateWatch(address, assetId, req.Webhook)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, dataBody{Data: watch})
+}
+
+func (srv *server) listWebhookDeliveries(w http.ResponseWriter, r *http.Request, param string) {
+	id, ok := parseWatchId(w, param)
+	if !ok {
+		return
+	}
+
+	p, err := getPaging(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+
+	deliveries, total, err := srv.store.GetWebhookDeliveries(id, p.Size, p.offset())
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+
+	p.Total = total
+	writeData(w, deliveries, p)
+}
+
+func parseWatchId(w http.ResponseWriter, s string) (uint, bool) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, "invalid watch id: %s", s)
+		return 0, false
+	}
+
+	return uint(id), true
+}
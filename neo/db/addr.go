@@ -11,12 +11,12 @@ import (
 )
 
 // GetAddrAssetInfo returns all addresses with it's assets.
-func GetAddrAssetInfo() []*addr.AssetInfo {
+func (store *SQLStore) GetAddrAssetInfo() []*addr.AssetInfo {
 	const query = "SELECT `address`.`id`, `address`.`address`, `address`.`created_at`, `address`.`last_transaction_time`, `addr_asset`.`asset_id`, `addr_asset`.`balance` FROM `addr_asset` LEFT JOIN `address` ON `address`.`id`=`addr_asset`.`address_id`"
 
 	result := []*addr.AssetInfo{}
 
-	rows, err := wrappedQuery(query)
+	rows, err := store.wrappedQuery(query)
 	if err != nil {
 		panic(err)
 	}
@@ -48,7 +48,7 @@ func GetAddrAssetInfo() []*addr.AssetInfo {
 }
 
 // returns true if new address created.
-func updateAddrInfo(tx *sql.Tx, blockTime uint64, txID string, addr string, assetType string) (bool, error) {
+func (store *SQLStore) updateAddrInfo(tx *sql.Tx, blockTime uint64, txID string, addr string, assetType string) (bool, error) {
 	var incrAsset, incrNep5 = 0, 0
 	switch assetType {
 	case asset.ASSET:
@@ -56,18 +56,18 @@ func updateAddrInfo(tx *sql.Tx, blockTime uint64, txID string, addr string, asse
 	case asset.NEP5:
 		incrNep5 = 1
 	default:
-		panic("Unsupported asset Type: " + assetType)
+		return false, fmt.Errorf("unsupported asset type: %s", assetType)
 	}
 
-	addressId, err := GetVoutAddrID(addr)
+	addressId, err := store.GetVoutAddrID(addr)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	addrCache, created := cache.GetAddrOrCreate(addr, blockTime, addressId)
 
 	if created {
 		const createAddrQuery = "INSERT INTO `address` (`id`, `address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES (?, ?, ?, ?, ?, ?)"
-		_, err = tx.Exec(createAddrQuery, addressId, addr, blockTime, blockTime, incrAsset, incrNep5)
+		_, err = execute(tx, createAddrQuery, addressId, addr, blockTime, blockTime, incrAsset, incrNep5)
 		if err != nil {
 			log.Error.Printf("TxMap: %s, addr=%s, assetType=%s\n", txID, addr, assetType)
 			return true, err
@@ -87,36 +87,36 @@ func updateAddrInfo(tx *sql.Tx, blockTime uint64, txID string, addr string, asse
 	}
 	query += fmt.Sprintf(" WHERE `address` = '%s' LIMIT 1", addr)
 
-	_, err = tx.Exec(query)
+	_, err = execute(tx, query)
 	return false, err
 }
 
 // returns true if new address created.
-func createAddrInfoIfNotExist(tx *sql.Tx, blockTime uint64, addr string) (bool, error) {
-	addressId, err := GetVoutAddrID(addr)
+func (store *SQLStore) createAddrInfoIfNotExist(tx *sql.Tx, blockTime uint64, addr string) (bool, error) {
+	addressId, err := store.GetVoutAddrID(addr)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	_, created := cache.GetAddrOrCreate(addr, blockTime, addressId)
 	if created {
 		const createAddrQuery = "INSERT INTO `address` (`id`, `address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES (?, ?, ?, ?, ?, ?)"
-		_, err := tx.Exec(createAddrQuery, addressId, addr, blockTime, blockTime, 0, 0)
+		_, err := execute(tx, createAddrQuery, addressId, addr, blockTime, blockTime, 0, 0)
 		return true, err
 	}
 
 	return false, nil
 }
 
-func GetVoutAddrID(addr string) (uint, error) {
+func (store *SQLStore) GetVoutAddrID(addr string) (uint, error) {
 	var id uint
 	query := "SELECT `address_id` FROM `tx_vout` WHERE `address` = ? LIMIT 1"
-	err := db.QueryRow(query, addr).Scan(&id)
+	err := store.db.QueryRow(query, addr).Scan(&id)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetVoutAddrID(addr)
+		store.reconnect()
+		return store.GetVoutAddrID(addr)
 	}
 	if id < 1 {
 		return 0, fmt.Errorf("GetVoutAddrID Get Error : %s", addr)
@@ -125,16 +125,16 @@ func GetVoutAddrID(addr string) (uint, error) {
 	return id, nil
 }
 
-func GetAddrID(addr string) (uint, error) {
+func (store *SQLStore) GetAddrID(addr string) (uint, error) {
 	var id uint
 	query := "SELECT `id` FROM `address` WHERE `address` = ? LIMIT 1"
-	err := db.QueryRow(query, addr).Scan(&id)
+	err := store.db.QueryRow(query, addr).Scan(&id)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetAddrID(addr)
+		store.reconnect()
+		return store.GetAddrID(addr)
 	}
 	if id < 1 {
 		return 0, fmt.Errorf("GetVoutAddrID Get Error : %s", addr)
@@ -143,16 +143,16 @@ func GetAddrID(addr string) (uint, error) {
 	return id, nil
 }
 
-func GetVoutAddrCount() uint {
+func (store *SQLStore) GetVoutAddrCount() uint {
 	var count uint
-	query := "SELECT COUNT(DISTINCT `address`) FROM `tx_vout` ORDER BY `id` ASC"
-	err := db.QueryRow(query).Scan(&count)
+	query := "SELECT COUNT(DISTINCT `address`) FROM `tx_vout`"
+	err := store.db.QueryRow(query).Scan(&count)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetVoutAddrCount()
+		store.reconnect()
+		return store.GetVoutAddrCount()
 	}
 
 	return count
@@ -4,11 +4,11 @@ import (
 	"neo_explorer/neo/asset"
 )
 
-func GetAssetInfo() []asset.Asset {
+func (store *SQLStore) GetAssetInfo() []asset.Asset {
 	const query = "SELECT `id`, `asset_id` FROM `asset`"
 
 	result := []asset.Asset{}
-	rows, err := wrappedQuery(query)
+	rows, err := store.wrappedQuery(query)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/big"
+	"neo_explorer/core/config"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/nep5"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BalanceChange is the change of the balance of an address for an asset or nep5 token.
+type BalanceChange struct {
+	AddressId uint
+	AssetId   uint
+	BlockTime uint64
+	Value     *big.Float
+}
+
+// BalanceRecord is the balance of an address at the end of a bucket.
+type BalanceRecord struct {
+	// Time is the unix time the bucket starts at.
+	Time    int64  `json:"time"`
+	Balance string `json:"balance"`
+}
+
+type balanceKey struct {
+	addressId uint
+	assetId   uint
+	bucket    int64
+}
+
+var (
+	// bucketOnce reads 'balance_history' once, existing history is bucketed with it until restart.
+	bucketOnce     sync.Once
+	bucketHourly   bool
+	bucketLocation *time.Location
+)
+
+// balanceBucket returns the unix time the bucket of blockTime starts at,
+// buckets are configured by 'balance_history'.
+func balanceBucket(blockTime uint64) int64 {
+	bucketOnce.Do(loadBucketConfig)
+
+	t := time.Unix(int64(blockTime), 0).In(bucketLocation)
+	hour := 0
+	if bucketHourly {
+		hour = t.Hour()
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, bucketLocation).Unix()
+}
+
+func loadBucketConfig() {
+	c := config.GetBalanceHistory()
+
+	// The time zone has been validated when config was loaded.
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		panic(err)
+	}
+
+	bucketHourly = c.Bucket == config.BucketHour
+	bucketLocation = loc
+}
+
+// CheckBalanceHistorySchema returns an error if the database was created before
+// balance history replaced daily GAS balances and has not been upgraded.
+func (store *SQLStore) CheckBalanceHistorySchema() error {
+	const query = "SELECT `last_tx_pk_balance`, `nep5_tx_pk_for_balance` FROM `counter` WHERE `id` = 1 AND EXISTS (SELECT `id` FROM `addr_balance_history` LIMIT 1)"
+	var txPk, nep5TxPk uint
+	err := store.db.QueryRow(query).Scan(&txPk, &nep5TxPk)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("balance history tables not found, upgrade the database as described in README: %v", err)
+	}
+
+	return nil
+}
+
+// DropGasBalanceHistory drops the daily GAS balances replaced by balance history,
+// it returns false if they do not exist.
+func (store *SQLStore) DropGasBalanceHistory() (bool, error) {
+	var one int
+	err := store.db.QueryRow("SELECT 1 FROM `addr_gas_balance` LIMIT 1").Scan(&one)
+	if err != nil && err != sql.ErrNoRows {
+		if store.dialect.isConnErr(err) {
+			return false, err
+		}
+		// The table does not exist.
+		return false, nil
+	}
+
+	if _, err := store.db.Exec("DROP TABLE `addr_gas_balance`"); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ApplyTxBalanceChanges persists balance changes of utxo assets made by the transaction.
+func (store *SQLStore) ApplyTxBalanceChanges(txPk uint, changes []BalanceChange) error {
+	return store.transact(func(trans *sql.Tx) error {
+		if err := applyBalanceChanges(trans, changes); err != nil {
+			return err
+		}
+
+		return updateCounter(trans, "last_tx_pk_balance", int64(txPk))
+	})
+}
+
+// ApplyNep5BalanceChanges persists balance changes made by the nep5 transfers.
+func (store *SQLStore) ApplyNep5BalanceChanges(records []*nep5.Transaction) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return store.transact(func(trans *sql.Tx) error {
+		addressIds := make(map[string]uint)
+		changes := []BalanceChange{}
+
+		for _, rec := range records {
+			for _, side := range []struct {
+				addr  string
+				value *big.Float
+			}{
+				{rec.From, new(big.Float).Neg(rec.Value)},
+				{rec.To, rec.Value},
+			} {
+				if len(side.addr) == 0 {
+					continue
+				}
+
+				addressId, ok := addressIds[side.addr]
+				if !ok {
+					const query = "SELECT `id` FROM `address` WHERE `address` = ? LIMIT 1"
+					if err := trans.QueryRow(query, side.addr).Scan(&addressId); err != nil {
+						return fmt.Errorf("address %s of nep5 tx record %d: %v", side.addr, rec.ID, err)
+					}
+					addressIds[side.addr] = addressId
+				}
+
+				changes = append(changes, BalanceChange{AddressId: addressId, AssetId: rec.AssetID, BlockTime: rec.BlockTime, Value: side.value})
+			}
+		}
+
+		if err := applyBalanceChanges(trans, changes); err != nil {
+			return err
+		}
+
+		return updateCounter(trans, "nep5_tx_pk_for_balance", int64(records[len(records)-1].ID))
+	})
+}
+
+// applyBalanceChanges adds changes to the balance of their buckets,
+// the balance of a new bucket starts from the one of the previous bucket.
+func applyBalanceChanges(trans *sql.Tx, changes []BalanceChange) error {
+	sums := make(map[balanceKey]*big.Float)
+	keys := []balanceKey{}
+
+	for _, c := range changes {
+		key := balanceKey{addressId: c.AddressId, assetId: c.AssetId, bucket: balanceBucket(c.BlockTime)}
+		if sum, ok := sums[key]; ok {
+			sum.Add(sum, c.Value)
+			continue
+		}
+
+		sums[key] = new(big.Float).Set(c.Value)
+		keys = append(keys, key)
+	}
+
+	// Earlier buckets first, then sort by address and asset to avoid potential deadlock.
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].bucket != keys[j].bucket {
+			return keys[i].bucket < keys[j].bucket
+		}
+		if keys[i].addressId != keys[j].addressId {
+			return keys[i].addressId < keys[j].addressId
+		}
+		return keys[i].assetId < keys[j].assetId
+	})
+
+	for _, key := range keys {
+		var lastBucket int64
+		var balanceStr string
+
+		const query = "SELECT `bucket_time`, `balance` FROM `addr_balance_history` WHERE `address_id` = ? AND `asset_id` = ? ORDER BY `bucket_time` DESC LIMIT 1"
+		err := trans.QueryRow(query, key.addressId, key.assetId).Scan(&lastBucket, &balanceStr)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		// Block time never decreases, changes of an earlier bucket are added to the last one anyway.
+		if err == nil && lastBucket >= key.bucket {
+			update := fmt.Sprintf("UPDATE `addr_balance_history` SET `balance` = `balance` + %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' AND `bucket_time` = %d LIMIT 1", sums[key], key.addressId, key.assetId, lastBucket)
+			if _, err := execute(trans, update); err != nil {
+				return err
+			}
+			continue
+		}
+
+		balance := sums[key]
+		if err == nil {
+			balance = new(big.Float).Add(util.StrToBigFloat(balanceStr), balance)
+		}
+
+		insert := fmt.Sprintf("INSERT INTO `addr_balance_history` (`address_id`, `asset_id`, `bucket_time`, `balance`) VALUES ('%d', '%d', %d, %.8f)", key.addressId, key.assetId, key.bucket, balance)
+		if _, err := execute(trans, insert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAddrBalanceHistory returns paged balances of the address for the asset in buckets starting in [from, to],
+// to is not limited if it is 0.
+func (store *SQLStore) GetAddrBalanceHistory(addressId uint, assetId uint, from int64, to int64, limit int, offset int) ([]BalanceRecord, uint64, error) {
+	if to == 0 {
+		to = math.MaxInt64
+	}
+
+	var total uint64
+	const countQuery = "SELECT COUNT(`id`) FROM `addr_balance_history` WHERE `address_id` = ? AND `asset_id` = ? AND `bucket_time` BETWEEN ? AND ?"
+	if err := store.db.QueryRow(countQuery, addressId, assetId, from, to).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	records := []BalanceRecord{}
+	const query = "SELECT `bucket_time`, `balance` FROM `addr_balance_history` WHERE `address_id` = ? AND `asset_id` = ? AND `bucket_time` BETWEEN ? AND ? ORDER BY `bucket_time` ASC LIMIT ? OFFSET ?"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		var r BalanceRecord
+		var balanceStr string
+		if err := rows.Scan(&r.Time, &balanceStr); err != nil {
+			return err
+		}
+
+		r.Balance = util.StrToBigFloat(balanceStr).Text('f', 8)
+		records = append(records, r)
+		return nil
+	}, query, addressId, assetId, from, to, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestBalanceHistory(t *testing.T) {
+	store := newTestStore(t)
+
+	// A gets 10 of asset 1 on day 0 and sends 4 to B an hour later, B gets 1 of asset 2 on day 1.
+	// A mints 100 of nep5 asset 5 on day 0 and sends 30 to B on day 1.
+	blocks := testBlocks(1, 3600, 86401)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "ContractTransaction"),
+			testTx(2, blocks[1], "ContractTransaction"),
+			testTx(3, blocks[2], "ContractTransaction"),
+		},
+		TXVins: []*tx.TransactionVin{
+			{TxId: 2, TxID: 1, Vout: 0},
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "HistoryAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(4), Address: "HistoryAddrB", AddressId: 2},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(6), Address: "HistoryAddrA", AddressId: 1},
+			{TxId: 3, N: 0, AssetID: 2, Value: big.NewFloat(1), Address: "HistoryAddrB", AddressId: 2},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	execQueries(t, store,
+		"INSERT INTO `address` (`address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES ('HistoryAddrA', 1, 1, 2, 2), ('HistoryAddrB', 3600, 86401, 2, 1)",
+		"INSERT INTO `nep5_tx` (`tx_id`, `asset_id`, `from`, `to`, `value`, `block_index`, `block_time`) VALUES (2, 5, '', 'HistoryAddrA', 100, 1, 3600), (3, 5, 'HistoryAddrA', 'HistoryAddrB', 30, 2, 86401)",
+	)
+
+	apply := func() {
+		changes := [][]BalanceChange{
+			{{AddressId: 1, AssetId: 1, BlockTime: 1, Value: big.NewFloat(10)}},
+			{
+				{AddressId: 1, AssetId: 1, BlockTime: 3600, Value: big.NewFloat(-10)},
+				{AddressId: 2, AssetId: 1, BlockTime: 3600, Value: big.NewFloat(4)},
+				{AddressId: 1, AssetId: 1, BlockTime: 3600, Value: big.NewFloat(6)},
+			},
+			{{AddressId: 2, AssetId: 2, BlockTime: 86401, Value: big.NewFloat(1)}},
+		}
+		for pk := store.GetLastTxPkForBalance() + 1; pk <= 3; pk++ {
+			if err := store.ApplyTxBalanceChanges(pk, changes[pk-1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, err := store.GetNep5TxRecords(store.GetNep5TxPkForBalance(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.ApplyNep5BalanceChanges(records); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(when string, addressId uint, assetId uint, from int64, want string) {
+		t.Helper()
+
+		records, total, err := store.GetAddrBalanceHistory(addressId, assetId, from, 0, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%d %v", total, records); got != want {
+			t.Errorf("balance history of address %d for asset %d from %d %s = %s, want %s", addressId, assetId, from, when, got, want)
+		}
+	}
+
+	apply()
+	if pk := store.GetNep5TxPkForBalance(); pk != 2 {
+		t.Errorf("GetNep5TxPkForBalance() = %d, want 2", pk)
+	}
+	check("", 1, 1, 0, "1 [{0 6.00000000}]")
+	check("", 2, 1, 0, "1 [{0 4.00000000}]")
+	check("", 2, 2, 0, "1 [{86400 1.00000000}]")
+	check("", 1, 5, 0, "2 [{0 100.00000000} {86400 70.00000000}]")
+	check("", 1, 5, 86400, "1 [{86400 70.00000000}]")
+	check("", 2, 5, 0, "1 [{86400 30.00000000}]")
+
+	// Changes of the kept day are subtracted, later days are removed.
+	if _, err := store.RewindTask("balance_history", 1); err != nil {
+		t.Fatal(err)
+	}
+	if pk, nep5Pk := store.GetLastTxPkForBalance(), store.GetNep5TxPkForBalance(); pk != 1 || nep5Pk != 0 {
+		t.Errorf("counters = %d, %d after rewind, want 1, 0", pk, nep5Pk)
+	}
+	check("after rewind", 1, 1, 0, "1 [{0 10.00000000}]")
+	check("after rewind", 1, 5, 0, "1 [{0 0.00000000}]")
+	check("after rewind", 2, 2, 0, "0 []")
+
+	apply()
+	check("after reapply", 1, 1, 0, "1 [{0 6.00000000}]")
+	check("after reapply", 1, 5, 0, "2 [{0 100.00000000} {86400 70.00000000}]")
+
+	if _, err := store.RollbackBlocks(2); err != nil {
+		t.Fatal(err)
+	}
+	if pk, nep5Pk := store.GetLastTxPkForBalance(), store.GetNep5TxPkForBalance(); pk != 2 || nep5Pk != 1 {
+		t.Errorf("counters = %d, %d after rollback, want 2, 1", pk, nep5Pk)
+	}
+	check("after rollback", 1, 5, 0, "1 [{0 100.00000000}]")
+	check("after rollback", 2, 5, 0, "0 []")
+	check("after rollback", 1, 1, 0, "1 [{0 6.00000000}]")
+
+	if _, err := store.ResetTask("balance_history"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `addr_balance_history`"); n != 0 {
+		t.Errorf("addr_balance_history has %d rows after reset, want 0", n)
+	}
+}
+
+func TestGasBalanceUpgrade(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.CheckBalanceHistorySchema(); err != nil {
+		t.Errorf("store.CheckBalanceHistorySchema() = %v on a new database", err)
+	}
+	if dropped, err := store.DropGasBalanceHistory(); dropped || err != nil {
+		t.Errorf("store.DropGasBalanceHistory() = %v, %v on a new database, want false, nil", dropped, err)
+	}
+
+	execQueries(t, store, "CREATE TABLE addr_gas_balance (id integer primary key, address_id int not null, date date not null, balance decimal(35, 8) not null)")
+	if dropped, err := store.DropGasBalanceHistory(); !dropped || err != nil {
+		t.Errorf("store.DropGasBalanceHistory() = %v, %v, want true, nil", dropped, err)
+	}
+	if dropped, _ := store.DropGasBalanceHistory(); dropped {
+		t.Error("addr_gas_balance dropped twice")
+	}
+
+	execQueries(t, store, "DROP TABLE addr_balance_history")
+	if err := store.CheckBalanceHistorySchema(); err == nil {
+		t.Error("store.CheckBalanceHistorySchema() = nil without addr_balance_history")
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 // InsertBlock inserts raw block data into database.
-func InsertBlock(maxIndex int, blocks []*block.Block, txBulk *tx.Bulk) error {
+func (store *SQLStore) InsertBlock(maxIndex int, blocks []*block.Block, txBulk *tx.Bulk) error {
 	insertBlocksCmd := generateInsertCmdForBlock(blocks)
 	insertTxsCmd := generateInsertCmdForTxs(txBulk.TXs)
 	insertTxAttrsCmd := generateInsertCmdForTxAttrs(txBulk.TXAttrs)
@@ -31,16 +31,20 @@ func InsertBlock(maxIndex int, blocks []*block.Block, txBulk *tx.Bulk) error {
 		insertClaims,
 	}
 
-	return transact(func(tx *sql.Tx) error {
+	return store.transact(func(tx *sql.Tx) error {
 		for _, cmd := range cmdList {
 			if cmd == "" {
 				continue
 			}
-			if _, err := tx.Exec(cmd); err != nil {
+			if _, err := execute(tx, cmd); err != nil {
 				return err
 			}
 		}
 
+		if err := insertBlockSysFees(tx, blocks, txBulk.TXs); err != nil {
+			return err
+		}
+
 		// Update tx type counter.
 		txTypeCounter := countTxTypes(txBulk.TXs)
 		for txType, cnt := range txTypeCounter {
@@ -77,10 +81,10 @@ func generateInsertCmdForTxs(txs []*tx.Transaction) string {
 	}
 
 	var strBuilder strings.Builder
-	strBuilder.WriteString("INSERT INTO `tx` (`block_index`, `block_time`, `txid`, `size`, `type`, `version`, `sys_fee`, `net_fee`, `nonce`, `script`, `gas`) VALUES ")
+	strBuilder.WriteString("INSERT INTO `tx` (`id`, `block_index`, `block_time`, `txid`, `size`, `type`, `version`, `sys_fee`, `net_fee`, `nonce`, `script`, `gas`) VALUES ")
 
 	for _, tx := range txs {
-		strBuilder.WriteString(fmt.Sprintf("(%d, %d, '%s', %d, '%s', %d, %.8f, %.8f, %d, '%s', %.8f),", tx.BlockIndex, tx.BlockTime, tx.TxID, tx.Size, tx.Type, tx.Version, tx.SysFee, tx.NetFee, tx.Nonce, tx.Script, tx.Gas))
+		strBuilder.WriteString(fmt.Sprintf("(%d, %d, %d, '%s', %d, '%s', %d, %.8f, %.8f, %d, '%s', %.8f),", tx.ID, tx.BlockIndex, tx.BlockTime, tx.TxID, tx.Size, tx.Type, tx.Version, tx.SysFee, tx.NetFee, tx.Nonce, tx.Script, tx.Gas))
 	}
 	return strings.TrimSuffix(strBuilder.String(), ",")
 }
@@ -163,10 +167,10 @@ func generateInsertCmdForClaims(claims []*tx.TransactionClaims) string {
 	}
 
 	var strBuilder strings.Builder
-	strBuilder.WriteString("INSERT INTO `tx_claims` (`tx_id`, `vout`) VALUES ")
+	strBuilder.WriteString("INSERT INTO `tx_claims` (`tx_id`, `txid`, `vout`) VALUES ")
 
 	for _, claim := range claims {
-		strBuilder.WriteString(fmt.Sprintf("('%d', %d),", claim.TxId, claim.Vout))
+		strBuilder.WriteString(fmt.Sprintf("('%d', '%d', %d),", claim.TxId, claim.TxID, claim.Vout))
 	}
 	return strings.TrimSuffix(strBuilder.String(), ",")
 }
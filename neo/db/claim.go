@@ -0,0 +1,220 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"sort"
+)
+
+// decrementInterval is the number of blocks after which GAS generated by every block decreases.
+const decrementInterval = 2000000
+
+// generationAmount is GAS generated by every block in each decrement interval.
+var generationAmount = []uint64{8, 7, 6, 5, 4, 3, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
+
+// AddrGas is GAS generated by NEO of an address.
+type AddrGas struct {
+	// Unclaimed is generated by unspent NEO until Height, it becomes claimable once the NEO is spent.
+	Unclaimed string `json:"unclaimed"`
+	// Claimable is generated by spent NEO which is not claimed yet.
+	Claimable string `json:"claimable"`
+	// Height is the block index of the last transaction applied to utxo.
+	Height uint `json:"height"`
+}
+
+// neoOutput is a NEO output held from block Start to block End (exclusive).
+type neoOutput struct {
+	Value *big.Float
+	Start uint
+	End   uint
+}
+
+// UnresolvedClaimTx is a claim transaction stored before tx_claims recorded the claimed transactions.
+type UnresolvedClaimTx struct {
+	TxPk       uint
+	TxID       string
+	BlockIndex uint
+}
+
+// GetAddrGas calculates unclaimed and claimable GAS of the address
+// following the NEO 2 generation schedule plus accumulated system fees.
+func (store *SQLStore) GetAddrGas(addressId uint) (*AddrGas, error) {
+	gas := &AddrGas{Unclaimed: "0.00000000", Claimable: "0.00000000"}
+
+	lastTxPk := store.getCounterInstance().LastTxPk
+	if lastTxPk == 0 {
+		return gas, nil
+	}
+
+	const heightQuery = "SELECT `block_index` FROM `tx` WHERE `id` = ? LIMIT 1"
+	if err := store.db.QueryRow(heightQuery, lastTxPk).Scan(&gas.Height); err != nil {
+		return nil, err
+	}
+
+	neoId, err := store.FindAssetPk(asset.NEOAssetID)
+	if err != nil || neoId == 0 {
+		return gas, err
+	}
+
+	unspent := []neoOutput{}
+	const unspentQuery = "SELECT `utxo`.`value`, `tx`.`block_index` FROM `utxo` INNER JOIN `tx` ON `tx`.`id` = `utxo`.`tx_id` WHERE `utxo`.`address_id` = ? AND `utxo`.`asset_id` = ? AND `utxo`.`used_in_tx` IS NULL"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var valueStr string
+		o := neoOutput{End: gas.Height + 1}
+		if err := rows.Scan(&valueStr, &o.Start); err != nil {
+			return err
+		}
+
+		o.Value = util.StrToBigFloat(valueStr)
+		unspent = append(unspent, o)
+		return nil
+	}, unspentQuery, addressId, neoId)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := []neoOutput{}
+	const spentQuery = "SELECT `utxo`.`value`, `tx`.`block_index`, `spent`.`block_index` FROM `utxo` INNER JOIN `tx` ON `tx`.`id` = `utxo`.`tx_id` INNER JOIN `tx` AS `spent` ON `spent`.`id` = `utxo`.`used_in_tx` WHERE `utxo`.`address_id` = ? AND `utxo`.`asset_id` = ? AND `utxo`.`used_in_tx` IS NOT NULL AND NOT EXISTS (SELECT `id` FROM `tx_claims` WHERE `tx_claims`.`txid` = `utxo`.`tx_id` AND `tx_claims`.`vout` = `utxo`.`n`)"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var valueStr string
+		o := neoOutput{}
+		if err := rows.Scan(&valueStr, &o.Start, &o.End); err != nil {
+			return err
+		}
+
+		o.Value = util.StrToBigFloat(valueStr)
+		spent = append(spent, o)
+		return nil
+	}, spentQuery, addressId, neoId)
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := store.getTotalSysFees(sysFeeIndexes(append(unspent, spent...)))
+	if err != nil {
+		return nil, err
+	}
+
+	gas.Unclaimed = fixed8String(calculateBonus(unspent, totals))
+	gas.Claimable = fixed8String(calculateBonus(spent, totals))
+
+	return gas, nil
+}
+
+// sysFeeIndexes returns blocks whose accumulated system fees are needed to calculate bonus of outputs.
+func sysFeeIndexes(outputs []neoOutput) []uint {
+	seen := make(map[uint]bool)
+	indexes := []uint{}
+
+	for _, o := range outputs {
+		for _, index := range []int{int(o.Start) - 1, int(o.End) - 1} {
+			if index < 0 || seen[uint(index)] {
+				continue
+			}
+
+			seen[uint(index)] = true
+			indexes = append(indexes, uint(index))
+		}
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
+
+// calculateBonus returns GAS generated by outputs in units of 10^-8 GAS, like CalculateBonus of NEO 2.
+// totals holds accumulated system fees of blocks returned by sysFeeIndexes.
+func calculateBonus(outputs []neoOutput, totals map[uint]uint64) *big.Int {
+	bonus := new(big.Int)
+
+	for _, o := range outputs {
+		if o.End <= o.Start {
+			continue
+		}
+
+		amount := generatedGas(o.Start, o.End) + totals[o.End-1]
+		if o.Start > 0 {
+			amount -= totals[o.Start-1]
+		}
+
+		// Value is in whole NEO since NEO is indivisible.
+		value, _ := o.Value.Int(nil)
+		bonus.Add(bonus, new(big.Int).Mul(value, new(big.Int).SetUint64(amount)))
+	}
+
+	return bonus
+}
+
+// generatedGas returns GAS generated by blocks [start, end).
+func generatedGas(start uint, end uint) uint64 {
+	var amount uint64
+
+	for start < end {
+		interval := start / decrementInterval
+		if interval >= uint(len(generationAmount)) {
+			break
+		}
+
+		intervalEnd := (interval + 1) * decrementInterval
+		if intervalEnd > end {
+			intervalEnd = end
+		}
+
+		amount += uint64(intervalEnd-start) * generationAmount[interval]
+		start = intervalEnd
+	}
+
+	return amount
+}
+
+// fixed8String formats an amount in units of 10^-8 with 8 decimals.
+func fixed8String(amount *big.Int) string {
+	q, r := new(big.Int).QuoRem(amount, big.NewInt(100000000), new(big.Int))
+	return fmt.Sprintf("%s.%08d", q, r.Int64())
+}
+
+// GetUnresolvedClaimTxs returns claim transactions having claims without claimed transactions.
+func (store *SQLStore) GetUnresolvedClaimTxs(limit int) ([]*UnresolvedClaimTx, error) {
+	claimTxs := []*UnresolvedClaimTx{}
+
+	const query = "SELECT DISTINCT `tx`.`id`, `tx`.`txid`, `tx`.`block_index` FROM `tx_claims` INNER JOIN `tx` ON `tx`.`id` = `tx_claims`.`tx_id` WHERE `tx_claims`.`txid` = 0 ORDER BY `tx`.`id` ASC LIMIT ?"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		c := &UnresolvedClaimTx{}
+		if err := rows.Scan(&c.TxPk, &c.TxID, &c.BlockIndex); err != nil {
+			return err
+		}
+
+		claimTxs = append(claimTxs, c)
+		return nil
+	}, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return claimTxs, nil
+}
+
+// ResolveClaims replaces claims of the claim transaction with the given ones.
+// Nothing is stored if the transaction has no claims, e.g. it was rolled back.
+func (store *SQLStore) ResolveClaims(txPk uint, claims []*tx.TransactionClaims) error {
+	return store.transact(func(trans *sql.Tx) error {
+		result, err := execute(trans, "DELETE FROM `tx_claims` WHERE `tx_id` = ?", txPk)
+		if err != nil {
+			return err
+		}
+		if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+			return err
+		}
+
+		cmd := generateInsertCmdForClaims(claims)
+		if cmd == "" {
+			return nil
+		}
+
+		_, err = execute(trans, cmd)
+		return err
+	})
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestAddrGas(t *testing.T) {
+	store := newTestStore(t)
+
+	// A gets 100 NEO in block 0, spends it in block 1 and claims it in block 2,
+	// where A also spends the 60 NEO received in block 1.
+	blocks := testBlocks(0, 0, 0)
+	newTx := func(id uint, index uint, txType string, sysFee float64) *tx.Transaction {
+		trans := testTx(id, blocks[index], txType)
+		trans.SysFee = big.NewFloat(sysFee)
+		return trans
+	}
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			newTx(1, 0, "IssueTransaction", 0),
+			newTx(2, 1, "ContractTransaction", 10.5),
+			newTx(3, 2, "ClaimTransaction", 0.6),
+			newTx(4, 2, "ContractTransaction", 0.7),
+		},
+		TXVins: []*tx.TransactionVin{
+			{TxId: 2, TxID: 1, Vout: 0},
+			{TxId: 4, TxID: 2, Vout: 0},
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(100), Address: "GasAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(60), Address: "GasAddrA", AddressId: 1},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(40), Address: "GasAddrB", AddressId: 2},
+			{TxId: 4, N: 0, AssetID: 1, Value: big.NewFloat(60), Address: "GasAddrA", AddressId: 1},
+		},
+		Assets: []*asset.Asset{
+			{AssetID: asset.NEOAssetID, Type: "GoverningToken", Name: "NEO", Amount: big.NewFloat(100000000), Available: big.NewFloat(0)},
+		},
+		Claims: []*tx.TransactionClaims{{TxId: 3, TxID: 1, Vout: 0}},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	// System fees of each block are summed up in whole GAS.
+	totals, err := store.getTotalSysFees([]uint{0, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals[0] != 0 || totals[1] != 10 || totals[2] != 11 {
+		t.Errorf("accumulated system fees = %v, want 0, 10, 11", totals)
+	}
+
+	if _, err := store.db.Exec("DELETE FROM `block_sys_fee` WHERE `block_index` > 0"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.BackfillBlockSysFees(); err != nil || n != 2 {
+		t.Errorf("BackfillBlockSysFees() = %d, %v, want 2 blocks", n, err)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `block_sys_fee` WHERE `block_index` = 2 AND `total_sys_fee` = 11"); n != 1 {
+		t.Error("accumulated system fee of block 2 is not backfilled")
+	}
+
+	cache.LoadAssetsInfo(store.GetAssetInfo())
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+	vins := map[uint][]*tx.TransactionVin{2: bulk.TXVins[:1], 4: bulk.TXVins[1:]}
+	vouts := map[uint][]*tx.TransactionVout{1: bulk.TXVouts[:1], 2: bulk.TXVouts[1:3], 4: bulk.TXVouts[3:]}
+	for _, trans := range bulk.TXs {
+		if err := store.ApplyVinsVouts(trans, vins[trans.ID], vouts[trans.ID]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkGas := func(addressId uint, unclaimed string, claimable string) {
+		t.Helper()
+
+		gas, err := store.GetAddrGas(addressId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gas.Height != 2 || gas.Unclaimed != unclaimed || gas.Claimable != claimable {
+			t.Errorf("gas of address %d = %+v, want unclaimed %s and claimable %s at height 2", addressId, gas, unclaimed, claimable)
+		}
+	}
+
+	// 60 NEO of A held in block 1: (8 + 10) * 60, held in block 2 until height 2: (8 + 1) * 60.
+	checkGas(1, "0.00000540", "0.00001080")
+	// 40 NEO of B held in blocks [1, 2]: (8 * 2 + 11) * 40.
+	checkGas(2, "0.00001080", "0.00000000")
+
+	// Claims stored before tx_claims recorded claimed transactions.
+	if _, err := store.db.Exec("UPDATE `tx_claims` SET `txid` = 0"); err != nil {
+		t.Fatal(err)
+	}
+	claimTxs, err := store.GetUnresolvedClaimTxs(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimTxs) != 1 || claimTxs[0].TxPk != 3 || claimTxs[0].TxID != "0x03" || claimTxs[0].BlockIndex != 2 {
+		t.Fatalf("unresolved claim txs = %+v, want tx 3", claimTxs)
+	}
+	// 100 NEO of A held in block 0: (8 + 0) * 100.
+	checkGas(1, "0.00000540", "0.00001880")
+
+	if err := store.ResolveClaims(3, bulk.Claims); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ResolveClaims(5, bulk.Claims); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `tx_claims` WHERE `txid` = 1"); n != 1 {
+		t.Errorf("tx_claims has %d resolved claims, want 1 of tx 3", n)
+	}
+	checkGas(1, "0.00000540", "0.00001080")
+
+	if _, err := store.RollbackBlocks(2); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `block_sys_fee`"); n != 2 {
+		t.Errorf("block_sys_fee has %d rows after rollback, want 2", n)
+	}
+}
+
+func TestGeneratedGas(t *testing.T) {
+	tests := []struct {
+		start, end uint
+		want       uint64
+	}{
+		{0, 1, 8},
+		{1999999, 2000001, 15},
+		{0, 44000000, 100000000},
+		{43999999, 44000005, 1},
+		{44000000, 45000000, 0},
+	}
+
+	for _, test := range tests {
+		if got := generatedGas(test.start, test.end); got != test.want {
+			t.Errorf("generatedGas(%d, %d) = %d, want %d", test.start, test.end, got, test.want)
+		}
+	}
+}
@@ -16,7 +16,8 @@ type Counter struct {
 	AppLogIdx          int
 	LastTxPkForSC      uint
 	Nep5TxPkForAddrTx  uint
-	LastTxPkGasBalacne uint
+	LastTxPkBalance    uint
+	Nep5TxPkForBalance uint
 	CntAddr            uint
 	CntTxReg           uint
 	CntTxMiner         uint
@@ -29,12 +30,12 @@ type Counter struct {
 }
 
 // GetLastHeight returns the highest block index stored in database.
-func GetLastHeight() int {
-	counter := getCounterInstance()
+func (store *SQLStore) GetLastHeight() int {
+	counter := store.getCounterInstance()
 	return counter.LastBlockIndex
 }
 
-func initCounterInstance() Counter {
+func (store *SQLStore) initCounterInstance() Counter {
 	c := Counter{
 		ID:                 1,
 		LastBlockIndex:     -1,
@@ -44,7 +45,8 @@ func initCounterInstance() Counter {
 		AppLogIdx:          -1,
 		LastTxPkForSC:      0,
 		Nep5TxPkForAddrTx:  0,
-		LastTxPkGasBalacne: 0,
+		LastTxPkBalance:    0,
+		Nep5TxPkForBalance: 0,
 		CntAddr:            0,
 		CntTxReg:           0,
 		CntTxMiner:         0,
@@ -55,9 +57,9 @@ func initCounterInstance() Counter {
 		CntTxPublish:       0,
 		CntTxEnrollment:    0,
 	}
-	const query = "INSERT INTO `counter` (`id`, `last_block_index`, `last_tx_pk`, `last_asset_tx_pk`, `last_tx_pk_for_nep5`, `app_log_idx`, `last_tx_pk_for_sc`, `nep5_tx_pk_for_addr_tx`, `last_tx_pk_gas_balance`, `cnt_addr`, `cnt_tx_reg`, `cnt_tx_miner`, `cnt_tx_issue`, `cnt_tx_invocation`, `cnt_tx_contract`, `cnt_tx_claim`, `cnt_tx_publish`, `cnt_tx_enrollment`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	const query = "INSERT INTO `counter` (`id`, `last_block_index`, `last_tx_pk`, `last_asset_tx_pk`, `last_tx_pk_for_nep5`, `app_log_idx`, `last_tx_pk_for_sc`, `nep5_tx_pk_for_addr_tx`, `last_tx_pk_balance`, `nep5_tx_pk_for_balance`, `cnt_addr`, `cnt_tx_reg`, `cnt_tx_miner`, `cnt_tx_issue`, `cnt_tx_invocation`, `cnt_tx_contract`, `cnt_tx_claim`, `cnt_tx_publish`, `cnt_tx_enrollment`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 
-	_, err := db.Exec(query,
+	_, err := execute(store.db, query,
 		c.ID,
 		c.LastBlockIndex,
 		c.LastTxPk,
@@ -66,7 +68,8 @@ func initCounterInstance() Counter {
 		c.AppLogIdx,
 		c.LastTxPkForSC,
 		c.Nep5TxPkForAddrTx,
-		c.LastTxPkGasBalacne,
+		c.LastTxPkBalance,
+		c.Nep5TxPkForBalance,
 		c.CntAddr,
 		c.CntTxReg,
 		c.CntTxMiner,
@@ -84,11 +87,11 @@ func initCounterInstance() Counter {
 	return c
 }
 
-func getCounterInstance() Counter {
-	const query = "SELECT `id`, `last_block_index`, `last_tx_pk`, `last_asset_tx_pk`, `last_tx_pk_for_nep5`, `app_log_idx`, `last_tx_pk_for_sc`, `nep5_tx_pk_for_addr_tx`, `last_tx_pk_gas_balance` FROM `counter` WHERE `id` = 1 LIMIT 1"
+func (store *SQLStore) getCounterInstance() Counter {
+	const query = "SELECT `id`, `last_block_index`, `last_tx_pk`, `last_asset_tx_pk`, `last_tx_pk_for_nep5`, `app_log_idx`, `last_tx_pk_for_sc`, `nep5_tx_pk_for_addr_tx`, `last_tx_pk_balance`, `nep5_tx_pk_for_balance` FROM `counter` WHERE `id` = 1 LIMIT 1"
 
 	var counter Counter
-	err := db.QueryRow(query).Scan(
+	err := store.db.QueryRow(query).Scan(
 		&counter.ID,
 		&counter.LastBlockIndex,
 		&counter.LastTxPk,
@@ -97,35 +100,36 @@ func getCounterInstance() Counter {
 		&counter.AppLogIdx,
 		&counter.LastTxPkForSC,
 		&counter.Nep5TxPkForAddrTx,
-		&counter.LastTxPkGasBalacne,
+		&counter.LastTxPkBalance,
+		&counter.Nep5TxPkForBalance,
 	)
 	switch err {
 	case sql.ErrNoRows:
-		return initCounterInstance()
+		return store.initCounterInstance()
 	case nil:
 		return counter
 	default:
-		reconnect()
-		return getCounterInstance()
+		store.reconnect()
+		return store.getCounterInstance()
 	}
 }
 
 // GetLastTxPkCounter returns the last resolved pk of transaction in counter.
-func GetLastTxPkCounter() uint {
-	counter := getCounterInstance()
+func (store *SQLStore) GetLastTxPkCounter() uint {
+	counter := store.getCounterInstance()
 	return counter.LastTxPk
 }
 
 // GetLastAssetTxPkCounter returns the last resolved pk of asset transaction in counter.
-func GetLastAssetTxPkCounter() uint {
-	counter := getCounterInstance()
+func (store *SQLStore) GetLastAssetTxPkCounter() uint {
+	counter := store.getCounterInstance()
 	return counter.LastAssetTxPk
 }
 
 func updateCounter(tx *sql.Tx, key string, value int64) error {
 	sql := fmt.Sprintf("UPDATE `counter` SET %s = %d WHERE `id`=1", key, value)
 
-	_, err := tx.Exec(sql)
+	_, err := execute(tx, sql)
 	return err
 }
 
@@ -153,63 +157,69 @@ func updateTxCounter(trans *sql.Tx, txType int, cnt int) error {
 		panic("Unknown transaction type when updating counter of tx types")
 	}
 
-	_, err := trans.Exec(query, cnt)
+	_, err := execute(trans, query, cnt)
 	return err
 }
 
 func incrAddrCounter(trans *sql.Tx, delta int) error {
 	query := "UPDATE `counter` SET `cnt_addr` = `cnt_addr` + ? WHERE `id` = 1 LIMIT 1"
-	_, err := trans.Exec(query, delta)
+	_, err := execute(trans, query, delta)
 	return err
 }
 
 func updateNep5Counter(tx *sql.Tx, lastTxPkForNep5 uint, appLogIdx int) error {
 	const sql = "UPDATE `counter` SET `last_tx_pk_for_nep5` = ?, `app_log_idx` = ? WHERE `id` = 1 LIMIT 1"
-	_, err := tx.Exec(sql, lastTxPkForNep5, appLogIdx)
+	_, err := execute(tx, sql, lastTxPkForNep5, appLogIdx)
 	return err
 }
 
 // UpdateNep5TxPkForAddrTx updates last pk of handled nep5 tx records.
 func UpdateNep5TxPkForAddrTx(tx *sql.Tx, pk uint) error {
 	const query = "UPDATE `counter` SET `nep5_tx_pk_for_addr_tx` = ? WHERE `id` = 1 LIMIT 1"
-	_, err := tx.Exec(query, pk)
+	_, err := execute(tx, query, pk)
 	return err
 }
 
 // UpdateLastTxPkForSC updates counter info of last processed sc transactions.
-func UpdateLastTxPkForSC(currentTxPk uint) error {
+func (store *SQLStore) UpdateLastTxPkForSC(currentTxPk uint) error {
 	const updateCounterSQL = "UPDATE `counter` SET `last_tx_pk_for_sc` = ? WHERE `id` = 1 LIMIT 1"
-	_, err := db.Exec(updateCounterSQL, currentTxPk)
+	_, err := execute(store.db, updateCounterSQL, currentTxPk)
 	return err
 }
 
 // GetLastTxPkForNep5 returns counter info of last processed nep5 transactions.
-func GetLastTxPkForNep5() (uint, int) {
-	counter := getCounterInstance()
+func (store *SQLStore) GetLastTxPkForNep5() (uint, int) {
+	counter := store.getCounterInstance()
 	return counter.LastTxPkForNep5, counter.AppLogIdx
 }
 
 // UpdateLastTxPkForNep5 updates counter info of last processed nep5 transactions.
-func UpdateLastTxPkForNep5(currentTxPk uint, applogIdx int) error {
+func (store *SQLStore) UpdateLastTxPkForNep5(currentTxPk uint, applogIdx int) error {
 	const updateCounterSQL = "UPDATE `counter` SET `last_tx_pk_for_nep5` = ?, `app_log_idx` = ? WHERE `id` = 1 LIMIT 1"
-	_, err := db.Exec(updateCounterSQL, currentTxPk, applogIdx)
+	_, err := execute(store.db, updateCounterSQL, currentTxPk, applogIdx)
 	return err
 }
 
-// GetLastTxPkForGasBalance returns the last resolved pk of gas balance task.
-func GetLastTxPkForGasBalance() uint {
-	counter := getCounterInstance()
-	return counter.LastTxPkGasBalacne
+// GetLastTxPkForBalance returns the last pk of transactions applied to balance history.
+func (store *SQLStore) GetLastTxPkForBalance() uint {
+	counter := store.getCounterInstance()
+	return counter.LastTxPkBalance
+}
+
+// GetNep5TxPkForBalance returns the last pk of nep5 tx records applied to balance history.
+func (store *SQLStore) GetNep5TxPkForBalance() uint {
+	counter := store.getCounterInstance()
+	return counter.Nep5TxPkForBalance
 }
 
 // GetNep5TxPkForAddrTx returns last pk of handled nep5 tx records.
-func GetNep5TxPkForAddrTx() uint {
-	counter := getCounterInstance()
+func (store *SQLStore) GetNep5TxPkForAddrTx() uint {
+	counter := store.getCounterInstance()
 	return counter.Nep5TxPkForAddrTx
 }
 
 // GetLastTxPkForSC returns counter info of last processed sc transactions.
-func GetLastTxPkForSC() uint {
-	counter := getCounterInstance()
+func (store *SQLStore) GetLastTxPkForSC() uint {
+	counter := store.getCounterInstance()
 	return counter.LastTxPkForSC
 }
\ No newline at end of file
@@ -0,0 +1,344 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"math/big"
+	"neo_explorer/core/util"
+	"time"
+)
+
+// DaySeconds is the length of a day in daily stats.
+const DaySeconds = 86400
+
+// txTypeColumns maps transaction types to their columns in `daily_stats`,
+// other types are only counted in `txs`.
+var txTypeColumns = []struct{ txType, column string }{
+	{"RegisterTransaction", "cnt_tx_reg"},
+	{"MinerTransaction", "cnt_tx_miner"},
+	{"IssueTransaction", "cnt_tx_issue"},
+	{"InvocationTransaction", "cnt_tx_invocation"},
+	{"ContractTransaction", "cnt_tx_contract"},
+	{"ClaimTransaction", "cnt_tx_claim"},
+	{"PublishTransaction", "cnt_tx_publish"},
+	{"EnrollmentTransaction", "cnt_tx_enrollment"},
+}
+
+// DailyStats is the network statistics of a UTC day, data before EndTime is aggregated.
+type DailyStats struct {
+	DayTime          int64             `json:"day_time"`
+	EndTime          int64             `json:"end_time"`
+	Complete         bool              `json:"complete"`
+	Blocks           uint64            `json:"blocks"`
+	AvgBlockInterval string            `json:"avg_block_interval"`
+	Txs              uint64            `json:"txs"`
+	TxTypes          map[string]uint64 `json:"tx_types"`
+	SysFee           string            `json:"sys_fee"`
+	NetFee           string            `json:"net_fee"`
+	ActiveAddrs      uint64            `json:"active_addrs"`
+	NewAddrs         uint64            `json:"new_addrs"`
+	Nep5Transfers    uint64            `json:"nep5_transfers"`
+	// AssetValues is the total value of utxo outputs of every asset, keyed by asset id.
+	AssetValues map[string]string `json:"asset_values"`
+	UpdatedAt   int64             `json:"updated_at"`
+}
+
+// DayStart returns the start of the UTC day of the unix time.
+func DayStart(t int64) int64 {
+	return t - t%DaySeconds
+}
+
+// GetDailyStatsReadyTime returns the time before which blocks are stored and their transactions
+// have been handled by the tx, nep5 and nep5_addr_tx tasks. It is 0 if there is no block.
+func (store *SQLStore) GetDailyStatsReadyTime() (int64, error) {
+	c := store.getCounterInstance()
+	if c.LastBlockIndex < 0 {
+		return 0, nil
+	}
+
+	var ready int64
+	if err := store.db.QueryRow("SELECT `time` FROM `block` WHERE `index` = ? LIMIT 1", c.LastBlockIndex).Scan(&ready); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+	ready++
+
+	// The tx being handled by the nep5 task has partially stored transfers if applogIdx is not -1.
+	nep5Pk := c.LastTxPkForNep5
+	if c.AppLogIdx == -1 {
+		nep5Pk++
+	}
+
+	pending := []struct {
+		query string
+		arg   uint
+	}{
+		{"SELECT `block_time` FROM `tx` WHERE `id` > ? ORDER BY `id` ASC LIMIT 1", c.LastTxPk},
+		{"SELECT `block_time` FROM `tx` WHERE `id` >= ? AND `type` = 'InvocationTransaction' ORDER BY `id` ASC LIMIT 1", nep5Pk},
+		{"SELECT `block_time` FROM `nep5_tx` WHERE `id` > ? ORDER BY `id` ASC LIMIT 1", c.Nep5TxPkForAddrTx},
+	}
+	for _, p := range pending {
+		var t int64
+		err := store.db.QueryRow(p.query, p.arg).Scan(&t)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t < ready {
+			ready = t
+		}
+	}
+
+	return ready, nil
+}
+
+// GetNextDailyStatsDay returns the start of the first day whose stats should be aggregated,
+// which is the last aggregated day since it may be incomplete, or the day of the genesis block.
+// It returns false if there is no block.
+func (store *SQLStore) GetNextDailyStatsDay() (int64, bool, error) {
+	var last sql.NullInt64
+	if err := store.db.QueryRow("SELECT MAX(`day_time`) FROM `daily_stats`").Scan(&last); err != nil {
+		return 0, false, err
+	}
+	if last.Valid {
+		return last.Int64, true, nil
+	}
+
+	var first sql.NullInt64
+	if err := store.db.QueryRow("SELECT MIN(`time`) FROM `block`").Scan(&first); err != nil {
+		return 0, false, err
+	}
+	if !first.Valid {
+		return 0, false, nil
+	}
+
+	return DayStart(first.Int64), true, nil
+}
+
+// UpdateDailyStats aggregates stats of the day starting at dayTime from data before endTime,
+// and replaces the stored ones.
+func (store *SQLStore) UpdateDailyStats(dayTime int64, endTime int64) (*DailyStats, error) {
+	s := &DailyStats{
+		DayTime:     dayTime,
+		EndTime:     endTime,
+		Complete:    endTime >= dayTime+DaySeconds,
+		TxTypes:     make(map[string]uint64),
+		AssetValues: make(map[string]string),
+		UpdatedAt:   time.Now().Unix(),
+	}
+	sysFee := new(big.Float)
+	netFee := new(big.Float)
+	assetValues := make(map[uint]*big.Float)
+	assetNames := make(map[uint]string)
+
+	var minIndex, maxIndex, minTime, maxTime sql.NullInt64
+	const blockQuery = "SELECT COUNT(`id`), MIN(`index`), MAX(`index`), MIN(`time`), MAX(`time`) FROM `block` WHERE `time` >= ? AND `time` < ?"
+	if err := store.db.QueryRow(blockQuery, dayTime, endTime).Scan(&s.Blocks, &minIndex, &maxIndex, &minTime, &maxTime); err != nil {
+		return nil, err
+	}
+
+	interval := 0.0
+	if s.Blocks > 0 {
+		// The interval of the first block of the day counts from the last block of the previous day.
+		var prevTime int64
+		err := store.db.QueryRow("SELECT `time` FROM `block` WHERE `index` = ? LIMIT 1", minIndex.Int64-1).Scan(&prevTime)
+		switch {
+		case err == nil:
+			interval = float64(maxTime.Int64-prevTime) / float64(s.Blocks)
+		case err == sql.ErrNoRows && s.Blocks > 1:
+			interval = float64(maxTime.Int64-minTime.Int64) / float64(s.Blocks-1)
+		case err != sql.ErrNoRows:
+			return nil, err
+		}
+
+		const txQuery = "SELECT `type`, COUNT(`id`), COALESCE(SUM(`sys_fee`), 0), COALESCE(SUM(`net_fee`), 0) FROM `tx` WHERE `block_index` BETWEEN ? AND ? GROUP BY `type`"
+		err = store.scanRows(func(rows *sql.Rows) error {
+			var txType, sysFeeStr, netFeeStr string
+			var cnt uint64
+			if err := rows.Scan(&txType, &cnt, &sysFeeStr, &netFeeStr); err != nil {
+				return err
+			}
+
+			s.Txs += cnt
+			s.TxTypes[txType] = cnt
+			sysFee.Add(sysFee, util.StrToBigFloat(sysFeeStr))
+			netFee.Add(netFee, util.StrToBigFloat(netFeeStr))
+			return nil
+		}, txQuery, minIndex.Int64, maxIndex.Int64)
+		if err != nil {
+			return nil, err
+		}
+
+		var minPk, maxPk sql.NullInt64
+		const pkQuery = "SELECT MIN(`id`), MAX(`id`) FROM `tx` WHERE `block_index` BETWEEN ? AND ?"
+		if err := store.db.QueryRow(pkQuery, minIndex.Int64, maxIndex.Int64).Scan(&minPk, &maxPk); err != nil {
+			return nil, err
+		}
+
+		if minPk.Valid {
+			const activeQuery = "SELECT COUNT(DISTINCT `address_id`) FROM `addr_tx` WHERE `tx_id` BETWEEN ? AND ?"
+			if err := store.db.QueryRow(activeQuery, minPk.Int64, maxPk.Int64).Scan(&s.ActiveAddrs); err != nil {
+				return nil, err
+			}
+
+			const nep5Query = "SELECT COUNT(`id`) FROM `nep5_tx` WHERE `tx_id` BETWEEN ? AND ?"
+			if err := store.db.QueryRow(nep5Query, minPk.Int64, maxPk.Int64).Scan(&s.Nep5Transfers); err != nil {
+				return nil, err
+			}
+
+			const valueQuery = "SELECT `tx_vout`.`asset_id`, `asset`.`asset_id`, COALESCE(SUM(`tx_vout`.`value`), 0) FROM `tx_vout` INNER JOIN `asset` ON `asset`.`id` = `tx_vout`.`asset_id` WHERE `tx_vout`.`tx_id` BETWEEN ? AND ? GROUP BY `tx_vout`.`asset_id`, `asset`.`asset_id`"
+			err := store.scanRows(func(rows *sql.Rows) error {
+				var assetId uint
+				var name, valueStr string
+				if err := rows.Scan(&assetId, &name, &valueStr); err != nil {
+					return err
+				}
+
+				assetValues[assetId] = util.StrToBigFloat(valueStr)
+				assetNames[assetId] = name
+				return nil
+			}, valueQuery, minPk.Int64, maxPk.Int64)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	const newAddrQuery = "SELECT COUNT(`id`) FROM `address` WHERE `created_at` >= ? AND `created_at` < ?"
+	if err := store.db.QueryRow(newAddrQuery, dayTime, endTime).Scan(&s.NewAddrs); err != nil {
+		return nil, err
+	}
+
+	s.AvgBlockInterval = big.NewFloat(math.Round(interval*1000)/1000).Text('f', 3)
+	s.SysFee = sysFee.Text('f', 8)
+	s.NetFee = netFee.Text('f', 8)
+
+	err := store.transact(func(trans *sql.Tx) error {
+		if _, err := execute(trans, "DELETE FROM `daily_asset_stats` WHERE `day_time` = ?", dayTime); err != nil {
+			return err
+		}
+		if _, err := execute(trans, "DELETE FROM `daily_stats` WHERE `day_time` = ?", dayTime); err != nil {
+			return err
+		}
+
+		for assetId, value := range assetValues {
+			const insert = "INSERT INTO `daily_asset_stats` (`day_time`, `asset_id`, `value`) VALUES (?, ?, ?)"
+			if _, err := execute(trans, insert, dayTime, assetId, value.Text('f', 8)); err != nil {
+				return err
+			}
+		}
+
+		query := "INSERT INTO `daily_stats` (`day_time`, `end_time`, `blocks`, `avg_block_interval`, `txs`, "
+		values := "VALUES (?, ?, ?, ?, ?, "
+		args := []interface{}{dayTime, endTime, s.Blocks, s.AvgBlockInterval, s.Txs}
+		for _, c := range txTypeColumns {
+			query += "`" + c.column + "`, "
+			values += "?, "
+			args = append(args, s.TxTypes[c.txType])
+		}
+		query += "`sys_fee`, `net_fee`, `active_addrs`, `new_addrs`, `nep5_transfers`, `updated_at`) "
+		values += "?, ?, ?, ?, ?, ?)"
+		args = append(args, s.SysFee, s.NetFee, s.ActiveAddrs, s.NewAddrs, s.Nep5Transfers, s.UpdatedAt)
+
+		_, err := execute(trans, query+values, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for assetId, value := range assetValues {
+		s.AssetValues[assetNames[assetId]] = value.Text('f', 8)
+	}
+
+	return s, nil
+}
+
+// GetDailyStats returns paged stats of days in [from, to] in ascending order of days, to is unlimited if 0.
+func (store *SQLStore) GetDailyStats(from int64, to int64, limit int, offset int) ([]*DailyStats, uint64, error) {
+	if to == 0 {
+		to = math.MaxInt64
+	}
+
+	var total uint64
+	const countQuery = "SELECT COUNT(`id`) FROM `daily_stats` WHERE `day_time` BETWEEN ? AND ?"
+	if err := store.db.QueryRow(countQuery, from, to).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT `day_time`, `end_time`, `blocks`, `avg_block_interval`, `txs`, "
+	for _, c := range txTypeColumns {
+		query += "`" + c.column + "`, "
+	}
+	query += "`sys_fee`, `net_fee`, `active_addrs`, `new_addrs`, `nep5_transfers`, `updated_at` FROM `daily_stats` WHERE `day_time` BETWEEN ? AND ? ORDER BY `day_time` ASC LIMIT ? OFFSET ?"
+
+	stats := []*DailyStats{}
+	byDay := make(map[int64]*DailyStats)
+	err := store.scanRows(func(rows *sql.Rows) error {
+		s := &DailyStats{TxTypes: make(map[string]uint64), AssetValues: make(map[string]string)}
+		var intervalStr, sysFeeStr, netFeeStr string
+		txTypes := make([]uint64, len(txTypeColumns))
+
+		dest := []interface{}{&s.DayTime, &s.EndTime, &s.Blocks, &intervalStr, &s.Txs}
+		for i := range txTypes {
+			dest = append(dest, &txTypes[i])
+		}
+		dest = append(dest, &sysFeeStr, &netFeeStr, &s.ActiveAddrs, &s.NewAddrs, &s.Nep5Transfers, &s.UpdatedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		s.Complete = s.EndTime >= s.DayTime+DaySeconds
+		s.AvgBlockInterval = util.StrToBigFloat(intervalStr).Text('f', 3)
+		s.SysFee = util.StrToBigFloat(sysFeeStr).Text('f', 8)
+		s.NetFee = util.StrToBigFloat(netFeeStr).Text('f', 8)
+		for i, c := range txTypeColumns {
+			if txTypes[i] > 0 {
+				s.TxTypes[c.txType] = txTypes[i]
+			}
+		}
+
+		stats = append(stats, s)
+		byDay[s.DayTime] = s
+		return nil
+	}, query, from, to, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(stats) == 0 {
+		return stats, total, nil
+	}
+
+	const valueQuery = "SELECT `daily_asset_stats`.`day_time`, `asset`.`asset_id`, `daily_asset_stats`.`value` FROM `daily_asset_stats` INNER JOIN `asset` ON `asset`.`id` = `daily_asset_stats`.`asset_id` WHERE `daily_asset_stats`.`day_time` BETWEEN ? AND ?"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var dayTime int64
+		var name, valueStr string
+		if err := rows.Scan(&dayTime, &name, &valueStr); err != nil {
+			return err
+		}
+
+		if s, ok := byDay[dayTime]; ok {
+			s.AssetValues[name] = util.StrToBigFloat(valueStr).Text('f', 8)
+		}
+		return nil
+	}, valueQuery, stats[0].DayTime, stats[len(stats)-1].DayTime)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return stats, total, nil
+}
+
+// deleteDailyStats removes stats of days which end after the time, they are aggregated again.
+func deleteDailyStats(trans *sql.Tx, r *RollbackReport, after int64) error {
+	if err := r.exec(trans, "daily_asset_stats", "deleted", "DELETE FROM `daily_asset_stats` WHERE `day_time` > ?", after-DaySeconds); err != nil {
+		return err
+	}
+
+	return r.exec(trans, "daily_stats", "deleted", "DELETE FROM `daily_stats` WHERE `day_time` > ?", after-DaySeconds)
+}
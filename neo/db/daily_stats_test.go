@@ -0,0 +1,102 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestDailyStats(t *testing.T) {
+	store := newTestStore(t)
+
+	// Blocks 0 and 1 are in day 10, block 2 is in day 11.
+	// A mines 10 of asset 1 in block 0 and sends it to B in block 1, C receives a nep5 transfer in block 2.
+	day := int64(10 * DaySeconds)
+	times := []uint64{uint64(day) + 100, uint64(day) + 200, uint64(day+DaySeconds) + 50}
+	blocks := testBlocks(times...)
+	newTx := func(id uint, index uint, txType string, sysFee float64, netFee float64) *tx.Transaction {
+		trans := testTx(id, blocks[index], txType)
+		trans.SysFee, trans.NetFee = big.NewFloat(sysFee), big.NewFloat(netFee)
+		return trans
+	}
+	bulk := &tx.Bulk{
+		TXs:    []*tx.Transaction{newTx(1, 0, "MinerTransaction", 0, 0), newTx(2, 1, "ContractTransaction", 1, 0.5), newTx(3, 2, "InvocationTransaction", 0, 0)},
+		TXVins: []*tx.TransactionVin{{TxId: 2, TxID: 1, Vout: 0}},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "StatsAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "StatsAddrB", AddressId: 2},
+		},
+		Assets: []*asset.Asset{
+			{AssetID: "0xasset", Type: "Token", Name: "Token", Amount: big.NewFloat(100), Available: big.NewFloat(100), Precision: 8},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	execQueries(t, store,
+		fmt.Sprintf("INSERT INTO `address` (`address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES ('StatsAddrA', %d, 0, 2, 0), ('StatsAddrB', %d, 0, 1, 0), ('StatsAddrC', %d, 0, 0, 1)", times[0], times[1], times[2]),
+		fmt.Sprintf("INSERT INTO `addr_tx` (`tx_id`, `address_id`, `block_time`, `asset_type`) VALUES (1, 1, %d, 'asset'), (2, 1, %d, 'asset'), (2, 2, %d, 'asset'), (3, 3, %d, 'nep5')", times[0], times[1], times[1], times[2]),
+		fmt.Sprintf("INSERT INTO `nep5_tx` (`tx_id`, `asset_id`, `from`, `to`, `value`, `block_index`, `block_time`) VALUES (3, 5, '', 'StatsAddrC', 1, 2, %d)", times[2]),
+		"UPDATE `counter` SET `last_tx_pk` = 1, `last_tx_pk_for_nep5` = 3, `app_log_idx` = -1, `nep5_tx_pk_for_addr_tx` = 1 WHERE `id` = 1",
+	)
+
+	// Data is ready before the first transaction not handled by the tx task.
+	if ready, err := store.GetDailyStatsReadyTime(); err != nil || ready != int64(times[1]) {
+		t.Errorf("GetDailyStatsReadyTime() = %d, %v, want %d", ready, err, times[1])
+	}
+	if _, err := store.db.Exec("UPDATE `counter` SET `last_tx_pk` = 3 WHERE `id` = 1"); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := store.GetDailyStatsReadyTime()
+	if err != nil || ready != int64(times[2])+1 {
+		t.Errorf("GetDailyStatsReadyTime() = %d, %v, want %d", ready, err, times[2]+1)
+	}
+
+	next, ok, err := store.GetNextDailyStatsDay()
+	if err != nil || !ok || next != day {
+		t.Fatalf("GetNextDailyStatsDay() = %d, %v, %v, want %d", next, ok, err, day)
+	}
+
+	for _, end := range []int64{day + DaySeconds, ready} {
+		if _, err := store.UpdateDailyStats(DayStart(end-1), end); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Aggregating a day again replaces its stats.
+	if _, err := store.UpdateDailyStats(day, day+DaySeconds); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(from int64, want ...string) {
+		t.Helper()
+
+		stats, total, err := store.GetDailyStats(from, 0, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != uint64(len(want)) || len(stats) != len(want) {
+			t.Fatalf("GetDailyStats(%d) returned %d of %d days, want %d", from, len(stats), total, len(want))
+		}
+		for i, s := range stats {
+			got := fmt.Sprintf("%d %v %d %s %d %v %s %s %d %d %d %v", s.DayTime, s.Complete, s.Blocks, s.AvgBlockInterval, s.Txs, s.TxTypes, s.SysFee, s.NetFee, s.ActiveAddrs, s.NewAddrs, s.Nep5Transfers, s.AssetValues)
+			if got != want[i] {
+				t.Errorf("stats of day %d = %s, want %s", s.DayTime, got, want[i])
+			}
+		}
+	}
+
+	day10 := fmt.Sprintf("%d true 2 100.000 2 map[ContractTransaction:1 MinerTransaction:1] 1.00000000 0.50000000 2 2 0 map[0xasset:20.00000000]", day)
+	day11 := fmt.Sprintf("%d false 1 86250.000 1 map[InvocationTransaction:1] 0.00000000 0.00000000 1 1 1 map[]", day+DaySeconds)
+	check(0, day10, day11)
+	check(day+DaySeconds, day11)
+
+	// Stats of days of rolled back blocks are removed.
+	if _, err := store.RollbackBlocks(2); err != nil {
+		t.Fatal(err)
+	}
+	check(0, day10)
+	if next, _, err := store.GetNextDailyStatsDay(); err != nil || next != day {
+		t.Errorf("GetNextDailyStatsDay() = %d, %v after rollback, want %d", next, err, day)
+	}
+}
@@ -3,46 +3,61 @@ package db
 import (
 	"database/sql"
 	"github.com/go-sql-driver/mysql"
-	"neo_explorer/core/config"
 	"neo_explorer/core/log"
 	"strings"
 	"sync/atomic"
 	"time"
 )
 
-var (
-	db     *sql.DB
-	locker uint32
-)
+var mysqlDialect = &dialect{
+	name: "mysql",
+	open: func(dsn string) (*sql.DB, error) {
+		return sql.Open("mysql", dsn)
+	},
+	isConnErr: func(err error) bool {
+		return err == mysql.ErrInvalidConn ||
+			strings.HasSuffix(err.Error(), "operation timed out") ||
+			strings.HasSuffix(err.Error(), "Server shutdown in progress") ||
+			strings.HasPrefix(err.Error(), "Error 1290")
+	},
+}
 
-func Init() {
+func (store *SQLStore) connect(d *dialect, dsn string) {
 	var err error
-	db, err = sql.Open("mysql", config.GetDbConnStr())
+	store.db, err = d.open(dsn)
 	if err != nil {
 		panic(err)
 	}
+
+	store.dialect = d
+	store.dsn = dsn
 }
 
-func reconnect() {
-	if !atomic.CompareAndSwapUint32(&locker, 0, 1) {
+func (store *SQLStore) reconnect() {
+	if !atomic.CompareAndSwapUint32(&store.locker, 0, 1) {
 		for {
 			// Lock was held by others, wait till lock released.
 			time.Sleep(20 * time.Millisecond)
 			// Lock was released.
-			if atomic.LoadUint32(&locker) != 1 {
+			if atomic.LoadUint32(&store.locker) != 1 {
 				return
 			}
 		}
 	}
 
-	defer atomic.StoreUint32(&locker, 0)
+	defer atomic.StoreUint32(&store.locker, 0)
 
 	for {
 		log.Printf("Try Reconnecting to database...")
-		db, _ = sql.Open("mysql", config.GetDbConnStr())
-
-		if err := db.Ping(); err == nil {
-			return
+		db, err := store.dialect.open(store.dsn)
+		if err == nil {
+			if err = db.Ping(); err == nil {
+				// Connections of the replaced pool in use are closed once released.
+				store.db.Close()
+				store.db = db
+				return
+			}
+			db.Close()
 		}
 
 		log.Printf("Wait for few seconds to reconnect again")
@@ -50,69 +65,93 @@ func reconnect() {
 	}
 }
 
-func wrappedQuery(query string, args ...interface{}) (*sql.Rows, error) {
+func (store *SQLStore) wrappedQuery(query string, args ...interface{}) (*sql.Rows, error) {
 	for {
-		rows, err := db.Query(query, args...)
+		rows, err := store.db.Query(query, args...)
 		if err == nil {
 			return rows, err
 		}
 
-		if !connErr(err) {
-			rows.Close()
+		if store.retryable(err) {
+			continue
+		}
+		if !store.connErr(err) {
 			return nil, err
 		}
 
-		reconnect()
+		store.reconnect()
 	}
 }
 
-func transact(txFunc func(*sql.Tx) error) (err error) {
-	tx, err := db.Begin()
-	if err != nil {
-		if !connErr(err) {
+// transact runs txFunc in a transaction, which is run again if it failed
+// with a retryable error, or with a connection error after reconnecting.
+func (store *SQLStore) transact(txFunc func(*sql.Tx) error) error {
+	for {
+		if retry, err := store.tryTransact(txFunc); !retry {
 			return err
 		}
+	}
+}
 
-		reconnect()
-		return transact(txFunc)
+// tryTransact runs txFunc in a transaction once and returns true if it should be run again.
+func (store *SQLStore) tryTransact(txFunc func(*sql.Tx) error) (retry bool, err error) {
+	start := time.Now()
+	tx, err := store.db.Begin()
+	if err != nil {
+		return store.shouldRetry(err), err
 	}
 
+	defer transactionDuration.ObserveSince(start)
 	defer func() {
 		if p := recover(); p != nil {
 			tx.Rollback()
 			panic(p)
 		} else if err != nil {
 			tx.Rollback()
+			retry = store.shouldRetry(err)
 		} else {
 			err = tx.Commit()
 			if err != nil {
 				log.Error.Println(err)
+				// The transaction may have been committed before a connection error.
+				retry = store.retryable(err)
 			}
 		}
 	}()
 
-	err = txFunc(tx)
-	if err == nil || !connErr(err) {
-		return err
+	return false, txFunc(tx)
+}
+
+// shouldRetry returns true if the transaction failed with err should be run again,
+// it reconnects to the database first on connection errors.
+func (store *SQLStore) shouldRetry(err error) bool {
+	if store.retryable(err) {
+		return true
+	}
+	if !store.connErr(err) {
+		return false
 	}
 
-	reconnect()
-	return transact(txFunc)
+	store.reconnect()
+	return true
 }
 
-func connErr(err error) bool {
-	if err == nil {
+// retryable returns true if the statement or transaction failed with err can be run again at once.
+func (store *SQLStore) retryable(err error) bool {
+	if store.dialect.isRetryable == nil || !store.dialect.isRetryable(err) {
 		return false
 	}
 
-	log.Println(err)
+	log.Printf("Retrying after %v\n", err)
+	return true
+}
 
-	if err == mysql.ErrInvalidConn ||
-		strings.HasSuffix(err.Error(), "operation timed out") ||
-		strings.HasSuffix(err.Error(), "Server shutdown in progress") ||
-		strings.HasPrefix(err.Error(), "Error 1290") {
-		return true
+func (store *SQLStore) connErr(err error) bool {
+	if err == nil {
+		return false
 	}
 
-	return false
+	log.Println(err)
+
+	return store.dialect.isConnErr(err)
 }
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestTransactRetries(t *testing.T) {
+	store := newTestStore(t)
+	execQueries(t, store, "CREATE TABLE retried (v int)")
+
+	deadlock := errors.New("deadlock detected")
+	d := *store.dialect
+	d.isRetryable = func(err error) bool { return err == deadlock }
+	store.dialect = &d
+	pool := store.db
+
+	attempts := 0
+	err := store.transact(func(trans *sql.Tx) error {
+		attempts++
+		if _, err := trans.Exec("INSERT INTO `retried` (`v`) VALUES (?)", attempts); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			return deadlock
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("transact = %v after %d attempts, want nil after 2", err, attempts)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `retried` WHERE `v` = 1"); n != 0 {
+		t.Error("first attempt not rolled back")
+	}
+	if store.db != pool {
+		t.Error("retryable error reconnected to the database")
+	}
+
+	failed := errors.New("constraint violated")
+	if err := store.transact(func(*sql.Tx) error { return failed }); err != failed {
+		t.Errorf("transact = %v, want %v", err, failed)
+	}
+}
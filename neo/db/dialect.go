@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+)
+
+// dialect describes how sql of this package, which is written for MySQL,
+// runs on a database.
+type dialect struct {
+	name string
+	// open opens a database handle with dsn.
+	open func(dsn string) (*sql.DB, error)
+	// isConnErr returns true if operations failed with err should be retried after reconnecting.
+	isConnErr func(err error) bool
+	// isRetryable returns true if operations failed with err can be retried at once on the same connections,
+	// e.g. after deadlocks. It may be nil.
+	isRetryable func(err error) bool
+}
+
+// rewrite translates MySQL flavored sql of this package for other databases:
+// backtick quoted identifiers are quoted with quote,
+// `LIMIT 1` of UPDATE and DELETE statements is removed,
+// and `ON DUPLICATE KEY UPDATE`, which is only used to skip duplicated rows, becomes `ON CONFLICT DO NOTHING`.
+// Placeholders are numbered as $1, $2... if numbered is true.
+func rewrite(query string, quote byte, numbered bool) string {
+	var b strings.Builder
+	var stmt strings.Builder
+	// tail is the position in stmt after its last string literal.
+	tail := 0
+	n := 0
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		switch c {
+		case '\'', '"':
+			// Copy string literal as is.
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] == '\\' {
+					j++
+					continue
+				}
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+
+			stmt.WriteString(query[i : j+1])
+			i = j
+			tail = stmt.Len()
+		case '`':
+			stmt.WriteByte(quote)
+		case '?':
+			if !numbered {
+				stmt.WriteByte(c)
+				break
+			}
+			n++
+			stmt.WriteString("$" + strconv.Itoa(n))
+		case ';':
+			b.WriteString(rewriteStatement(stmt.String(), tail))
+			b.WriteByte(c)
+			stmt.Reset()
+			tail = 0
+		default:
+			stmt.WriteByte(c)
+		}
+	}
+
+	b.WriteString(rewriteStatement(stmt.String(), tail))
+	return b.String()
+}
+
+// rewriteStatement rewrites clauses after the last string literal of a single statement.
+func rewriteStatement(stmt string, tail int) string {
+	head, rest := stmt[:tail], stmt[tail:]
+
+	if i := strings.Index(strings.ToUpper(rest), "ON DUPLICATE KEY UPDATE"); i >= 0 {
+		rest = rest[:i] + "ON CONFLICT DO NOTHING"
+	}
+
+	verb := strings.ToUpper(strings.TrimSpace(stmt))
+	if strings.HasPrefix(verb, "UPDATE") || strings.HasPrefix(verb, "DELETE") {
+		trimmed := strings.TrimRight(rest, " \t\n")
+		if strings.HasSuffix(strings.ToUpper(trimmed), " LIMIT 1") {
+			rest = trimmed[:len(trimmed)-len(" LIMIT 1")]
+		}
+	}
+
+	return head + rest
+}
+
+// rewriteConnector opens connections which rewrite every query before running it.
+type rewriteConnector struct {
+	driver  driver.Driver
+	dsn     string
+	rewrite func(query string) string
+}
+
+func (c *rewriteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rewriteConn{Conn: conn, rewrite: c.rewrite}, nil
+}
+
+func (c *rewriteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type rewriteConn struct {
+	driver.Conn
+	rewrite func(query string) string
+}
+
+func (c *rewriteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.rewrite(query))
+}
+
+func (c *rewriteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, c.rewrite(query))
+	}
+
+	return c.Prepare(query)
+}
+
+func (c *rewriteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, c.rewrite(query), args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (c *rewriteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, c.rewrite(query), args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (c *rewriteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+
+	return c.Conn.Begin()
+}
+
+func (c *rewriteConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (c *rewriteConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+func (c *rewriteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
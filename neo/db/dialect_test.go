@@ -0,0 +1,44 @@
+package db
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		query    string
+		quote    byte
+		numbered bool
+		want     string
+	}{
+		{
+			query: "UPDATE `counter` SET `cnt_addr` = `cnt_addr` + ? WHERE `id` = 1 LIMIT 1",
+			quote: '"', numbered: true,
+			want: `UPDATE "counter" SET "cnt_addr" = "cnt_addr" + $1 WHERE "id" = 1`,
+		},
+		{
+			query: "SELECT `id` FROM `tx` WHERE `txid` = ? LIMIT 1",
+			quote: '`',
+			want:  "SELECT `id` FROM `tx` WHERE `txid` = ? LIMIT 1",
+		},
+		{
+			query: "UPDATE `nep5` SET `transfers` = `transfers` + 1 WHERE `asset_id` = '1' LIMIT 1;INSERT INTO `nep5_tx` (`from`) VALUES ('a LIMIT 1');",
+			quote: '`',
+			want:  "UPDATE `nep5` SET `transfers` = `transfers` + 1 WHERE `asset_id` = '1';INSERT INTO `nep5_tx` (`from`) VALUES ('a LIMIT 1');",
+		},
+		{
+			query: "INSERT INTO `addr_tx` (`tx_id`) VALUES ('1'),('2')ON DUPLICATE KEY UPDATE `address_id`=`address_id`",
+			quote: '"',
+			want:  `INSERT INTO "addr_tx" ("tx_id") VALUES ('1'),('2')ON CONFLICT DO NOTHING`,
+		},
+		{
+			query: "INSERT INTO `nep5` (`name`) VALUES ('it''s ? `x`', ?)",
+			quote: '"', numbered: true,
+			want: `INSERT INTO "nep5" ("name") VALUES ('it''s ? ` + "`x`" + `', $1)`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := rewrite(test.query, test.quote, test.numbered); got != test.want {
+			t.Errorf("rewrite(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"neo_explorer/core/metrics"
+	"regexp"
+	"strings"
+)
+
+var (
+	transactionDuration = metrics.NewHistogram("neo_explorer_db_transaction_duration_seconds",
+		"Duration of db transactions, including commit.", metrics.DefBuckets)
+	rowsWritten = metrics.NewCounterVec("neo_explorer_db_rows_written_total",
+		"Rows inserted, updated or deleted by the indexer.", "table", "op")
+)
+
+// writeStmt matches the verb and table of INSERT, UPDATE and DELETE statements.
+var writeStmt = regexp.MustCompile("(?is)^\\s*(insert|update|delete)\\s+(?:ignore\\s+)?(?:into\\s+|from\\s+)?`?(\\w+)`?")
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// execute runs query with e and counts rows it has written.
+func execute(e execer, query string, args ...interface{}) (sql.Result, error) {
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return res, err
+	}
+
+	if m := writeStmt.FindStringSubmatch(query); m != nil {
+		if rows, err := res.RowsAffected(); err == nil && rows > 0 {
+			rowsWritten.With(m[2], strings.ToLower(m[1])).Add(float64(rows))
+		}
+	}
+
+	return res, nil
+}
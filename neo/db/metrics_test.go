@@ -0,0 +1,65 @@
+package db
+
+import (
+	"bytes"
+	"neo_explorer/core/metrics"
+	"strings"
+	"testing"
+)
+
+func TestWriteStmt(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"INSERT INTO `block` (`hash`) VALUES (?)", "insert block"},
+		{"INSERT IGNORE INTO `addr_tx` (`tx_id`) VALUES (?)", "insert addr_tx"},
+		{"\n\tupdate `counter` SET `last_tx_pk` = ?", "update counter"},
+		{"DELETE FROM `utxo` WHERE `tx_id` >= ?", "delete utxo"},
+		{"SELECT * FROM `block`", ""},
+	}
+
+	for _, test := range tests {
+		got := ""
+		if m := writeStmt.FindStringSubmatch(test.query); m != nil {
+			got = strings.ToLower(m[1]) + " " + m[2]
+		}
+		if got != test.want {
+			t.Errorf("writeStmt of %q = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestExecuteCountsRowsWritten(t *testing.T) {
+	store := newTestStore(t)
+
+	// Rows of a table of its own are not counted by other tests.
+	if _, err := store.db.Exec("CREATE TABLE `metrics_test` (`id` INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		"INSERT INTO `metrics_test` (`id`) VALUES (1), (2), (3)",
+		"UPDATE `metrics_test` SET `id` = 4 WHERE `id` > 1",
+		"UPDATE `metrics_test` SET `id` = 5 WHERE `id` > 10",
+		"DELETE FROM `metrics_test` WHERE `id` = 1",
+		"SELECT COUNT(*) FROM `metrics_test`",
+	} {
+		if _, err := execute(store.db, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := metrics.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`neo_explorer_db_rows_written_total{table="metrics_test",op="insert"} 3`,
+		`neo_explorer_db_rows_written_total{table="metrics_test",op="update"} 2`,
+		`neo_explorer_db_rows_written_total{table="metrics_test",op="delete"} 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
@@ -2,45 +2,75 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"neo_explorer/core/cache"
+	"strconv"
+	"strings"
 )
 
 // HandleNEP5Migrate handles nep5 contract migration.
-func HandleNEP5Migrate(newAssetAdmin, oldAssetID, newAssetID string, txPK uint) error {
-	return transact(func(tx *sql.Tx) error {
+func (store *SQLStore) HandleNEP5Migrate(newAssetAdmin, oldAssetID, newAssetID string, txPK uint) error {
+	oldAssetId, err := cache.GetAssetId(oldAssetID)
+	if err != nil {
+		return err
+	}
+	newAssetId, err := cache.GetAssetId(newAssetID)
+	if err != nil {
+		return err
+	}
+
+	return store.transact(func(tx *sql.Tx) error {
 		query := "UPDATE `nep5` SET `visible` = FALSE WHERE `asset_id` = ? LIMIT 1"
-		if _, err := tx.Exec(query, oldAssetID); err != nil {
+		if _, err := execute(tx, query, oldAssetId); err != nil {
 			return err
 		}
 
-		query = "DELETE FROM `addr_asset` WHERE `asset_id` = ? AND `address_id` IN ("
-		query += "SELECT `address_id` FROM (SELECT `address_id` FROM `addr_asset` WHERE asset_id=? AND `address_id` IN ("
-		query += "SELECT `address_id` FROM `addr_asset` WHERE `asset_id` IN (?, ?) GROUP BY `address_id` HAVING COUNT(`asset_id`) = 2))a)"
-		if _, err := tx.Exec(query, newAssetID, newAssetID, oldAssetID, newAssetID); err != nil {
+		// Addresses holding both assets keep balance of the old one.
+		addressIds := []string{}
+		query = "SELECT `address_id` FROM `addr_asset` WHERE `asset_id` IN (?, ?) GROUP BY `address_id` HAVING COUNT(`asset_id`) = 2"
+		err := queryRows(tx, func(rows *sql.Rows) error {
+			var addressId uint
+			if err := rows.Scan(&addressId); err != nil {
+				return err
+			}
+
+			addressIds = append(addressIds, strconv.FormatUint(uint64(addressId), 10))
+			return nil
+		}, query, oldAssetId, newAssetId)
+		if err != nil {
 			return err
 		}
 
+		if len(addressIds) > 0 {
+			query = fmt.Sprintf("DELETE FROM `addr_asset` WHERE `asset_id` = ? AND `address_id` IN (%s)", strings.Join(addressIds, ", "))
+			if _, err := execute(tx, query, newAssetId); err != nil {
+				return err
+			}
+		}
+
 		query = "UPDATE `addr_asset` SET `asset_id` = ? WHERE `asset_id` = ?"
-		if _, err := tx.Exec(query, newAssetID, oldAssetID); err != nil {
+		if _, err := execute(tx, query, newAssetId, oldAssetId); err != nil {
 			return err
 		}
 
-		newAssetAdminId, err2 := GetVoutAddrID(newAssetAdmin)
-		if err2 != nil {
-			panic(err2)
+		newAssetAdminId, err := store.GetVoutAddrID(newAssetAdmin)
+		if err != nil {
+			return err
+		}
+		addrs, holdingAddrs, err := cache.MigrateNEP5(newAssetAdminId, oldAssetID, newAssetID)
+		if err != nil {
+			return err
 		}
-		addrs, holdingAddrs := cache.MigrateNEP5(newAssetAdminId, oldAssetID, newAssetID)
 		query = "UPDATE `nep5` SET `addresses` = ?, `holding_addresses` = ? WHERE `asset_id` = ? LIMIT 1"
-		if _, err := tx.Exec(query, addrs, holdingAddrs, newAssetID); err != nil {
+		if _, err := execute(tx, query, addrs, holdingAddrs, newAssetId); err != nil {
 			return err
 		}
 
 		query = "INSERT INTO `nep5_migrate`(`old_asset_id`, `new_asset_id`, `migrate_tx_id`) VALUES (?, ?, ?)"
-		if _, err := tx.Exec(query, oldAssetID, newAssetID, txPK); err != nil {
+		if _, err := execute(tx, query, oldAssetID, newAssetID, txPK); err != nil {
 			return err
 		}
 
-		err := updateNep5Counter(tx, txPK, -1)
-		return err
+		return updateNep5Counter(tx, txPK, -1)
 	})
 }
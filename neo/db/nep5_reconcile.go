@@ -0,0 +1,197 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/util"
+	"time"
+)
+
+// Nep5Contract is a visible nep5 token with the script of its registration transaction,
+// which its script hash is derived from.
+type Nep5Contract struct {
+	AssetId     uint
+	Symbol      string
+	Decimals    uint8
+	TotalSupply *big.Float
+	TxId        uint
+	Script      string
+}
+
+// Nep5Holder is an address having an addr_asset record of a nep5 token.
+type Nep5Holder struct {
+	AddressId uint
+	Address   string
+	Balance   *big.Float
+}
+
+// Nep5Correction is a balance or total supply changed by reconciliation.
+type Nep5Correction struct {
+	// AddressId is 0 for total supply.
+	AddressId uint
+	Address   string
+	Old       *big.Float
+	New       *big.Float
+}
+
+// Nep5Reconciliation is the result of reconciling one nep5 token with its contract state.
+type Nep5Reconciliation struct {
+	AssetId    uint
+	BlockIndex uint
+	// Corrections lists changed balances and total supply.
+	Corrections []Nep5Correction
+	// Skipped is the number of holders whose balance changed after it was read,
+	// they are reconciled next time.
+	Skipped          int
+	Addresses        uint64
+	HoldingAddresses uint64
+}
+
+// GetNep5Contracts returns all visible nep5 tokens.
+func (store *SQLStore) GetNep5Contracts() ([]*Nep5Contract, error) {
+	contracts := []*Nep5Contract{}
+
+	const query = "SELECT `nep5`.`asset_id`, `nep5`.`symbol`, `nep5`.`decimals`, `nep5`.`total_supply`, `nep5`.`tx_id`, `tx`.`script` FROM `nep5` INNER JOIN `tx` ON `tx`.`id` = `nep5`.`tx_id` WHERE `nep5`.`visible` = TRUE ORDER BY `nep5`.`id` ASC"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		c := &Nep5Contract{}
+		var totalSupplyStr string
+
+		if err := rows.Scan(&c.AssetId, &c.Symbol, &c.Decimals, &totalSupplyStr, &c.TxId, &c.Script); err != nil {
+			return err
+		}
+
+		c.TotalSupply = util.StrToBigFloat(totalSupplyStr)
+		contracts = append(contracts, c)
+		return nil
+	}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return contracts, nil
+}
+
+// GetNep5Holders returns all addresses having addr_asset records of the nep5 token.
+func (store *SQLStore) GetNep5Holders(assetId uint) ([]*Nep5Holder, error) {
+	holders := []*Nep5Holder{}
+
+	const query = "SELECT `addr_asset`.`address_id`, `address`.`address`, `addr_asset`.`balance` FROM `addr_asset` INNER JOIN `address` ON `address`.`id` = `addr_asset`.`address_id` WHERE `addr_asset`.`asset_id` = ? ORDER BY `addr_asset`.`address_id` ASC"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		h := &Nep5Holder{}
+		var balanceStr string
+
+		if err := rows.Scan(&h.AddressId, &h.Address, &balanceStr); err != nil {
+			return err
+		}
+
+		h.Balance = util.StrToBigFloat(balanceStr)
+		holders = append(holders, h)
+		return nil
+	}, query, assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	return holders, nil
+}
+
+// ReconcileNep5 sets balances of holders and total supply of the contract to the values queried
+// from the contract at blockIndex, balances not queried are nil and kept.
+// Values changed since holders and contract were read are kept as well,
+// they were written by nep5 task in the meanwhile.
+// Addresses and holding addresses of the token are recounted, and every correction
+// is recorded in nep5_reconcile, all in one db transaction.
+func (store *SQLStore) ReconcileNep5(contract *Nep5Contract, holders []*Nep5Holder, balances []*big.Float, totalSupply *big.Float, blockIndex uint) (*Nep5Reconciliation, error) {
+	r := &Nep5Reconciliation{}
+	now := time.Now().Unix()
+
+	err := store.transact(func(trans *sql.Tx) error {
+		*r = Nep5Reconciliation{AssetId: contract.AssetId, BlockIndex: blockIndex}
+		corrected := []*Nep5Holder{}
+
+		for i, h := range holders {
+			if balances[i] == nil {
+				continue
+			}
+
+			var balanceStr string
+			const query = "SELECT `balance` FROM `addr_asset` WHERE `address_id` = ? AND `asset_id` = ? LIMIT 1"
+			err := trans.QueryRow(query, h.AddressId, contract.AssetId).Scan(&balanceStr)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !sameAmount(util.StrToBigFloat(balanceStr), h.Balance) {
+				r.Skipped++
+				continue
+			}
+			if sameAmount(h.Balance, balances[i]) {
+				continue
+			}
+
+			update := fmt.Sprintf("UPDATE `addr_asset` SET `balance` = %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' LIMIT 1", balances[i], h.AddressId, contract.AssetId)
+			if _, err := execute(trans, update); err != nil {
+				return err
+			}
+			if err := insertNep5Correction(trans, contract.AssetId, h.AddressId, h.Balance, balances[i], blockIndex, now); err != nil {
+				return err
+			}
+
+			r.Corrections = append(r.Corrections, Nep5Correction{AddressId: h.AddressId, Address: h.Address, Old: h.Balance, New: balances[i]})
+			corrected = append(corrected, &Nep5Holder{AddressId: h.AddressId, Balance: balances[i]})
+		}
+
+		if totalSupply != nil {
+			var totalSupplyStr string
+			const query = "SELECT `total_supply` FROM `nep5` WHERE `asset_id` = ? LIMIT 1"
+			if err := trans.QueryRow(query, contract.AssetId).Scan(&totalSupplyStr); err != nil {
+				return err
+			}
+
+			current := util.StrToBigFloat(totalSupplyStr)
+			if sameAmount(current, contract.TotalSupply) && !sameAmount(current, totalSupply) {
+				if err := UpdateNep5TotalSupply(trans, contract.AssetId, totalSupply); err != nil {
+					return err
+				}
+				if err := insertNep5Correction(trans, contract.AssetId, 0, current, totalSupply, blockIndex, now); err != nil {
+					return err
+				}
+
+				r.Corrections = append(r.Corrections, Nep5Correction{Old: current, New: totalSupply})
+			}
+		}
+
+		const countQuery = "SELECT COUNT(`id`), COALESCE(SUM(CASE WHEN `balance` > 0 THEN 1 ELSE 0 END), 0) FROM `addr_asset` WHERE `asset_id` = ?"
+		if err := trans.QueryRow(countQuery, contract.AssetId).Scan(&r.Addresses, &r.HoldingAddresses); err != nil {
+			return err
+		}
+		const updateQuery = "UPDATE `nep5` SET `addresses` = ?, `holding_addresses` = ? WHERE `asset_id` = ? LIMIT 1"
+		if _, err := execute(trans, updateQuery, r.Addresses, r.HoldingAddresses, contract.AssetId); err != nil {
+			return err
+		}
+
+		// Cache is only changed after all statements succeeded.
+		for _, h := range corrected {
+			if item, ok := cache.GetAddrAsset(h.AddressId, contract.AssetId); ok {
+				item.SetBalance(h.Balance)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func insertNep5Correction(trans *sql.Tx, assetId uint, addressId uint, oldValue *big.Float, newValue *big.Float, blockIndex uint, createdAt int64) error {
+	query := fmt.Sprintf("INSERT INTO `nep5_reconcile` (`asset_id`, `address_id`, `old_value`, `new_value`, `block_index`, `created_at`) VALUES ('%d', '%d', %.8f, %.8f, %d, %d)", assetId, addressId, oldValue, newValue, blockIndex, createdAt)
+	_, err := execute(trans, query)
+	return err
+}
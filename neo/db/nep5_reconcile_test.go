@@ -0,0 +1,75 @@
+package db
+
+import (
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestReconcileNep5(t *testing.T) {
+	store := newTestStore(t)
+
+	blocks := testBlocks(1)
+	invocation := testTx(1, blocks[0], "InvocationTransaction")
+	invocation.Script = "00"
+	insertTestBlocks(t, store, blocks, &tx.Bulk{TXs: []*tx.Transaction{invocation}})
+
+	execQueries(t, store,
+		"INSERT INTO `nep5` (`asset_id`, `admin_address`, `name`, `symbol`, `decimals`, `total_supply`, `tx_id`, `block_index`, `block_time`, `addresses`, `holding_addresses`, `transfers`) VALUES (5, 'admin', 'Token', 'TKN', 8, 100, 1, 0, 1, 5, 5, 1)",
+		"INSERT INTO `address` (`address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES ('ReconcileAddrA', 1, 1, 0, 1), ('ReconcileAddrB', 1, 1, 0, 1)",
+		"INSERT INTO `addr_asset` (`address_id`, `asset_id`, `balance`, `transactions`, `last_transaction_time`) VALUES (1, 5, 50, 1, 1), (2, 5, 10, 1, 1)",
+	)
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+
+	contracts, err := store.GetNep5Contracts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contracts) != 1 || contracts[0].AssetId != 5 || contracts[0].Script != "00" || contracts[0].Decimals != 8 {
+		t.Fatalf("contracts = %+v, want TKN with script of its registration tx", contracts)
+	}
+	contract := contracts[0]
+
+	holders, err := store.GetNep5Holders(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 2 || holders[0].Address != "ReconcileAddrA" || holders[1].Balance.Text('f', 8) != "10.00000000" {
+		t.Fatalf("holders = %+v", holders)
+	}
+
+	// Balance of B is changed by nep5 task after it was read.
+	if _, err := store.db.Exec("UPDATE `addr_asset` SET `balance` = 11 WHERE `address_id` = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := store.ReconcileNep5(contract, holders, []*big.Float{big.NewFloat(40), big.NewFloat(0)}, big.NewFloat(90), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Corrections) != 2 || r.Skipped != 1 || r.Addresses != 2 || r.HoldingAddresses != 2 {
+		t.Errorf("reconciliation = %+v, want 2 corrections, B skipped and 2 holding addresses", r)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `nep5_reconcile` WHERE `asset_id` = 5 AND `block_index` = 100"); n != 2 {
+		t.Errorf("nep5_reconcile has %d rows, want 2", n)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `nep5` WHERE `total_supply` = 90 AND `addresses` = 2"); n != 1 {
+		t.Error("total supply and addresses of nep5 are not corrected")
+	}
+	if cached, _ := cache.GetAddrAsset(1, 5); cached.GetBalance().Text('f', 8) != "40.00000000" {
+		t.Errorf("cached balance of A = %v, want 40", cached.GetBalance())
+	}
+
+	holders, err = store.GetNep5Holders(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = store.ReconcileNep5(contract, holders, []*big.Float{nil, big.NewFloat(0)}, nil, 101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Corrections) != 1 || r.Corrections[0].Address != "ReconcileAddrB" || r.HoldingAddresses != 1 {
+		t.Errorf("reconciliation = %+v, want balance of B corrected and 1 holding address", r)
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/lib/pq"
+	"io"
+	"net"
+)
+
+// postgresDialect runs sql of this package on PostgreSQL.
+// Tables must be created with sqls/create_table_postgres.sql.
+var postgresDialect = &dialect{
+	name: "postgres",
+	open: func(dsn string) (*sql.DB, error) {
+		return sql.OpenDB(&rewriteConnector{
+			driver: &pq.Driver{},
+			dsn:    dsn,
+			rewrite: func(query string) string {
+				return rewrite(query, '"', true)
+			},
+		}), nil
+	},
+	isConnErr:   isPostgresConnErr,
+	isRetryable: isPostgresRetryable,
+}
+
+func isPostgresConnErr(err error) bool {
+	if err == driver.ErrBadConn || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	if e, ok := err.(*pq.Error); ok {
+		switch e.Code.Class() {
+		// connection_exception, insufficient_resources and operator_intervention, e.g. admin_shutdown.
+		case "08", "53", "57":
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPostgresRetryable returns true for serialization_failure and deadlock_detected,
+// after which the transaction can be retried.
+func isPostgresRetryable(err error) bool {
+	e, ok := err.(*pq.Error)
+	return ok && (e.Code == "40001" || e.Code == "40P01")
+}
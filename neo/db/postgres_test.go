@@ -0,0 +1,46 @@
+package db
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"io"
+	"testing"
+)
+
+func TestIsPostgresConnErr(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{io.ErrUnexpectedEOF, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "40P01"}, false},
+		{&pq.Error{Code: "23505"}, false},
+		{errors.New("syntax error"), false},
+	}
+
+	for _, test := range tests {
+		if got := isPostgresConnErr(test.err); got != test.want {
+			t.Errorf("isPostgresConnErr(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestIsPostgresRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "08006"}, false},
+		{io.ErrUnexpectedEOF, false},
+	}
+
+	for _, test := range tests {
+		if got := isPostgresRetryable(test.err); got != test.want {
+			t.Errorf("isPostgresRetryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
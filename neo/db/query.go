@@ -0,0 +1,528 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"neo_explorer/core/cache"
+	"strconv"
+	"strings"
+)
+
+// UTXO is an unspent output of an address.
+type UTXO struct {
+	TxID  string `json:"txid"`
+	N     uint16 `json:"n"`
+	Asset string `json:"asset"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AddrBalance is the balance of an address for one asset or nep5 token.
+type AddrBalance struct {
+	Asset               string `json:"asset"`
+	AssetType           string `json:"asset_type"`
+	Name                string `json:"name"`
+	Symbol              string `json:"symbol"`
+	Decimals            uint8  `json:"decimals"`
+	Balance             string `json:"balance"`
+	Transactions        uint64 `json:"transactions"`
+	LastTransactionTime uint64 `json:"last_transaction_time"`
+}
+
+// HistoryRecord is a transaction in which an address moved an asset.
+type HistoryRecord struct {
+	TxID       string `json:"txid"`
+	BlockIndex uint   `json:"block_index"`
+	BlockTime  uint64 `json:"block_time"`
+	Asset      string `json:"asset"`
+	Name       string `json:"name"`
+	From       string `json:"from,omitempty"`
+	To         string `json:"to,omitempty"`
+	Value      string `json:"value,omitempty"`
+}
+
+// TxDetail is a transaction with its inputs, outputs and nep5 transfers.
+type TxDetail struct {
+	TxID       string         `json:"txid"`
+	BlockIndex uint           `json:"block_index"`
+	BlockTime  uint64         `json:"block_time"`
+	Size       uint           `json:"size"`
+	Type       string         `json:"type"`
+	Version    uint           `json:"version"`
+	SysFee     string         `json:"sys_fee"`
+	NetFee     string         `json:"net_fee"`
+	Nonce      int64          `json:"nonce"`
+	Script     string         `json:"script"`
+	Gas        string         `json:"gas"`
+	Vin        []TxIO         `json:"vin"`
+	Vout       []TxIO         `json:"vout"`
+	Nep5       []Nep5Transfer `json:"nep5"`
+}
+
+// TxIO is an input or output of a transaction.
+type TxIO struct {
+	TxID    string `json:"txid,omitempty"`
+	N       uint16 `json:"n"`
+	Asset   string `json:"asset"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Address string `json:"address"`
+}
+
+// Nep5Transfer is a nep5 transfer record.
+type Nep5Transfer struct {
+	TxID       string `json:"txid"`
+	Contract   string `json:"contract"`
+	Name       string `json:"name"`
+	Symbol     string `json:"symbol"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Value      string `json:"value"`
+	BlockIndex uint   `json:"block_index"`
+	BlockTime  uint64 `json:"block_time"`
+}
+
+// BlockDetail is a block with the txids it contains.
+type BlockDetail struct {
+	Hash               string   `json:"hash"`
+	Size               int      `json:"size"`
+	Version            uint     `json:"version"`
+	PreviousBlockHash  string   `json:"previousblockhash"`
+	MerkleRoot         string   `json:"merkleroot"`
+	Time               uint64   `json:"time"`
+	Index              uint     `json:"index"`
+	Nonce              string   `json:"nonce"`
+	NextConsensus      string   `json:"nextconsensus"`
+	ScriptInvocation   string   `json:"script_invocation"`
+	ScriptVerification string   `json:"script_verification"`
+	NextBlockHash      string   `json:"nextblockhash"`
+	Txs                []string `json:"tx"`
+}
+
+// AssetDetail is a utxo asset.
+type AssetDetail struct {
+	AssetID      string `json:"asset"`
+	BlockIndex   uint   `json:"block_index"`
+	BlockTime    uint64 `json:"block_time"`
+	Version      uint   `json:"version"`
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	Amount       string `json:"amount"`
+	Available    string `json:"available"`
+	Precision    uint8  `json:"precision"`
+	Owner        string `json:"owner"`
+	Admin        string `json:"admin"`
+	Issuer       string `json:"issuer"`
+	Expiration   uint64 `json:"expiration"`
+	Frozen       bool   `json:"frozen"`
+	Addresses    uint64 `json:"addresses"`
+	Transactions uint64 `json:"transactions"`
+}
+
+// Nep5Detail is a nep5 token.
+type Nep5Detail struct {
+	Contract         string `json:"contract"`
+	AdminAddress     string `json:"admin_address"`
+	Name             string `json:"name"`
+	Symbol           string `json:"symbol"`
+	Decimals         uint8  `json:"decimals"`
+	TotalSupply      string `json:"total_supply"`
+	TxID             string `json:"txid"`
+	BlockIndex       uint   `json:"block_index"`
+	BlockTime        uint64 `json:"block_time"`
+	Addresses        uint64 `json:"addresses"`
+	HoldingAddresses uint64 `json:"holding_addresses"`
+	Transfers        uint64 `json:"transfers"`
+	Visible          bool   `json:"visible"`
+}
+
+// FindAddrID returns pk of the given address, or zero if it has never been seen.
+func (store *SQLStore) FindAddrID(addr string) (uint, error) {
+	var id uint
+	const query = "SELECT `id` FROM `address` WHERE `address` = ? LIMIT 1"
+	err := store.db.QueryRow(query, addr).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// FindAssetPk returns pk of the utxo asset with the given asset_id or name.
+func (store *SQLStore) FindAssetPk(assetIDOrName string) (uint, error) {
+	var id uint
+	const query = "SELECT `id` FROM `asset` WHERE `asset_id` = ? OR `name` = ? ORDER BY `id` ASC LIMIT 1"
+	err := store.db.QueryRow(query, assetIDOrName, assetIDOrName).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// IsNep5Asset checks if the given asset pk belongs to a nep5 token.
+func (store *SQLStore) IsNep5Asset(assetId uint) (bool, error) {
+	var id uint
+	const query = "SELECT `id` FROM `nep5` WHERE `asset_id` = ? LIMIT 1"
+	err := store.db.QueryRow(query, assetId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// ResolveAsset returns pk of the asset given by utxo asset id, asset name or nep5 contract hash,
+// and whether it is a nep5 asset. The pk is 0 if there is no such asset.
+func (store *SQLStore) ResolveAsset(asset string) (uint, bool, error) {
+	hash := strings.TrimPrefix(strings.ToLower(asset), "0x")
+	if _, err := hex.DecodeString(hash); err != nil {
+		hash = ""
+	}
+
+	switch len(hash) {
+	case 40:
+		assetId, ok := cache.LookupAssetId(hash)
+		if !ok {
+			return 0, false, nil
+		}
+
+		isNep5, err := store.IsNep5Asset(assetId)
+		if err != nil || !isNep5 {
+			return 0, false, err
+		}
+
+		return assetId, true, nil
+	case 64:
+		asset = "0x" + hash
+	}
+
+	assetId, err := store.FindAssetPk(asset)
+	return assetId, false, err
+}
+
+// GetAddrUTXOs returns paged unspent outputs of the address.
+func (store *SQLStore) GetAddrUTXOs(addressId uint, limit int, offset int) ([]UTXO, uint64, error) {
+	var total uint64
+	const countQuery = "SELECT COUNT(`id`) FROM `utxo` WHERE `address_id` = ? AND `used_in_tx` IS NULL"
+	if err := store.db.QueryRow(countQuery, addressId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	const query = "SELECT COALESCE(`tx`.`txid`, ''), `utxo`.`n`, COALESCE(`asset`.`asset_id`, ''), COALESCE(`asset`.`name`, ''), `utxo`.`value` FROM `utxo` LEFT JOIN `asset` ON `asset`.`id` = `utxo`.`asset_id` LEFT JOIN `tx` ON `tx`.`id` = `utxo`.`tx_id` WHERE `utxo`.`address_id` = ? AND `utxo`.`used_in_tx` IS NULL ORDER BY `utxo`.`id` ASC LIMIT ? OFFSET ?"
+	rows, err := store.wrappedQuery(query, addressId, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []UTXO{}
+	for rows.Next() {
+		var u UTXO
+		if err := rows.Scan(&u.TxID, &u.N, &u.Asset, &u.Name, &u.Value); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, u)
+	}
+
+	return result, total, rows.Err()
+}
+
+// GetAddrBalances returns paged balances of all assets and nep5 tokens of the address.
+func (store *SQLStore) GetAddrBalances(addressId uint, limit int, offset int) ([]AddrBalance, uint64, error) {
+	var total uint64
+	const countQuery = "SELECT COUNT(`id`) FROM `addr_asset` WHERE `address_id` = ?"
+	if err := store.db.QueryRow(countQuery, addressId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	const query = "SELECT `addr_asset`.`asset_id`, `asset`.`asset_id`, `asset`.`name`, `asset`.`precision`, `nep5`.`name`, `nep5`.`symbol`, `nep5`.`decimals`, `addr_asset`.`balance`, `addr_asset`.`transactions`, `addr_asset`.`last_transaction_time` FROM `addr_asset` LEFT JOIN `asset` ON `asset`.`id` = `addr_asset`.`asset_id` LEFT JOIN `nep5` ON `nep5`.`asset_id` = `addr_asset`.`asset_id` WHERE `addr_asset`.`address_id` = ? ORDER BY `addr_asset`.`id` ASC LIMIT ? OFFSET ?"
+	rows, err := store.wrappedQuery(query, addressId, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []AddrBalance{}
+	for rows.Next() {
+		var b AddrBalance
+		var assetId uint
+		var assetID, assetName, nep5Name, nep5Symbol sql.NullString
+		var precision, decimals sql.NullInt64
+
+		err := rows.Scan(&assetId, &assetID, &assetName, &precision, &nep5Name, &nep5Symbol, &decimals, &b.Balance, &b.Transactions, &b.LastTransactionTime)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if nep5Name.Valid {
+			b.AssetType = "nep5"
+			b.Asset, _ = cache.GetAssetID(assetId)
+			b.Name = nep5Name.String
+			b.Symbol = nep5Symbol.String
+			b.Decimals = uint8(decimals.Int64)
+		} else {
+			b.AssetType = "asset"
+			b.Asset = assetID.String
+			b.Name = assetName.String
+			b.Symbol = assetName.String
+			b.Decimals = uint8(precision.Int64)
+		}
+
+		result = append(result, b)
+	}
+
+	return result, total, rows.Err()
+}
+
+// GetAddrAssetHistory returns paged utxo asset transactions of the address.
+// If assetId is zero, transactions of all utxo assets are returned.
+func (store *SQLStore) GetAddrAssetHistory(addressId uint, assetId uint, limit int, offset int) ([]HistoryRecord, uint64, error) {
+	filter := " WHERE `asset_tx`.`address_id` = ?"
+	args := []interface{}{addressId}
+	if assetId > 0 {
+		filter += " AND `asset_tx`.`asset_id` = ?"
+		args = append(args, assetId)
+	}
+
+	var total uint64
+	if err := store.db.QueryRow("SELECT COUNT(`id`) FROM `asset_tx`"+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT COALESCE(`tx`.`txid`, ''), COALESCE(`tx`.`block_index`, 0), COALESCE(`tx`.`block_time`, 0), COALESCE(`asset`.`asset_id`, ''), COALESCE(`asset`.`name`, '') FROM `asset_tx` LEFT JOIN `asset` ON `asset`.`id` = `asset_tx`.`asset_id` LEFT JOIN `tx` ON `tx`.`id` = `asset_tx`.`tx_id`"
+	query += filter + " ORDER BY `asset_tx`.`tx_id` DESC LIMIT ? OFFSET ?"
+	rows, err := store.wrappedQuery(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []HistoryRecord{}
+	for rows.Next() {
+		var r HistoryRecord
+		if err := rows.Scan(&r.TxID, &r.BlockIndex, &r.BlockTime, &r.Asset, &r.Name); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, r)
+	}
+
+	return result, total, rows.Err()
+}
+
+// GetAddrNep5History returns paged nep5 transfers of the address for the given token.
+func (store *SQLStore) GetAddrNep5History(addr string, assetId uint, limit int, offset int) ([]HistoryRecord, uint64, error) {
+	const filter = " WHERE `nep5_tx`.`asset_id` = ? AND (`nep5_tx`.`from` = ? OR `nep5_tx`.`to` = ?)"
+
+	var total uint64
+	if err := store.db.QueryRow("SELECT COUNT(`id`) FROM `nep5_tx`"+filter, assetId, addr, addr).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT COALESCE(`tx`.`txid`, ''), `nep5_tx`.`block_index`, `nep5_tx`.`block_time`, COALESCE(`nep5`.`symbol`, ''), `nep5_tx`.`from`, `nep5_tx`.`to`, `nep5_tx`.`value` FROM `nep5_tx` LEFT JOIN `nep5` ON `nep5`.`asset_id` = `nep5_tx`.`asset_id` LEFT JOIN `tx` ON `tx`.`id` = `nep5_tx`.`tx_id`"
+	query += filter + " ORDER BY `nep5_tx`.`id` DESC LIMIT ? OFFSET ?"
+	rows, err := store.wrappedQuery(query, assetId, addr, addr, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	contract, _ := cache.GetAssetID(assetId)
+	result := []HistoryRecord{}
+
+	for rows.Next() {
+		r := HistoryRecord{Asset: contract}
+		var value float64
+		if err := rows.Scan(&r.TxID, &r.BlockIndex, &r.BlockTime, &r.Name, &r.From, &r.To, &value); err != nil {
+			return nil, 0, err
+		}
+		r.Value = strconv.FormatFloat(value, 'f', -1, 64)
+		result = append(result, r)
+	}
+
+	return result, total, rows.Err()
+}
+
+// GetTxDetail returns transaction with its vins, vouts and nep5 transfers.
+func (store *SQLStore) GetTxDetail(txid string) (*TxDetail, error) {
+	var pk uint
+	t := TxDetail{}
+	const query = "SELECT `id`, `block_index`, `block_time`, `txid`, `size`, `type`, `version`, `sys_fee`, `net_fee`, `nonce`, `script`, `gas` FROM `tx` WHERE `txid` = ? LIMIT 1"
+	err := store.db.QueryRow(query, txid).Scan(&pk, &t.BlockIndex, &t.BlockTime, &t.TxID, &t.Size, &t.Type, &t.Version, &t.SysFee, &t.NetFee, &t.Nonce, &t.Script, &t.Gas)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Vin, err = store.getTxDetailVins(pk); err != nil {
+		return nil, err
+	}
+	if t.Vout, err = store.getTxDetailVouts(pk); err != nil {
+		return nil, err
+	}
+	if t.Nep5, err = store.getTxDetailNep5(pk); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (store *SQLStore) getTxDetailVins(txPk uint) ([]TxIO, error) {
+	const query = "SELECT COALESCE(`tx`.`txid`, ''), `tx_vin`.`vout`, COALESCE(`asset`.`asset_id`, ''), COALESCE(`asset`.`name`, ''), COALESCE(`tx_vout`.`value`, 0), COALESCE(`tx_vout`.`address`, '') FROM `tx_vin` LEFT JOIN `tx` ON `tx`.`id` = `tx_vin`.`txid` LEFT JOIN `tx_vout` ON `tx_vout`.`tx_id` = `tx_vin`.`txid` AND `tx_vout`.`n` = `tx_vin`.`vout` LEFT JOIN `asset` ON `asset`.`id` = `tx_vout`.`asset_id` WHERE `tx_vin`.`tx_id` = ? ORDER BY `tx_vin`.`id` ASC"
+	rows, err := store.wrappedQuery(query, txPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []TxIO{}
+	for rows.Next() {
+		var vin TxIO
+		if err := rows.Scan(&vin.TxID, &vin.N, &vin.Asset, &vin.Name, &vin.Value, &vin.Address); err != nil {
+			return nil, err
+		}
+		result = append(result, vin)
+	}
+
+	return result, rows.Err()
+}
+
+func (store *SQLStore) getTxDetailVouts(txPk uint) ([]TxIO, error) {
+	const query = "SELECT `tx_vout`.`n`, COALESCE(`asset`.`asset_id`, ''), COALESCE(`asset`.`name`, ''), `tx_vout`.`value`, `tx_vout`.`address` FROM `tx_vout` LEFT JOIN `asset` ON `asset`.`id` = `tx_vout`.`asset_id` WHERE `tx_vout`.`tx_id` = ? ORDER BY `tx_vout`.`n` ASC"
+	rows, err := store.wrappedQuery(query, txPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []TxIO{}
+	for rows.Next() {
+		var vout TxIO
+		if err := rows.Scan(&vout.N, &vout.Asset, &vout.Name, &vout.Value, &vout.Address); err != nil {
+			return nil, err
+		}
+		result = append(result, vout)
+	}
+
+	return result, rows.Err()
+}
+
+func (store *SQLStore) getTxDetailNep5(txPk uint) ([]Nep5Transfer, error) {
+	const query = "SELECT COALESCE(`tx`.`txid`, ''), `nep5_tx`.`asset_id`, COALESCE(`nep5`.`name`, ''), COALESCE(`nep5`.`symbol`, ''), `nep5_tx`.`from`, `nep5_tx`.`to`, `nep5_tx`.`value`, `nep5_tx`.`block_index`, `nep5_tx`.`block_time` FROM `nep5_tx` LEFT JOIN `nep5` ON `nep5`.`asset_id` = `nep5_tx`.`asset_id` LEFT JOIN `tx` ON `tx`.`id` = `nep5_tx`.`tx_id` WHERE `nep5_tx`.`tx_id` = ? ORDER BY `nep5_tx`.`id` ASC"
+	rows, err := store.wrappedQuery(query, txPk)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNep5Transfers(rows)
+}
+
+func scanNep5Transfers(rows *sql.Rows) ([]Nep5Transfer, error) {
+	result := []Nep5Transfer{}
+
+	for rows.Next() {
+		var t Nep5Transfer
+		var assetId uint
+		var value float64
+		if err := rows.Scan(&t.TxID, &assetId, &t.Name, &t.Symbol, &t.From, &t.To, &value, &t.BlockIndex, &t.BlockTime); err != nil {
+			return nil, err
+		}
+		t.Contract, _ = cache.GetAssetID(assetId)
+		t.Value = strconv.FormatFloat(value, 'f', -1, 64)
+		result = append(result, t)
+	}
+
+	return result, rows.Err()
+}
+
+// GetBlockDetail returns block of the given index, or of the given hash if index is negative.
+func (store *SQLStore) GetBlockDetail(index int, hash string) (*BlockDetail, error) {
+	query := "SELECT `hash`, `size`, `version`, `previousblockhash`, `merkleroot`, `time`, `index`, `nonce`, `nextconsensus`, `script_invocation`, `script_verification`, `nextblockhash` FROM `block` "
+	var row *sql.Row
+	if index >= 0 {
+		row = store.db.QueryRow(query+"WHERE `index` = ? LIMIT 1", index)
+	} else {
+		row = store.db.QueryRow(query+"WHERE `hash` = ? LIMIT 1", hash)
+	}
+
+	b := BlockDetail{}
+	err := row.Scan(&b.Hash, &b.Size, &b.Version, &b.PreviousBlockHash, &b.MerkleRoot, &b.Time, &b.Index, &b.Nonce, &b.NextConsensus, &b.ScriptInvocation, &b.ScriptVerification, &b.NextBlockHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.wrappedQuery("SELECT `txid` FROM `tx` WHERE `block_index` = ? ORDER BY `id` ASC", b.Index)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	b.Txs = []string{}
+	for rows.Next() {
+		var txid string
+		if err := rows.Scan(&txid); err != nil {
+			return nil, err
+		}
+		b.Txs = append(b.Txs, txid)
+	}
+
+	return &b, rows.Err()
+}
+
+// GetAssetDetail returns utxo asset of the given asset_id.
+func (store *SQLStore) GetAssetDetail(assetID string) (*AssetDetail, error) {
+	const query = "SELECT `asset_id`, `block_index`, `block_time`, `version`, `type`, `name`, `amount`, `available`, `precision`, `owner`, `admin`, `issuer`, `expiration`, `frozen`, `addresses`, `transactions` FROM `asset` WHERE `asset_id` = ? LIMIT 1"
+
+	a := AssetDetail{}
+	err := store.db.QueryRow(query, assetID).Scan(&a.AssetID, &a.BlockIndex, &a.BlockTime, &a.Version, &a.Type, &a.Name, &a.Amount, &a.Available, &a.Precision, &a.Owner, &a.Admin, &a.Issuer, &a.Expiration, &a.Frozen, &a.Addresses, &a.Transactions)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// GetNep5Detail returns nep5 token of the given asset pk.
+func (store *SQLStore) GetNep5Detail(assetId uint) (*Nep5Detail, error) {
+	const query = "SELECT `nep5`.`admin_address`, `nep5`.`name`, `nep5`.`symbol`, `nep5`.`decimals`, `nep5`.`total_supply`, COALESCE(`tx`.`txid`, ''), `nep5`.`block_index`, `nep5`.`block_time`, `nep5`.`addresses`, `nep5`.`holding_addresses`, `nep5`.`transfers`, `nep5`.`visible` FROM `nep5` LEFT JOIN `tx` ON `tx`.`id` = `nep5`.`tx_id` WHERE `nep5`.`asset_id` = ? ORDER BY `nep5`.`id` DESC LIMIT 1"
+
+	n := Nep5Detail{}
+	err := store.db.QueryRow(query, assetId).Scan(&n.AdminAddress, &n.Name, &n.Symbol, &n.Decimals, &n.TotalSupply, &n.TxID, &n.BlockIndex, &n.BlockTime, &n.Addresses, &n.HoldingAddresses, &n.Transfers, &n.Visible)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n.Contract, _ = cache.GetAssetID(assetId)
+	return &n, nil
+}
+
+// GetNep5Transfers returns paged transfers of the given nep5 token.
+func (store *SQLStore) GetNep5Transfers(assetId uint, limit int, offset int) ([]Nep5Transfer, uint64, error) {
+	var total uint64
+	const countQuery = "SELECT COUNT(`id`) FROM `nep5_tx` WHERE `asset_id` = ?"
+	if err := store.db.QueryRow(countQuery, assetId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	const query = "SELECT COALESCE(`tx`.`txid`, ''), `nep5_tx`.`asset_id`, COALESCE(`nep5`.`name`, ''), COALESCE(`nep5`.`symbol`, ''), `nep5_tx`.`from`, `nep5_tx`.`to`, `nep5_tx`.`value`, `nep5_tx`.`block_index`, `nep5_tx`.`block_time` FROM `nep5_tx` LEFT JOIN `nep5` ON `nep5`.`asset_id` = `nep5_tx`.`asset_id` LEFT JOIN `tx` ON `tx`.`id` = `nep5_tx`.`tx_id` WHERE `nep5_tx`.`asset_id` = ? ORDER BY `nep5_tx`.`id` DESC LIMIT ? OFFSET ?"
+	rows, err := store.wrappedQuery(query, assetId, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result, err := scanNep5Transfers(rows)
+	return result, total, err
+}
@@ -0,0 +1,289 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"neo_explorer/neo/asset"
+	"sort"
+)
+
+// resetTasks undo all records of each task so that it starts from the first transaction.
+var resetTasks = map[string]func(trans *sql.Tx, r *RollbackReport) error{
+	"tx":              resetTx,
+	"asset_tx":        resetAssetTx,
+	"balance_history": resetBalanceHistory,
+	"sc":              resetSC,
+	"nep5":            resetNep5,
+}
+
+// rewindTasks undo records of each task created by transactions whose pk >= r.FirstTxPk.
+var rewindTasks = map[string]func(trans *sql.Tx, r *RollbackReport, counter Counter) error{
+	"tx":              rewindTx,
+	"asset_tx":        rewindAssetTx,
+	"balance_history": rewindBalanceHistory,
+	"sc":              rewindSC,
+	"nep5":            rewindNep5,
+}
+
+// Tasks returns names of tasks which can be reset or rewound.
+func Tasks() []string {
+	names := []string{}
+	for name := range resetTasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// lastTxPk returns pk of the last transaction handled by the task.
+func lastTxPk(task string, counter Counter) uint {
+	switch task {
+	case "tx":
+		return counter.LastTxPk
+	case "asset_tx":
+		return counter.LastAssetTxPk
+	case "balance_history":
+		return counter.LastTxPkBalance
+	case "sc":
+		return counter.LastTxPkForSC
+	case "nep5":
+		return counter.LastTxPkForNep5
+	}
+
+	return 0
+}
+
+// ResetTask removes all records of the task and resets its counters in one db transaction,
+// the task starts from the first transaction on next start.
+// Resetting nep5 resets nep5_addr_tx, balance history and snapshots of nep5 assets as well.
+// It must not be called while tasks are running.
+func (store *SQLStore) ResetTask(task string) (*RollbackReport, error) {
+	reset, ok := resetTasks[task]
+	if !ok {
+		return nil, fmt.Errorf("unknown task: %s", task)
+	}
+
+	counter := store.getCounterInstance()
+	report := &RollbackReport{}
+
+	err := store.transact(func(trans *sql.Tx) error {
+		*report = RollbackReport{
+			FromHeight: -1,
+			ToHeight:   counter.LastBlockIndex,
+			FirstTxPk:  1,
+			LastTxPk:   lastTxPk(task, counter),
+		}
+
+		if err := reset(trans, report); err != nil {
+			return err
+		}
+
+		return report.exec(trans, "task_error", "deleted", "DELETE FROM `task_error` WHERE `task` IN (?, ?)", task, taskErrorAlias(task))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// RewindTask reverts records of the task created by transactions whose pk > txPk in one db transaction,
+// the task continues from txPk+1 on next start. Rewinding nep5 rewinds balance_history as well.
+// It must not be called while tasks are running.
+func (store *SQLStore) RewindTask(task string, txPk uint) (*RollbackReport, error) {
+	rewind, ok := rewindTasks[task]
+	if !ok {
+		return nil, fmt.Errorf("unknown task: %s", task)
+	}
+
+	counter := store.getCounterInstance()
+	last := lastTxPk(task, counter)
+	if txPk >= last {
+		return nil, fmt.Errorf("task %s has handled transactions up to pk %d only", task, last)
+	}
+
+	report := &RollbackReport{}
+
+	err := store.transact(func(trans *sql.Tx) error {
+		*report = RollbackReport{
+			FromHeight: -1,
+			ToHeight:   counter.LastBlockIndex,
+			FirstTxPk:  txPk + 1,
+			LastTxPk:   last,
+		}
+
+		if err := rewind(trans, report, counter); err != nil {
+			return err
+		}
+
+		return report.exec(trans, "task_error", "deleted", "DELETE FROM `task_error` WHERE `task` IN (?, ?) AND `tx_pk` > ?", task, taskErrorAlias(task), txPk)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// taskErrorAlias returns the other task quarantining transactions for the task,
+// or the task itself.
+func taskErrorAlias(task string) string {
+	if task == "nep5" {
+		return "nep5_addr_tx"
+	}
+
+	return task
+}
+
+func resetTx(trans *sql.Tx, r *RollbackReport) error {
+	if err := r.exec(trans, "utxo", "deleted", "DELETE FROM `utxo`"); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_asset", "deleted", "DELETE FROM `addr_asset` WHERE `asset_id` NOT IN (SELECT `asset_id` FROM `nep5`)"); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_tx", "deleted", "DELETE FROM `addr_tx` WHERE `asset_type` = ?", asset.ASSET); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "asset", "updated", "UPDATE `asset` SET `addresses` = 0, `available` = 0, `transactions` = 0"); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "address", "updated", "UPDATE `address` SET `trans_asset` = 0"); err != nil {
+		return err
+	}
+	if err := removeUnusedAddrs(trans, r); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_tx_pk", 0)
+}
+
+func resetAssetTx(trans *sql.Tx, r *RollbackReport) error {
+	if err := r.exec(trans, "asset_tx", "deleted", "DELETE FROM `asset_tx`"); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_asset_tx_pk", 0)
+}
+
+func resetBalanceHistory(trans *sql.Tx, r *RollbackReport) error {
+	if err := r.exec(trans, "addr_balance_history", "deleted", "DELETE FROM `addr_balance_history`"); err != nil {
+		return err
+	}
+	if err := updateCounter(trans, "last_tx_pk_balance", 0); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "nep5_tx_pk_for_balance", 0)
+}
+
+func resetSC(trans *sql.Tx, r *RollbackReport) error {
+	if err := r.exec(trans, "smartcontract_info", "deleted", "DELETE FROM `smartcontract_info`"); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_tx_pk_for_sc", 0)
+}
+
+func resetNep5(trans *sql.Tx, r *RollbackReport) error {
+	if err := r.exec(trans, "addr_balance_history", "deleted", "DELETE FROM `addr_balance_history` WHERE `asset_id` IN (SELECT `asset_id` FROM `nep5`)"); err != nil {
+		return err
+	}
+	if err := updateCounter(trans, "nep5_tx_pk_for_balance", 0); err != nil {
+		return err
+	}
+	if err := deleteSnapshots(trans, r, "`asset_id` IN (SELECT `asset_id` FROM `nep5`)"); err != nil {
+		return err
+	}
+	if err := deleteRichLists(trans, r, "`asset_id` IN (SELECT `asset_id` FROM `nep5`)"); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_asset", "deleted", "DELETE FROM `addr_asset` WHERE `asset_id` IN (SELECT `asset_id` FROM `nep5`)"); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_tx", "deleted", "DELETE FROM `addr_tx` WHERE `asset_type` = ?", asset.NEP5); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "address", "updated", "UPDATE `address` SET `trans_nep5` = 0"); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"nep5_reg_info", "nep5_tx", "nep5_migrate", "nep5_reconcile", "nep5"} {
+		if err := r.exec(trans, table, "deleted", fmt.Sprintf("DELETE FROM `%s`", table)); err != nil {
+			return err
+		}
+	}
+
+	if err := removeUnusedAddrs(trans, r); err != nil {
+		return err
+	}
+	if err := updateNep5Counter(trans, 0, -1); err != nil {
+		return err
+	}
+
+	return UpdateNep5TxPkForAddrTx(trans, 0)
+}
+
+// removeUnusedAddrs removes addresses which are neither counted by tx or nep5 task
+// nor holding any asset nor having balance history. Addresses are cached by their assets when tasks start,
+// so the tasks recreate these addresses when they appear again.
+func removeUnusedAddrs(trans *sql.Tx, r *RollbackReport) error {
+	res, err := execute(trans, "DELETE FROM `address` WHERE `trans_asset` = 0 AND `trans_nep5` = 0 AND `id` NOT IN (SELECT `address_id` FROM `addr_asset`) AND `id` NOT IN (SELECT `address_id` FROM `addr_balance_history`)")
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return nil
+	}
+
+	r.Rows = append(r.Rows, RollbackRows{Table: "address", Action: "deleted", Rows: deleted})
+	return incrAddrCounter(trans, -int(deleted))
+}
+
+func rewindTx(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	if err := rollbackUTXOs(trans, r, counter.LastTxPk); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_tx", "deleted", "DELETE FROM `addr_tx` WHERE `tx_id` >= ? AND `asset_type` = ?", r.FirstTxPk, asset.ASSET); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_tx_pk", int64(r.FirstTxPk-1))
+}
+
+func rewindAssetTx(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	if err := r.exec(trans, "asset_tx", "deleted", "DELETE FROM `asset_tx` WHERE `tx_id` >= ?", r.FirstTxPk); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_asset_tx_pk", int64(r.FirstTxPk-1))
+}
+
+func rewindBalanceHistory(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	return rollbackBalanceHistory(trans, r, counter)
+}
+
+func rewindSC(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	if err := r.exec(trans, "smartcontract_info", "deleted", "DELETE FROM `smartcontract_info` WHERE `tx_id` >= ?", r.FirstTxPk); err != nil {
+		return err
+	}
+
+	return updateCounter(trans, "last_tx_pk_for_sc", int64(r.FirstTxPk-1))
+}
+
+func rewindNep5(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	// Balance history of the removed nep5 tx records must be reverted before they are removed.
+	if err := rollbackBalanceHistory(trans, r, counter); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_tx", "deleted", "DELETE FROM `addr_tx` WHERE `tx_id` >= ? AND `asset_type` = ?", r.FirstTxPk, asset.NEP5); err != nil {
+		return err
+	}
+
+	return rollbackNep5(trans, r, counter)
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestResetAndRewindTasks(t *testing.T) {
+	store := newTestStore(t)
+
+	blocks := testBlocks(1, 86401)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "ContractTransaction"),
+			testTx(2, blocks[1], "ContractTransaction"),
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "ResetAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(5), Address: "ResetAddrB", AddressId: 2},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+	for i, trans := range bulk.TXs {
+		if err := store.ApplyVinsVouts(trans, nil, bulk.TXVouts[i:i+1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.RecordAddrAssetIDTx([]tx.AddrAssetIDTx{{AddressId: uint(i + 1), AssetID: 1, TxId: trans.ID}}, int64(trans.ID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.QuarantineTx("asset_tx", 2, "bad transaction"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.RewindTask("asset_tx", 2); err == nil {
+		t.Error("task rewound beyond its last transaction")
+	}
+	if _, err := store.RewindTask("block", 0); err == nil {
+		t.Error("unknown task rewound")
+	}
+
+	if _, err := store.RewindTask("asset_tx", 1); err != nil {
+		t.Fatal(err)
+	}
+	if pk := store.GetLastAssetTxPkCounter(); pk != 1 {
+		t.Errorf("last_asset_tx_pk = %d after rewind, want 1", pk)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `asset_tx`"); n != 1 {
+		t.Errorf("asset_tx has %d rows after rewind, want 1", n)
+	}
+	if pks, _ := store.GetQuarantinedTxs("asset_tx"); len(pks) != 0 {
+		t.Errorf("quarantined transactions %v kept after rewind", pks)
+	}
+
+	report, err := store.ResetTask("tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.LastTxPk != 2 {
+		t.Errorf("report = %+v, want last tx pk 2", report)
+	}
+	if pk := store.getCounterInstance().LastTxPk; pk != 0 {
+		t.Errorf("last_tx_pk = %d after reset, want 0", pk)
+	}
+	for _, table := range []string{"utxo", "addr_asset", "addr_tx", "address"} {
+		if n := countRows(t, store, "SELECT COUNT(*) FROM `"+table+"`"); n != 0 {
+			t.Errorf("%s has %d rows after reset, want 0", table, n)
+		}
+	}
+	if n := countRows(t, store, "SELECT `cnt_addr` FROM `counter` WHERE `id` = 1"); n != 0 {
+		t.Errorf("cnt_addr = %d after reset, want 0", n)
+	}
+	// Records of other tasks are kept.
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `asset_tx`"); n != 1 {
+		t.Errorf("asset_tx has %d rows after reset of tx, want 1", n)
+	}
+}
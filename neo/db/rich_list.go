@@ -0,0 +1,419 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"math/big"
+	"neo_explorer/core/util"
+	"strings"
+	"time"
+)
+
+// Labels of holders in rich lists.
+const (
+	LabelContract = "contract"
+	LabelMultisig = "multisig"
+)
+
+// balanceBandCount is the number of balance bands, their lower bounds are 0, 1, 10, ..., 1e9.
+const balanceBandCount = 11
+
+// AssetDistribution summarizes how an asset is distributed among its holders.
+type AssetDistribution struct {
+	AssetId          uint          `json:"-"`
+	Supply           string        `json:"supply"`
+	Holders          uint64        `json:"holders"`
+	Top10Percentage  string        `json:"top10_percentage"`
+	Top100Percentage string        `json:"top100_percentage"`
+	Gini             string        `json:"gini"`
+	BlockIndex       uint          `json:"block_index"`
+	UpdatedAt        int64         `json:"updated_at"`
+	Bands            []BalanceBand `json:"bands"`
+}
+
+// BalanceBand is the number of holders and their total balance in a band of balances.
+type BalanceBand struct {
+	LowerBound string `json:"lower_bound"`
+	Holders    uint64 `json:"holders"`
+	Balance    string `json:"balance"`
+}
+
+// RichListEntry is a holder in the rich list of an asset.
+type RichListEntry struct {
+	Ranking    uint   `json:"rank"`
+	Address    string `json:"address"`
+	Balance    string `json:"balance"`
+	Percentage string `json:"percentage"`
+	Label      string `json:"label,omitempty"`
+}
+
+// richHolder is a holder read while computing the rich list.
+type richHolder struct {
+	addressId uint
+	balance   *big.Float
+}
+
+// GetRichListAssets returns pks of all utxo assets and visible nep5 assets.
+func (store *SQLStore) GetRichListAssets() ([]uint, error) {
+	assetIds := []uint{}
+
+	const query = "SELECT `id` FROM `asset` WHERE `id` NOT IN (SELECT `asset_id` FROM `nep5` WHERE `visible` = FALSE) ORDER BY `id` ASC"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		var assetId uint
+		if err := rows.Scan(&assetId); err != nil {
+			return err
+		}
+
+		assetIds = append(assetIds, assetId)
+		return nil
+	}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return assetIds, nil
+}
+
+// UpdateRichList recomputes the top holders and the distribution of the asset from addr_asset,
+// and replaces the stored ones.
+func (store *SQLStore) UpdateRichList(assetId uint, top int) (*AssetDistribution, error) {
+	blockIndex := store.GetLastHeight()
+	if blockIndex < 0 {
+		blockIndex = 0
+	}
+
+	supply, err := store.getAssetSupply(assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	holders := []richHolder{}
+	total := new(big.Float)
+	weighted := new(big.Float)
+	top10 := new(big.Float)
+	top100 := new(big.Float)
+	bandHolders := make([]uint64, balanceBandCount)
+	bandBalances := make([]*big.Float, balanceBandCount)
+	for i := range bandBalances {
+		bandBalances[i] = new(big.Float)
+	}
+
+	var n uint64
+	const query = "SELECT `address_id`, `balance` FROM `addr_asset` WHERE `asset_id` = ? AND `balance` > 0 ORDER BY `balance` DESC, `address_id` ASC"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var h richHolder
+		var balanceStr string
+		if err := rows.Scan(&h.addressId, &balanceStr); err != nil {
+			return err
+		}
+
+		h.balance = util.StrToBigFloat(balanceStr)
+		n++
+
+		total.Add(total, h.balance)
+		weighted.Add(weighted, new(big.Float).Mul(new(big.Float).SetUint64(n), h.balance))
+		if n <= 10 {
+			top10.Add(top10, h.balance)
+		}
+		if n <= 100 {
+			top100.Add(top100, h.balance)
+		}
+		if n <= uint64(top) {
+			holders = append(holders, h)
+		}
+
+		band := balanceBand(h.balance)
+		bandHolders[band]++
+		bandBalances[band].Add(bandBalances[band], h.balance)
+		return nil
+	}, query, assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stored supply may lag behind balances, the sum of balances is used then.
+	if supply.Cmp(total) < 0 {
+		supply = total
+	}
+
+	d := &AssetDistribution{
+		AssetId:          assetId,
+		Supply:           supply.Text('f', 8),
+		Holders:          n,
+		Top10Percentage:  percentageOf(top10, supply),
+		Top100Percentage: percentageOf(top100, supply),
+		Gini:             gini(n, total, weighted),
+		BlockIndex:       uint(blockIndex),
+		UpdatedAt:        time.Now().Unix(),
+	}
+	for i := range bandHolders {
+		d.Bands = append(d.Bands, BalanceBand{
+			LowerBound: bandLowerBound(i).Text('f', 8),
+			Holders:    bandHolders[i],
+			Balance:    bandBalances[i].Text('f', 8),
+		})
+	}
+
+	labels := make([]string, len(holders))
+	for i, h := range holders {
+		if labels[i], err = store.getHolderLabel(h.addressId); err != nil {
+			return nil, err
+		}
+	}
+
+	err = store.transact(func(trans *sql.Tx) error {
+		if err := deleteRichLists(trans, &RollbackReport{}, "`asset_id` = ?", assetId); err != nil {
+			return err
+		}
+
+		for i, h := range holders {
+			const insert = "INSERT INTO `rich_list` (`asset_id`, `ranking`, `address_id`, `balance`, `percentage`, `label`) VALUES (?, ?, ?, ?, ?, ?)"
+			if _, err := execute(trans, insert, assetId, i+1, h.addressId, h.balance.Text('f', 8), percentageOf(h.balance, supply), labels[i]); err != nil {
+				return err
+			}
+		}
+
+		for _, b := range d.Bands {
+			const insert = "INSERT INTO `asset_balance_band` (`asset_id`, `lower_bound`, `holders`, `balance`) VALUES (?, ?, ?, ?)"
+			if _, err := execute(trans, insert, assetId, b.LowerBound, b.Holders, b.Balance); err != nil {
+				return err
+			}
+		}
+
+		const insert = "INSERT INTO `asset_distribution` (`asset_id`, `supply`, `holders`, `top10_percentage`, `top100_percentage`, `gini`, `block_index`, `updated_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err := execute(trans, insert, assetId, d.Supply, d.Holders, d.Top10Percentage, d.Top100Percentage, d.Gini, d.BlockIndex, d.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// getAssetSupply returns total supply of nep5 assets or available amount of utxo assets.
+func (store *SQLStore) getAssetSupply(assetId uint) (*big.Float, error) {
+	var supplyStr string
+
+	const nep5Query = "SELECT `total_supply` FROM `nep5` WHERE `asset_id` = ? LIMIT 1"
+	err := store.db.QueryRow(nep5Query, assetId).Scan(&supplyStr)
+	if err == sql.ErrNoRows {
+		const assetQuery = "SELECT `available` FROM `asset` WHERE `id` = ? LIMIT 1"
+		err = store.db.QueryRow(assetQuery, assetId).Scan(&supplyStr)
+	}
+	if err == sql.ErrNoRows {
+		return new(big.Float), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return util.StrToBigFloat(supplyStr), nil
+}
+
+// balanceBand returns index of the band the positive balance falls in.
+func balanceBand(balance *big.Float) int {
+	band := 0
+	for band < balanceBandCount-1 && balance.Cmp(bandLowerBound(band+1)) >= 0 {
+		band++
+	}
+
+	return band
+}
+
+// bandLowerBound returns 0 for the first band and 10^(band-1) for the others.
+func bandLowerBound(band int) *big.Float {
+	if band == 0 {
+		return new(big.Float)
+	}
+
+	lower := big.NewFloat(1)
+	for i := 1; i < band; i++ {
+		lower.Mul(lower, big.NewFloat(10))
+	}
+
+	return lower
+}
+
+// percentageOf returns value / total in percent.
+func percentageOf(value *big.Float, total *big.Float) string {
+	if total.Sign() == 0 {
+		return "0.00000000"
+	}
+
+	p := new(big.Float).Quo(value, total)
+	return p.Mul(p, big.NewFloat(100)).Text('f', 8)
+}
+
+// gini returns the Gini coefficient of n balances in descending order,
+// weighted is the sum of every balance multiplied by its 1-based position.
+func gini(n uint64, total *big.Float, weighted *big.Float) string {
+	if n == 0 || total.Sign() == 0 {
+		return "0.00000000"
+	}
+
+	// G = ((n + 1) * total - 2 * weighted) / (n * total)
+	num := new(big.Float).Mul(new(big.Float).SetUint64(n+1), total)
+	num.Sub(num, new(big.Float).Mul(big.NewFloat(2), weighted))
+	g := num.Quo(num, new(big.Float).Mul(new(big.Float).SetUint64(n), total))
+	if g.Sign() < 0 {
+		g.SetInt64(0)
+	}
+
+	return g.Text('f', 8)
+}
+
+// getHolderLabel returns LabelContract if the address is a deployed contract,
+// LabelMultisig if it has spent utxo with a multi-signature verification script,
+// or empty string otherwise.
+func (store *SQLStore) getHolderLabel(addressId uint) (string, error) {
+	var address string
+	err := store.db.QueryRow("SELECT `address` FROM `address` WHERE `id` = ? LIMIT 1", addressId).Scan(&address)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !util.AddressValid(address) {
+		return "", nil
+	}
+
+	scriptHash := util.GetScriptHashFromAddress(address)
+
+	var id uint
+	err = store.db.QueryRow("SELECT `id` FROM `smartcontract_info` WHERE `script_hash` = ? LIMIT 1", util.GetAssetIDFromScriptHash(scriptHash)).Scan(&id)
+	if err == nil {
+		return LabelContract, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// Every transaction spending utxo of the address carries its verification script.
+	var txId uint
+	const spendQuery = "SELECT `tx_vin`.`tx_id` FROM `tx_vout` INNER JOIN `tx_vin` ON `tx_vin`.`txid` = `tx_vout`.`tx_id` AND `tx_vin`.`vout` = `tx_vout`.`n` WHERE `tx_vout`.`address_id` = ? LIMIT 1"
+	err = store.db.QueryRow(spendQuery, addressId).Scan(&txId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	label := ""
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var verification string
+		if err := rows.Scan(&verification); err != nil {
+			return err
+		}
+
+		if isMultisigScriptOf(verification, scriptHash) {
+			label = LabelMultisig
+		}
+		return nil
+	}, "SELECT `verification` FROM `tx_scripts` WHERE `tx_id` = ?", txId)
+	if err != nil {
+		return "", err
+	}
+
+	return label, nil
+}
+
+// isMultisigScriptOf checks if the hex verification script ends with CHECKMULTISIG and hashes to the script hash.
+func isMultisigScriptOf(verification string, scriptHash []byte) bool {
+	if !strings.HasSuffix(strings.ToLower(verification), "ae") {
+		return false
+	}
+
+	script, err := hex.DecodeString(verification)
+	if err != nil {
+		return false
+	}
+
+	return hex.EncodeToString(util.Hash160(script)) == hex.EncodeToString(scriptHash)
+}
+
+// GetAssetDistribution returns the distribution of the asset with its balance bands,
+// or nil if it has not been computed.
+func (store *SQLStore) GetAssetDistribution(assetId uint) (*AssetDistribution, error) {
+	d := &AssetDistribution{AssetId: assetId, Bands: []BalanceBand{}}
+	var supplyStr, top10Str, top100Str, giniStr string
+
+	const query = "SELECT `supply`, `holders`, `top10_percentage`, `top100_percentage`, `gini`, `block_index`, `updated_at` FROM `asset_distribution` WHERE `asset_id` = ? LIMIT 1"
+	err := store.db.QueryRow(query, assetId).Scan(&supplyStr, &d.Holders, &top10Str, &top100Str, &giniStr, &d.BlockIndex, &d.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.Supply = util.StrToBigFloat(supplyStr).Text('f', 8)
+	d.Top10Percentage = util.StrToBigFloat(top10Str).Text('f', 8)
+	d.Top100Percentage = util.StrToBigFloat(top100Str).Text('f', 8)
+	d.Gini = util.StrToBigFloat(giniStr).Text('f', 8)
+
+	const bandQuery = "SELECT `lower_bound`, `holders`, `balance` FROM `asset_balance_band` WHERE `asset_id` = ? ORDER BY `lower_bound` ASC"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		var b BalanceBand
+		var lowerStr, balanceStr string
+		if err := rows.Scan(&lowerStr, &b.Holders, &balanceStr); err != nil {
+			return err
+		}
+
+		b.LowerBound = util.StrToBigFloat(lowerStr).Text('f', 8)
+		b.Balance = util.StrToBigFloat(balanceStr).Text('f', 8)
+		d.Bands = append(d.Bands, b)
+		return nil
+	}, bandQuery, assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// GetRichList returns paged top holders of the asset in ascending order of rankings.
+func (store *SQLStore) GetRichList(assetId uint, limit int, offset int) ([]RichListEntry, error) {
+	entries := []RichListEntry{}
+
+	const query = "SELECT `rich_list`.`ranking`, `address`.`address`, `rich_list`.`balance`, `rich_list`.`percentage`, `rich_list`.`label` FROM `rich_list` INNER JOIN `address` ON `address`.`id` = `rich_list`.`address_id` WHERE `rich_list`.`asset_id` = ? ORDER BY `rich_list`.`ranking` ASC LIMIT ? OFFSET ?"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		var e RichListEntry
+		var balanceStr, percentageStr string
+		if err := rows.Scan(&e.Ranking, &e.Address, &balanceStr, &percentageStr, &e.Label); err != nil {
+			return err
+		}
+
+		e.Balance = util.StrToBigFloat(balanceStr).Text('f', 8)
+		e.Percentage = util.StrToBigFloat(percentageStr).Text('f', 8)
+		entries = append(entries, e)
+		return nil
+	}, query, assetId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetRichListSize returns the number of holders in the rich list of the asset.
+func (store *SQLStore) GetRichListSize(assetId uint) (uint64, error) {
+	var size uint64
+	err := store.db.QueryRow("SELECT COUNT(`id`) FROM `rich_list` WHERE `asset_id` = ?", assetId).Scan(&size)
+	return size, err
+}
+
+// deleteRichLists removes rich lists, distributions and balance bands of assets whose distributions match the condition.
+func deleteRichLists(trans *sql.Tx, r *RollbackReport, cond string, args ...interface{}) error {
+	sub := "SELECT `asset_id` FROM `asset_distribution` WHERE " + cond
+	if err := r.exec(trans, "rich_list", "deleted", "DELETE FROM `rich_list` WHERE `asset_id` IN ("+sub+")", args...); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "asset_balance_band", "deleted", "DELETE FROM `asset_balance_band` WHERE `asset_id` IN ("+sub+")", args...); err != nil {
+		return err
+	}
+
+	return r.exec(trans, "asset_distribution", "deleted", "DELETE FROM `asset_distribution` WHERE "+cond, args...)
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestRichList(t *testing.T) {
+	store := newTestStore(t)
+
+	// A is a deployed contract, B is a multisig address which spends its utxo in block 1.
+	multisig := []byte{0x52, 0x53, 0xae}
+	addrA := util.GetAddressFromScriptHash(util.Hash160([]byte("contract")))
+	addrB := util.GetAddressFromScriptHash(util.Hash160(multisig))
+
+	blocks := testBlocks(0, 1)
+	bulk := &tx.Bulk{
+		TXs:       []*tx.Transaction{testTx(1, blocks[0], "ContractTransaction"), testTx(2, blocks[1], "ContractTransaction")},
+		TXVins:    []*tx.TransactionVin{{TxId: 2, TxID: 1, Vout: 0}},
+		TXVouts:   []*tx.TransactionVout{{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(1), Address: addrB, AddressId: 2}},
+		TXScripts: []*tx.TransactionScripts{{TxId: 2, Invocation: "00", Verification: hex.EncodeToString(multisig)}},
+		Assets: []*asset.Asset{
+			{AssetID: "0xasset", Type: "Token", Name: "Token", Amount: big.NewFloat(100), Available: big.NewFloat(100), Precision: 8},
+			{AssetID: "visible", Type: "NEP5", Name: "Visible", Amount: big.NewFloat(0), Available: big.NewFloat(0), Precision: 8},
+			{AssetID: "hidden", Type: "NEP5", Name: "Hidden", Amount: big.NewFloat(0), Available: big.NewFloat(0), Precision: 8},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	execQueries(t, store,
+		"INSERT INTO `nep5` (`asset_id`, `admin_address`, `name`, `symbol`, `decimals`, `total_supply`, `tx_id`, `block_index`, `block_time`, `addresses`, `holding_addresses`, `transfers`, `visible`) VALUES (2, 'admin', 'Visible', 'VIS', 8, 0, 1, 0, 0, 1, 1, 1, 1), (3, 'admin', 'Hidden', 'HID', 8, 0, 1, 0, 0, 0, 0, 0, 0)",
+		fmt.Sprintf("INSERT INTO `address` (`address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES ('%s', 0, 0, 1, 0), ('%s', 0, 1, 2, 0), ('RichAddrC', 0, 0, 1, 1), ('RichAddrD', 0, 0, 1, 0)", addrA, addrB),
+		"INSERT INTO `addr_asset` (`address_id`, `asset_id`, `balance`, `transactions`, `last_transaction_time`) VALUES (1, 1, 50, 1, 0), (2, 1, 30, 2, 1), (3, 1, 0.5, 1, 0), (4, 1, 0, 1, 0), (3, 2, 7, 1, 0)",
+		fmt.Sprintf("INSERT INTO `smartcontract_info` (`tx_id`, `script_hash`, `name`, `version`, `author`, `email`, `description`, `need_storage`, `parameter_list`, `return_type`) VALUES (1, '%s', 'Contract', '1', '', '', '', 0, '', '')", util.GetAssetIDFromScriptHash(util.Hash160([]byte("contract")))),
+	)
+
+	assetIds, err := store.GetRichListAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(assetIds) != "[1 2]" {
+		t.Errorf("GetRichListAssets() = %v, want [1 2] without the hidden nep5 asset", assetIds)
+	}
+
+	check := func(assetId uint, want string) {
+		t.Helper()
+
+		d, err := store.GetAssetDistribution(assetId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := store.GetRichList(assetId, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprintf("%s %d %s %s %s %v %v", d.Supply, d.Holders, d.Top10Percentage, d.Top100Percentage, d.Gini, d.Bands[:4], entries)
+		if got != want {
+			t.Errorf("rich list of asset %d = %s, want %s", assetId, got, want)
+		}
+	}
+
+	for _, assetId := range assetIds {
+		if _, err := store.UpdateRichList(assetId, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Gini of 50, 30 and 0.5 is (4 * 80.5 - 2 * (50 + 60 + 1.5)) / (3 * 80.5).
+	check(1, "100.00000000 3 80.50000000 80.50000000 0.40993789 "+
+		"[{0.00000000 1 0.50000000} {1.00000000 0 0.00000000} {10.00000000 2 80.00000000} {100.00000000 0 0.00000000}] "+
+		fmt.Sprintf("[{1 %s 50.00000000 50.00000000 contract} {2 %s 30.00000000 30.00000000 multisig}]", addrA, addrB))
+	// Supply of the nep5 asset falls back to the sum of balances.
+	check(2, "7.00000000 1 100.00000000 100.00000000 0.00000000 "+
+		"[{0.00000000 0 0.00000000} {1.00000000 1 7.00000000} {10.00000000 0 0.00000000} {100.00000000 0 0.00000000}] "+
+		"[{1 RichAddrC 7.00000000 100.00000000 }]")
+
+	// Rich lists are replaced on update.
+	if _, err := store.UpdateRichList(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := store.GetRichListSize(1); err != nil || size != 1 {
+		t.Errorf("GetRichListSize(1) = %d, %v after update with top 1, want 1", size, err)
+	}
+
+	// Rich lists computed at rolled back heights are removed.
+	if _, err := store.RollbackBlocks(1); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := store.GetAssetDistribution(1); err != nil || d != nil {
+		t.Errorf("GetAssetDistribution(1) = %+v, %v after rollback, want nil", d, err)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `rich_list`"); n != 0 {
+		t.Errorf("%d rich_list rows left after rollback, want 0", n)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `asset_balance_band`"); n != 0 {
+		t.Errorf("%d asset_balance_band rows left after rollback, want 0", n)
+	}
+}
@@ -0,0 +1,652 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+)
+
+// RollbackReport describes what has been undone by RollbackBlocks.
+type RollbackReport struct {
+	FromHeight int
+	ToHeight   int
+	// Pk range of the removed transactions, both are 0 if there is none.
+	FirstTxPk uint
+	LastTxPk  uint
+	Rows      []RollbackRows
+	// Notes lists derived data which cannot be restored exactly.
+	Notes []string
+}
+
+// RollbackRows records affected rows of a single rollback statement.
+type RollbackRows struct {
+	Table  string
+	Action string
+	Rows   int64
+}
+
+type addrAssetKey struct {
+	addressId uint
+	assetId   uint
+}
+
+// GetBlockHash returns hash of the stored block, or empty string if not exists.
+func (store *SQLStore) GetBlockHash(index int) string {
+	if index < 0 {
+		return ""
+	}
+
+	var hash string
+	const query = "SELECT `hash` FROM `block` WHERE `index` = ? LIMIT 1"
+	err := store.db.QueryRow(query, index).Scan(&hash)
+	if err != nil && err != sql.ErrNoRows {
+		if !store.connErr(err) {
+			panic(err)
+		}
+		store.reconnect()
+		return store.GetBlockHash(index)
+	}
+
+	return hash
+}
+
+// RollbackBlocks removes all blocks whose index >= height,
+// and reverts every derived record of their transactions in one db transaction.
+func (store *SQLStore) RollbackBlocks(height int) (*RollbackReport, error) {
+	counter := store.getCounterInstance()
+	report := &RollbackReport{}
+
+	err := store.transact(func(trans *sql.Tx) error {
+		*report = RollbackReport{
+			FromHeight: height,
+			ToHeight:   counter.LastBlockIndex,
+		}
+
+		var firstTxPk, lastTxPk sql.NullInt64
+		const query = "SELECT MIN(`id`), MAX(`id`) FROM `tx` WHERE `block_index` >= ?"
+		if err := trans.QueryRow(query, height).Scan(&firstTxPk, &lastTxPk); err != nil {
+			return err
+		}
+
+		if firstTxPk.Valid {
+			report.FirstTxPk = uint(firstTxPk.Int64)
+			report.LastTxPk = uint(lastTxPk.Int64)
+
+			if err := rollbackTxs(trans, report, counter); err != nil {
+				return err
+			}
+		}
+
+		if err := deleteSnapshots(trans, report, "`height` >= ?", height); err != nil {
+			return err
+		}
+		if err := deleteRichLists(trans, report, "`block_index` >= ?", height); err != nil {
+			return err
+		}
+
+		var firstBlockTime sql.NullInt64
+		if err := trans.QueryRow("SELECT MIN(`time`) FROM `block` WHERE `index` >= ?", height).Scan(&firstBlockTime); err != nil {
+			return err
+		}
+		if firstBlockTime.Valid {
+			if err := deleteDailyStats(trans, report, firstBlockTime.Int64); err != nil {
+				return err
+			}
+		}
+
+		if err := report.exec(trans, "asset", "deleted", "DELETE FROM `asset` WHERE `block_index` >= ?", height); err != nil {
+			return err
+		}
+		if err := report.exec(trans, "block", "deleted", "DELETE FROM `block` WHERE `index` >= ?", height); err != nil {
+			return err
+		}
+		if err := report.exec(trans, "block_sys_fee", "deleted", "DELETE FROM `block_sys_fee` WHERE `block_index` >= ?", height); err != nil {
+			return err
+		}
+		if err := rollbackAddrs(trans, report); err != nil {
+			return err
+		}
+
+		return updateCounter(trans, "last_block_index", int64(height-1))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func rollbackTxs(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	first := r.FirstTxPk
+
+	// Derived data must be reverted before raw transaction data is removed.
+	if counter.LastTxPk >= first {
+		if err := rollbackUTXOs(trans, r, counter.LastTxPk); err != nil {
+			return err
+		}
+		if err := updateCounter(trans, "last_tx_pk", int64(first-1)); err != nil {
+			return err
+		}
+	}
+
+	if err := rollbackBalanceHistory(trans, r, counter); err != nil {
+		return err
+	}
+
+	if err := rollbackNep5(trans, r, counter); err != nil {
+		return err
+	}
+
+	if err := r.exec(trans, "addr_tx", "deleted", "DELETE FROM `addr_tx` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "asset_tx", "deleted", "DELETE FROM `asset_tx` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+	if counter.LastAssetTxPk >= first {
+		if err := updateCounter(trans, "last_asset_tx_pk", int64(first-1)); err != nil {
+			return err
+		}
+	}
+
+	if err := r.exec(trans, "smartcontract_info", "deleted", "DELETE FROM `smartcontract_info` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+	// Pks of removed transactions will be reused.
+	if err := r.exec(trans, "task_error", "deleted", "DELETE FROM `task_error` WHERE `tx_pk` >= ?", first); err != nil {
+		return err
+	}
+	if err := rollbackWatchDeliveries(trans, r, first); err != nil {
+		return err
+	}
+	if counter.LastTxPkForSC >= first {
+		if err := updateCounter(trans, "last_tx_pk_for_sc", int64(first-1)); err != nil {
+			return err
+		}
+	}
+
+	txs, err := queryTxTypes(trans, first)
+	if err != nil {
+		return err
+	}
+	for txType, cnt := range countTxTypes(txs) {
+		if err := updateTxCounter(trans, txType, -cnt); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"tx_attr", "tx_vin", "tx_vout", "tx_scripts", "tx_claims"} {
+		query := fmt.Sprintf("DELETE FROM `%s` WHERE `tx_id` >= ?", table)
+		if err := r.exec(trans, table, "deleted", query, first); err != nil {
+			return err
+		}
+	}
+
+	return r.exec(trans, "tx", "deleted", "DELETE FROM `tx` WHERE `id` >= ?", first)
+}
+
+func queryTxTypes(trans *sql.Tx, first uint) ([]*tx.Transaction, error) {
+	rows, err := trans.Query("SELECT `type` FROM `tx` WHERE `id` >= ?", first)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := []*tx.Transaction{}
+	for rows.Next() {
+		t := &tx.Transaction{}
+		if err := rows.Scan(&t.Type); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+
+	return txs, rows.Err()
+}
+
+// rollbackUTXOs reverts results of ApplyVinsVouts for transactions in [first, last].
+func rollbackUTXOs(trans *sql.Tx, r *RollbackReport, last uint) error {
+	first := r.FirstTxPk
+	balances := make(map[addrAssetKey]*big.Float)
+	// Every transaction counts once for each address-asset pair it touches.
+	touched := make(map[uint]map[addrAssetKey]bool)
+
+	touch := func(txPk uint, key addrAssetKey, delta *big.Float) {
+		if _, ok := balances[key]; !ok {
+			balances[key] = big.NewFloat(0)
+		}
+		balances[key] = new(big.Float).Add(balances[key], delta)
+
+		if _, ok := touched[txPk]; !ok {
+			touched[txPk] = make(map[addrAssetKey]bool)
+		}
+		touched[txPk][key] = true
+	}
+
+	err := queryRows(trans, func(rows *sql.Rows) error {
+		var txPk uint
+		var usedIn sql.NullInt64
+		var key addrAssetKey
+		var valueStr string
+
+		if err := rows.Scan(&txPk, &usedIn, &key.addressId, &key.assetId, &valueStr); err != nil {
+			return err
+		}
+
+		value := util.StrToBigFloat(valueStr)
+		if txPk >= first {
+			touch(txPk, key, new(big.Float).Neg(value))
+		}
+		if usedIn.Valid && uint(usedIn.Int64) >= first {
+			touch(uint(usedIn.Int64), key, value)
+		}
+
+		return nil
+	}, "SELECT `tx_id`, `used_in_tx`, `address_id`, `asset_id`, `value` FROM `utxo` WHERE `tx_id` >= ? OR `used_in_tx` >= ?", first, first)
+	if err != nil {
+		return err
+	}
+
+	pairTxs := make(map[addrAssetKey]int)
+	assetTxs := make(map[uint]int)
+	addrTxs := make(map[uint]int)
+
+	for _, keys := range touched {
+		assets := make(map[uint]bool)
+		addrs := make(map[uint]bool)
+
+		for key := range keys {
+			pairTxs[key]++
+			assets[key.assetId] = true
+			addrs[key.addressId] = true
+		}
+		for assetId := range assets {
+			assetTxs[assetId]++
+		}
+		for addressId := range addrs {
+			addrTxs[addressId]++
+		}
+	}
+
+	for key, delta := range balances {
+		query := fmt.Sprintf("UPDATE `addr_asset` SET `balance` = `balance` + %.8f, `transactions` = `transactions` - %d WHERE `address_id` = '%d' AND `asset_id` = '%d' LIMIT 1", delta, pairTxs[key], key.addressId, key.assetId)
+		if err := r.exec(trans, "addr_asset", "updated", query); err != nil {
+			return err
+		}
+	}
+	for assetId, cnt := range assetTxs {
+		const query = "UPDATE `asset` SET `transactions` = `transactions` - ? WHERE `id` = ? LIMIT 1"
+		if err := r.exec(trans, "asset", "updated", query, cnt, assetId); err != nil {
+			return err
+		}
+	}
+	for addressId, cnt := range addrTxs {
+		const query = "UPDATE `address` SET `trans_asset` = `trans_asset` - ? WHERE `id` = ? LIMIT 1"
+		if err := r.exec(trans, "address", "updated", query, cnt, addressId); err != nil {
+			return err
+		}
+	}
+
+	if err := rollbackAvailable(trans, r, last); err != nil {
+		return err
+	}
+
+	if err := r.exec(trans, "utxo", "restored", "UPDATE `utxo` SET `used_in_tx` = NULL WHERE `used_in_tx` >= ?", first); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "utxo", "deleted", "DELETE FROM `utxo` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+
+	r.Notes = append(r.Notes, "last_transaction_time of address and addr_asset is not restored")
+	return nil
+}
+
+// rollbackAvailable reverts asset amount issued by claim and issue transactions.
+func rollbackAvailable(trans *sql.Tx, r *RollbackReport, last uint) error {
+	gasId, _ := cache.LookupAssetId(asset.GASAssetID)
+	issued := make(map[uint]*big.Float)
+
+	err := queryRows(trans, func(rows *sql.Rows) error {
+		var txType string
+		var assetId uint
+		var valueStr string
+
+		if err := rows.Scan(&txType, &assetId, &valueStr); err != nil {
+			return err
+		}
+
+		if (txType == "ClaimTransaction" && assetId == gasId) ||
+			(txType == "IssueTransaction" && assetId != gasId) {
+			if _, ok := issued[assetId]; !ok {
+				issued[assetId] = big.NewFloat(0)
+			}
+			issued[assetId] = new(big.Float).Add(issued[assetId], util.StrToBigFloat(valueStr))
+		}
+
+		return nil
+	}, "SELECT `tx`.`type`, `tx_vout`.`asset_id`, `tx_vout`.`value` FROM `tx_vout` INNER JOIN `tx` ON `tx`.`id` = `tx_vout`.`tx_id` WHERE `tx`.`id` BETWEEN ? AND ? AND `tx`.`type` IN ('ClaimTransaction', 'IssueTransaction')", r.FirstTxPk, last)
+	if err != nil {
+		return err
+	}
+
+	for assetId, amount := range issued {
+		query := fmt.Sprintf("UPDATE `asset` SET `available` = `available` - %.8f WHERE `id` = '%d' LIMIT 1", amount, assetId)
+		if err := r.exec(trans, "asset", "updated", query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollbackBalanceHistory reverts balance history of transactions whose pk >= r.FirstTxPk,
+// changes of utxo assets up to counter.LastTxPkBalance and of nep5 tx records up to counter.Nep5TxPkForBalance.
+// Records after the bucket of the last kept transaction are removed,
+// and records of that bucket get the reverted amount subtracted.
+// It must be called before nep5 tx records are removed.
+func rollbackBalanceHistory(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	first := r.FirstTxPk
+	if first <= 1 {
+		if err := r.exec(trans, "addr_balance_history", "deleted", "DELETE FROM `addr_balance_history`"); err != nil {
+			return err
+		}
+		if err := updateCounter(trans, "last_tx_pk_balance", 0); err != nil {
+			return err
+		}
+		return updateCounter(trans, "nep5_tx_pk_for_balance", 0)
+	}
+
+	var blockTime uint64
+	if err := trans.QueryRow("SELECT `block_time` FROM `tx` WHERE `id` = ? LIMIT 1", first-1).Scan(&blockTime); err != nil {
+		return err
+	}
+	keepBucket := balanceBucket(blockTime)
+
+	changes := make(map[balanceKey]*big.Float)
+	collect := func(sign int) func(rows *sql.Rows) error {
+		return func(rows *sql.Rows) error {
+			var key balanceKey
+			var blockTime uint64
+			var valueStr string
+
+			if err := rows.Scan(&key.addressId, &key.assetId, &blockTime, &valueStr); err != nil {
+				return err
+			}
+			if balanceBucket(blockTime) != keepBucket {
+				return nil
+			}
+
+			value := util.StrToBigFloat(valueStr)
+			if sign < 0 {
+				value.Neg(value)
+			}
+			key.bucket = keepBucket
+			if _, ok := changes[key]; !ok {
+				changes[key] = big.NewFloat(0)
+			}
+			changes[key] = new(big.Float).Add(changes[key], value)
+
+			return nil
+		}
+	}
+
+	if counter.LastTxPkBalance >= first {
+		const voutQuery = "SELECT `tx_vout`.`address_id`, `tx_vout`.`asset_id`, `tx`.`block_time`, `tx_vout`.`value` FROM `tx_vout` INNER JOIN `tx` ON `tx`.`id` = `tx_vout`.`tx_id` WHERE `tx_vout`.`tx_id` BETWEEN ? AND ?"
+		if err := queryRows(trans, collect(1), voutQuery, first, counter.LastTxPkBalance); err != nil {
+			return err
+		}
+
+		const vinQuery = "SELECT `v`.`address_id`, `v`.`asset_id`, `tx`.`block_time`, `v`.`value` FROM `tx_vin` INNER JOIN `tx` ON `tx`.`id` = `tx_vin`.`tx_id` INNER JOIN `tx_vout` `v` ON `v`.`tx_id` = `tx_vin`.`txid` AND `v`.`n` = `tx_vin`.`vout` WHERE `tx_vin`.`tx_id` BETWEEN ? AND ?"
+		if err := queryRows(trans, collect(-1), vinQuery, first, counter.LastTxPkBalance); err != nil {
+			return err
+		}
+	}
+
+	const nep5ToQuery = "SELECT `address`.`id`, `nep5_tx`.`asset_id`, `nep5_tx`.`block_time`, `nep5_tx`.`value` FROM `nep5_tx` INNER JOIN `address` ON `address`.`address` = `nep5_tx`.`to` WHERE `nep5_tx`.`tx_id` >= ? AND `nep5_tx`.`id` <= ?"
+	if err := queryRows(trans, collect(1), nep5ToQuery, first, counter.Nep5TxPkForBalance); err != nil {
+		return err
+	}
+	const nep5FromQuery = "SELECT `address`.`id`, `nep5_tx`.`asset_id`, `nep5_tx`.`block_time`, `nep5_tx`.`value` FROM `nep5_tx` INNER JOIN `address` ON `address`.`address` = `nep5_tx`.`from` WHERE `nep5_tx`.`tx_id` >= ? AND `nep5_tx`.`id` <= ?"
+	if err := queryRows(trans, collect(-1), nep5FromQuery, first, counter.Nep5TxPkForBalance); err != nil {
+		return err
+	}
+
+	if err := r.exec(trans, "addr_balance_history", "deleted", "DELETE FROM `addr_balance_history` WHERE `bucket_time` > ?", keepBucket); err != nil {
+		return err
+	}
+
+	for key, change := range changes {
+		query := fmt.Sprintf("UPDATE `addr_balance_history` SET `balance` = `balance` - %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' AND `bucket_time` = %d LIMIT 1", change, key.addressId, key.assetId, key.bucket)
+		if err := r.exec(trans, "addr_balance_history", "updated", query); err != nil {
+			return err
+		}
+	}
+
+	if counter.LastTxPkBalance >= first {
+		if err := updateCounter(trans, "last_tx_pk_balance", int64(first-1)); err != nil {
+			return err
+		}
+	}
+
+	var keptNep5TxPk uint
+	if err := trans.QueryRow("SELECT COALESCE(MAX(`id`), 0) FROM `nep5_tx` WHERE `tx_id` < ?", first).Scan(&keptNep5TxPk); err != nil {
+		return err
+	}
+	if counter.Nep5TxPkForBalance > keptNep5TxPk {
+		return updateCounter(trans, "nep5_tx_pk_for_balance", int64(keptNep5TxPk))
+	}
+
+	return nil
+}
+
+// rollbackNep5 removes nep5 records created by the rolled back transactions.
+func rollbackNep5(trans *sql.Tx, r *RollbackReport, counter Counter) error {
+	first := r.FirstTxPk
+
+	// Snapshots of nep5 assets which replayed the removed records.
+	var firstNep5TxPk sql.NullInt64
+	if err := trans.QueryRow("SELECT MIN(`id`) FROM `nep5_tx` WHERE `tx_id` >= ?", first).Scan(&firstNep5TxPk); err != nil {
+		return err
+	}
+	if firstNep5TxPk.Valid {
+		if err := deleteSnapshots(trans, r, "`end_pk` >= ? AND `asset_id` IN (SELECT `asset_id` FROM `nep5`)", firstNep5TxPk.Int64); err != nil {
+			return err
+		}
+	}
+
+	transfers := make(map[uint]int)
+	addrTransfers := make(map[string]int)
+
+	err := queryRows(trans, func(rows *sql.Rows) error {
+		var assetId uint
+		var from, to string
+
+		if err := rows.Scan(&assetId, &from, &to); err != nil {
+			return err
+		}
+
+		transfers[assetId]++
+		if len(from) > 0 {
+			addrTransfers[from]++
+		}
+		if len(to) > 0 && to != from {
+			addrTransfers[to]++
+		}
+
+		return nil
+	}, "SELECT `asset_id`, `from`, `to` FROM `nep5_tx` WHERE `tx_id` >= ?", first)
+	if err != nil {
+		return err
+	}
+
+	for assetId, cnt := range transfers {
+		const query = "UPDATE `nep5` SET `transfers` = `transfers` - ? WHERE `asset_id` = ? LIMIT 1"
+		if err := r.exec(trans, "nep5", "updated", query, cnt, assetId); err != nil {
+			return err
+		}
+	}
+	for addr, cnt := range addrTransfers {
+		const query = "UPDATE `address` SET `trans_nep5` = `trans_nep5` - ? WHERE `address` = ? LIMIT 1"
+		if err := r.exec(trans, "address", "updated", query, cnt, addr); err != nil {
+			return err
+		}
+	}
+
+	if err := r.exec(trans, "nep5_tx", "deleted", "DELETE FROM `nep5_tx` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+
+	// Nep5 assets registered in the rolled back blocks.
+	if err := r.exec(trans, "addr_asset", "deleted", "DELETE FROM `addr_asset` WHERE `asset_id` IN (SELECT `asset_id` FROM `nep5` WHERE `tx_id` >= ?)", first); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "nep5_reg_info", "deleted", "DELETE FROM `nep5_reg_info` WHERE `nep5_id` IN (SELECT `id` FROM `nep5` WHERE `tx_id` >= ?)", first); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "nep5", "deleted", "DELETE FROM `nep5` WHERE `tx_id` >= ?", first); err != nil {
+		return err
+	}
+
+	res, err := execute(trans, "DELETE FROM `nep5_migrate` WHERE `migrate_tx_id` >= ?", first)
+	if err != nil {
+		return err
+	}
+	if migrated, _ := res.RowsAffected(); migrated > 0 {
+		r.Rows = append(r.Rows, RollbackRows{Table: "nep5_migrate", Action: "deleted", Rows: migrated})
+		r.Notes = append(r.Notes, "addr_asset records moved by nep5 migration are not restored")
+	}
+
+	if counter.LastTxPkForNep5 >= first {
+		if err := updateNep5Counter(trans, first-1, -1); err != nil {
+			return err
+		}
+	}
+
+	var maxNep5TxPk uint
+	if err := trans.QueryRow("SELECT COALESCE(MAX(`id`), 0) FROM `nep5_tx`").Scan(&maxNep5TxPk); err != nil {
+		return err
+	}
+	if counter.Nep5TxPkForAddrTx > maxNep5TxPk {
+		if err := UpdateNep5TxPkForAddrTx(trans, maxNep5TxPk); err != nil {
+			return err
+		}
+	}
+
+	r.Notes = append(r.Notes, "nep5 balances are refreshed when the transfers are applied again")
+	return nil
+}
+
+// rollbackAddrs removes addresses which only appeared in the rolled back blocks.
+// Address pk is assigned in order of first appearance in tx_vout,
+// so these addresses are exactly the ones whose pk beyond the distinct vout address count.
+func rollbackAddrs(trans *sql.Tx, r *RollbackReport) error {
+	var addrCount uint
+	if err := trans.QueryRow("SELECT COUNT(DISTINCT `address`) FROM `tx_vout`").Scan(&addrCount); err != nil {
+		return err
+	}
+
+	addrs := make(map[uint]int)
+	holdings := make(map[uint]int)
+
+	err := queryRows(trans, func(rows *sql.Rows) error {
+		var assetId uint
+		var balanceStr string
+
+		if err := rows.Scan(&assetId, &balanceStr); err != nil {
+			return err
+		}
+
+		addrs[assetId]++
+		if util.StrToBigFloat(balanceStr).Cmp(big.NewFloat(0)) == 1 {
+			holdings[assetId]++
+		}
+
+		return nil
+	}, "SELECT `asset_id`, `balance` FROM `addr_asset` WHERE `address_id` > ?", addrCount)
+	if err != nil {
+		return err
+	}
+
+	for assetId, cnt := range addrs {
+		const assetQuery = "UPDATE `asset` SET `addresses` = `addresses` - ? WHERE `id` = ? LIMIT 1"
+		if err := r.exec(trans, "asset", "updated", assetQuery, cnt, assetId); err != nil {
+			return err
+		}
+
+		const nep5Query = "UPDATE `nep5` SET `addresses` = `addresses` - ?, `holding_addresses` = `holding_addresses` - ? WHERE `asset_id` = ? LIMIT 1"
+		if err := r.exec(trans, "nep5", "updated", nep5Query, cnt, holdings[assetId], assetId); err != nil {
+			return err
+		}
+	}
+
+	if err := r.exec(trans, "addr_asset", "deleted", "DELETE FROM `addr_asset` WHERE `address_id` > ?", addrCount); err != nil {
+		return err
+	}
+	if err := r.exec(trans, "addr_balance_history", "deleted", "DELETE FROM `addr_balance_history` WHERE `address_id` > ?", addrCount); err != nil {
+		return err
+	}
+
+	res, err := execute(trans, "DELETE FROM `address` WHERE `id` > ?", addrCount)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return nil
+	}
+
+	r.Rows = append(r.Rows, RollbackRows{Table: "address", Action: "deleted", Rows: deleted})
+	return incrAddrCounter(trans, -int(deleted))
+}
+
+// exec executes the rollback statement and records its affected rows.
+func (r *RollbackReport) exec(trans *sql.Tx, table string, action string, query string, args ...interface{}) error {
+	res, err := execute(trans, query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
+	}
+
+	for i := range r.Rows {
+		if r.Rows[i].Table == table && r.Rows[i].Action == action {
+			r.Rows[i].Rows += affected
+			return nil
+		}
+	}
+
+	r.Rows = append(r.Rows, RollbackRows{Table: table, Action: action, Rows: affected})
+	return nil
+}
+
+// queryRows reads all rows before returning,
+// so that the transaction can be used by following statements.
+func queryRows(trans *sql.Tx, scan func(*sql.Rows) error, query string, args ...interface{}) error {
+	rows, err := trans.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
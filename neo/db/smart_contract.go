@@ -8,12 +8,12 @@ import (
 )
 
 // InsertSCInfos persists new smart contracts info into db.
-func InsertSCInfos(scRegInfos []*nep5.RegInfo, txPK uint) error {
+func (store *SQLStore) InsertSCInfos(scRegInfos []*nep5.RegInfo, txPK uint) error {
 	if len(scRegInfos) == 0 {
-		return UpdateLastTxPkForSC(txPK)
+		return store.UpdateLastTxPkForSC(txPK)
 	}
 
-	return transact(func(trans *sql.Tx) error {
+	return store.transact(func(trans *sql.Tx) error {
 		query := "INSERT INTO `smartcontract_info`(`tx_id`, `script_hash`, `name`, `version`, `author`, `email`, `description`, `need_storage`, `parameter_list`, `return_type`) VALUES "
 		args := []interface{}{}
 
@@ -23,9 +23,9 @@ func InsertSCInfos(scRegInfos []*nep5.RegInfo, txPK uint) error {
 			args = append(args, regInfo.TxId, scriptHashHex, regInfo.Name, regInfo.Version, regInfo.Author, regInfo.Email, regInfo.Description, regInfo.NeedStorage, regInfo.ParameterList, regInfo.ReturnType)
 		}
 
-		_, err := trans.Exec(query[:len(query)-2], args...)
+		_, err := execute(trans, query[:len(query)-2], args...)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		return updateCounter(trans, "last_tx_pk_for_sc", int64(txPK))
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/util"
+	"sort"
+	"time"
+)
+
+// snapshotChunkSize is the number of transactions or nep5 transfers replayed in one db transaction.
+var snapshotChunkSize uint = 10000
+
+// Snapshot holds balances of all holders of an asset as of a block height,
+// Holders and Total are partial until the snapshot is finished.
+type Snapshot struct {
+	Id       uint   `json:"-"`
+	AssetId  uint   `json:"-"`
+	Height   uint   `json:"height"`
+	IsNep5   bool   `json:"nep5"`
+	LastPk   uint   `json:"-"`
+	EndPk    uint   `json:"-"`
+	Finished bool   `json:"finished"`
+	Holders  uint64 `json:"holders"`
+	Total    string `json:"total"`
+}
+
+// SnapshotBalance is the balance of a holder in a snapshot.
+type SnapshotBalance struct {
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+// CreateSnapshot returns the snapshot of the asset at the height, it is created if it does not exist.
+// Balances of utxo assets are replayed from tx_vout and tx_vin, and of nep5 assets from nep5_tx,
+// so the height must have been handled by the nep5 task for nep5 assets.
+func (store *SQLStore) CreateSnapshot(assetId uint, height uint) (*Snapshot, error) {
+	s, err := store.GetSnapshot(assetId, height)
+	if err != nil || s != nil {
+		return s, err
+	}
+
+	isNep5, err := store.IsNep5Asset(assetId)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored := store.GetLastHeight(); int(height) > stored {
+		return nil, fmt.Errorf("block %d is not stored yet, the highest stored block is %d", height, stored)
+	}
+
+	var endPk uint
+	const endTxPkQuery = "SELECT COALESCE(MAX(`id`), 0) FROM `tx` WHERE `block_index` <= ?"
+	if err := store.db.QueryRow(endTxPkQuery, height).Scan(&endPk); err != nil {
+		return nil, err
+	}
+
+	if isNep5 {
+		// Transfers of the transaction are partially stored if applogIdx is not -1.
+		lastPk, applogIdx := store.GetLastTxPkForNep5()
+		if applogIdx != -1 {
+			lastPk--
+		}
+		if endPk > lastPk {
+			return nil, fmt.Errorf("nep5 task has not handled block %d yet", height)
+		}
+
+		const endNep5PkQuery = "SELECT COALESCE(MAX(`id`), 0) FROM `nep5_tx` WHERE `asset_id` = ? AND `block_index` <= ?"
+		if err := store.db.QueryRow(endNep5PkQuery, assetId, height).Scan(&endPk); err != nil {
+			return nil, err
+		}
+	}
+
+	const insert = "INSERT INTO `snapshot` (`asset_id`, `height`, `last_pk`, `end_pk`, `created_at`) VALUES (?, ?, 0, ?, ?)"
+	if _, err := execute(store.db, insert, assetId, height, endPk, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+
+	return store.GetSnapshot(assetId, height)
+}
+
+// GetSnapshot returns the snapshot of the asset at the height, or nil if it does not exist.
+func (store *SQLStore) GetSnapshot(assetId uint, height uint) (*Snapshot, error) {
+	s := &Snapshot{AssetId: assetId, Height: height}
+
+	const query = "SELECT `id`, `last_pk`, `end_pk` FROM `snapshot` WHERE `asset_id` = ? AND `height` = ? LIMIT 1"
+	err := store.db.QueryRow(query, assetId, height).Scan(&s.Id, &s.LastPk, &s.EndPk)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.IsNep5, err = store.IsNep5Asset(assetId); err != nil {
+		return nil, err
+	}
+	s.Finished = s.LastPk >= s.EndPk
+
+	var totalStr string
+	const sumQuery = "SELECT COUNT(`id`), COALESCE(SUM(`balance`), 0) FROM `snapshot_balance` WHERE `snapshot_id` = ? AND `balance` > 0"
+	if err := store.db.QueryRow(sumQuery, s.Id).Scan(&s.Holders, &totalStr); err != nil {
+		return nil, err
+	}
+	s.Total = util.StrToBigFloat(totalStr).Text('f', 8)
+
+	return s, nil
+}
+
+// BuildSnapshot replays records of the snapshot chunk by chunk until it is finished,
+// progress is called after every chunk. It resumes from the last replayed chunk if it was interrupted.
+func (store *SQLStore) BuildSnapshot(s *Snapshot, progress func(s *Snapshot)) error {
+	for !s.Finished {
+		if err := store.continueSnapshot(s); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(s)
+		}
+	}
+
+	return nil
+}
+
+// continueSnapshot replays the next chunk of records of the snapshot in one db transaction.
+func (store *SQLStore) continueSnapshot(s *Snapshot) error {
+	deltas := make(map[uint]*big.Float)
+	add := func(addressId uint, value *big.Float) {
+		if addressId == 0 {
+			return
+		}
+		if delta, ok := deltas[addressId]; ok {
+			delta.Add(delta, value)
+			return
+		}
+		deltas[addressId] = new(big.Float).Set(value)
+	}
+
+	var next uint
+
+	err := store.transact(func(trans *sql.Tx) error {
+		if s.IsNep5 {
+			next = s.EndPk
+			rows := uint(0)
+
+			const query = "SELECT `nep5_tx`.`id`, COALESCE(`f`.`id`, 0), COALESCE(`t`.`id`, 0), `nep5_tx`.`value` FROM `nep5_tx` LEFT JOIN `address` `f` ON `f`.`address` = `nep5_tx`.`from` LEFT JOIN `address` `t` ON `t`.`address` = `nep5_tx`.`to` WHERE `nep5_tx`.`asset_id` = ? AND `nep5_tx`.`id` > ? AND `nep5_tx`.`id` <= ? ORDER BY `nep5_tx`.`id` ASC LIMIT ?"
+			err := queryRows(trans, func(r *sql.Rows) error {
+				var id, from, to uint
+				var valueStr string
+				if err := r.Scan(&id, &from, &to, &valueStr); err != nil {
+					return err
+				}
+
+				value := util.StrToBigFloat(valueStr)
+				add(from, new(big.Float).Neg(value))
+				add(to, value)
+
+				rows++
+				if rows == snapshotChunkSize {
+					next = id
+				}
+				return nil
+			}, query, s.AssetId, s.LastPk, s.EndPk, snapshotChunkSize)
+			if err != nil {
+				return err
+			}
+		} else {
+			next = s.LastPk + snapshotChunkSize
+			if next > s.EndPk {
+				next = s.EndPk
+			}
+
+			collect := func(sign int) func(r *sql.Rows) error {
+				return func(r *sql.Rows) error {
+					var addressId uint
+					var valueStr string
+					if err := r.Scan(&addressId, &valueStr); err != nil {
+						return err
+					}
+
+					value := util.StrToBigFloat(valueStr)
+					if sign < 0 {
+						value.Neg(value)
+					}
+					add(addressId, value)
+					return nil
+				}
+			}
+
+			const voutQuery = "SELECT `address_id`, `value` FROM `tx_vout` WHERE `tx_id` BETWEEN ? AND ? AND `asset_id` = ?"
+			if err := queryRows(trans, collect(1), voutQuery, s.LastPk+1, next, s.AssetId); err != nil {
+				return err
+			}
+
+			const vinQuery = "SELECT `v`.`address_id`, `v`.`value` FROM `tx_vin` INNER JOIN `tx_vout` `v` ON `v`.`tx_id` = `tx_vin`.`txid` AND `v`.`n` = `tx_vin`.`vout` WHERE `tx_vin`.`tx_id` BETWEEN ? AND ? AND `v`.`asset_id` = ?"
+			if err := queryRows(trans, collect(-1), vinQuery, s.LastPk+1, next, s.AssetId); err != nil {
+				return err
+			}
+		}
+
+		if err := applySnapshotDeltas(trans, s.Id, deltas); err != nil {
+			return err
+		}
+
+		// Another process replaying the same snapshot makes this chunk fail.
+		res, err := execute(trans, "UPDATE `snapshot` SET `last_pk` = ? WHERE `id` = ? AND `last_pk` = ? LIMIT 1", next, s.Id, s.LastPk)
+		if err != nil {
+			return err
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return fmt.Errorf("snapshot of asset %d at height %d is being built by another process", s.AssetId, s.Height)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.LastPk = next
+	s.Finished = s.LastPk >= s.EndPk
+	return nil
+}
+
+func applySnapshotDeltas(trans *sql.Tx, snapshotId uint, deltas map[uint]*big.Float) error {
+	addressIds := make([]uint, 0, len(deltas))
+	for addressId := range deltas {
+		addressIds = append(addressIds, addressId)
+	}
+	sort.Slice(addressIds, func(i, j int) bool { return addressIds[i] < addressIds[j] })
+
+	for _, addressId := range addressIds {
+		delta := deltas[addressId].Text('f', 8)
+		if util.StrToBigFloat(delta).Sign() == 0 {
+			continue
+		}
+
+		update := fmt.Sprintf("UPDATE `snapshot_balance` SET `balance` = `balance` + %s WHERE `snapshot_id` = '%d' AND `address_id` = '%d' LIMIT 1", delta, snapshotId, addressId)
+		res, err := execute(trans, update)
+		if err != nil {
+			return err
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			continue
+		}
+
+		insert := fmt.Sprintf("INSERT INTO `snapshot_balance` (`snapshot_id`, `address_id`, `balance`) VALUES ('%d', '%d', %s)", snapshotId, addressId, delta)
+		if _, err := execute(trans, insert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetSnapshotBalances returns paged holders of the snapshot, in descending order of balances.
+func (store *SQLStore) GetSnapshotBalances(snapshotId uint, limit int, offset int) ([]SnapshotBalance, error) {
+	balances := []SnapshotBalance{}
+
+	err := store.scanSnapshotBalances(snapshotId, limit, offset, func(b SnapshotBalance) error {
+		balances = append(balances, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// ScanSnapshotBalances calls fn with all holders of the snapshot in descending order of balances.
+func (store *SQLStore) ScanSnapshotBalances(snapshotId uint, fn func(b SnapshotBalance) error) error {
+	return store.scanSnapshotBalances(snapshotId, 0, 0, fn)
+}
+
+// scanSnapshotBalances scans paged holders of the snapshot, all holders are scanned if limit is 0.
+func (store *SQLStore) scanSnapshotBalances(snapshotId uint, limit int, offset int, fn func(b SnapshotBalance) error) error {
+	query := "SELECT `address`.`address`, `snapshot_balance`.`balance` FROM `snapshot_balance` INNER JOIN `address` ON `address`.`id` = `snapshot_balance`.`address_id` WHERE `snapshot_balance`.`snapshot_id` = ? AND `snapshot_balance`.`balance` > 0 ORDER BY `snapshot_balance`.`balance` DESC, `snapshot_balance`.`address_id` ASC"
+	args := []interface{}{snapshotId}
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	return store.scanRows(func(rows *sql.Rows) error {
+		var b SnapshotBalance
+		var balanceStr string
+		if err := rows.Scan(&b.Address, &balanceStr); err != nil {
+			return err
+		}
+
+		b.Balance = util.StrToBigFloat(balanceStr).Text('f', 8)
+		return fn(b)
+	}, query, args...)
+}
+
+// deleteSnapshots removes snapshots matching the condition with their balances.
+func deleteSnapshots(trans *sql.Tx, r *RollbackReport, cond string, args ...interface{}) error {
+	if err := r.exec(trans, "snapshot_balance", "deleted", "DELETE FROM `snapshot_balance` WHERE `snapshot_id` IN (SELECT `id` FROM `snapshot` WHERE "+cond+")", args...); err != nil {
+		return err
+	}
+
+	return r.exec(trans, "snapshot", "deleted", "DELETE FROM `snapshot` WHERE "+cond, args...)
+}
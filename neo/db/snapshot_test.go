@@ -0,0 +1,133 @@
+package db
+
+import (
+	"fmt"
+	"math/big"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	store := newTestStore(t)
+
+	defer func(size uint) { snapshotChunkSize = size }(snapshotChunkSize)
+	snapshotChunkSize = 1
+
+	// A gets 10 of asset 1 in block 0, sends 4 to B in block 1 and the rest to B in block 2.
+	// A mints 100 of nep5 asset 5 in block 0 and sends 30 to B in block 1, 20 to C in block 2.
+	blocks := testBlocks(0, 1, 2)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "ContractTransaction"),
+			testTx(2, blocks[1], "ContractTransaction"),
+			testTx(3, blocks[2], "ContractTransaction"),
+		},
+		TXVins: []*tx.TransactionVin{
+			{TxId: 2, TxID: 1, Vout: 0},
+			{TxId: 3, TxID: 2, Vout: 1},
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "SnapshotAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(4), Address: "SnapshotAddrB", AddressId: 2},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(6), Address: "SnapshotAddrA", AddressId: 1},
+			{TxId: 3, N: 0, AssetID: 1, Value: big.NewFloat(6), Address: "SnapshotAddrB", AddressId: 2},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	execQueries(t, store,
+		"INSERT INTO `nep5` (`asset_id`, `admin_address`, `name`, `symbol`, `decimals`, `total_supply`, `tx_id`, `block_index`, `block_time`, `addresses`, `holding_addresses`, `transfers`) VALUES (5, 'admin', 'Token', 'TKN', 8, 100, 1, 0, 0, 3, 3, 3)",
+		"INSERT INTO `address` (`address`, `created_at`, `last_transaction_time`, `trans_asset`, `trans_nep5`) VALUES ('SnapshotAddrA', 0, 2, 3, 3), ('SnapshotAddrB', 1, 2, 2, 1), ('SnapshotAddrC', 2, 2, 0, 1)",
+		"INSERT INTO `nep5_tx` (`tx_id`, `asset_id`, `from`, `to`, `value`, `block_index`, `block_time`) VALUES (1, 5, '', 'SnapshotAddrA', 100, 0, 0), (2, 5, 'SnapshotAddrA', 'SnapshotAddrB', 30, 1, 1), (3, 5, 'SnapshotAddrA', 'SnapshotAddrC', 20, 2, 2)",
+	)
+
+	if _, err := store.CreateSnapshot(5, 1); err == nil {
+		t.Error("created snapshot of nep5 asset at height not handled by nep5 task")
+	}
+	if err := store.UpdateLastTxPkForNep5(3, -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateSnapshot(1, 3); err == nil {
+		t.Error("created snapshot at height not stored yet")
+	}
+
+	check := func(assetId uint, height uint, want string) {
+		t.Helper()
+
+		s, err := store.GetSnapshot(assetId, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balances, err := store.GetSnapshotBalances(s.Id, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%v %d %s %v", s.Finished, s.Holders, s.Total, balances); got != want {
+			t.Errorf("snapshot of asset %d at height %d = %s, want %s", assetId, height, got, want)
+		}
+	}
+
+	// An interrupted snapshot resumes from the last replayed chunk.
+	s, err := store.CreateSnapshot(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.continueSnapshot(s); err != nil {
+		t.Fatal(err)
+	}
+	check(1, 1, "false 1 10.00000000 [{SnapshotAddrA 10.00000000}]")
+
+	if s, err = store.CreateSnapshot(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	chunks := 0
+	if err := store.BuildSnapshot(s, func(*Snapshot) { chunks++ }); err != nil {
+		t.Fatal(err)
+	}
+	if chunks != 1 {
+		t.Errorf("replayed %d chunks after resuming, want 1", chunks)
+	}
+	check(1, 1, "true 2 10.00000000 [{SnapshotAddrA 6.00000000} {SnapshotAddrB 4.00000000}]")
+
+	for _, snapshot := range []struct {
+		assetId uint
+		height  uint
+		want    string
+	}{
+		{1, 2, "true 1 10.00000000 [{SnapshotAddrB 10.00000000}]"},
+		{5, 1, "true 2 100.00000000 [{SnapshotAddrA 70.00000000} {SnapshotAddrB 30.00000000}]"},
+		{5, 2, "true 3 100.00000000 [{SnapshotAddrA 50.00000000} {SnapshotAddrB 30.00000000} {SnapshotAddrC 20.00000000}]"},
+	} {
+		s, err := store.CreateSnapshot(snapshot.assetId, snapshot.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.BuildSnapshot(s, nil); err != nil {
+			t.Fatal(err)
+		}
+		check(snapshot.assetId, snapshot.height, snapshot.want)
+	}
+
+	all := []string{}
+	err = store.ScanSnapshotBalances(s.Id, func(b SnapshotBalance) error {
+		all = append(all, b.Address)
+		return nil
+	})
+	if err != nil || fmt.Sprint(all) != "[SnapshotAddrA SnapshotAddrB]" {
+		t.Errorf("ScanSnapshotBalances() = %v, %v, want holders A and B", all, err)
+	}
+
+	// Snapshots of rolled back blocks are removed.
+	if _, err := store.RollbackBlocks(2); err != nil {
+		t.Fatal(err)
+	}
+	for _, snapshot := range []struct {
+		assetId uint
+		height  uint
+		kept    bool
+	}{{1, 1, true}, {1, 2, false}, {5, 1, true}, {5, 2, false}} {
+		if s, err := store.GetSnapshot(snapshot.assetId, snapshot.height); err != nil || (s != nil) != snapshot.kept {
+			t.Errorf("GetSnapshot(%d, %d) = %+v, %v after rollback, want kept %v", snapshot.assetId, snapshot.height, s, err, snapshot.kept)
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+)
+
+var sqliteDialect = &dialect{
+	name: "sqlite",
+	open: func(dsn string) (*sql.DB, error) {
+		return sql.OpenDB(&rewriteConnector{
+			driver: &sqlite3.SQLiteDriver{},
+			dsn:    dsn,
+			rewrite: func(query string) string {
+				return rewrite(query, '`', false)
+			},
+		}), nil
+	},
+	isConnErr: func(err error) bool {
+		if e, ok := err.(sqlite3.Error); ok {
+			return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+		}
+
+		return false
+	},
+}
+
+// sqliteDSN returns connection string of the sqlite database file.
+// Tasks write concurrently, so transactions take the write lock when they begin
+// and wait for others instead of failing.
+func sqliteDSN(path string) string {
+	params := url.Values{}
+	params.Set("_busy_timeout", "60000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+
+	return fmt.Sprintf("file:%s?%s", path, params.Encode())
+}
+
+// openSQLite opens the sqlite database file and creates tables if not exist.
+func (store *SQLStore) openSQLite(path string) {
+	store.connect(sqliteDialect, sqliteDSN(path))
+
+	if _, err := store.db.Exec(sqliteSchema); err != nil {
+		panic(err)
+	}
+}
+
+// sqliteSchema is equivalent to sqls/create_table.sql.
+const sqliteSchema = `
+create table if not exists addr_asset
+(
+    id           integer primary key autoincrement,
+    address_id   int                       not null,
+    asset_id     int                       not null,
+    balance      decimal(35, 8)           not null,
+    transactions bigint unsigned          not null,
+    last_transaction_time bigint unsigned not null
+);
+
+create index if not exists addr_asset_asset_id_balance_index
+    on addr_asset(asset_id, balance);
+
+create unique index if not exists addr_asset_address_id_asset_id_uindex
+    on addr_asset(address_id, asset_id);
+
+
+create table if not exists addr_tx
+(
+    id         integer primary key autoincrement,
+    tx_id      int         not null,
+    address_id  int        not null,
+    block_time bigint unsigned not null,
+    asset_type varchar(16)     not null
+);
+
+create unique index if not exists addr_tx_address_id_asset_type_txid_uindex
+    on addr_tx(address_id, asset_type, tx_id);
+
+create index if not exists addr_tx_txid
+    on addr_tx(tx_id);
+
+create index if not exists addr_tx_address_id
+    on addr_tx(address_id);
+
+
+create table if not exists address
+(
+    id                    integer primary key autoincrement,
+    address               varchar(128)     not null,
+    created_at            bigint unsigned not null,
+    last_transaction_time bigint unsigned not null,
+    trans_asset           bigint unsigned not null,
+    trans_nep5           bigint unsigned not null
+);
+
+create unique index if not exists uk_address
+    on address(address);
+
+create index if not exists idx_address_created_at
+    on address(created_at);
+
+
+create table if not exists asset
+(
+    id           integer primary key autoincrement,
+    block_index  int unsigned     not null,
+    block_time   bigint unsigned  not null,
+    version      int unsigned     not null,
+    asset_id     char(66)         not null,
+    type         varchar(32)      not null,
+    name         varchar(128)      not null,
+    amount       decimal(35, 8)   not null,
+    available    decimal(35, 8)   not null,
+    "precision"  tinyint unsigned not null,
+    owner        char(66)         not null,
+    admin        char(34)         not null,
+    issuer       char(66)         not null,
+    expiration   bigint unsigned  not null,
+    frozen       tinyint(1)       not null,
+    addresses    bigint unsigned  not null,
+    transactions bigint unsigned  not null
+);
+
+create index if not exists idx_asset_asset_id
+    on asset(asset_id);
+
+create index if not exists idx_asset_time
+    on asset(block_time);
+
+
+create table if not exists asset_tx
+(
+    id          integer primary key autoincrement,
+    address_id  int       not null,
+    asset_id    int             not null,
+    tx_id       int             not null
+);
+
+create index if not exists idx_asset_tx_address_id_asset_id
+    on asset_tx(address_id, asset_id);
+
+create unique index if not exists idx_asset_tx_address_id_asset_id_txid
+    on asset_tx(address_id, asset_id, tx_id);
+
+
+create table if not exists block
+(
+    id                  integer primary key autoincrement,
+    hash                char(66)        not null,
+    size                int             not null,
+    version             int unsigned    not null,
+    previousblockhash   char(66)        not null,
+    merkleroot          char(66)        not null,
+    time                bigint unsigned not null,
+    "index"             int unsigned    not null,
+    nonce               char(16)        not null,
+    nextconsensus       char(34)        not null,
+    script_invocation   text            not null,
+    script_verification text            not null,
+    nextblockhash       char(66)        not null
+);
+
+create index if not exists idx_block_hash
+    on block(hash);
+
+create unique index if not exists idx_block_index
+    on block("index");
+
+create index if not exists idx_block_time
+    on block(time);
+
+create table if not exists tx
+(
+    id          integer primary key autoincrement,
+    block_index int unsigned    not null,
+    block_time  bigint unsigned not null,
+    txid        char(66)        not null,
+    size        int unsigned    not null,
+    type        varchar(32)     not null,
+    version     int unsigned    not null,
+    sys_fee     decimal(27, 8)  not null,
+    net_fee     decimal(27, 8)  not null,
+    nonce       bigint          not null,
+    script      text            not null,
+    gas         decimal(27, 8)  not null
+);
+
+create index if not exists idx_tx_block_index
+    on tx(block_index);
+
+create index if not exists idx_tx_txid
+    on tx(txid);
+
+create index if not exists idx_tx_type
+    on tx(type);
+
+
+create table if not exists tx_attr
+(
+    id      integer primary key autoincrement,
+    tx_id   int         not null,
+    "usage" varchar(32) not null,
+    data    mediumtext  not null
+);
+
+create index if not exists idx_tx_attr_txid
+    on tx_attr(tx_id);
+
+create index if not exists idx_tx_attr_usage
+    on tx_attr("usage");
+
+
+create table if not exists tx_claims
+(
+    id   integer primary key autoincrement,
+    tx_id   int         not null,
+    txid   int     not null,
+    vout int unsigned not null
+);
+
+create index if not exists idx_tx_claims_txid
+    on tx_claims(tx_id);
+
+create index if not exists idx_tx_claims_txid_vout
+    on tx_claims(txid, vout);
+
+
+create table if not exists tx_scripts
+(
+    id           integer primary key autoincrement,
+    tx_id   int         not null,
+    invocation   text     not null,
+    verification text     not null
+);
+
+create index if not exists idx_tx_scripts_txid
+    on tx_scripts(tx_id);
+
+
+create table if not exists tx_vin
+(
+    id     integer primary key autoincrement,
+    tx_id   int         not null,
+    txid   int     not null,
+    vout   int unsigned not null
+);
+
+create index if not exists idx_tx_vin_tx_id
+    on tx_vin(tx_id);
+
+create index if not exists idx_tx_vin_txid
+on tx_vin(txid);
+
+
+create table if not exists tx_vout
+(
+    id       integer primary key autoincrement,
+    tx_id   int         not null,
+    n        int unsigned   not null,
+    asset_id int            not null,
+    value    decimal(35, 8) not null,
+    address  char(34)       not null,
+    address_id  int         not null
+);
+
+create index if not exists idx_tx_vout_address
+    on tx_vout(address);
+
+create index if not exists idx_tx_vout_address_id
+    on tx_vout(address_id);
+
+create index if not exists idx_tx_vout_asset_id
+    on tx_vout(asset_id);
+
+create index if not exists idx_tx_vout_txid
+    on tx_vout(tx_id);
+
+
+create table if not exists utxo
+(
+    id         integer primary key autoincrement,
+    address_id    int            not null,
+    tx_id      int            not null,
+    n          int unsigned   not null,
+    asset_id   int           not null,
+    value      decimal(35, 8) not null,
+    used_in_tx int
+);
+
+create index if not exists idx_utxo_address_id
+    on utxo(address_id);
+
+create index if not exists idx_utxo_asset_id
+    on utxo(asset_id);
+
+create index if not exists idx_utxo_txid
+    on utxo(tx_id);
+
+create index if not exists idx_utxo_used_in_tx
+    on utxo(used_in_tx);
+
+
+create table if not exists counter
+(
+    id                     integer primary key autoincrement,
+    last_block_index       int          not null,
+    last_tx_pk             int unsigned not null,
+    last_asset_tx_pk       int unsigned not null,
+    last_tx_pk_for_nep5    int unsigned not null,
+    app_log_idx            int          not null,
+    last_tx_pk_for_sc      int unsigned not null,
+    nep5_tx_pk_for_addr_tx int unsigned not null,
+    last_tx_pk_balance     int unsigned not null,
+    nep5_tx_pk_for_balance int unsigned not null,
+    cnt_addr               int unsigned not null,
+    cnt_tx_reg             int unsigned not null,
+    cnt_tx_miner           int unsigned not null,
+    cnt_tx_issue           int unsigned not null,
+    cnt_tx_invocation      int unsigned not null,
+    cnt_tx_contract        int unsigned not null,
+    cnt_tx_claim           int unsigned not null,
+    cnt_tx_publish         int unsigned not null,
+    cnt_tx_enrollment      int unsigned not null
+);
+
+create table if not exists smartcontract_info
+(
+    id             integer primary key autoincrement,
+    tx_id          int          not null,
+    script_hash    char(40)     not null,
+    name           varchar(255) not null,
+    version        varchar(255) not null,
+    author         varchar(255) not null,
+    email          varchar(255) not null,
+    description    varchar(255) not null,
+    need_storage   tinyint(1)   not null,
+    parameter_list varchar(255) not null,
+    return_type    varchar(255) not null
+);
+
+create index if not exists idx_script_hash
+    on smartcontract_info(script_hash);
+
+
+create table if not exists nep5
+(
+    id                integer primary key autoincrement,
+    asset_id          int                  not null,
+    admin_address     char(40)             not null,
+    name              varchar(128)          not null,
+    symbol            varchar(16)          not null,
+    decimals          tinyint unsigned     not null,
+    total_supply      decimal(35, 8)       not null,
+    tx_id             int                  not null,
+    block_index       int unsigned         not null,
+    block_time        bigint unsigned      not null,
+    addresses         bigint unsigned      not null,
+    holding_addresses bigint unsigned      not null,
+    transfers         bigint unsigned      not null,
+    visible           tinyint(1) default 1 not null
+);
+
+create index if not exists idx_nep5_txid
+    on nep5(tx_id);
+
+
+create table if not exists nep5_reg_info
+(
+    id             integer primary key autoincrement,
+    nep5_id        int unsigned not null,
+    name           varchar(255) not null,
+    version        varchar(255) not null,
+    author         varchar(255) not null,
+    email          varchar(255) not null,
+    description    varchar(255) not null,
+    need_storage   tinyint(1)   not null,
+    parameter_list varchar(255) not null,
+    return_type    varchar(255) not null
+);
+
+create index if not exists idx_nep5_id
+    on nep5_reg_info(nep5_id);
+
+
+create table if not exists nep5_tx
+(
+    id          integer primary key autoincrement,
+    tx_id       int             not null,
+    asset_id    int             not null,
+    "from"      varchar(128)     not null,
+    "to"        varchar(128)     not null,
+    value       double          not null,
+    block_index int unsigned    not null,
+    block_time  bigint unsigned not null
+);
+
+create index if not exists idx_nep5_tx_asset_id
+    on nep5_tx(asset_id);
+
+create index if not exists idx_nep5_tx_from
+    on nep5_tx("from");
+
+create index if not exists idx_nep5_tx_to
+    on nep5_tx("to");
+
+create index if not exists idx_nep5_tx_txid
+    on nep5_tx(tx_id);
+
+
+create table if not exists nep5_migrate
+(
+    id           integer primary key autoincrement,
+    old_asset_id char(40) not null,
+    new_asset_id char(40) not null,
+    migrate_tx_id int not null
+);
+
+-- bucket_time is the unix time the hour or day starts at, balance is the one at the end of it.
+create table if not exists addr_balance_history
+(
+    id          integer primary key autoincrement,
+    address_id  int unsigned   not null,
+    asset_id    int unsigned   not null,
+    bucket_time bigint         not null,
+    balance     decimal(35, 8) not null
+);
+
+create unique index if not exists uk_addr_balance_history
+    on addr_balance_history(address_id, asset_id, bucket_time);
+
+create index if not exists idx_addr_balance_history_bucket_time
+    on addr_balance_history(bucket_time);
+
+create table if not exists task_error
+(
+    id         integer primary key autoincrement,
+    task       varchar(32)     not null,
+    tx_pk      int unsigned    not null,
+    error      text            not null,
+    created_at bigint unsigned not null
+);
+
+create unique index if not exists uk_task_error_task_tx_pk
+    on task_error(task, tx_pk);
+
+-- address_id is 0 for total supply.
+create table if not exists nep5_reconcile
+(
+    id          integer primary key autoincrement,
+    asset_id    int unsigned    not null,
+    address_id  int unsigned    not null,
+    old_value   decimal(35, 8)  not null,
+    new_value   decimal(35, 8)  not null,
+    block_index int unsigned    not null,
+    created_at  bigint unsigned not null
+);
+
+create index if not exists idx_nep5_reconcile_asset_id
+    on nep5_reconcile(asset_id);
+
+-- total_sys_fee is the sum of system fees of blocks [0, block_index] in whole GAS.
+create table if not exists block_sys_fee
+(
+    id            integer primary key autoincrement,
+    block_index   int unsigned    not null,
+    total_sys_fee bigint unsigned not null
+);
+
+create unique index if not exists uk_block_sys_fee_block_index
+    on block_sys_fee(block_index);
+
+-- last_pk and end_pk are pks of tx for utxo assets or of nep5_tx for nep5 assets,
+-- records up to last_pk have been replayed, the snapshot is finished once last_pk reaches end_pk.
+create table if not exists snapshot
+(
+    id         integer primary key autoincrement,
+    asset_id   int unsigned    not null,
+    height     int unsigned    not null,
+    last_pk    int unsigned    not null,
+    end_pk     int unsigned    not null,
+    created_at bigint unsigned not null
+);
+
+create unique index if not exists uk_snapshot_asset_id_height
+    on snapshot(asset_id, height);
+
+create table if not exists snapshot_balance
+(
+    id          integer primary key autoincrement,
+    snapshot_id int unsigned   not null,
+    address_id  int unsigned   not null,
+    balance     decimal(35, 8) not null
+);
+
+create unique index if not exists uk_snapshot_balance_snapshot_id_address_id
+    on snapshot_balance(snapshot_id, address_id);
+
+create index if not exists idx_snapshot_balance_snapshot_id_balance
+    on snapshot_balance(snapshot_id, balance);
+
+-- rich_list holds the largest holders of every asset, recomputed by the rich_list task,
+-- percentage is the share of supply in percent, label is 'contract' or 'multisig' when known.
+create table if not exists rich_list
+(
+    id         integer primary key autoincrement,
+    asset_id   int unsigned   not null,
+    ranking    int unsigned   not null,
+    address_id int unsigned   not null,
+    balance    decimal(35, 8) not null,
+    percentage decimal(11, 8) not null,
+    label      varchar(16)    not null
+);
+
+create unique index if not exists uk_rich_list_asset_id_ranking
+    on rich_list(asset_id, ranking);
+
+create table if not exists asset_distribution
+(
+    id                integer primary key autoincrement,
+    asset_id          int unsigned    not null,
+    supply            decimal(35, 8)  not null,
+    holders           bigint unsigned not null,
+    top10_percentage  decimal(11, 8)  not null,
+    top100_percentage decimal(11, 8)  not null,
+    gini              decimal(9, 8)   not null,
+    block_index       int unsigned    not null,
+    updated_at        bigint unsigned not null
+);
+
+create unique index if not exists uk_asset_distribution_asset_id
+    on asset_distribution(asset_id);
+
+-- holders with balances in [lower_bound, lower_bound * 10), or in (0, 1) for the band of lower_bound 0.
+create table if not exists asset_balance_band
+(
+    id          integer primary key autoincrement,
+    asset_id    int unsigned    not null,
+    lower_bound decimal(35, 8)  not null,
+    holders     bigint unsigned not null,
+    balance     decimal(35, 8)  not null
+);
+
+create index if not exists idx_asset_balance_band_asset_id
+    on asset_balance_band(asset_id);
+
+-- daily_stats holds network statistics of every UTC day since the genesis block, day_time is the start of the day,
+-- data before end_time is aggregated, end_time is less than day_time + 86400 if the day is incomplete.
+create table if not exists daily_stats
+(
+    id                 integer primary key autoincrement,
+    day_time           bigint unsigned not null,
+    end_time           bigint unsigned not null,
+    blocks             int unsigned    not null,
+    avg_block_interval decimal(12, 3)  not null,
+    txs                int unsigned    not null,
+    cnt_tx_reg         int unsigned    not null,
+    cnt_tx_miner       int unsigned    not null,
+    cnt_tx_issue       int unsigned    not null,
+    cnt_tx_invocation  int unsigned    not null,
+    cnt_tx_contract    int unsigned    not null,
+    cnt_tx_claim       int unsigned    not null,
+    cnt_tx_publish     int unsigned    not null,
+    cnt_tx_enrollment  int unsigned    not null,
+    sys_fee            decimal(27, 8)  not null,
+    net_fee            decimal(27, 8)  not null,
+    active_addrs       int unsigned    not null,
+    new_addrs          int unsigned    not null,
+    nep5_transfers     int unsigned    not null,
+    updated_at         bigint unsigned not null
+);
+
+create unique index if not exists uk_daily_stats_day_time
+    on daily_stats(day_time);
+
+-- daily_asset_stats holds the total value of utxo outputs of every asset created in every day.
+create table if not exists daily_asset_stats
+(
+    id       integer primary key autoincrement,
+    day_time bigint unsigned not null,
+    asset_id int unsigned    not null,
+    value    decimal(35, 8)  not null
+);
+
+create unique index if not exists uk_daily_asset_stats_day_time_asset_id
+    on daily_asset_stats(day_time, asset_id);
+
+-- watch is an address or a nep5 asset watched by a webhook, asset_id is 0 for addresses and address is '' for nep5 assets.
+create table if not exists watch
+(
+    id         integer primary key autoincrement,
+    address    varchar(128)    not null,
+    asset_id   int unsigned    not null,
+    webhook    varchar(512)    not null,
+    secret     char(64)        not null,
+    created_at bigint unsigned not null
+);
+
+create index if not exists idx_watch_address
+    on watch(address);
+
+-- watch_delivery is the delivery log of webhooks, status is 'pending', 'delivered' or 'failed',
+-- event_idx is the index of the nep5 transfer in the transaction, or -1 for utxo movements.
+-- tx_pk is null once the transaction is rolled back, as its pk will be reused, and for deliveries which
+-- revert a delivered movement of a rolled back transaction, reverts is the id of the reverted delivery.
+create table if not exists watch_delivery
+(
+    id              integer primary key autoincrement,
+    watch_id        int unsigned    not null,
+    tx_pk           int unsigned    null,
+    event_idx       int             not null,
+    address         varchar(128)    not null,
+    direction       varchar(8)      not null,
+    reverts         int unsigned    default 0 not null,
+    payload         text            not null,
+    status          varchar(16)     not null,
+    attempts        int unsigned    not null,
+    next_attempt_at bigint unsigned not null,
+    last_error      varchar(255)    not null,
+    created_at      bigint unsigned not null,
+    delivered_at    bigint unsigned not null
+);
+
+create unique index if not exists uk_watch_delivery_movement
+    on watch_delivery(watch_id, tx_pk, event_idx, address, direction);
+
+create index if not exists idx_watch_delivery_status_next_attempt_at
+    on watch_delivery(status, next_attempt_at);
+`
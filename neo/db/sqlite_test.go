@@ -0,0 +1,189 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"math/big"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/block"
+	"neo_explorer/neo/nep5"
+	"neo_explorer/neo/tx"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "neo_explorer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewSQLite(filepath.Join(dir, "neo.db"))
+	defer store.Close()
+
+	if height := store.GetLastHeight(); height != -1 {
+		t.Fatalf("GetLastHeight() = %d of empty database, want -1", height)
+	}
+
+	blocks := []*block.Block{
+		{Hash: "0x00", Index: 0, Time: 1},
+		{Hash: "0x01", PreviousBlockHash: "0x00", Index: 1, Time: 86401},
+	}
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			{ID: 1, BlockIndex: 0, TxID: "0xaa", Type: "MinerTransaction", SysFee: big.NewFloat(0), NetFee: big.NewFloat(0), Gas: big.NewFloat(0)},
+			{ID: 2, BlockIndex: 1, TxID: "0xbb", Type: "ContractTransaction", SysFee: big.NewFloat(0), NetFee: big.NewFloat(0), Gas: big.NewFloat(0)},
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "AddrA", AddressId: 1},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(5), Address: "AddrB", AddressId: 2},
+		},
+	}
+	if err := store.InsertBlock(1, blocks, bulk); err != nil {
+		t.Fatal(err)
+	}
+
+	if height := store.GetLastHeight(); height != 1 {
+		t.Errorf("GetLastHeight() = %d, want 1", height)
+	}
+	if hash := store.GetBlockHash(1); hash != "0x01" {
+		t.Errorf("GetBlockHash(1) = %s, want 0x01", hash)
+	}
+	if pk := store.GetTx("0xbb"); pk != 2 {
+		t.Errorf("GetTx(0xbb) = %d, want 2", pk)
+	}
+
+	// Insert then update balance of the day.
+	for _, change := range []float64{1.5, 2.25} {
+		changes := []BalanceChange{{AddressId: 1, AssetId: 1, BlockTime: 86401, Value: big.NewFloat(change)}}
+		if err := store.ApplyTxBalanceChanges(2, changes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rows int
+	var balance float64
+	if err := store.db.QueryRow("SELECT COUNT(*), SUM(`balance`) FROM `addr_balance_history` WHERE `address_id` = ?", 1).Scan(&rows, &balance); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 || balance != 3.75 {
+		t.Errorf("addr_balance_history has %d rows with balance %v, want 1 row with balance 3.75", rows, balance)
+	}
+	if pk := store.GetLastTxPkForBalance(); pk != 2 {
+		t.Errorf("GetLastTxPkForBalance() = %d, want 2", pk)
+	}
+
+	// Duplicated addr_tx records are skipped.
+	recs := []*nep5.Transaction{{ID: 1, TxId: 2, From: "AddrA", To: "AddrB"}}
+	for i := 0; i < 2; i++ {
+		if err := store.InsertNep5AddrTxRec(recs, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM `addr_tx`").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("addr_tx has %d rows, want 2", rows)
+	}
+
+	if err := store.UpdateLastTxPkForNep5(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if pk, idx := store.GetLastTxPkForNep5(); pk != 2 || idx != 3 {
+		t.Errorf("GetLastTxPkForNep5() = %d, %d, want 2, 3", pk, idx)
+	}
+
+	if _, err := store.RollbackBlocks(1); err != nil {
+		t.Fatal(err)
+	}
+	if height := store.GetLastHeight(); height != 0 {
+		t.Errorf("GetLastHeight() = %d after rollback, want 0", height)
+	}
+	if pk := store.GetTx("0xbb"); pk != 0 {
+		t.Errorf("GetTx(0xbb) = %d after rollback, want 0", pk)
+	}
+}
+
+func countRows(t *testing.T, store *SQLStore, query string, args ...interface{}) int {
+	var n int
+	if err := store.db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+// newTestStore returns a store on an empty SQLite database which is removed after the test,
+// the counter is created as tasks do when they start.
+func newTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	dir, err := ioutil.TempDir("", "neo_explorer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewSQLite(filepath.Join(dir, "neo.db"))
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	store.GetLastHeight()
+
+	return store
+}
+
+// testBlocks returns a chain of blocks, block i is created at times[i].
+func testBlocks(times ...uint64) []*block.Block {
+	blocks := make([]*block.Block, len(times))
+	for i, blockTime := range times {
+		blocks[i] = &block.Block{Hash: fmt.Sprintf("0x%02x", i), Index: uint(i), Time: blockTime}
+		if i > 0 {
+			blocks[i].PreviousBlockHash = blocks[i-1].Hash
+		}
+	}
+
+	return blocks
+}
+
+// testTx returns the transaction of the given pk in the block, without fees.
+func testTx(id uint, b *block.Block, txType string) *tx.Transaction {
+	return &tx.Transaction{
+		ID:         id,
+		BlockIndex: b.Index,
+		BlockTime:  b.Time,
+		TxID:       fmt.Sprintf("0x%02x", id),
+		Type:       txType,
+		SysFee:     big.NewFloat(0),
+		NetFee:     big.NewFloat(0),
+		Gas:        big.NewFloat(0),
+	}
+}
+
+// insertTestBlocks stores the blocks and their transactions.
+func insertTestBlocks(t *testing.T, store *SQLStore, blocks []*block.Block, bulk *tx.Bulk) {
+	t.Helper()
+
+	if err := store.InsertBlock(int(blocks[len(blocks)-1].Index), blocks, bulk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// execQueries prepares records which are not written by the tested functions.
+func execQueries(t *testing.T, store *SQLStore, queries ...string) {
+	t.Helper()
+
+	for _, query := range queries {
+		if _, err := store.db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/config"
+	"neo_explorer/neo/addr"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/block"
+	"neo_explorer/neo/nep5"
+	"neo_explorer/neo/tx"
+)
+
+// Store is the storage used by tasks.
+type Store interface {
+	// Data to init caches.
+	GetAssetInfo() []asset.Asset
+	GetAddrAssetInfo() []*addr.AssetInfo
+	GetNep5AssetDecimals() map[uint]uint8
+
+	// Blocks.
+	GetLastHeight() int
+	GetBlockHash(index int) string
+	InsertBlock(maxIndex int, blocks []*block.Block, txBulk *tx.Bulk) error
+	RollbackBlocks(height int) (*RollbackReport, error)
+	BackfillBlockSysFees() (int, error)
+
+	// Transactions, utxo and addresses.
+	GetTx(txid string) uint
+	GetTxCount() uint
+	GetHighestTxPk() uint
+	GetTxs(txPk uint, limit int, txType string) []*tx.Transaction
+	GetVinVout(txIDs []string) (map[uint][]*tx.TransactionVin, map[uint][]*tx.TransactionVout, error)
+	GetVout(txId uint, n uint16) (*tx.TransactionVout, error)
+	GetVoutAddrID(addr string) (uint, error)
+	GetVoutAddrCount() uint
+	ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.TransactionVout) error
+	RecordAddrAssetIDTx(records []tx.AddrAssetIDTx, txPK int64) error
+	ApplyTxBalanceChanges(txPk uint, changes []BalanceChange) error
+	CheckBalanceHistorySchema() error
+	DropGasBalanceHistory() (bool, error)
+	GetUnresolvedClaimTxs(limit int) ([]*UnresolvedClaimTx, error)
+	ResolveClaims(txPk uint, claims []*tx.TransactionClaims) error
+
+	// Nep5 and smart contracts.
+	GetInvocationTxs(startPk uint, limit uint) []*tx.Transaction
+	GetMaxNonEmptyScriptTxPk() uint
+	GetTxScripts(txId uint) ([]*tx.TransactionScripts, error)
+	InsertNep5Asset(trans *tx.Transaction, nep5 *nep5.Nep5, regInfo *nep5.RegInfo, addrAsset *addr.Asset, atHeight uint) error
+	InsertNep5transaction(trans *tx.Transaction, appLogIdx int, assetId uint, fromAddr string, fromBalance *big.Float, toAddr string, toBalance *big.Float, transferValue *big.Float, totalSupply *big.Float) error
+	UpdateNep5TotalSupplyAndAddrAsset(blockTime uint64, blockIndex uint, addr string, balance *big.Float, assetId uint, totalSupply *big.Float) error
+	HandleNEP5Migrate(newAssetAdmin, oldAssetID, newAssetID string, txPK uint) error
+	GetNep5TxRecords(pk uint, limit int) ([]*nep5.Transaction, error)
+	ApplyNep5BalanceChanges(records []*nep5.Transaction) error
+	InsertNep5AddrTxRec(nep5TxRecs []*nep5.Transaction, lastPk uint) error
+	InsertSCInfos(scRegInfos []*nep5.RegInfo, txPK uint) error
+	GetNep5Contracts() ([]*Nep5Contract, error)
+	GetNep5Holders(assetId uint) ([]*Nep5Holder, error)
+	ReconcileNep5(contract *Nep5Contract, holders []*Nep5Holder, balances []*big.Float, totalSupply *big.Float, blockIndex uint) (*Nep5Reconciliation, error)
+
+	// Counters.
+	GetLastTxPkCounter() uint
+	GetLastAssetTxPkCounter() uint
+	GetLastTxPkForBalance() uint
+	GetNep5TxPkForBalance() uint
+	GetLastTxPkForNep5() (uint, int)
+	UpdateLastTxPkForNep5(currentTxPk uint, applogIdx int) error
+	GetLastTxPkForSC() uint
+	GetNep5TxPkForAddrTx() uint
+
+	// Transactions which tasks failed to handle.
+	QuarantineTx(task string, txPk uint, reason string) error
+	GetQuarantinedTxs(task string) (map[uint]bool, error)
+
+	// Verification of balances.
+	VerifyBalances(withCache bool) (*VerifyReport, error)
+	RecheckBalances(r *VerifyReport, withCache bool) (*VerifyReport, error)
+	RepairBalances(r *VerifyReport) (int, error)
+
+	// Rich lists and distributions of assets.
+	GetRichListAssets() ([]uint, error)
+	UpdateRichList(assetId uint, top int) (*AssetDistribution, error)
+
+	// Daily network statistics.
+	GetDailyStatsReadyTime() (int64, error)
+	GetNextDailyStatsDay() (int64, bool, error)
+	UpdateDailyStats(dayTime int64, endTime int64) (*DailyStats, error)
+
+	// Webhook deliveries of watched movements.
+	GetDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error)
+	UpdateWebhookDelivery(d *WebhookDelivery) error
+}
+
+// APIStore is the storage queried by the api.
+type APIStore interface {
+	// Addresses.
+	FindAddrID(addr string) (uint, error)
+	GetAddrBalances(addressId uint, limit int, offset int) ([]AddrBalance, uint64, error)
+	GetAddrUTXOs(addressId uint, limit int, offset int) ([]UTXO, uint64, error)
+	GetAddrAssetHistory(addressId uint, assetId uint, limit int, offset int) ([]HistoryRecord, uint64, error)
+	GetAddrNep5History(addr string, assetId uint, limit int, offset int) ([]HistoryRecord, uint64, error)
+	GetAddrGas(addressId uint) (*AddrGas, error)
+	GetAddrBalanceHistory(addressId uint, assetId uint, from int64, to int64, limit int, offset int) ([]BalanceRecord, uint64, error)
+
+	// Transactions and blocks.
+	GetTxDetail(txid string) (*TxDetail, error)
+	GetBlockDetail(index int, hash string) (*BlockDetail, error)
+
+	// Assets and nep5.
+	ResolveAsset(asset string) (uint, bool, error)
+	GetAssetDetail(assetID string) (*AssetDetail, error)
+	GetNep5Detail(assetId uint) (*Nep5Detail, error)
+	GetNep5Transfers(assetId uint, limit int, offset int) ([]Nep5Transfer, uint64, error)
+
+	// Balance snapshots.
+	CreateSnapshot(assetId uint, height uint) (*Snapshot, error)
+	GetSnapshot(assetId uint, height uint) (*Snapshot, error)
+	GetSnapshotBalances(snapshotId uint, limit int, offset int) ([]SnapshotBalance, error)
+	BuildSnapshot(s *Snapshot, progress func(s *Snapshot)) error
+
+	// Rich lists.
+	GetAssetDistribution(assetId uint) (*AssetDistribution, error)
+	GetRichList(assetId uint, limit int, offset int) ([]RichListEntry, error)
+	GetRichListSize(assetId uint) (uint64, error)
+
+	// Daily network statistics.
+	GetDailyStats(from int64, to int64, limit int, offset int) ([]*DailyStats, uint64, error)
+
+	// Watchlist.
+	CreateWatch(address string, assetId uint, webhook string) (*Watch, error)
+	GetWatches() ([]*Watch, error)
+	DeleteWatch(id uint) (bool, error)
+	GetWebhookDeliveries(watchId uint, limit int, offset int) ([]*WebhookDelivery, uint64, error)
+}
+
+// SQLStore is the Store backed by a sql database, it owns its connection to the database.
+type SQLStore struct {
+	db     *sql.DB
+	locker uint32
+
+	// dialect and dsn are used to reconnect to the database.
+	dialect *dialect
+	dsn     string
+
+	// watches caches watches of the database.
+	watches watchCache
+}
+
+var (
+	_ Store    = (*SQLStore)(nil)
+	_ APIStore = (*SQLStore)(nil)
+)
+
+// NewStore connects to the database selected in config and returns it as a Store.
+func NewStore() *SQLStore {
+	store := &SQLStore{}
+	bucketOnce.Do(loadBucketConfig)
+
+	switch driver := config.GetDbDriver(); driver {
+	case config.DriverMySQL:
+		store.connect(mysqlDialect, config.GetDbConnStr())
+	case config.DriverSQLite:
+		store.openSQLite(config.GetDbPath())
+	case config.DriverPostgres:
+		store.connect(postgresDialect, config.GetPostgresConnStr())
+	default:
+		panic(fmt.Errorf("unsupported database driver: %s", driver))
+	}
+
+	return store
+}
+
+// NewSQLite opens the sqlite database file, creates tables if not exist and returns it as a Store.
+func NewSQLite(path string) *SQLStore {
+	store := &SQLStore{}
+	store.openSQLite(path)
+
+	return store
+}
+
+// Close closes the connection to the database.
+func (store *SQLStore) Close() error {
+	return store.db.Close()
+}
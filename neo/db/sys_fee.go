@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/log"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/block"
+	"neo_explorer/neo/tx"
+	"strings"
+)
+
+// sysFeeBackfillSize is the number of blocks backfilled in one db transaction.
+const sysFeeBackfillSize = 10000
+
+// insertBlockSysFees stores accumulated system fees of blocks, which must follow the last stored block.
+func insertBlockSysFees(trans *sql.Tx, blocks []*block.Block, txs []*tx.Transaction) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	first := blocks[0].Index
+	total, err := getTotalSysFee(trans, int(first)-1)
+	if err != nil {
+		return err
+	}
+
+	fees := make(map[uint]*big.Float)
+	for _, t := range txs {
+		if t.SysFee == nil {
+			continue
+		}
+		if fee, ok := fees[t.BlockIndex]; ok {
+			fee.Add(fee, t.SysFee)
+		} else {
+			fees[t.BlockIndex] = new(big.Float).Set(t.SysFee)
+		}
+	}
+
+	cmd, _ := generateInsertCmdForSysFees(total, first, blocks[len(blocks)-1].Index, fees)
+	_, err = execute(trans, cmd)
+	return err
+}
+
+// getTotalSysFee returns accumulated system fee of blocks [0, index], it is 0 if index < 0.
+func getTotalSysFee(trans *sql.Tx, index int) (uint64, error) {
+	if index < 0 {
+		return 0, nil
+	}
+
+	var total uint64
+	const query = "SELECT `total_sys_fee` FROM `block_sys_fee` WHERE `block_index` = ? LIMIT 1"
+	err := trans.QueryRow(query, index).Scan(&total)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("accumulated system fee of block %d is missing", index)
+	}
+
+	return total, err
+}
+
+// generateInsertCmdForSysFees accumulates system fees of blocks [first, last] onto total,
+// it returns the insert command and the accumulated system fee of the last block.
+// Like NEO 2, system fees of each block are summed up in whole GAS.
+func generateInsertCmdForSysFees(total uint64, first uint, last uint, fees map[uint]*big.Float) (string, uint64) {
+	var strBuilder strings.Builder
+	strBuilder.WriteString("INSERT INTO `block_sys_fee` (`block_index`, `total_sys_fee`) VALUES ")
+
+	for index := first; index <= last; index++ {
+		if fee, ok := fees[index]; ok {
+			whole, _ := fee.Uint64()
+			total += whole
+		}
+		strBuilder.WriteString(fmt.Sprintf("(%d, %d),", index, total))
+	}
+
+	return strings.TrimSuffix(strBuilder.String(), ","), total
+}
+
+// BackfillBlockSysFees stores accumulated system fees of blocks stored before block_sys_fee existed,
+// it returns the number of backfilled blocks.
+func (store *SQLStore) BackfillBlockSysFees() (int, error) {
+	height := store.GetLastHeight()
+
+	next := 0
+	var total uint64
+	const query = "SELECT `block_index`, `total_sys_fee` FROM `block_sys_fee` ORDER BY `block_index` DESC LIMIT 1"
+	var stored int
+	err := store.db.QueryRow(query).Scan(&stored, &total)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil {
+		next = stored + 1
+	}
+
+	if next > height {
+		return 0, nil
+	}
+
+	log.Printf("Backfilling accumulated system fees of blocks [%d, %d]\n", next, height)
+
+	for first := next; first <= height; first += sysFeeBackfillSize {
+		last := first + sysFeeBackfillSize - 1
+		if last > height {
+			last = height
+		}
+
+		fees := make(map[uint]*big.Float)
+		err := store.scanRows(func(rows *sql.Rows) error {
+			var index uint
+			var feeStr string
+			if err := rows.Scan(&index, &feeStr); err != nil {
+				return err
+			}
+
+			fees[index] = util.StrToBigFloat(feeStr)
+			return nil
+		}, "SELECT `block_index`, SUM(`sys_fee`) FROM `tx` WHERE `block_index` BETWEEN ? AND ? GROUP BY `block_index`", first, last)
+		if err != nil {
+			return 0, err
+		}
+
+		cmd, newTotal := generateInsertCmdForSysFees(total, uint(first), uint(last), fees)
+		err = store.transact(func(trans *sql.Tx) error {
+			_, err := execute(trans, cmd)
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		total = newTotal
+		if (last+1)%(sysFeeBackfillSize*10) == 0 {
+			log.Printf("Backfilled accumulated system fees to block %d\n", last)
+		}
+	}
+
+	return height - next + 1, nil
+}
+
+// getTotalSysFees returns accumulated system fees of the given blocks.
+func (store *SQLStore) getTotalSysFees(indexes []uint) (map[uint]uint64, error) {
+	totals := make(map[uint]uint64, len(indexes))
+
+	const chunk = 500
+	for start := 0; start < len(indexes); start += chunk {
+		end := start + chunk
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+
+		strs := make([]string, end-start)
+		for i, index := range indexes[start:end] {
+			strs[i] = fmt.Sprintf("%d", index)
+		}
+
+		query := fmt.Sprintf("SELECT `block_index`, `total_sys_fee` FROM `block_sys_fee` WHERE `block_index` IN (%s)", strings.Join(strs, ", "))
+		err := store.scanRows(func(rows *sql.Rows) error {
+			var index uint
+			var total uint64
+			if err := rows.Scan(&index, &total); err != nil {
+				return err
+			}
+
+			totals[index] = total
+			return nil
+		}, query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, index := range indexes {
+		if _, ok := totals[index]; !ok {
+			return nil, fmt.Errorf("accumulated system fee of block %d is missing", index)
+		}
+	}
+
+	return totals, nil
+}
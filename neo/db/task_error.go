@@ -0,0 +1,36 @@
+package db
+
+import (
+	"time"
+)
+
+// QuarantineTx records a transaction which the given task keeps failing to handle,
+// the task skips it from now on.
+func (store *SQLStore) QuarantineTx(task string, txPk uint, reason string) error {
+	const query = "INSERT INTO `task_error` (`task`, `tx_pk`, `error`, `created_at`) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE `tx_pk` = `tx_pk`"
+	_, err := execute(store.db, query, task, txPk, reason, time.Now().Unix())
+	return err
+}
+
+// GetQuarantinedTxs returns pks of transactions quarantined by the given task.
+func (store *SQLStore) GetQuarantinedTxs(task string) (map[uint]bool, error) {
+	const query = "SELECT `tx_pk` FROM `task_error` WHERE `task` = ?"
+	rows, err := store.wrappedQuery(query, task)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pks := make(map[uint]bool)
+
+	for rows.Next() {
+		var pk uint
+		if err := rows.Scan(&pk); err != nil {
+			return nil, err
+		}
+
+		pks[pk] = true
+	}
+
+	return pks, rows.Err()
+}
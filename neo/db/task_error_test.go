@@ -0,0 +1,48 @@
+package db
+
+import (
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestQuarantineTx(t *testing.T) {
+	store := newTestStore(t)
+
+	blocks := testBlocks(0, 0)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "MinerTransaction"),
+			testTx(2, blocks[1], "ContractTransaction"),
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	// Quarantined transactions are recorded once per task.
+	for i := 0; i < 2; i++ {
+		for _, pk := range []uint{1, 2} {
+			if err := store.QuarantineTx("tx", pk, "bad transaction"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := store.QuarantineTx("nep5", 2, "bad transaction"); err != nil {
+		t.Fatal(err)
+	}
+	if pks, err := store.GetQuarantinedTxs("tx"); err != nil || len(pks) != 2 || !pks[1] || !pks[2] {
+		t.Errorf("GetQuarantinedTxs(tx) = %v, %v, want map[1:true 2:true]", pks, err)
+	}
+	if pks, err := store.GetQuarantinedTxs("asset_tx"); err != nil || len(pks) != 0 {
+		t.Errorf("GetQuarantinedTxs(asset_tx) = %v, %v, want none", pks, err)
+	}
+
+	// Quarantined transactions of rolled back blocks are removed.
+	if _, err := store.RollbackBlocks(1); err != nil {
+		t.Fatal(err)
+	}
+	if pks, err := store.GetQuarantinedTxs("tx"); err != nil || len(pks) != 1 || !pks[1] {
+		t.Errorf("GetQuarantinedTxs(tx) = %v, %v after rollback, want map[1:true]", pks, err)
+	}
+	if pks, err := store.GetQuarantinedTxs("nep5"); err != nil || len(pks) != 0 {
+		t.Errorf("GetQuarantinedTxs(nep5) = %v, %v after rollback, want none", pks, err)
+	}
+}
@@ -14,7 +14,7 @@ import (
 )
 
 // GetTxs returns transactions of given tx pk range.
-func GetTxs(txPk uint, limit int, txType string) []*tx.Transaction {
+func (store *SQLStore) GetTxs(txPk uint, limit int, txType string) []*tx.Transaction {
 	txSQL := "SELECT `id`, `block_index`, `block_time`, `txid`, `size`, `type`, `version`, `sys_fee`, `net_fee`, `nonce`, `script`, `gas` FROM `tx` WHERE `id` >= ?"
 
 	if txType != "" {
@@ -23,7 +23,7 @@ func GetTxs(txPk uint, limit int, txType string) []*tx.Transaction {
 
 	txSQL += " AND (EXISTS(SELECT `id` FROM `tx_vin` WHERE `tx_id`=`tx`.`id` LIMIT 1) OR EXISTS (SELECT `id` FROM `tx_vout` WHERE `tx_id`=`tx`.`id` LIMIT 1)) ORDER BY ID ASC LIMIT ?"
 
-	rows, err := wrappedQuery(txSQL, txPk, limit)
+	rows, err := store.wrappedQuery(txSQL, txPk, limit)
 	if err != nil {
 		panic(err)
 	}
@@ -66,44 +66,44 @@ func GetTxs(txPk uint, limit int, txType string) []*tx.Transaction {
 	return result
 }
 
-func GetTx(txid string) uint {
+func (store *SQLStore) GetTx(txid string) uint {
 	var id uint
 	query := "SELECT `id` FROM `tx` WHERE `txid` = ? LIMIT 1"
-	err := db.QueryRow(query, txid).Scan(&id)
+	err := store.db.QueryRow(query, txid).Scan(&id)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetTx(txid)
+		store.reconnect()
+		return store.GetTx(txid)
 	}
 
 	return id
 }
 
-func GetTxCount() uint {
+func (store *SQLStore) GetTxCount() uint {
 	var count uint
 	query := "SELECT COUNT(`id`) FROM `tx`"
-	err := db.QueryRow(query).Scan(&count)
+	err := store.db.QueryRow(query).Scan(&count)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetTxCount()
+		store.reconnect()
+		return store.GetTxCount()
 	}
 
 	return count
 }
 
 // GetVinVout returns correspond vouts of vins.
-func GetVinVout(txIDs []string) (map[uint][]*tx.TransactionVin, map[uint][]*tx.TransactionVout, error) {
-	vinMap, err := GetVins(txIDs)
+func (store *SQLStore) GetVinVout(txIDs []string) (map[uint][]*tx.TransactionVin, map[uint][]*tx.TransactionVout, error) {
+	vinMap, err := store.GetVins(txIDs)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	voutMap, err := GetVouts(txIDs)
+	voutMap, err := store.GetVouts(txIDs)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -112,14 +112,14 @@ func GetVinVout(txIDs []string) (map[uint][]*tx.TransactionVin, map[uint][]*tx.T
 }
 
 // GetVins returns all vins of the given txID.
-func GetVins(txIDs []string) (map[uint][]*tx.TransactionVin, error) {
+func (store *SQLStore) GetVins(txIDs []string) (map[uint][]*tx.TransactionVin, error) {
 	query := "SELECT `tx_id`, `txid`, `vout` FROM `tx_vin` WHERE `tx_id` IN ('"
 	query += strings.Join(txIDs, "', '")
 	query += "')"
 
 	vinMap := make(map[uint][]*tx.TransactionVin)
 
-	rows, err := wrappedQuery(query)
+	rows, err := store.wrappedQuery(query)
 	if err != nil {
 		return nil, err
 	}
@@ -145,14 +145,14 @@ func GetVins(txIDs []string) (map[uint][]*tx.TransactionVin, error) {
 }
 
 // GetVouts returns all vins of the given txID.
-func GetVouts(txIDs []string) (map[uint][]*tx.TransactionVout, error) {
+func (store *SQLStore) GetVouts(txIDs []string) (map[uint][]*tx.TransactionVout, error) {
 	query := "SELECT `tx_id`, `n`, `asset_id`, `value`, `address`, `address_id` FROM `tx_vout` WHERE `tx_id` IN ('"
 	query += strings.Join(txIDs, "', '")
 	query += "')"
 
 	voutMap := make(map[uint][]*tx.TransactionVout)
 
-	rows, err := wrappedQuery(query)
+	rows, err := store.wrappedQuery(query)
 	if err != nil {
 		return nil, err
 	}
@@ -182,15 +182,15 @@ func GetVouts(txIDs []string) (map[uint][]*tx.TransactionVout, error) {
 	return voutMap, nil
 }
 
-func handleVins(blockIndex uint, tx *sql.Tx, vins []*tx.TransactionVin, cachedVinVouts *[]*tx.TransactionVout) error {
+func (store *SQLStore) handleVins(blockIndex uint, tx *sql.Tx, vins []*tx.TransactionVin, cachedVinVouts *[]*tx.TransactionVout) error {
 	for _, vin := range vins {
 		const disableUTXOSQL = "UPDATE `utxo` SET `used_in_tx` = ? WHERE `tx_id` = ? AND `n` = ? LIMIT 1"
-		_, err := tx.Exec(disableUTXOSQL, vin.TxId, vin.TxID, vin.Vout)
+		_, err := execute(tx, disableUTXOSQL, vin.TxId, vin.TxID, vin.Vout)
 		if err != nil {
 			return err
 		}
 
-		vinVout, err := GetVout(vin.TxID, vin.Vout)
+		vinVout, err := store.GetVout(vin.TxID, vin.Vout)
 		if err != nil {
 			return err
 		}
@@ -202,7 +202,7 @@ func handleVins(blockIndex uint, tx *sql.Tx, vins []*tx.TransactionVin, cachedVi
 			addrAssetCache.SubtractBalance(vinVout.Value, blockIndex)
 		}
 		reduceAddrAssetSQL := fmt.Sprintf("UPDATE `addr_asset` SET `balance` = `balance` - %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' LIMIT 1", vinVout.Value, vinVout.AddressId, vinVout.AssetID)
-		_, err = tx.Exec(reduceAddrAssetSQL)
+		_, err = execute(tx, reduceAddrAssetSQL)
 		if err != nil {
 			return err
 		}
@@ -214,7 +214,7 @@ func handleVins(blockIndex uint, tx *sql.Tx, vins []*tx.TransactionVin, cachedVi
 func handleVouts(blockIndex uint, blockTime uint64, tx *sql.Tx, vouts []*tx.TransactionVout) error {
 	for _, vout := range vouts {
 		insertUTXOQuery := fmt.Sprintf("INSERT INTO `utxo` (`address_id`, `tx_id`, `n`, `asset_id`, `value`, `used_in_tx`) VALUES ('%d', '%d', %d, '%d', %.8f, null)", vout.AddressId, vout.TxId, vout.N, vout.AssetID, vout.Value)
-		if _, err := tx.Exec(insertUTXOQuery); err != nil {
+		if _, err := execute(tx, insertUTXOQuery); err != nil {
 			log.Error.Printf("handleVouts:%+v ,blockIndex: %d", vout, blockIndex)
 			return err
 		}
@@ -225,13 +225,13 @@ func handleVouts(blockIndex uint, blockTime uint64, tx *sql.Tx, vouts []*tx.Tran
 		if created {
 			// Transactions counter and last transaction time will be updated later, currently set its initial value to 0.
 			insertAddrAssetQuery := fmt.Sprintf("INSERT INTO `addr_asset` (`address_id`, `asset_id`, `balance`, `transactions`, `last_transaction_time`) VALUES ('%d', '%d', %.8f, %d, %d)", vout.AddressId, vout.AssetID, vout.Value, 0, 0)
-			if _, err := tx.Exec(insertAddrAssetQuery); err != nil {
+			if _, err := execute(tx, insertAddrAssetQuery); err != nil {
 				log.Error.Printf("handleVouts:%+v ,blockIndex: %d", vout, blockIndex)
 				return err
 			}
 			// Increase asset addresses count.
 			incrAssetAddrCount := fmt.Sprintf("UPDATE `asset` SET `addresses` = `addresses` + 1 WHERE `id` = '%d' LIMIT 1", vout.AssetID)
-			if _, err := tx.Exec(incrAssetAddrCount); err != nil {
+			if _, err := execute(tx, incrAssetAddrCount); err != nil {
 				log.Error.Printf("handleVouts:%+v ,blockIndex: %d", vout, blockIndex)
 				return err
 			}
@@ -239,7 +239,7 @@ func handleVouts(blockIndex uint, blockTime uint64, tx *sql.Tx, vouts []*tx.Tran
 			addrAssetCache.AddBalance(vout.Value, blockIndex)
 			// 'last_transaction_time' will be updated later.
 			incrAddrAsset := fmt.Sprintf("UPDATE `addr_asset` SET `balance` = `balance` + %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' LIMIT 1", vout.Value, vout.AddressId, vout.AssetID)
-			if _, err := tx.Exec(incrAddrAsset); err != nil {
+			if _, err := execute(tx, incrAddrAsset); err != nil {
 				log.Error.Printf("handleVouts:%+v ,blockIndex: %d", vout, blockIndex)
 				return err
 			}
@@ -250,12 +250,12 @@ func handleVouts(blockIndex uint, blockTime uint64, tx *sql.Tx, vouts []*tx.Tran
 }
 
 // RecordAddrAssetIDTx records {address, asset_id, txid}.
-func RecordAddrAssetIDTx(records []tx.AddrAssetIDTx, txPK int64) error {
+func (store *SQLStore) RecordAddrAssetIDTx(records []tx.AddrAssetIDTx, txPK int64) error {
 	if len(records) == 0 {
 		return nil
 	}
 
-	return transact(func(trans *sql.Tx) error {
+	return store.transact(func(trans *sql.Tx) error {
 		piece := 100
 
 		for start := 0; start < len(records); start += piece {
@@ -272,7 +272,7 @@ func RecordAddrAssetIDTx(records []tx.AddrAssetIDTx, txPK int64) error {
 			}
 
 			query = query[:len(query)-2]
-			_, err := trans.Exec(query)
+			_, err := execute(trans, query)
 			if err != nil {
 				return err
 			}
@@ -288,11 +288,13 @@ func RecordAddrAssetIDTx(records []tx.AddrAssetIDTx, txPK int64) error {
 }
 
 // ApplyVinsVouts process transaction and update related db table info.
-func ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.TransactionVout) error {
-	return transact(func(trans *sql.Tx) error {
+func (store *SQLStore) ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.TransactionVout) error {
+	byAddress, _ := store.getWatches()
+
+	return store.transact(func(trans *sql.Tx) error {
 		cachedVinVouts := []*tx.TransactionVout{}
 
-		if err := handleVins(t.BlockIndex, trans, vins, &cachedVinVouts); err != nil {
+		if err := store.handleVins(t.BlockIndex, trans, vins, &cachedVinVouts); err != nil {
 			log.Error.Println(err)
 			return err
 		}
@@ -311,7 +313,7 @@ func ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.Tr
 
 		for _, addr := range addrs {
 			// Update address table.
-			created, err := updateAddrInfo(trans, t.BlockTime, t.TxID, addr, asset.ASSET)
+			created, err := store.updateAddrInfo(trans, t.BlockTime, t.TxID, addr, asset.ASSET)
 			if err != nil {
 				log.Error.Println(err)
 				return err
@@ -340,7 +342,7 @@ func ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.Tr
 			}
 		}
 
-		if err := updateTxInfo(trans, t.BlockTime, t.ID, addrs, assetIDs, addrAssetPair); err != nil {
+		if err := store.updateTxInfo(trans, t.BlockTime, t.ID, addrs, assetIDs, addrAssetPair); err != nil {
 			log.Error.Println(err)
 			return err
 		}
@@ -357,6 +359,11 @@ func ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.Tr
 			return err
 		}
 
+		if err := queueUTXOMovements(trans, byAddress, t, cachedVinVouts, vouts); err != nil {
+			log.Error.Println(err)
+			return err
+		}
+
 		return nil
 	})
 }
@@ -367,7 +374,7 @@ func handleClaimTx(tx *sql.Tx, vouts []*tx.TransactionVout) error {
 	for _, vout := range vouts {
 		assetID, err := cache.GetAssetID(vout.AssetID)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		if assetID == asset.GASAssetID {
@@ -376,7 +383,7 @@ func handleClaimTx(tx *sql.Tx, vouts []*tx.TransactionVout) error {
 	}
 
 	query := fmt.Sprintf("UPDATE `asset` SET `available` = `available` + %.8f WHERE `asset_id` = '%s' LIMIT 1", gas, asset.GASAssetID)
-	if _, err := tx.Exec(query); err != nil {
+	if _, err := execute(tx, query); err != nil {
 		return err
 	}
 
@@ -389,7 +396,7 @@ func handleIssueTx(tx *sql.Tx, vouts []*tx.TransactionVout) error {
 	for _, vout := range vouts {
 		assetID, err := cache.GetAssetID(vout.AssetID)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		if assetID != asset.GASAssetID {
 			if _, ok := issued[vout.AssetID]; !ok {
@@ -401,7 +408,7 @@ func handleIssueTx(tx *sql.Tx, vouts []*tx.TransactionVout) error {
 	}
 	for assetID, increment := range issued {
 		query := fmt.Sprintf("UPDATE `asset` SET `available` = `available` + %.8f WHERE `id` = '%d' LIMIT 1", increment, assetID)
-		if _, err := tx.Exec(query); err != nil {
+		if _, err := execute(tx, query); err != nil {
 			return err
 		}
 	}
@@ -432,22 +439,22 @@ func countTxInfo(cachedVinVouts []*tx.TransactionVout, vouts []*tx.TransactionVo
 	return assetIDs, addrAssetPair
 }
 
-func updateTxInfo(tx *sql.Tx, blockTime uint64, txId uint, addrs []string, assetIDs map[uint]bool, addrAssetPair map[string]map[uint]bool) error {
+func (store *SQLStore) updateTxInfo(tx *sql.Tx, blockTime uint64, txId uint, addrs []string, assetIDs map[uint]bool, addrAssetPair map[string]map[uint]bool) error {
 	for _, addr := range addrs {
-		addressId, err := GetVoutAddrID(addr)
+		addressId, err := store.GetVoutAddrID(addr)
 		if err != nil {
 			panic(err)
 		}
 		// Add new AddrTx record.
 		const insertAddrTx = "INSERT INTO `addr_tx` (`tx_id`, `address_id`, `block_time`, `asset_type`) VALUES (?, ?, ?, ?)"
-		if _, err := tx.Exec(insertAddrTx, txId, addressId, blockTime, asset.ASSET); err != nil {
+		if _, err := execute(tx, insertAddrTx, txId, addressId, blockTime, asset.ASSET); err != nil {
 			return err
 		}
 
 		for assetID := range addrAssetPair[addr] {
 			// Increase transaction count in addr_asset.
 			const query = "UPDATE `addr_asset` SET `transactions` = `transactions` + 1, `last_transaction_time` = ? WHERE `address_id` = ? AND `asset_id` = ? LIMIT 1"
-			if _, err := tx.Exec(query, blockTime, addressId, assetID); err != nil {
+			if _, err := execute(tx, query, blockTime, addressId, assetID); err != nil {
 				return err
 			}
 		}
@@ -456,7 +463,7 @@ func updateTxInfo(tx *sql.Tx, blockTime uint64, txId uint, addrs []string, asset
 	for assetID := range assetIDs {
 		// Increase asset transactions count.
 		const query = "UPDATE `asset` SET `transactions` = `transactions` + 1 WHERE `id` = ? LIMIT 1"
-		if _, err := tx.Exec(query, assetID); err != nil {
+		if _, err := execute(tx, query, assetID); err != nil {
 			return err
 		}
 	}
@@ -464,11 +471,11 @@ func updateTxInfo(tx *sql.Tx, blockTime uint64, txId uint, addrs []string, asset
 }
 
 // GetVout returns vouts of a transaction.
-func GetVout(txId uint, n uint16) (*tx.TransactionVout, error) {
+func (store *SQLStore) GetVout(txId uint, n uint16) (*tx.TransactionVout, error) {
 	vout := new(tx.TransactionVout)
 	valueStr := ""
 	const query = "SELECT `tx_id`, `n`, `asset_id`, `value`, `address`, `address_id` FROM `tx_vout` WHERE `tx_id` = ? AND `n` = ?"
-	err := db.QueryRow(query, txId, n).Scan(
+	err := store.db.QueryRow(query, txId, n).Scan(
 		// &vout.ID,
 		&vout.TxId,
 		//&vout.TxMap,
@@ -491,16 +498,16 @@ func GetVout(txId uint, n uint16) (*tx.TransactionVout, error) {
 }
 
 // GetHighestTxPk returns maximum pk of tx.
-func GetHighestTxPk() uint {
+func (store *SQLStore) GetHighestTxPk() uint {
 	var pk uint
 	const query = "SELECT `id` FROM `tx` WHERE EXISTS (SELECT `id` FROM `tx_vin` WHERE `tx_id`=`tx`.`id` LIMIT 1) OR EXISTS (SELECT `id` FROM `tx_vout` WHERE `tx_id`=`tx`.`id` LIMIT 1) ORDER BY `id` DESC LIMIT 1"
-	err := db.QueryRow(query).Scan(&pk)
+	err := store.db.QueryRow(query).Scan(&pk)
 	if err != nil && err != sql.ErrNoRows {
-		if !connErr(err) {
+		if !store.connErr(err) {
 			panic(err)
 		}
-		reconnect()
-		return GetHighestTxPk()
+		store.reconnect()
+		return store.GetHighestTxPk()
 	}
 
 	return pk
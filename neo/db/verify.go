@@ -0,0 +1,316 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/asset"
+	"strings"
+)
+
+// VerifyReport lists balances which are inconsistent with utxo and issued outputs.
+type VerifyReport struct {
+	// Checked is the number of compared address assets.
+	Checked   int
+	Balances  []BalanceMismatch
+	Available []AvailableMismatch
+}
+
+// BalanceMismatch is an address asset whose balance is not the sum of its unspent utxos.
+type BalanceMismatch struct {
+	AddressId uint
+	AssetId   uint
+	// Balance is the balance in addr_asset, nil if the record does not exist.
+	Balance *big.Float
+	// Cached is the balance in cache, nil if it is not cached or cache is not compared.
+	Cached *big.Float
+	// UTXO is the sum of unspent utxos.
+	UTXO *big.Float
+}
+
+// AvailableMismatch is an asset whose available amount is not the sum of its issued outputs.
+type AvailableMismatch struct {
+	AssetId   uint
+	AssetID   string
+	Available *big.Float
+	// Issued is the sum of outputs of claim transactions for GAS,
+	// or the sum of outputs of issue transactions for other assets,
+	// in transactions handled by tx task.
+	Issued *big.Float
+}
+
+// OK returns true if nothing mismatches.
+func (r *VerifyReport) OK() bool {
+	return len(r.Balances) == 0 && len(r.Available) == 0
+}
+
+// sameAmount compares amounts at the precision of decimal(35, 8) columns.
+func sameAmount(a, b *big.Float) bool {
+	return a.Text('f', 8) == b.Text('f', 8)
+}
+
+// VerifyBalances recomputes balances of utxo assets from unspent utxos and compares them
+// with addr_asset, and with cached balances if withCache is true.
+// It also compares available amount of assets with their issued outputs.
+// Records may change while they are compared, see RecheckBalances.
+func (store *SQLStore) VerifyBalances(withCache bool) (*VerifyReport, error) {
+	report := &VerifyReport{}
+
+	const query = "SELECT `a`.`address_id`, `a`.`asset_id`, `a`.`balance`, COALESCE(`u`.`total`, 0) FROM `addr_asset` `a` LEFT JOIN (SELECT `address_id`, `asset_id`, SUM(`value`) AS `total` FROM `utxo` WHERE `used_in_tx` IS NULL GROUP BY `address_id`, `asset_id`) `u` ON `u`.`address_id` = `a`.`address_id` AND `u`.`asset_id` = `a`.`asset_id` WHERE `a`.`asset_id` NOT IN (SELECT `asset_id` FROM `nep5`)"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		m := BalanceMismatch{}
+		var balanceStr, utxoStr string
+
+		if err := rows.Scan(&m.AddressId, &m.AssetId, &balanceStr, &utxoStr); err != nil {
+			return err
+		}
+
+		m.Balance = util.StrToBigFloat(balanceStr)
+		m.UTXO = util.StrToBigFloat(utxoStr)
+		report.Checked++
+		report.addBalance(m, withCache)
+
+		return nil
+	}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unspent utxos without addr_asset record.
+	const missingQuery = "SELECT `u`.`address_id`, `u`.`asset_id`, SUM(`u`.`value`) FROM `utxo` `u` LEFT JOIN `addr_asset` `a` ON `a`.`address_id` = `u`.`address_id` AND `a`.`asset_id` = `u`.`asset_id` WHERE `u`.`used_in_tx` IS NULL AND `a`.`id` IS NULL GROUP BY `u`.`address_id`, `u`.`asset_id`"
+	err = store.scanRows(func(rows *sql.Rows) error {
+		m := BalanceMismatch{}
+		var utxoStr string
+
+		if err := rows.Scan(&m.AddressId, &m.AssetId, &utxoStr); err != nil {
+			return err
+		}
+
+		m.UTXO = util.StrToBigFloat(utxoStr)
+		report.Checked++
+		report.addBalance(m, withCache)
+
+		return nil
+	}, missingQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Available, err = store.verifyAvailable(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// RecheckBalances compares the mismatched records of the report again,
+// it should be called while tasks are not writing, so that only real mismatches are left.
+func (store *SQLStore) RecheckBalances(r *VerifyReport, withCache bool) (*VerifyReport, error) {
+	report := &VerifyReport{Checked: r.Checked}
+
+	for _, old := range r.Balances {
+		m := BalanceMismatch{AddressId: old.AddressId, AssetId: old.AssetId}
+
+		var balanceStr string
+		const query = "SELECT `balance` FROM `addr_asset` WHERE `address_id` = ? AND `asset_id` = ? LIMIT 1"
+		err := store.db.QueryRow(query, m.AddressId, m.AssetId).Scan(&balanceStr)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil {
+			m.Balance = util.StrToBigFloat(balanceStr)
+		}
+
+		var utxoStr string
+		const utxoQuery = "SELECT COALESCE(SUM(`value`), 0) FROM `utxo` WHERE `address_id` = ? AND `asset_id` = ? AND `used_in_tx` IS NULL"
+		if err := store.db.QueryRow(utxoQuery, m.AddressId, m.AssetId).Scan(&utxoStr); err != nil {
+			return nil, err
+		}
+		m.UTXO = util.StrToBigFloat(utxoStr)
+
+		report.addBalance(m, withCache)
+	}
+
+	if len(r.Available) > 0 {
+		assetIds := []uint{}
+		for _, m := range r.Available {
+			assetIds = append(assetIds, m.AssetId)
+		}
+
+		var err error
+		report.Available, err = store.verifyAvailable(assetIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// addBalance records m if its balances mismatch.
+func (r *VerifyReport) addBalance(m BalanceMismatch, withCache bool) {
+	mismatched := m.Balance == nil || !sameAmount(m.Balance, m.UTXO)
+
+	if withCache {
+		if item, ok := cache.GetAddrAsset(m.AddressId, m.AssetId); ok {
+			m.Cached = item.GetBalance()
+		}
+		if m.Cached == nil || !sameAmount(m.Cached, m.UTXO) {
+			mismatched = true
+		}
+	}
+
+	if mismatched {
+		r.Balances = append(r.Balances, m)
+	}
+}
+
+// verifyAvailable compares available amount of the given assets, or all assets if nil,
+// with outputs issued by transactions handled by tx task.
+func (store *SQLStore) verifyAvailable(assetIds []uint) ([]AvailableMismatch, error) {
+	filter := ""
+	if assetIds != nil {
+		ids := []string{}
+		for _, id := range assetIds {
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+		filter = " AND `v`.`asset_id` IN (" + strings.Join(ids, ", ") + ")"
+	}
+
+	lastTxPk := store.getCounterInstance().LastTxPk
+	gasId, _ := cache.LookupAssetId(asset.GASAssetID)
+	issued := make(map[uint]*big.Float)
+
+	query := "SELECT `v`.`asset_id`, `t`.`type`, SUM(`v`.`value`) FROM `tx` `t` INNER JOIN `tx_vout` `v` ON `v`.`tx_id` = `t`.`id` WHERE `t`.`type` IN ('ClaimTransaction', 'IssueTransaction') AND `t`.`id` <= ?" + filter + " GROUP BY `v`.`asset_id`, `t`.`type`"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		var assetId uint
+		var txType, valueStr string
+
+		if err := rows.Scan(&assetId, &txType, &valueStr); err != nil {
+			return err
+		}
+
+		// Same as handleClaimTx and handleIssueTx.
+		if (txType == "ClaimTransaction" && assetId == gasId) ||
+			(txType == "IssueTransaction" && assetId != gasId) {
+			if _, ok := issued[assetId]; !ok {
+				issued[assetId] = big.NewFloat(0)
+			}
+			issued[assetId] = new(big.Float).Add(issued[assetId], util.StrToBigFloat(valueStr))
+		}
+
+		return nil
+	}, query, lastTxPk)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []AvailableMismatch{}
+	err = store.scanRows(func(rows *sql.Rows) error {
+		m := AvailableMismatch{}
+		var availableStr string
+
+		if err := rows.Scan(&m.AssetId, &m.AssetID, &availableStr); err != nil {
+			return err
+		}
+		if assetIds != nil && !containsId(assetIds, m.AssetId) {
+			return nil
+		}
+
+		m.Available = util.StrToBigFloat(availableStr)
+		m.Issued = issued[m.AssetId]
+		if m.Issued == nil {
+			m.Issued = big.NewFloat(0)
+		}
+		if !sameAmount(m.Available, m.Issued) {
+			mismatches = append(mismatches, m)
+		}
+
+		return nil
+	}, "SELECT `id`, `asset_id`, `available` FROM `asset`")
+	if err != nil {
+		return nil, err
+	}
+
+	return mismatches, nil
+}
+
+func containsId(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RepairBalances sets mismatched balances in addr_asset, and in cache if compared,
+// to the sum of unspent utxos, and available amount of assets to their issued outputs.
+// Missing addr_asset records are not created, they are restored by resetting tx task.
+// It returns the number of repaired records.
+func (store *SQLStore) RepairBalances(r *VerifyReport) (int, error) {
+	repaired := 0
+
+	err := store.transact(func(trans *sql.Tx) error {
+		repaired = 0
+
+		for _, m := range r.Balances {
+			if m.Balance == nil || sameAmount(m.Balance, m.UTXO) {
+				continue
+			}
+
+			query := fmt.Sprintf("UPDATE `addr_asset` SET `balance` = %.8f WHERE `address_id` = '%d' AND `asset_id` = '%d' LIMIT 1", m.UTXO, m.AddressId, m.AssetId)
+			if _, err := execute(trans, query); err != nil {
+				return err
+			}
+			repaired++
+		}
+
+		for _, m := range r.Available {
+			query := fmt.Sprintf("UPDATE `asset` SET `available` = %.8f WHERE `id` = '%d' LIMIT 1", m.Issued, m.AssetId)
+			if _, err := execute(trans, query); err != nil {
+				return err
+			}
+			repaired++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Cache is only changed after db is.
+	for _, m := range r.Balances {
+		if m.Cached == nil || sameAmount(m.Cached, m.UTXO) {
+			continue
+		}
+		if item, ok := cache.GetAddrAsset(m.AddressId, m.AssetId); ok {
+			item.SetBalance(m.UTXO)
+			repaired++
+		}
+	}
+
+	return repaired, nil
+}
+
+// scanRows runs the query and scans every row.
+func (store *SQLStore) scanRows(scan func(*sql.Rows) error, query string, args ...interface{}) error {
+	rows, err := store.wrappedQuery(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
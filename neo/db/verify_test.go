@@ -0,0 +1,107 @@
+package db
+
+import (
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+func TestVerifyBalances(t *testing.T) {
+	store := newTestStore(t)
+
+	blocks := testBlocks(1)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "IssueTransaction"),
+			testTx(2, blocks[0], "ContractTransaction"),
+		},
+		TXVins: []*tx.TransactionVin{
+			{TxId: 2, TxID: 1, Vout: 0},
+		},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "VerifyAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(4), Address: "VerifyAddrB", AddressId: 2},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(6), Address: "VerifyAddrA", AddressId: 1},
+		},
+		Assets: []*asset.Asset{
+			{AssetID: "0xasset", Type: "Token", Name: "Token", Amount: big.NewFloat(100), Available: big.NewFloat(0), Precision: 8},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+
+	cache.LoadAssetsInfo(store.GetAssetInfo())
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+	if err := store.ApplyVinsVouts(bulk.TXs[0], nil, bulk.TXVouts[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ApplyVinsVouts(bulk.TXs[1], bulk.TXVins, bulk.TXVouts[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := store.VerifyBalances(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked != 2 {
+		t.Fatalf("report of consistent balances = %+v, want 2 checked without mismatch", report)
+	}
+
+	// Corrupts addr_asset of A, cache of B, available of the asset,
+	// and adds an utxo of C without addr_asset.
+	execQueries(t, store,
+		"UPDATE `addr_asset` SET `balance` = 7 WHERE `address_id` = 1",
+		"UPDATE `asset` SET `available` = 1",
+		"INSERT INTO `utxo` (`address_id`, `tx_id`, `n`, `asset_id`, `value`, `used_in_tx`) VALUES (3, 2, 2, 1, 2.5, null)",
+	)
+	cached, _ := cache.GetAddrAsset(2, 1)
+	cached.SetBalance(big.NewFloat(3))
+
+	report, err = store.VerifyBalances(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = store.RecheckBalances(report, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Balances) != 3 || len(report.Available) != 1 {
+		t.Fatalf("report = %+v, want 3 balance and 1 available mismatches", report)
+	}
+	for _, m := range report.Balances {
+		switch m.AddressId {
+		case 1:
+			if m.Balance.Text('f', 8) != "7.00000000" || m.UTXO.Text('f', 8) != "6.00000000" {
+				t.Errorf("mismatch of A = %+v, want balance 7 and utxo 6", m)
+			}
+		case 2:
+			if m.Cached.Text('f', 8) != "3.00000000" || m.UTXO.Text('f', 8) != "4.00000000" {
+				t.Errorf("mismatch of B = %+v, want cached 3 and utxo 4", m)
+			}
+		case 3:
+			if m.Balance != nil || m.UTXO.Text('f', 8) != "2.50000000" {
+				t.Errorf("mismatch of C = %+v, want missing balance and utxo 2.5", m)
+			}
+		}
+	}
+	if m := report.Available[0]; m.AssetID != "0xasset" || m.Issued.Text('f', 8) != "10.00000000" {
+		t.Errorf("available mismatch = %+v, want 10 issued", m)
+	}
+
+	repaired, err := store.RepairBalances(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired != 3 {
+		t.Errorf("repaired %d records, want 3", repaired)
+	}
+
+	report, err = store.VerifyBalances(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Balances) != 1 || report.Balances[0].AddressId != 3 || len(report.Available) != 0 {
+		t.Errorf("report after repair = %+v, want only the missing addr_asset of C", report)
+	}
+}
@@ -0,0 +1,477 @@
+package db
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/tx"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Directions of watched movements.
+const (
+	DirectionIn       = "in"
+	DirectionOut      = "out"
+	DirectionTransfer = "transfer"
+)
+
+// Statuses of webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// rolledBackError is the error of deliveries cancelled because their transactions are rolled back.
+const rolledBackError = "transaction rolled back"
+
+// Watch is an address or a nep5 asset whose movements are posted to the webhook.
+type Watch struct {
+	Id       uint   `json:"id"`
+	Address  string `json:"address,omitempty"`
+	AssetId  uint   `json:"-"`
+	Contract string `json:"contract,omitempty"`
+	Webhook  string `json:"webhook"`
+	// Secret signs payloads, it is only returned when the watch is created.
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// WebhookPayload is the body posted to webhooks, Address is empty for transfers of watched nep5 assets.
+// Reverted is set when a delivered movement is undone because its block has been rolled back.
+type WebhookPayload struct {
+	WatchId     uint   `json:"watch_id"`
+	TxID        string `json:"txid"`
+	BlockHeight uint   `json:"block_height"`
+	BlockTime   uint64 `json:"block_time"`
+	Asset       string `json:"asset"`
+	Nep5        bool   `json:"nep5"`
+	Address     string `json:"address,omitempty"`
+	Direction   string `json:"direction"`
+	Amount      string `json:"amount"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	Reverted    bool   `json:"reverted,omitempty"`
+}
+
+// WebhookDelivery is a payload to be posted to the webhook of a watch,
+// Reverts is the id of the delivery whose movement it reverts.
+type WebhookDelivery struct {
+	Id            uint   `json:"id"`
+	WatchId       uint   `json:"watch_id"`
+	Reverts       uint   `json:"reverts,omitempty"`
+	Webhook       string `json:"-"`
+	Secret        string `json:"-"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      uint   `json:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	LastError     string `json:"last_error"`
+	CreatedAt     int64  `json:"created_at"`
+	DeliveredAt   int64  `json:"delivered_at"`
+}
+
+// watchCache caches all watches of a store, it is reloaded after watches change.
+type watchCache struct {
+	sync.RWMutex
+	loaded    bool
+	byAddress map[string][]*Watch
+	byAsset   map[uint][]*Watch
+}
+
+func (store *SQLStore) resetWatches() {
+	store.watches.Lock()
+	defer store.watches.Unlock()
+
+	store.watches.loaded = false
+}
+
+// getWatches returns the cached watches, loading them if needed.
+// The watchlist is disabled if it can not be loaded, e.g. the tables are not created.
+func (store *SQLStore) getWatches() (map[string][]*Watch, map[uint][]*Watch) {
+	store.watches.RLock()
+	if store.watches.loaded {
+		defer store.watches.RUnlock()
+		return store.watches.byAddress, store.watches.byAsset
+	}
+	store.watches.RUnlock()
+
+	store.watches.Lock()
+	defer store.watches.Unlock()
+
+	if !store.watches.loaded {
+		store.watches.byAddress = make(map[string][]*Watch)
+		store.watches.byAsset = make(map[uint][]*Watch)
+		store.watches.loaded = true
+
+		list, err := store.GetWatches()
+		if err != nil {
+			log.Error.Printf("Watchlist is disabled, failed to load watches: %v\n", err)
+		}
+		for _, w := range list {
+			if w.AssetId != 0 {
+				store.watches.byAsset[w.AssetId] = append(store.watches.byAsset[w.AssetId], w)
+			} else {
+				store.watches.byAddress[w.Address] = append(store.watches.byAddress[w.Address], w)
+			}
+		}
+	}
+
+	return store.watches.byAddress, store.watches.byAsset
+}
+
+// CreateWatch watches the address, or the nep5 asset if assetId is not 0, with a new secret.
+func (store *SQLStore) CreateWatch(address string, assetId uint, webhook string) (*Watch, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	w := &Watch{Address: address, AssetId: assetId, Webhook: webhook, Secret: hex.EncodeToString(secret), CreatedAt: time.Now().Unix()}
+	if assetId != 0 {
+		w.Address = ""
+		w.Contract, _ = cache.GetAssetID(assetId)
+	}
+
+	const insert = "INSERT INTO `watch` (`address`, `asset_id`, `webhook`, `secret`, `created_at`) VALUES (?, ?, ?, ?, ?)"
+	if _, err := execute(store.db, insert, w.Address, w.AssetId, w.Webhook, w.Secret, w.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	const query = "SELECT MAX(`id`) FROM `watch` WHERE `secret` = ?"
+	if err := store.db.QueryRow(query, w.Secret).Scan(&w.Id); err != nil {
+		return nil, err
+	}
+
+	store.resetWatches()
+	return w, nil
+}
+
+// GetWatches returns all watches without secrets.
+func (store *SQLStore) GetWatches() ([]*Watch, error) {
+	list := []*Watch{}
+
+	const query = "SELECT `watch`.`id`, `watch`.`address`, `watch`.`asset_id`, COALESCE(`asset`.`asset_id`, ''), `watch`.`webhook`, `watch`.`created_at` FROM `watch` LEFT JOIN `asset` ON `asset`.`id` = `watch`.`asset_id` ORDER BY `watch`.`id` ASC"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		w := &Watch{}
+		if err := rows.Scan(&w.Id, &w.Address, &w.AssetId, &w.Contract, &w.Webhook, &w.CreatedAt); err != nil {
+			return err
+		}
+
+		list = append(list, w)
+		return nil
+	}, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// DeleteWatch removes the watch, its pending deliveries fail. It returns false if the watch does not exist.
+func (store *SQLStore) DeleteWatch(id uint) (bool, error) {
+	deleted := false
+
+	err := store.transact(func(trans *sql.Tx) error {
+		res, err := execute(trans, "DELETE FROM `watch` WHERE `id` = ?", id)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		deleted = affected > 0
+
+		const update = "UPDATE `watch_delivery` SET `status` = ?, `last_error` = ? WHERE `watch_id` = ? AND `status` = ?"
+		_, err = execute(trans, update, DeliveryFailed, "watch removed", id, DeliveryPending)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	store.resetWatches()
+	return deleted, nil
+}
+
+// watchedMovement is a movement of a watched address or nep5 asset.
+type watchedMovement struct {
+	watch    *Watch
+	eventIdx int
+	payload  WebhookPayload
+}
+
+// queueUTXOMovements queues deliveries of net balance changes of watched addresses made by the transaction.
+func queueUTXOMovements(trans *sql.Tx, byAddress map[string][]*Watch, t *tx.Transaction, vinVouts []*tx.TransactionVout, vouts []*tx.TransactionVout) error {
+	if len(byAddress) == 0 {
+		return nil
+	}
+
+	type movementKey struct {
+		address string
+		assetId uint
+	}
+	changes := make(map[movementKey]*big.Float)
+	add := func(vout *tx.TransactionVout, value *big.Float) {
+		if len(byAddress[vout.Address]) == 0 {
+			return
+		}
+
+		key := movementKey{address: vout.Address, assetId: vout.AssetID}
+		if _, ok := changes[key]; !ok {
+			changes[key] = new(big.Float)
+		}
+		changes[key].Add(changes[key], value)
+	}
+
+	for _, vinVout := range vinVouts {
+		add(vinVout, new(big.Float).Neg(vinVout.Value))
+	}
+	for _, vout := range vouts {
+		add(vout, vout.Value)
+	}
+
+	keys := make([]movementKey, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].address != keys[j].address {
+			return keys[i].address < keys[j].address
+		}
+		return keys[i].assetId < keys[j].assetId
+	})
+
+	movements := []watchedMovement{}
+	for _, key := range keys {
+		change := changes[key]
+		direction := DirectionIn
+		if change.Sign() < 0 {
+			direction = DirectionOut
+			change.Neg(change)
+		}
+
+		amount := change.Text('f', 8)
+		if amount == "0.00000000" {
+			continue
+		}
+
+		assetID, _ := cache.GetAssetID(key.assetId)
+		address := key.address
+		for _, w := range byAddress[address] {
+			movements = append(movements, watchedMovement{
+				watch:    w,
+				eventIdx: -1,
+				payload: WebhookPayload{
+					TxID:        t.TxID,
+					BlockHeight: t.BlockIndex,
+					BlockTime:   t.BlockTime,
+					Asset:       assetID,
+					Address:     address,
+					Direction:   direction,
+					Amount:      amount,
+				},
+			})
+		}
+	}
+
+	return queueDeliveries(trans, t.ID, movements)
+}
+
+// queueNep5Transfer queues deliveries of the nep5 transfer to watches of its addresses and asset.
+func queueNep5Transfer(trans *sql.Tx, byAddress map[string][]*Watch, byAsset map[uint][]*Watch, t *tx.Transaction, appLogIdx int, assetId uint, fromAddr string, toAddr string, value *big.Float) error {
+	if len(byAddress) == 0 && len(byAsset) == 0 {
+		return nil
+	}
+
+	assetID, _ := cache.GetAssetID(assetId)
+	payload := WebhookPayload{
+		TxID:        t.TxID,
+		BlockHeight: t.BlockIndex,
+		BlockTime:   t.BlockTime,
+		Asset:       assetID,
+		Nep5:        true,
+		Amount:      value.Text('f', 8),
+		From:        fromAddr,
+		To:          toAddr,
+	}
+
+	movements := []watchedMovement{}
+	sides := []struct{ address, direction string }{{fromAddr, DirectionOut}, {toAddr, DirectionIn}}
+	for _, side := range sides {
+		if side.address == "" {
+			continue
+		}
+
+		for _, w := range byAddress[side.address] {
+			p := payload
+			p.Address = side.address
+			p.Direction = side.direction
+			movements = append(movements, watchedMovement{watch: w, eventIdx: appLogIdx, payload: p})
+		}
+	}
+	for _, w := range byAsset[assetId] {
+		p := payload
+		p.Direction = DirectionTransfer
+		movements = append(movements, watchedMovement{watch: w, eventIdx: appLogIdx, payload: p})
+	}
+
+	return queueDeliveries(trans, t.ID, movements)
+}
+
+// queueDeliveries stores pending deliveries of the movements in the transaction which makes them,
+// so that deliveries are queued if and only if the movements are committed.
+// Movements replayed after a reset are skipped.
+func queueDeliveries(trans *sql.Tx, txPk uint, movements []watchedMovement) error {
+	now := time.Now().Unix()
+
+	for _, m := range movements {
+		m.payload.WatchId = m.watch.Id
+		payload, err := json.Marshal(m.payload)
+		if err != nil {
+			return err
+		}
+
+		const insert = "INSERT INTO `watch_delivery` (`watch_id`, `tx_pk`, `event_idx`, `address`, `direction`, `payload`, `status`, `attempts`, `next_attempt_at`, `last_error`, `created_at`, `delivered_at`) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, '', ?, 0) ON DUPLICATE KEY UPDATE `watch_id` = `watch_id`"
+		if _, err := execute(trans, insert, m.watch.Id, txPk, m.eventIdx, m.payload.Address, m.payload.Direction, string(payload), DeliveryPending, now, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revertDelivery queues a delivery which tells the webhook that the movement of the delivered delivery is undone.
+func revertDelivery(e execer, id uint, payload string) error {
+	p := WebhookPayload{}
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return err
+	}
+	p.Reverted = true
+
+	reverted, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	const insert = "INSERT INTO `watch_delivery` (`watch_id`, `tx_pk`, `event_idx`, `address`, `direction`, `reverts`, `payload`, `status`, `attempts`, `next_attempt_at`, `last_error`, `created_at`, `delivered_at`) SELECT `watch_id`, NULL, `event_idx`, `address`, `direction`, `id`, ?, ?, 0, ?, '', ?, 0 FROM `watch_delivery` WHERE `id` = ?"
+	_, err = execute(e, insert, string(reverted), DeliveryPending, now, now, id)
+	return err
+}
+
+// rollbackWatchDeliveries detaches deliveries of removed transactions from their pks which will be reused.
+// Delivered movements are kept in the log and reverted by new deliveries, undelivered ones are cancelled.
+func rollbackWatchDeliveries(trans *sql.Tx, r *RollbackReport, first uint) error {
+	delivered := []*WebhookDelivery{}
+
+	const query = "SELECT `id`, `payload` FROM `watch_delivery` WHERE `tx_pk` >= ? AND `status` = ? ORDER BY `id` ASC"
+	err := queryRows(trans, func(rows *sql.Rows) error {
+		d := &WebhookDelivery{}
+		if err := rows.Scan(&d.Id, &d.Payload); err != nil {
+			return err
+		}
+
+		delivered = append(delivered, d)
+		return nil
+	}, query, first, DeliveryDelivered)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range delivered {
+		if err := revertDelivery(trans, d.Id, d.Payload); err != nil {
+			return err
+		}
+	}
+	if len(delivered) > 0 {
+		r.Rows = append(r.Rows, RollbackRows{Table: "watch_delivery", Action: "reverted", Rows: int64(len(delivered))})
+	}
+
+	// MySQL assigns columns from left to right, so `status` is updated after it is checked by `last_error`.
+	const detach = "UPDATE `watch_delivery` SET `tx_pk` = NULL, `last_error` = CASE WHEN `status` = ? THEN ? ELSE `last_error` END, `status` = CASE WHEN `status` = ? THEN ? ELSE `status` END WHERE `tx_pk` >= ?"
+	return r.exec(trans, "watch_delivery", "updated", detach, DeliveryPending, rolledBackError, DeliveryPending, DeliveryFailed, first)
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due, oldest first.
+func (store *SQLStore) GetDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	deliveries := []*WebhookDelivery{}
+
+	const query = "SELECT `watch_delivery`.`id`, `watch_delivery`.`watch_id`, `watch_delivery`.`reverts`, `watch`.`webhook`, `watch`.`secret`, `watch_delivery`.`payload`, `watch_delivery`.`status`, `watch_delivery`.`attempts`, `watch_delivery`.`next_attempt_at`, `watch_delivery`.`last_error`, `watch_delivery`.`created_at`, `watch_delivery`.`delivered_at` FROM `watch_delivery` INNER JOIN `watch` ON `watch`.`id` = `watch_delivery`.`watch_id` WHERE `watch_delivery`.`status` = ? AND `watch_delivery`.`next_attempt_at` <= ? ORDER BY `watch_delivery`.`id` ASC LIMIT ?"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		d := &WebhookDelivery{}
+		if err := rows.Scan(&d.Id, &d.WatchId, &d.Reverts, &d.Webhook, &d.Secret, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return err
+		}
+
+		deliveries = append(deliveries, d)
+		return nil
+	}, query, DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the result of an attempt of the delivery.
+func (store *SQLStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	if len(d.LastError) > 255 {
+		d.LastError = d.LastError[:255]
+	}
+
+	return store.transact(func(trans *sql.Tx) error {
+		const update = "UPDATE `watch_delivery` SET `status` = ?, `attempts` = ?, `next_attempt_at` = ?, `last_error` = ?, `delivered_at` = ? WHERE `id` = ? AND `status` = ? LIMIT 1"
+		res, err := execute(trans, update, d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.DeliveredAt, d.Id, DeliveryPending)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected > 0 || d.Status != DeliveryDelivered {
+			return err
+		}
+
+		// The delivery has been cancelled by a rollback while it was posted, so its movement is reverted.
+		const cancelled = "UPDATE `watch_delivery` SET `status` = ?, `attempts` = ?, `last_error` = '', `delivered_at` = ? WHERE `id` = ? AND `tx_pk` IS NULL AND `reverts` = 0 AND `last_error` = ? LIMIT 1"
+		if res, err = execute(trans, cancelled, d.Status, d.Attempts, d.DeliveredAt, d.Id, rolledBackError); err != nil {
+			return err
+		}
+		if affected, err = res.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		return revertDelivery(trans, d.Id, d.Payload)
+	})
+}
+
+// GetWebhookDeliveries returns paged deliveries of the watch, newest first.
+func (store *SQLStore) GetWebhookDeliveries(watchId uint, limit int, offset int) ([]*WebhookDelivery, uint64, error) {
+	var total uint64
+	if err := store.db.QueryRow("SELECT COUNT(`id`) FROM `watch_delivery` WHERE `watch_id` = ?", watchId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	deliveries := []*WebhookDelivery{}
+	const query = "SELECT `id`, `watch_id`, `reverts`, `payload`, `status`, `attempts`, `next_attempt_at`, `last_error`, `created_at`, `delivered_at` FROM `watch_delivery` WHERE `watch_id` = ? ORDER BY `id` DESC LIMIT ? OFFSET ?"
+	err := store.scanRows(func(rows *sql.Rows) error {
+		d := &WebhookDelivery{}
+		if err := rows.Scan(&d.Id, &d.WatchId, &d.Reverts, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return err
+		}
+
+		deliveries = append(deliveries, d)
+		return nil
+	}, query, watchId, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/neo/asset"
+	"neo_explorer/neo/tx"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchlist(t *testing.T) {
+	store := newTestStore(t)
+
+	blocks := testBlocks(1, 2)
+	bulk := &tx.Bulk{
+		TXs: []*tx.Transaction{
+			testTx(1, blocks[0], "IssueTransaction"),
+			testTx(2, blocks[1], "ContractTransaction"),
+			testTx(3, blocks[1], "InvocationTransaction"),
+		},
+		TXVins: []*tx.TransactionVin{{TxId: 2, TxID: 1, Vout: 0}},
+		TXVouts: []*tx.TransactionVout{
+			{TxId: 1, N: 0, AssetID: 1, Value: big.NewFloat(10), Address: "WatchAddrA", AddressId: 1},
+			{TxId: 2, N: 0, AssetID: 1, Value: big.NewFloat(4), Address: "WatchAddrB", AddressId: 2},
+			{TxId: 2, N: 1, AssetID: 1, Value: big.NewFloat(6), Address: "WatchAddrA", AddressId: 1},
+		},
+		Assets: []*asset.Asset{
+			{AssetID: "0xasset", Type: "Token", Name: "Token", Amount: big.NewFloat(100), Available: big.NewFloat(0), Precision: 8},
+			{AssetID: "0xtoken", Type: "NEP5", Name: "Nep5", Amount: big.NewFloat(100), Available: big.NewFloat(100), Precision: 8},
+		},
+	}
+	insertTestBlocks(t, store, blocks, bulk)
+	cache.LoadAssetsInfo(store.GetAssetInfo())
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+
+	addrWatch, err := store.CreateWatch("WatchAddrA", 0, "http://localhost/addr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenWatch, err := store.CreateWatch("", 2, "http://localhost/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrWatch.Secret) != 64 || tokenWatch.Contract != "0xtoken" || tokenWatch.Id == addrWatch.Id {
+		t.Fatalf("created watches %+v and %+v", addrWatch, tokenWatch)
+	}
+	if watches, err := store.GetWatches(); err != nil || len(watches) != 2 || watches[0].Secret != "" {
+		t.Fatalf("GetWatches() = %+v, %v, want 2 watches without secrets", watches, err)
+	}
+
+	// Deliveries are queued in the transaction of their movements, which fails if they can not be queued.
+	execQueries(t, store, "ALTER TABLE `watch_delivery` RENAME TO `watch_delivery_moved`")
+	if err := store.ApplyVinsVouts(bulk.TXs[0], nil, bulk.TXVouts[:1]); err == nil {
+		t.Fatal("movements of tx 1 are applied without their deliveries")
+	}
+	if pk := store.getCounterInstance().LastTxPk; pk != 0 {
+		t.Errorf("last_tx_pk = %d after deliveries failed to be queued, want 0", pk)
+	}
+	execQueries(t, store, "ALTER TABLE `watch_delivery_moved` RENAME TO `watch_delivery`")
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+
+	// A receives 10, then sends 4 of them to B, and sends 1 nep5 token to B.
+	if err := store.ApplyVinsVouts(bulk.TXs[0], nil, bulk.TXVouts[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ApplyVinsVouts(bulk.TXs[1], bulk.TXVins, bulk.TXVouts[1:]); err != nil {
+		t.Fatal(err)
+	}
+	// Replayed transfers are not delivered twice.
+	for i := 0; i < 2; i++ {
+		if err := store.InsertNep5transaction(bulk.TXs[2], 0, 2, "WatchAddrA", big.NewFloat(9), "WatchAddrB", big.NewFloat(1), big.NewFloat(1), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(want ...string) []*WebhookDelivery {
+		t.Helper()
+
+		deliveries, err := store.GetDueWebhookDeliveries(time.Now().Unix(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != len(want) {
+			t.Fatalf("GetDueWebhookDeliveries() returned %d deliveries, want %d", len(deliveries), len(want))
+		}
+		for i, d := range deliveries {
+			p := WebhookPayload{}
+			if err := json.Unmarshal([]byte(d.Payload), &p); err != nil {
+				t.Fatal(err)
+			}
+			got := fmt.Sprintf("%s %d %s %s %v %s %s %s", d.Webhook, p.WatchId, p.TxID, p.Asset, p.Nep5, p.Address, p.Direction, p.Amount)
+			if p.Reverted {
+				got += fmt.Sprintf(" reverts %d", d.Reverts)
+			}
+			if got != want[i] {
+				t.Errorf("delivery %d = %s, want %s", i, got, want[i])
+			}
+		}
+
+		return deliveries
+	}
+
+	a, token := addrWatch.Id, tokenWatch.Id
+	deliveries := check(
+		fmt.Sprintf("http://localhost/addr %d 0x01 0xasset false WatchAddrA in 10.00000000", a),
+		fmt.Sprintf("http://localhost/addr %d 0x02 0xasset false WatchAddrA out 4.00000000", a),
+		fmt.Sprintf("http://localhost/addr %d 0x03 0xtoken true WatchAddrA out 1.00000000", a),
+		fmt.Sprintf("http://localhost/token %d 0x03 0xtoken true  transfer 1.00000000", token),
+	)
+
+	d := deliveries[0]
+	d.Status, d.Attempts, d.DeliveredAt = DeliveryDelivered, 1, time.Now().Unix()
+	if err := store.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+	d = deliveries[1]
+	d.Attempts, d.NextAttemptAt, d.LastError = 1, time.Now().Unix()+60, "webhook responded 500"
+	if err := store.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pending deliveries of removed watches fail.
+	if deleted, err := store.DeleteWatch(token); err != nil || !deleted {
+		t.Fatalf("DeleteWatch(%d) = %v, %v, want true", token, deleted, err)
+	}
+	if deleted, err := store.DeleteWatch(token); err != nil || deleted {
+		t.Errorf("DeleteWatch(%d) again = %v, %v, want false", token, deleted, err)
+	}
+	check(fmt.Sprintf("http://localhost/addr %d 0x03 0xtoken true WatchAddrA out 1.00000000", a))
+
+	history, total, err := store.GetWebhookDeliveries(a, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(history) != 3 || history[2].Status != DeliveryDelivered || history[1].LastError != "webhook responded 500" {
+		t.Errorf("GetWebhookDeliveries(%d) = %+v, %d", a, history, total)
+	}
+
+	// The movement of tx 2 is delivered, the one of tx 3 is being posted when its block is rolled back.
+	d = deliveries[1]
+	d.Status, d.Attempts, d.DeliveredAt = DeliveryDelivered, 2, time.Now().Unix()
+	if err := store.UpdateWebhookDelivery(d); err != nil {
+		t.Fatal(err)
+	}
+	posted := deliveries[2]
+
+	// Delivered movements of rolled back transactions are reverted, pending ones are cancelled.
+	r, err := store.RollbackBlocks(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fmt.Sprint(r.Rows), "{watch_delivery reverted 1}") {
+		t.Errorf("rollback rows = %v, want 1 reverted watch_delivery", r.Rows)
+	}
+	if n := countRows(t, store, "SELECT COUNT(*) FROM `watch_delivery` WHERE `tx_pk` IS NULL AND `reverts` = 0"); n != 3 {
+		t.Errorf("%d deliveries of rolled back transactions are detached from their pks, want 3", n)
+	}
+	reverted := fmt.Sprintf("http://localhost/addr %d 0x02 0xasset false WatchAddrA out 4.00000000 reverts %d", a, deliveries[1].Id)
+	check(reverted)
+
+	posted.Status, posted.Attempts, posted.DeliveredAt = DeliveryDelivered, 1, time.Now().Unix()
+	if err := store.UpdateWebhookDelivery(posted); err != nil {
+		t.Fatal(err)
+	}
+	check(reverted, fmt.Sprintf("http://localhost/addr %d 0x03 0xtoken true WatchAddrA out 1.00000000 reverts %d", a, posted.Id))
+
+	history, total, err = store.GetWebhookDeliveries(a, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(history) != 5 || history[2].Status != DeliveryDelivered || history[3].Status != DeliveryDelivered || history[4].Status != DeliveryDelivered {
+		t.Errorf("GetWebhookDeliveries(%d) after rollback = %+v, %d, want delivered movements kept", a, history, total)
+	}
+
+	// Reused pks of transactions of the new chain are delivered again.
+	fork := testBlocks(1, 3)
+	forked := testTx(2, fork[1], "ContractTransaction")
+	insertTestBlocks(t, store, fork[1:], &tx.Bulk{TXs: []*tx.Transaction{forked}, TXVouts: bulk.TXVouts[1:]})
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+	if err := store.ApplyVinsVouts(forked, bulk.TXVins, bulk.TXVouts[1:]); err != nil {
+		t.Fatal(err)
+	}
+	check(reverted,
+		fmt.Sprintf("http://localhost/addr %d 0x03 0xtoken true WatchAddrA out 1.00000000 reverts %d", a, posted.Id),
+		fmt.Sprintf("http://localhost/addr %d 0x02 0xasset false WatchAddrA out 4.00000000", a),
+	)
+}
@@ -6,7 +6,6 @@ import (
 	"neo_explorer/core/cache"
 	"neo_explorer/core/util"
 	"neo_explorer/neo/asset"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/rpc"
 	"neo_explorer/neo/smartcontract"
 	"neo_explorer/neo/tx"
@@ -16,27 +15,43 @@ import (
 var txMap map[string]uint
 var addrMap map[string]uint
 
+// Lookup finds pks of stored transactions and addresses.
+type Lookup interface {
+	GetTx(txid string) uint
+	GetVoutAddrID(addr string) (uint, error)
+}
+
 // ParseTxs parses all raw transactions in raw blocks to Bulk.
-func Txs(rawBlocks []*rpc.RawBlock, lastTxPkId *uint, LastAddrPkId *util.SafeCounter) *tx.Bulk {
+// Pks taken before an error are not given back, the caller should reload them from db.
+func Txs(lookup Lookup, rawBlocks []*rpc.RawBlock, lastTxPkId *uint, LastAddrPkId *util.SafeCounter) (*tx.Bulk, error) {
 	txs := tx.Bulk{}
 	txMap = make(map[string]uint, 100)
 	addrMap = make(map[string]uint, 100)
 
+	var err error
 	for _, rawBlock := range rawBlocks {
 		for _, rawTx := range rawBlock.Tx {
 			*lastTxPkId++
 			txMap[rawTx.TxID] = *lastTxPkId
 			txs.TXs = appendTx(txs.TXs, rawBlock.Index, rawBlock.Time, &rawTx, *lastTxPkId)
 			txs.TXAttrs = appendTxAttrs(txs.TXAttrs, &rawTx, *lastTxPkId)
-			txs.TXVins = appendTxVin(txs.TXVins, &rawTx, *lastTxPkId)
-			txs.TXVouts = appendTxVout(txs.TXVouts, &rawTx, *lastTxPkId, LastAddrPkId)
+			if txs.TXVins, err = appendTxVin(lookup, txs.TXVins, &rawTx, *lastTxPkId); err != nil {
+				return nil, err
+			}
+			if txs.TXVouts, err = appendTxVout(lookup, txs.TXVouts, &rawTx, *lastTxPkId, LastAddrPkId); err != nil {
+				return nil, err
+			}
 			txs.TXScripts = appendTxScripts(txs.TXScripts, &rawTx, *lastTxPkId)
-			txs.Assets = appendAsset(rawBlock, txs.Assets, &rawTx)
-			txs.Claims = appendClaims(txs.Claims, &rawTx, *lastTxPkId)
+			if txs.Assets, err = appendAsset(rawBlock, txs.Assets, &rawTx); err != nil {
+				return nil, err
+			}
+			if txs.Claims, err = appendClaims(lookup, txs.Claims, &rawTx, *lastTxPkId); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	return &txs
+	return &txs, nil
 }
 
 func appendTx(txs []*tx.Transaction, blockIndex uint, blockTime uint64, rawTx *rpc.RawTx, ID uint) []*tx.Transaction {
@@ -75,14 +90,13 @@ func appendTxAttrs(txAttrs []*tx.TransactionAttribute, rawTx *rpc.RawTx, txId ui
 	return txAttrs
 }
 
-func appendTxVin(txVin []*tx.TransactionVin, rawTx *rpc.RawTx, txId uint) []*tx.TransactionVin {
+func appendTxVin(lookup Lookup, txVin []*tx.TransactionVin, rawTx *rpc.RawTx, txId uint) ([]*tx.TransactionVin, error) {
 	for _, rawVin := range rawTx.Vin {
 		txID, ok := txMap[rawVin.TxID]
 		if !ok {
-			txID = db.GetTx(rawVin.TxID)
+			txID = lookup.GetTx(rawVin.TxID)
 			if txID < 1 {
-				err, _ := fmt.Printf("appendTxVin get TxID error: %+v", rawTx)
-				panic(err)
+				return nil, fmt.Errorf("appendTxVin get TxID error: vin %s of tx %s not found", rawVin.TxID, rawTx.TxID)
 			}
 		}
 
@@ -94,18 +108,18 @@ func appendTxVin(txVin []*tx.TransactionVin, rawTx *rpc.RawTx, txId uint) []*tx.
 		}
 		txVin = append(txVin, &vin)
 	}
-	return txVin
+	return txVin, nil
 }
 
-func appendTxVout(txVout []*tx.TransactionVout, rawTx *rpc.RawTx, txId uint, LastAddrPkId *util.SafeCounter) []*tx.TransactionVout {
+func appendTxVout(lookup Lookup, txVout []*tx.TransactionVout, rawTx *rpc.RawTx, txId uint, LastAddrPkId *util.SafeCounter) ([]*tx.TransactionVout, error) {
 	for _, rawVout := range rawTx.Vout {
 		assetId, err := cache.GetAssetId(rawVout.Asset)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		addrID, ok := addrMap[rawVout.Address]
 		if !ok {
-			addrID, err = db.GetVoutAddrID(rawVout.Address)
+			addrID, err = lookup.GetVoutAddrID(rawVout.Address)
 			if err != nil {
 				LastAddrPkId.Add(1)
 				addrID = uint(LastAddrPkId.Get())
@@ -124,7 +138,7 @@ func appendTxVout(txVout []*tx.TransactionVout, rawTx *rpc.RawTx, txId uint, Las
 		addrMap[rawVout.Address] = addrID
 		txVout = append(txVout, &vout)
 	}
-	return txVout
+	return txVout, nil
 }
 
 func appendTxScripts(txScripts []*tx.TransactionScripts, rawTx *rpc.RawTx, txId uint) []*tx.TransactionScripts {
@@ -140,7 +154,7 @@ func appendTxScripts(txScripts []*tx.TransactionScripts, rawTx *rpc.RawTx, txId
 	return txScripts
 }
 
-func appendAsset(rawBlock *rpc.RawBlock, assets []*asset.Asset, rawTx *rpc.RawTx) []*asset.Asset {
+func appendAsset(rawBlock *rpc.RawBlock, assets []*asset.Asset, rawTx *rpc.RawTx) ([]*asset.Asset, error) {
 	var asset *asset.Asset
 	if rawTx.Type == typeName(tx.RegisterTransaction) {
 		asset = parseAssetFromRegisterTransaction(rawBlock.Index, rawTx)
@@ -149,7 +163,7 @@ func appendAsset(rawBlock *rpc.RawBlock, assets []*asset.Asset, rawTx *rpc.RawTx
 		if strings.HasSuffix(rawTx.Script, smartcontract.AssetFingerPrint) {
 			asset = parseAssetFromInvocationTransaction(rawTx.Script)
 			if asset == nil {
-				return assets
+				return assets, nil
 			}
 
 			// Supplement the rest fields.
@@ -160,12 +174,12 @@ func appendAsset(rawBlock *rpc.RawBlock, assets []*asset.Asset, rawTx *rpc.RawTx
 	}
 
 	if asset == nil {
-		return assets
+		return assets, nil
 	}
 
 	id, err := cache.GetAssetId(rawTx.TxID)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	asset.ID = id
 
@@ -175,19 +189,28 @@ func appendAsset(rawBlock *rpc.RawBlock, assets []*asset.Asset, rawTx *rpc.RawTx
 	asset.Transactions = 0
 
 	assets = append(assets, asset)
-	return assets
+	return assets, nil
 }
 
-func appendClaims(claims []*tx.TransactionClaims, rawTx *rpc.RawTx, txId uint) []*tx.TransactionClaims {
+func appendClaims(lookup Lookup, claims []*tx.TransactionClaims, rawTx *rpc.RawTx, txId uint) ([]*tx.TransactionClaims, error) {
 	for _, rawClaim := range rawTx.Claims {
+		txID, ok := txMap[rawClaim.TxID]
+		if !ok {
+			txID = lookup.GetTx(rawClaim.TxID)
+			if txID < 1 {
+				return nil, fmt.Errorf("appendClaims get TxID error: claim %s of tx %s not found", rawClaim.TxID, rawTx.TxID)
+			}
+		}
+
 		claim := tx.TransactionClaims{
 			TxId: txId,
 			//TxMap: rawClaim.TxMap,
+			TxID: txID,
 			Vout: rawClaim.Vout,
 		}
 		claims = append(claims, &claim)
 	}
-	return claims
+	return claims, nil
 }
 
 func parseAssetFromRegisterTransaction(blockIndex uint, rawTx *rpc.RawTx) *asset.Asset {
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"neo_explorer/core/log"
+	"net/url"
+)
+
+// Servers changed by admin at runtime, guarded by sLock.
+var (
+	// addedServers are added besides the configured ones.
+	addedServers = make(map[string]bool)
+	// removedServers are never used even if configured or discovered.
+	removedServers = make(map[string]bool)
+)
+
+// AddServer adds the rpc server at runtime, it must answer getblockcount.
+func AddServer(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid rpc url: %s", rawURL)
+	}
+
+	var count int
+	if err := DefaultClient.WithTimeout(probeTimeout).CallServer(ctx, rawURL, "getblockcount", nil, &count); err != nil {
+		return err
+	}
+	p := probe(rawURL)
+
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	delete(removedServers, rawURL)
+	if !isConfigured(rawURL) {
+		addedServers[rawURL] = true
+	}
+
+	s, ok := servers[rawURL]
+	if !ok {
+		s = newServerState()
+		if servers == nil {
+			servers = make(map[string]*serverState)
+		}
+		servers[rawURL] = s
+	}
+	s.height = count - 1
+	s.updateProbe(rawURL, p)
+	serverHeight.With(rawURL).Set(float64(s.height))
+
+	log.Printf("Rpc server %s added at height %d\n", rawURL, s.height)
+	return nil
+}
+
+// RemoveServer removes the rpc server until it is added again, configured ones included.
+func RemoveServer(url string) error {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	if _, ok := servers[url]; !ok && !isConfigured(url) {
+		return fmt.Errorf("unknown rpc server: %s", url)
+	}
+
+	delete(servers, url)
+	delete(addedServers, url)
+	delete(discovered, url)
+	removedServers[url] = true
+
+	log.Printf("Rpc server %s removed\n", url)
+	return nil
+}
+
+// DisableServer stops sending requests to the rpc server if disabled is true,
+// or resumes it otherwise. Heights of disabled servers are still refreshed.
+func DisableServer(url string, disabled bool) error {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	s, ok := servers[url]
+	if !ok {
+		return errors.New("unknown rpc server: " + url)
+	}
+
+	s.disabled = disabled
+
+	if disabled {
+		log.Printf("Rpc server %s disabled\n", url)
+	} else {
+		log.Printf("Rpc server %s enabled\n", url)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"testing"
+)
+
+func TestAdminServers(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	s := newTestServer(t, func(req request) interface{} {
+		if req.Method == "getblockcount" {
+			return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": 101}
+		}
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -32601, "message": "Method not found"}}
+	})
+	setServers(t, map[string]*serverState{})
+	t.Cleanup(func() {
+		sLock.Lock()
+		delete(addedServers, s.URL)
+		delete(removedServers, s.URL)
+		sLock.Unlock()
+	})
+
+	if err := AddServer(context.Background(), "ftp://127.0.0.1"); err == nil {
+		t.Error("server with invalid url added")
+	}
+
+	if err := AddServer(context.Background(), s.URL); err != nil {
+		t.Fatal(err)
+	}
+	if url, ok := getServer(100, 0); !ok || url != s.URL {
+		t.Fatalf("getServer = %s, %v after server added", url, ok)
+	}
+	if !containsURL(rpcURLs(), s.URL) {
+		t.Error("added server not refreshed")
+	}
+
+	if err := DisableServer(s.URL, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getServer(0, 0); ok {
+		t.Error("disabled server selected")
+	}
+	if err := DisableServer(s.URL, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getServer(0, 0); !ok {
+		t.Error("enabled server not selected")
+	}
+
+	if err := RemoveServer(s.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getServer(0, 0); ok {
+		t.Error("removed server selected")
+	}
+	if containsURL(rpcURLs(), s.URL) {
+		t.Error("removed server still refreshed")
+	}
+	if err := RemoveServer(s.URL); err == nil {
+		t.Error("unknown server removed")
+	}
+}
+
+func containsURL(urls []string, url string) bool {
+	for _, u := range urls {
+		if u == url {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,231 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"neo_explorer/core/log"
+	"sync"
+)
+
+// noBatchServers records rpc servers which rejected batch calls.
+var noBatchServers sync.Map
+
+// DownloadBlocks downloads blocks of heights [from, from+count) in a single batch call,
+// which is hedged like DownloadBlock if the server is slow.
+// Blocks which can not be downloaded are nil, e.g. beyond the best height or ctx is done.
+func DownloadBlocks(ctx context.Context, from int, count int) []*RawBlock {
+	blocks := make([]*RawBlock, count)
+	if count == 1 {
+		blocks[0] = DownloadBlock(ctx, from)
+		return blocks
+	}
+
+	paramsList := make([][]interface{}, count)
+	for i := range paramsList {
+		paramsList[i] = []interface{}{from + i, 1}
+	}
+
+	urls, results, errs := DefaultClient.hedgedBatchCall(ctx, from, "getblock", paramsList, func() []interface{} {
+		results := make([]interface{}, count)
+		for i := range results {
+			results[i] = new(*RawBlock)
+		}
+		return results
+	})
+
+	for i, err := range errs {
+		if err == ErrNoServer || ctx.Err() != nil {
+			continue
+		}
+
+		blocks[i] = *results[i].(**RawBlock)
+		if err != nil || blocks[i] == nil {
+			// The server may lag behind, try others.
+			blocks[i] = DownloadBlock(ctx, from+i)
+			continue
+		}
+
+		blocks[i].Server = urls[i]
+	}
+
+	return blocks
+}
+
+// GetApplicationLogs returns application logs of transactions in a single batch call,
+// blockIndex is the highest block of these transactions.
+// Logs are nil if ctx is done before they are returned.
+func GetApplicationLogs(ctx context.Context, blockIndex int, txIDs []string) []*RawApplicationLogResult {
+	logs := make([]*RawApplicationLogResult, len(txIDs))
+	if len(txIDs) == 1 {
+		logs[0] = GetApplicationLog(ctx, blockIndex, txIDs[0])
+		return logs
+	}
+
+	paramsList := make([][]interface{}, len(txIDs))
+	results := make([]interface{}, len(txIDs))
+	for i, txID := range txIDs {
+		paramsList[i] = []interface{}{txID}
+		results[i] = &logs[i]
+	}
+
+	_, errs := DefaultClient.BatchCall(ctx, blockIndex, "getapplicationlog", paramsList, results)
+
+	for i, err := range errs {
+		if (err != nil || logs[i] == nil) && ctx.Err() == nil {
+			// Retry until succeeded.
+			logs[i] = GetApplicationLog(ctx, blockIndex, txIDs[i])
+		}
+	}
+
+	return logs
+}
+
+// hedgedBatchCall is like BatchCall, but if the server has not answered within hedgeDelay of batch calls,
+// the same batch is sent to a second server and the first batch response is taken.
+// newResults returns targets of each request of one attempt, targets of the taken one are returned.
+// If both fail, the batch is sent by BatchCall.
+func (c *Client) hedgedBatchCall(ctx context.Context, minHeight int, method string, paramsList [][]interface{}, newResults func() []interface{}) ([]string, []interface{}, []error) {
+	body, err := marshalBatch(method, paramsList)
+	if err != nil {
+		return make([]string, len(paramsList)), newResults(), batchErrors(len(paramsList), err)
+	}
+
+	type batchResult struct {
+		results []interface{}
+		errs    []error
+	}
+
+	url, r, _, err := c.hedge(ctx, minHeight, batchExcluded(), methodCapability(method), method+" batch",
+		func(ctx context.Context, url string) (interface{}, error) {
+			respBody, err := c.send(ctx, url, body)
+			if err != nil {
+				return nil, err
+			}
+
+			results := newResults()
+			errs := make([]error, len(results))
+			if !decodeBatchResponse(url, respBody, results, errs) {
+				log.Printf("Rpc server %s does not support batch calls, send requests one by one\n", url)
+				noBatchServers.Store(url, true)
+				return nil, fmt.Errorf("rpc server %s does not support batch calls", url)
+			}
+
+			return batchResult{results, errs}, nil
+		})
+	if err != nil {
+		results := newResults()
+		urls, errs := c.BatchCall(ctx, minHeight, method, paramsList, results)
+		return urls, results, errs
+	}
+
+	urls := make([]string, len(paramsList))
+	for i := range urls {
+		urls[i] = url
+	}
+
+	return urls, r.(batchResult).results, r.(batchResult).errs
+}
+
+// BatchCall sends requests of the method with each params of paramsList in a single JSON-RPC batch
+// to one of rpc servers whose height higher than minHeight,
+// and decodes every result into results of the same position.
+// Requests are sent one by one if servers reject batch calls.
+// It returns urls of servers which answered and errors of each request.
+func (c *Client) BatchCall(ctx context.Context, minHeight int, method string, paramsList [][]interface{}, results []interface{}) ([]string, []error) {
+	urls := make([]string, len(paramsList))
+	errs := make([]error, len(paramsList))
+
+	body, err := marshalBatch(method, paramsList)
+	if err != nil {
+		return urls, batchErrors(len(paramsList), err)
+	}
+
+	excluded := batchExcluded()
+
+	url, respBody, err := c.post(ctx, minHeight, methodCapability(method), body, excluded)
+	switch {
+	case err == nil:
+		if decodeBatchResponse(url, respBody, results, errs) {
+			for i := range urls {
+				urls[i] = url
+			}
+			return urls, errs
+		}
+
+		log.Printf("Rpc server %s does not support batch calls, send requests one by one\n", url)
+		noBatchServers.Store(url, true)
+	case err != ErrNoServer || len(excluded) == 0:
+		return urls, batchErrors(len(paramsList), err)
+	}
+
+	for i, params := range paramsList {
+		urls[i], errs[i] = c.Call(ctx, minHeight, method, params, results[i])
+	}
+
+	return urls, errs
+}
+
+// marshalBatch returns the body of a JSON-RPC batch of the method with each params of paramsList.
+func marshalBatch(method string, paramsList [][]interface{}) ([]byte, error) {
+	requests := make([]request, len(paramsList))
+	for i, params := range paramsList {
+		// Ids start from 1 and are used to match responses.
+		requests[i] = newRequest(method, params, i+1)
+	}
+
+	return json.Marshal(requests)
+}
+
+// batchExcluded returns rpc servers which rejected batch calls.
+func batchExcluded() []string {
+	excluded := []string{}
+	noBatchServers.Range(func(url, _ interface{}) bool {
+		excluded = append(excluded, url.(string))
+		return true
+	})
+
+	return excluded
+}
+
+// batchErrors returns err for each of n requests.
+func batchErrors(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// decodeBatchResponse decodes results of a batch call into results by their ids,
+// requests without response get an error.
+// It returns false if the response is not a batch.
+func decodeBatchResponse(url string, respBody []byte, results []interface{}, errs []error) bool {
+	responses := []response{}
+	if err := json.Unmarshal(respBody, &responses); err != nil {
+		return false
+	}
+
+	answered := make([]bool, len(results))
+	for _, resp := range responses {
+		if resp.ID < 1 || resp.ID > len(results) {
+			log.Error.Printf("Unexpected response id %d of batch call from %s\n", resp.ID, url)
+			continue
+		}
+
+		i := resp.ID - 1
+		answered[i] = true
+		if err := resp.decode(results[i]); err != nil {
+			errs[i] = err
+		}
+	}
+
+	for i := range answered {
+		if !answered[i] {
+			errs[i] = fmt.Errorf("no response of request %d from %s", i+1, url)
+		}
+	}
+
+	return true
+}
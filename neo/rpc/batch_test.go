@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"testing"
+)
+
+func TestDecodeBatchResponse(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	blocks := make([]*RawBlock, 4)
+	results := []interface{}{&blocks[0], &blocks[1], &blocks[2], &blocks[3]}
+	errs := make([]error, len(results))
+	respBody := []byte(`[
+		{"jsonrpc":"2.0","id":3,"result":{"index":12}},
+		{"jsonrpc":"2.0","id":1,"result":{"index":10}},
+		{"jsonrpc":"2.0","id":4,"error":{"code":-100,"message":"Unknown block"}},
+		{"jsonrpc":"2.0","id":9,"result":{"index":99}}
+	]`)
+
+	if !decodeBatchResponse("http://seed1", respBody, results, errs) {
+		t.Fatal("batch response not decoded")
+	}
+
+	if b := blocks[0]; errs[0] != nil || b == nil || b.Index != 10 {
+		t.Errorf("block of id 1 = %+v, %v, want index 10", b, errs[0])
+	}
+	if b := blocks[1]; errs[1] == nil || b != nil {
+		t.Errorf("block of id 2 = %+v, %v, want no response error", b, errs[1])
+	}
+	if b := blocks[2]; errs[2] != nil || b == nil || b.Index != 12 {
+		t.Errorf("block of id 3 = %+v, %v, want index 12", b, errs[2])
+	}
+	if e, ok := errs[3].(*Error); !ok || e.Code != -100 {
+		t.Errorf("error of id 4 = %v, want rpc error -100", errs[3])
+	}
+}
+
+func TestDecodeBatchResponseNotBatch(t *testing.T) {
+	var b *RawBlock
+	results := []interface{}{&b}
+	errs := make([]error, 1)
+	respBody := []byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}`)
+
+	if decodeBatchResponse("http://seed1", respBody, results, errs) {
+		t.Error("single response decoded as batch")
+	}
+}
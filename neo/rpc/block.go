@@ -1,16 +1,10 @@
 package rpc
 
-// BlockCountRespponse returns block height of chain.
-type BlockCountRespponse struct {
-	jsonRPCResponse
-	Result int `json:"result"`
-}
-
-// BlockResponse returns full block data of a specific index.
-type BlockResponse struct {
-	jsonRPCResponse
-	Result *RawBlock `json:"result"`
-}
+import (
+	"context"
+	"fmt"
+	"neo_explorer/core/log"
+)
 
 // RawBlock is the raw block structure used in rpc response.
 type RawBlock struct {
@@ -29,15 +23,49 @@ type RawBlock struct {
 	}
 	Tx            []RawTx
 	NextBlockHash string `json:"nextblockhash"`
+
+	// Server is the rpc url this block was downloaded from.
+	Server string `json:"-"`
 }
 
 // DownloadBlock from rpc server.
-func DownloadBlock(index int) *RawBlock {
-	params := []interface{}{index, 1}
-	args := getRPCRequestBody("getblock", params)
+func DownloadBlock(ctx context.Context, index int) *RawBlock {
+	return DownloadBlockExcluding(ctx, index)
+}
+
+// DownloadBlockExcluding downloads block from any rpc server except the excluded ones.
+// If the server is slow, the block is requested from another server too.
+// It returns nil if no server has the block or ctx is done.
+func DownloadBlockExcluding(ctx context.Context, index int, excluded ...string) *RawBlock {
+	url, result, err := DefaultClient.hedgedCall(ctx, index, excluded, "getblock", []interface{}{index, 1},
+		func() interface{} { return new(*RawBlock) })
+	if err != nil {
+		// Exceed the highest block index.
+		if err != ErrNoServer && ctx.Err() == nil {
+			log.Error.Printf("Failed to download block %d: %v\n", index, err)
+		}
+		return nil
+	}
 
-	respData := BlockResponse{}
-	rpcCall(index, args, &respData)
+	b := *result.(**RawBlock)
+	if b != nil {
+		b.Server = url
+	}
+
+	return b
+}
+
+// DownloadBlockFrom downloads block from the given rpc server.
+func DownloadBlockFrom(ctx context.Context, url string, index int) (*RawBlock, error) {
+	var b *RawBlock
+	if err := DefaultClient.CallServer(ctx, url, "getblock", []interface{}{index, 1}, &b); err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("rpc server %s returned no block of height %d", url, index)
+	}
 
-	return respData.Result
+	b.Server = url
+	return b, nil
 }
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"neo_explorer/core/log"
+	"net/http"
+	"time"
+)
+
+// requestTimeout is the default timeout of each request to rpc servers.
+const requestTimeout = 20 * time.Second
+
+// maxRounds bounds how many times all servers are tried by calls whose ctx can never be done.
+const maxRounds = 3
+
+// DefaultClient is used by functions of this package.
+var DefaultClient = NewClient(requestTimeout)
+
+// Client sends JSON-RPC requests to rpc servers.
+// Connections to servers are kept alive and reused, it is safe for concurrent use.
+type Client struct {
+	http    *http.Client
+	timeout time.Duration
+}
+
+// NewClient returns a client whose requests time out after timeout.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				// Every block worker may keep a connection to the same server.
+				MaxIdleConnsPerHost: 256,
+				IdleConnTimeout:     time.Minute,
+			},
+		},
+		timeout: timeout,
+	}
+}
+
+// WithTimeout returns a client sharing connections with c,
+// whose requests time out after timeout.
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	return &Client{
+		http:    c.http,
+		timeout: timeout,
+	}
+}
+
+// Call sends the request to one of rpc servers whose height higher than minHeight,
+// decodes its result into result and returns url of the server which answered.
+// Servers which can not be reached are replaced by others until ctx is done,
+// or maxRounds times if ctx can never be done.
+// Methods of plugins, e.g. getapplicationlog, are only sent to servers supporting them.
+// It returns ErrNoServer if no server is high enough, and *Error if the server answered an error.
+func (c *Client) Call(ctx context.Context, minHeight int, method string, params []interface{}, result interface{}) (string, error) {
+	return c.call(ctx, minHeight, nil, method, params, result)
+}
+
+func (c *Client) call(ctx context.Context, minHeight int, excluded []string, method string, params []interface{}, result interface{}) (string, error) {
+	body, err := json.Marshal(newRequest(method, params, 1))
+	if err != nil {
+		return "", err
+	}
+
+	url, respBody, err := c.post(ctx, minHeight, methodCapability(method), body, excluded)
+	if err != nil {
+		return url, err
+	}
+
+	return url, decodeResult(url, respBody, result)
+}
+
+// CallServer sends the request to the given rpc server only and decodes its result into result.
+func (c *Client) CallServer(ctx context.Context, url string, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(newRequest(method, params, 1))
+	if err != nil {
+		return err
+	}
+
+	respBody, err := c.send(ctx, url, body)
+	if err != nil {
+		return err
+	}
+
+	return decodeResult(url, respBody, result)
+}
+
+// post sends body to one of rpc servers whose height higher than minHeight and supporting caps
+// until one of them answers, and returns its url with the response body.
+// Servers in excluded list will not be selected.
+func (c *Client) post(ctx context.Context, minHeight int, caps capability, body []byte, excluded []string) (string, []byte, error) {
+	// Servers failed during this call are skipped until all others failed too.
+	tried := excluded
+	rounds := 1
+	var lastErr error
+
+	for {
+		url, ok := getServer(minHeight, caps, tried...)
+		if !ok && len(tried) == len(excluded) {
+			return "", nil, ErrNoServer
+		}
+		if !ok {
+			if ctx.Done() == nil && rounds >= maxRounds {
+				return "", nil, lastErr
+			}
+			rounds++
+			tried = excluded
+			if !sleep(ctx, time.Second) {
+				return "", nil, ctx.Err()
+			}
+			continue
+		}
+
+		respBody, err := c.send(ctx, url, body)
+		if err == nil {
+			return url, respBody, nil
+		}
+		if ctx.Err() != nil {
+			return "", nil, err
+		}
+
+		log.Error.Println(err)
+		lastErr = err
+		tried = append(tried[:len(tried):len(tried)], url)
+		if !sleep(ctx, 50*time.Millisecond) {
+			return "", nil, ctx.Err()
+		}
+	}
+}
+
+// send posts body to the given rpc server once and returns the response body.
+// The request times out after the timeout of client or when ctx is done, whichever comes first,
+// and its connection is closed then.
+func (c *Client) send(ctx context.Context, url string, body []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "neo_explorer")
+
+	start := time.Now()
+	var respBody []byte
+	resp, err := c.http.Do(req)
+	if err == nil {
+		respBody, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// The request is abandoned, e.g. the slower one of hedged requests.
+		abandonRequest(url, time.Since(start))
+		return nil, ctx.Err()
+	}
+
+	observeRequest(url, start, err)
+	if err != nil {
+		return nil, fmt.Errorf("request to rpc server %s failed: %v", url, err)
+	}
+
+	return respBody, nil
+}
+
+// sleep pauses for d, it returns false at once if ctx is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestServer starts a rpc server answering requests with handle.
+func newTestServer(t *testing.T, handle func(req request) interface{}) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(handle(req))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func TestClientCall(t *testing.T) {
+	var params []interface{}
+	s := newTestServer(t, func(req request) interface{} {
+		params = req.Params
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{"txid": "0xabc"}}
+	})
+	setServers(t, map[string]*serverState{s.URL: {height: 100, latency: initialLatency}})
+
+	var result *RawApplicationLogResult
+	url, err := NewClient(time.Second).Call(context.Background(), 10, "test",
+		[]interface{}{"0xabc", 1, true, []string{"a"}, map[string]int{"n": 2}}, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url != s.URL {
+		t.Errorf("url = %s, want %s", url, s.URL)
+	}
+	if result == nil || result.TxID != "0xabc" {
+		t.Errorf("result = %+v, want txid 0xabc", result)
+	}
+
+	want := []interface{}{"0xabc", float64(1), true, []interface{}{"a"}, map[string]interface{}{"n": float64(2)}}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %#v, want %#v", params, want)
+	}
+}
+
+func TestClientCallErrors(t *testing.T) {
+	s := newTestServer(t, func(req request) interface{} {
+		if req.Method == "broken" {
+			return "not a response"
+		}
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -100, "message": "Unknown block"}}
+	})
+	setServers(t, map[string]*serverState{s.URL: {height: 100, latency: initialLatency}})
+
+	c := NewClient(time.Second)
+	var b *RawBlock
+
+	_, err := c.Call(context.Background(), 10, "getblock", []interface{}{10, 1}, &b)
+	if e, ok := err.(*Error); !ok || e.Code != -100 {
+		t.Errorf("err = %v, want rpc error -100", err)
+	}
+
+	if _, err := c.Call(context.Background(), 10, "broken", nil, &b); err == nil {
+		t.Error("invalid response decoded without error")
+	}
+
+	if _, err := c.Call(context.Background(), 200, "getblock", []interface{}{200, 1}, &b); err != ErrNoServer {
+		t.Errorf("err = %v, want ErrNoServer", err)
+	}
+}
+
+func TestClientCallRetriesOtherServers(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	s := newTestServer(t, func(req request) interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": 42}
+	})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	setServers(t, map[string]*serverState{
+		s.URL:    {height: 100, latency: initialLatency},
+		down.URL: {height: 100, latency: 0.001},
+	})
+
+	for i := 0; i < 10; i++ {
+		var count int
+		url, err := NewClient(time.Second).Call(context.Background(), 10, "getblockcount", nil, &count)
+		if err != nil || url != s.URL || count != 42 {
+			t.Fatalf("Call = %s, %d, %v, want %s, 42", url, count, err, s.URL)
+		}
+	}
+}
+
+func TestClientCallCanceled(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	setServers(t, map[string]*serverState{down.URL: {height: 100, latency: initialLatency}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var count int
+	if _, err := NewClient(time.Second).Call(ctx, 10, "getblockcount", nil, &count); err == nil {
+		t.Error("Call succeeded without any available server")
+	}
+}
+
+func TestClientCallGivesUp(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	setServers(t, map[string]*serverState{down.URL: {height: 100, latency: initialLatency}})
+
+	// Calls which can not be cancelled give up after maxRounds.
+	done := make(chan error, 1)
+	go func() {
+		var count int
+		_, err := NewClient(time.Second).Call(context.Background(), 10, "getblockcount", nil, &count)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Call succeeded without any available server")
+		}
+	case <-time.After(time.Duration(maxRounds+2) * time.Second):
+		t.Errorf("Call did not give up after %d rounds", maxRounds)
+	}
+}
+
+func TestBatchCallFallback(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	// The server rejects batch calls.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": nil, "error": map[string]interface{}{"code": -32600, "message": "Invalid Request"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": req.Params[0]})
+	}))
+	defer s.Close()
+	defer noBatchServers.Delete(s.URL)
+	setServers(t, map[string]*serverState{s.URL: {height: 100, latency: initialLatency}})
+
+	values := make([]int, 3)
+	results := []interface{}{&values[0], &values[1], &values[2]}
+	paramsList := [][]interface{}{{1}, {2}, {3}}
+
+	urls, errs := NewClient(time.Second).BatchCall(context.Background(), 10, "echo", paramsList, results)
+	for i := range values {
+		if errs[i] != nil || urls[i] != s.URL || values[i] != i+1 {
+			t.Errorf("result %d = %s, %d, %v, want %s, %d", i, urls[i], values[i], errs[i], s.URL, i+1)
+		}
+	}
+
+	if _, ok := noBatchServers.Load(s.URL); !ok {
+		t.Error("server rejecting batch calls not recorded")
+	}
+}
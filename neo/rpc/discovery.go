@@ -0,0 +1,298 @@
+package rpc
+
+import (
+	"context"
+	"math/rand"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// discoveryInterval is how often peers of healthy servers are looked for new rpc servers.
+var discoveryInterval = time.Minute
+
+const (
+	// discoverySources is the number of healthy servers asked for their peers each time.
+	discoverySources = 5
+	// discoveryWorkers limits concurrent probes of peer addresses.
+	discoveryWorkers = 16
+	// maxDiscoveredFailures is how many refreshes in a row a discovered server may fail
+	// before it is dropped.
+	maxDiscoveredFailures = 20
+)
+
+// discovered tracks rpc servers found from peers, the configured ones are not included.
+// It is guarded by sLock.
+var discovered = make(map[string]*discoveredServer)
+
+type discoveredServer struct {
+	// source is the url of the server which advertised it.
+	source   string
+	failures int
+}
+
+// reservedNets are never used by discovered servers unless allowed explicitly.
+var reservedNets, _ = config.ParseNets([]string{
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+})
+
+type peer struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// peersResult is the result of 'getpeers' rpc call.
+type peersResult struct {
+	Unconnected []peer `json:"unconnected"`
+	Connected   []peer `json:"connected"`
+}
+
+// discoverPeriodically looks for new rpc servers from peers of healthy servers until ctx is done
+// if discovery is enabled.
+func discoverPeriodically(ctx context.Context) {
+	for {
+		if d := config.GetRPCDiscovery(); d.Enabled {
+			discover(ctx, d)
+		}
+		if !sleep(ctx, discoveryInterval) {
+			return
+		}
+	}
+}
+
+// discover asks some healthy servers for their peers, probes rpc ports of the peers
+// and adds responsive ones to the server pool. It returns how many servers are added.
+func discover(ctx context.Context, d config.Discovery) int {
+	// Validated when config loaded.
+	allow, _ := config.ParseNets(d.Allow)
+	deny, _ := config.ParseNets(d.Deny)
+
+	sources, known, room := discoveryState(d.MaxServers)
+	if room <= 0 || len(sources) == 0 {
+		return 0
+	}
+
+	candidates := make(map[string]string)
+	for _, source := range sources {
+		for _, url := range peerURLs(ctx, source, d.Ports, allow, deny) {
+			if !known[url] {
+				candidates[url] = source
+			}
+		}
+	}
+
+	added := 0
+	for url, height := range probeCandidates(ctx, candidates) {
+		if addDiscovered(url, candidates[url], height, d.MaxServers) {
+			log.Printf("Discovered rpc server %s at height %d from peers of %s\n", url, height, candidates[url])
+			added++
+		}
+	}
+
+	return added
+}
+
+// discoveryState returns healthy servers in random order, at most discoverySources of them,
+// urls of all known servers and how many servers can still be discovered.
+func discoveryState(maxServers int) ([]string, map[string]bool, int) {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	now := time.Now()
+	healthy := []string{}
+	known := make(map[string]bool)
+
+	for url, s := range servers {
+		known[url] = true
+		if s.height >= 0 && s.state(now) == circuitClosed {
+			healthy = append(healthy, url)
+		}
+	}
+	for _, url := range config.GetRPCs() {
+		known[url] = true
+	}
+	for url := range removedServers {
+		known[url] = true
+	}
+
+	rand.Shuffle(len(healthy), func(i, j int) {
+		healthy[i], healthy[j] = healthy[j], healthy[i]
+	})
+	if len(healthy) > discoverySources {
+		healthy = healthy[:discoverySources]
+	}
+
+	return healthy, known, maxServers - len(discovered)
+}
+
+// peerURLs returns rpc urls of allowed peers of the server.
+func peerURLs(ctx context.Context, source string, ports []int, allow, deny []*net.IPNet) []string {
+	result := peersResult{}
+	err := DefaultClient.WithTimeout(probeTimeout).CallServer(ctx, source, "getpeers", nil, &result)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Error.Printf("Failed to get peers of rpc server %s: %v\n", source, err)
+		return nil
+	}
+
+	urls := []string{}
+	for _, p := range append(result.Connected, result.Unconnected...) {
+		ip := net.ParseIP(p.Address)
+		if !allowPeer(ip, allow, deny) {
+			continue
+		}
+
+		for _, port := range ports {
+			urls = append(urls, peerURL(ip, port))
+		}
+	}
+
+	return urls
+}
+
+// allowPeer returns true if the peer at ip may be added as rpc server.
+// Only public addresses are allowed if the allow list is empty.
+func allowPeer(ip net.IP, allow, deny []*net.IPNet) bool {
+	if ip == nil || containsIP(deny, ip) {
+		return false
+	}
+
+	if len(allow) > 0 {
+		return containsIP(allow, ip)
+	}
+
+	return ip.IsGlobalUnicast() && !containsIP(reservedNets, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peerURL returns the rpc url of ip on the given port.
+func peerURL(ip net.IP, port int) string {
+	scheme := "http"
+	switch port {
+	case 443, 10331, 20331:
+		scheme = "https"
+	}
+
+	// Peers of IPv4 are usually reported as IPv4-mapped IPv6 addresses.
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return scheme + "://" + net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// probeCandidates requests heights of the candidate urls concurrently until ctx is done,
+// and returns heights of those responded.
+func probeCandidates(ctx context.Context, candidates map[string]string) map[string]int {
+	var mu sync.Mutex
+	heights := make(map[string]int)
+
+	urls := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < discoveryWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			client := DefaultClient.WithTimeout(probeTimeout)
+			for url := range urls {
+				var count int
+				if err := client.CallServer(ctx, url, "getblockcount", nil, &count); err != nil || count < 1 {
+					continue
+				}
+
+				mu.Lock()
+				heights[url] = count - 1
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for url := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case urls <- url:
+		case <-ctx.Done():
+		}
+	}
+	close(urls)
+	wg.Wait()
+
+	return heights
+}
+
+// addDiscovered adds the server to the pool if there is room for it.
+func addDiscovered(url string, source string, height int, maxServers int) bool {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	if len(discovered) >= maxServers {
+		return false
+	}
+	if _, ok := servers[url]; ok {
+		return false
+	}
+
+	s := newServerState()
+	s.height = height
+	if servers == nil {
+		servers = make(map[string]*serverState)
+	}
+	servers[url] = s
+	discovered[url] = &discoveredServer{source: source}
+	serverHeight.With(url).Set(float64(height))
+
+	return true
+}
+
+// rpcURLs returns urls of configured, added and discovered rpc servers except removed ones.
+func rpcURLs() []string {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	urls := []string{}
+	for _, url := range config.GetRPCs() {
+		if !removedServers[url] && !addedServers[url] {
+			urls = append(urls, url)
+		}
+	}
+	for url := range addedServers {
+		urls = append(urls, url)
+	}
+	for url := range discovered {
+		urls = append(urls, url)
+	}
+
+	return urls
+}
+
+// isConfigured returns true if the url is a configured rpc server.
+func isConfigured(url string) bool {
+	for _, rpc := range config.GetRPCs() {
+		if rpc == url {
+			return true
+		}
+	}
+
+	return false
+}
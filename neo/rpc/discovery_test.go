@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestAllowPeer(t *testing.T) {
+	allow, _ := config.ParseNets([]string{"127.0.0.1", "203.0.113.0/24"})
+	deny, _ := config.ParseNets([]string{"203.0.113.9"})
+
+	tests := []struct {
+		ip          string
+		allow, deny bool
+		want        bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "::ffff:8.8.8.8", want: true},
+		{ip: "192.168.1.2", want: false},
+		{ip: "127.0.0.1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "127.0.0.1", allow: true, want: true},
+		{ip: "203.0.113.8", allow: true, deny: true, want: true},
+		{ip: "203.0.113.9", allow: true, deny: true, want: false},
+		{ip: "8.8.8.8", allow: true, want: false},
+	}
+
+	for _, tt := range tests {
+		var a, d []*net.IPNet
+		if tt.allow {
+			a = allow
+		}
+		if tt.deny {
+			d = deny
+		}
+
+		if got := allowPeer(net.ParseIP(tt.ip), a, d); got != tt.want {
+			t.Errorf("allowPeer(%s, allow=%v, deny=%v) = %v, want %v", tt.ip, tt.allow, tt.deny, got, tt.want)
+		}
+	}
+}
+
+func TestPeerURL(t *testing.T) {
+	tests := []struct {
+		ip   string
+		port int
+		want string
+	}{
+		{"::ffff:8.8.8.8", 10332, "http://8.8.8.8:10332"},
+		{"8.8.8.8", 10331, "https://8.8.8.8:10331"},
+		{"2001:db8::1", 20332, "http://[2001:db8::1]:20332"},
+	}
+
+	for _, tt := range tests {
+		if got := peerURL(net.ParseIP(tt.ip), tt.port); got != tt.want {
+			t.Errorf("peerURL(%s, %d) = %s, want %s", tt.ip, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	peerServer := newTestServer(t, func(req request) interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": 1001}
+	})
+	u, _ := url.Parse(peerServer.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	source := newTestServer(t, func(req request) interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{
+			"unconnected": []interface{}{map[string]interface{}{"address": "::ffff:127.0.0.1", "port": 10333}},
+			"connected":   []interface{}{map[string]interface{}{"address": "192.168.1.2", "port": 10333}},
+		}}
+	})
+
+	setServers(t, map[string]*serverState{source.URL: {height: 1000, latency: initialLatency}})
+	t.Cleanup(func() { discovered = make(map[string]*discoveredServer) })
+
+	d := config.Discovery{
+		Enabled:    true,
+		MaxServers: 1,
+		Ports:      []int{port},
+		Allow:      []string{"127.0.0.1"},
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n := discover(cancelled, d); n != 0 {
+		t.Fatalf("discovered %d servers after ctx done, want 0", n)
+	}
+
+	if n := discover(context.Background(), d); n != 1 {
+		t.Fatalf("discovered %d servers, want 1", n)
+	}
+
+	statuses := ServerStatuses()
+	if len(statuses) != 2 {
+		t.Fatalf("got %d servers, want 2", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.URL == peerServer.URL && (s.Height != 1000 || s.DiscoveredFrom != source.URL) {
+			t.Errorf("discovered server = %+v, want height 1000 from %s", s, source.URL)
+		}
+	}
+
+	// Known servers are not added again, and the limit is reached.
+	if n := discover(context.Background(), d); n != 0 {
+		t.Errorf("discovered %d servers again, want 0", n)
+	}
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"neo_explorer/core/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// hedgePercentile of recent latencies of the method after which
+	// the same request is sent to a second server.
+	hedgePercentile = 0.9
+	// Bounds of the delay before sending the hedged request.
+	minHedgeDelay = 50 * time.Millisecond
+	maxHedgeDelay = 5 * time.Second
+	// defaultHedgeDelay is used until enough latencies are observed.
+	defaultHedgeDelay = time.Second
+)
+
+const (
+	// latencyWindow is how many recent latencies of each method are kept.
+	latencyWindow = 256
+	// minLatencySamples are required to compute the percentile.
+	minLatencySamples = 20
+)
+
+// latencies keeps recent latencies of successful hedged calls by method.
+var latencies = struct {
+	sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}{
+	samples: make(map[string][]time.Duration),
+	next:    make(map[string]int),
+}
+
+func observeLatency(method string, d time.Duration) {
+	latencies.Lock()
+	defer latencies.Unlock()
+
+	samples := latencies.samples[method]
+	if len(samples) < latencyWindow {
+		latencies.samples[method] = append(samples, d)
+		return
+	}
+
+	samples[latencies.next[method]] = d
+	latencies.next[method] = (latencies.next[method] + 1) % latencyWindow
+}
+
+// hedgeDelay returns how long to wait for the first server before sending the request to another.
+func hedgeDelay(method string) time.Duration {
+	latencies.Lock()
+	samples := append([]time.Duration(nil), latencies.samples[method]...)
+	latencies.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return defaultHedgeDelay
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	d := samples[int(float64(len(samples)-1)*hedgePercentile)]
+
+	switch {
+	case d < minHedgeDelay:
+		return minHedgeDelay
+	case d > maxHedgeDelay:
+		return maxHedgeDelay
+	}
+
+	return d
+}
+
+// hedgedCall is like call, but if the server has not answered within hedgeDelay,
+// the same request is sent to a second server and the first successful response is taken,
+// the other request is cancelled. newResult returns the target of each request.
+// If both fail, the request is sent to other servers one by one.
+func (c *Client) hedgedCall(ctx context.Context, minHeight int, excluded []string, method string, params []interface{}, newResult func() interface{}) (string, interface{}, error) {
+	url, result, tried, err := c.hedge(ctx, minHeight, excluded, methodCapability(method), method,
+		func(ctx context.Context, url string) (interface{}, error) {
+			result := newResult()
+			return result, c.CallServer(ctx, url, method, params, result)
+		})
+	if err == nil || err == ErrNoServer || ctx.Err() != nil {
+		return url, result, err
+	}
+
+	result = newResult()
+	url, err = c.call(ctx, minHeight, tried, method, params, result)
+	return url, result, err
+}
+
+// hedge sends a request with send to one of rpc servers whose height higher than minHeight and supporting caps,
+// and to a second server too if the first one has not answered within hedgeDelay of key.
+// It returns the first successful result and cancels the other request.
+// If both fail, it returns the error of the last one with servers tried.
+func (c *Client) hedge(ctx context.Context, minHeight int, excluded []string, caps capability, key string,
+	send func(ctx context.Context, url string) (interface{}, error)) (string, interface{}, []string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// Cancels the slower request.
+	defer cancel()
+
+	type attempt struct {
+		url    string
+		result interface{}
+		err    error
+		hedged bool
+	}
+
+	results := make(chan attempt, 2)
+	start := func(url string, hedged bool) {
+		go func() {
+			begin := time.Now()
+			result, err := send(ctx, url)
+			if err == nil {
+				observeLatency(key, time.Since(begin))
+			}
+			results <- attempt{url, result, err, hedged}
+		}()
+	}
+
+	url, ok := getServer(minHeight, caps, excluded...)
+	if !ok {
+		return "", nil, nil, ErrNoServer
+	}
+
+	tried := append(excluded[:len(excluded):len(excluded)], url)
+	start(url, false)
+	pending := 1
+
+	timer := time.NewTimer(hedgeDelay(key))
+	defer timer.Stop()
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-ctx.Done():
+			return "", nil, tried, ctx.Err()
+		case <-timer.C:
+			if url, ok := getServer(minHeight, caps, tried...); ok {
+				tried = append(tried, url)
+				start(url, true)
+				pending++
+			}
+		case a := <-results:
+			pending--
+			if a.err == nil {
+				if len(tried) > len(excluded)+1 {
+					hedgedRequests.With(hedgeWinner(a.hedged)).Inc()
+				}
+				return a.url, a.result, tried, nil
+			}
+
+			log.Error.Println(a.err)
+			err = a.err
+		}
+	}
+
+	return "", nil, tried, err
+}
+
+func hedgeWinner(hedged bool) string {
+	if hedged {
+		return "hedged"
+	}
+
+	return "first"
+}
@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHedgeDelay(t *testing.T) {
+	const method = "test_hedge_delay"
+	if d := hedgeDelay(method); d != defaultHedgeDelay {
+		t.Errorf("hedgeDelay without samples = %s, want %s", d, defaultHedgeDelay)
+	}
+
+	for i := 1; i <= 100; i++ {
+		observeLatency(method, time.Duration(i)*10*time.Millisecond)
+	}
+	if d := hedgeDelay(method); d != 900*time.Millisecond {
+		t.Errorf("hedgeDelay = %s, want 900ms", d)
+	}
+
+	// Old samples are replaced.
+	for i := 0; i < latencyWindow; i++ {
+		observeLatency(method, time.Millisecond)
+	}
+	if d := hedgeDelay(method); d != minHedgeDelay {
+		t.Errorf("hedgeDelay = %s, want %s", d, minHedgeDelay)
+	}
+}
+
+func TestHedgedCall(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	defer func(d time.Duration) { defaultHedgeDelay = d }(defaultHedgeDelay)
+	defaultHedgeDelay = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fast := newTestServer(t, func(req request) interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{"index": 7}}
+	})
+
+	slowState := &serverState{height: 100, latency: 0.001}
+	setServers(t, map[string]*serverState{
+		slow.URL: slowState,
+		fast.URL: {height: 100, latency: 10},
+	})
+
+	c := NewClient(10 * time.Second)
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		url, result, err := c.hedgedCall(context.Background(), 7, nil, "test_hedged_call", []interface{}{7, 1},
+			func() interface{} { return new(*RawBlock) })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b := *result.(**RawBlock)
+		if url != fast.URL || b == nil || b.Index != 7 {
+			t.Fatalf("hedgedCall = %s, %+v, want block 7 from %s", url, b, fast.URL)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("hedgedCall took %s", elapsed)
+		}
+	}
+
+	sLock.Lock()
+	latency := slowState.latency
+	sLock.Unlock()
+	if latency <= 0.001 {
+		t.Errorf("latency of the slow server = %f, not increased by cancelled requests", latency)
+	}
+}
+
+func TestHedgedCallClosesLoser(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	defer func(d time.Duration) { defaultHedgeDelay = d }(defaultHedgeDelay)
+	defaultHedgeDelay = 50 * time.Millisecond
+
+	closed := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The context is done when the connection is closed once the body is read.
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		closed <- struct{}{}
+	}))
+	defer slow.Close()
+
+	fast := newTestServer(t, func(req request) interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{"index": 7}}
+	})
+
+	setServers(t, map[string]*serverState{
+		slow.URL: {height: 100, latency: 0.001},
+		fast.URL: {height: 100, latency: 10},
+	})
+
+	url, _, err := NewClient(time.Minute).hedgedCall(context.Background(), 7, nil, "test_hedged_call_closes_loser", []interface{}{7, 1},
+		func() interface{} { return new(*RawBlock) })
+	if err != nil || url != fast.URL {
+		t.Fatalf("hedgedCall = %s, %v, want the answer of %s", url, err, fast.URL)
+	}
+
+	// The connection to the slow server is closed at once instead of after the client timeout.
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("request to the slow server not cancelled")
+	}
+}
+
+func TestHedgedBatchCall(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	defer func(d time.Duration) { defaultHedgeDelay = d }(defaultHedgeDelay)
+	defaultHedgeDelay = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests := []request{}
+		if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+			t.Errorf("invalid batch: %v", err)
+			return
+		}
+
+		responses := []interface{}{}
+		for _, req := range requests {
+			responses = append(responses, map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": map[string]interface{}{"index": req.Params[0]}})
+		}
+		json.NewEncoder(w).Encode(responses)
+	}))
+	defer fast.Close()
+
+	setServers(t, map[string]*serverState{
+		slow.URL: {height: 100, latency: 0.001},
+		fast.URL: {height: 100, latency: 10},
+	})
+
+	start := time.Now()
+	paramsList := [][]interface{}{{7, 1}, {8, 1}}
+	urls, results, errs := NewClient(10*time.Second).hedgedBatchCall(context.Background(), 8, "test_hedged_batch_call", paramsList,
+		func() []interface{} { return []interface{}{new(*RawBlock), new(*RawBlock)} })
+
+	for i, result := range results {
+		b := *result.(**RawBlock)
+		if errs[i] != nil || urls[i] != fast.URL || b == nil || b.Index != uint(7+i) {
+			t.Errorf("result %d = %s, %+v, %v, want block %d from %s", i, urls[i], b, errs[i], 7+i, fast.URL)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hedgedBatchCall took %s", elapsed)
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": 1})
+	}))
+	defer s.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := NewClient(10*time.Second).send(ctx, s.URL, []byte("{}")); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
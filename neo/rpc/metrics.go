@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"neo_explorer/core/metrics"
+	"time"
+)
+
+var (
+	serverHeight = metrics.NewGaugeVec("neo_explorer_rpc_server_height",
+		"Block height of each rpc server, -1 if unavailable.", "server")
+	requestErrors = metrics.NewCounterVec("neo_explorer_rpc_errors_total",
+		"Failed requests to each rpc server.", "server")
+	requestDuration = metrics.NewHistogramVec("neo_explorer_rpc_request_duration_seconds",
+		"Duration of requests to each rpc server.", metrics.DefBuckets, "server")
+	hedgedRequests = metrics.NewCounterVec("neo_explorer_rpc_hedged_requests_total",
+		"Hedged requests by which of the two requests answered first.", "winner")
+	serverCircuitOpen = metrics.NewGaugeVec("neo_explorer_rpc_server_circuit_open",
+		"1 if the circuit of the rpc server is open or half-open, 0 if closed.", "server")
+)
+
+func init() {
+	metrics.NewGaugeFunc("neo_explorer_rpc_best_height",
+		"Highest block height of all rpc servers.", func() float64 {
+			return float64(BestHeight.Get())
+		})
+	metrics.NewGaugeFunc("neo_explorer_rpc_discovered_servers",
+		"Number of rpc servers discovered from peers.", func() float64 {
+			sLock.Lock()
+			defer sLock.Unlock()
+
+			return float64(len(discovered))
+		})
+}
+
+// observeRequest records duration and result of a request to the rpc server,
+// both in metrics and health of the server.
+func observeRequest(url string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	if !recordRequest(url, elapsed, err) {
+		// Not a server of the pool, e.g. peers probed by discovery.
+		return
+	}
+
+	requestDuration.With(url).Observe(elapsed.Seconds())
+	if err != nil {
+		requestErrors.With(url).Inc()
+	}
+}
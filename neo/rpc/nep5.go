@@ -1,19 +1,14 @@
 package rpc
 
 import (
+	"context"
 	"math/big"
 	"math/rand"
 	"neo_explorer/core/log"
 	"time"
 )
 
-// ApplicationLogResponse is the struct of returning data from 'getapplicationlog' rpc call.
-type ApplicationLogResponse struct {
-	jsonRPCResponse
-	Result *RawApplicationLogResult `json:"result"`
-}
-
-// RawApplicationLogResult is the inner struct of struct 'ApplicationLogResponse'.
+// RawApplicationLogResult is the result of 'getapplicationlog' rpc call.
 type RawApplicationLogResult struct {
 	TxID       string                       `json:"txid"`
 	Executions []RawApplicationLogExecution `json:"executions"`
@@ -35,35 +30,36 @@ type RawNotifications struct {
 	State    *RawState `json:"state"`
 }
 
-// GetApplicationLog returns application log of nep5 transaction.
-func GetApplicationLog(blockIndex int, txID string) *RawApplicationLogResult {
+// GetApplicationLog returns application log of nep5 transaction, retrying until succeeded.
+// It returns nil if ctx is done.
+func GetApplicationLog(ctx context.Context, blockIndex int, txID string) *RawApplicationLogResult {
 	params := []interface{}{txID}
-	const method = "getapplicationlog"
-	args := getRPCRequestBody(method, params)
-
-	respData := ApplicationLogResponse{}
-	rpcCall(blockIndex, args, &respData)
-
-	if respData.Result != nil {
-		return respData.Result
-	}
-
 	retryTime := uint(0)
 	delay := 0
 
 	for {
+		var result *RawApplicationLogResult
+		_, err := DefaultClient.Call(ctx, blockIndex, "getapplicationlog", params, &result)
+		if err == nil && result != nil {
+			return result
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
 		retryTime++
 		if delay < 10*1000 {
 			delay = rand.Intn(1<<retryTime) + 1000
 		}
 
-		log.Printf("Can not get application log of %s\n", txID)
+		if err == ErrNoServer {
+			log.Printf("No rpc server with ApplicationLogs plugin reached height %d\n", blockIndex)
+		}
+		log.Printf("Can not get application log of %s: %v\n", txID, err)
 		log.Printf("Delay for %d msecs and try to connect again. RetryTime=%d\n", delay, retryTime)
 
-		time.Sleep(time.Duration(delay) * time.Millisecond)
-		rpcCall(blockIndex, args, &respData)
-		if respData.Result != nil {
-			return respData.Result
+		if !sleep(ctx, time.Duration(delay)*time.Millisecond) {
+			return nil
 		}
 	}
 }
@@ -0,0 +1,361 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"neo_explorer/core/log"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Circuit states of rpc servers.
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var circuitNames = []string{"closed", "open", "half-open"}
+
+var (
+	// circuitFailures is how many consecutive failures open the circuit of a server,
+	// no request is sent to the server while its circuit is open.
+	circuitFailures = 5
+	// circuitCooldown is how long the circuit stays open,
+	// after that a single probe request decides whether to close it.
+	circuitCooldown = 30 * time.Second
+)
+
+const (
+	// ewmaAlpha is the weight of the latest request in moving averages.
+	ewmaAlpha = 0.2
+	// initialLatency in seconds is assumed for servers not requested yet.
+	initialLatency = 0.5
+	// minWeight keeps unhealthy servers selectable with a small chance.
+	minWeight = 0.001
+)
+
+// serverState tracks height and health of a rpc server.
+type serverState struct {
+	height int
+	// Moving averages of latency in seconds and failure ratio.
+	latency   float64
+	errorRate float64
+
+	requests uint64
+	errors   uint64
+	timeouts uint64
+
+	// failures counts consecutive failures.
+	failures int
+	circuit  int
+	openedAt time.Time
+	// probing is true while the probe request of a half-open circuit is in flight.
+	probing bool
+
+	// disabled servers are not selected, set by admin.
+	disabled bool
+
+	// Capabilities and version reported by the latest successful probe.
+	probed   bool
+	probedAt time.Time
+	caps     capability
+	version  string
+}
+
+func newServerState() *serverState {
+	return &serverState{
+		height:  -1,
+		latency: initialLatency,
+	}
+}
+
+// state returns the circuit state, an open circuit becomes half-open after the cooldown.
+func (s *serverState) state(now time.Time) int {
+	if s.circuit == circuitOpen && now.Sub(s.openedAt) >= circuitCooldown {
+		s.circuit = circuitHalfOpen
+		s.probing = false
+	}
+
+	return s.circuit
+}
+
+// record updates health with the result of a request,
+// and returns true if the circuit state changed.
+func (s *serverState) record(now time.Time, elapsed time.Duration, err error) bool {
+	before := s.state(now)
+
+	s.requests++
+	failed := 0.0
+	if err != nil {
+		s.errors++
+		failed = 1
+		if isTimeout(err) {
+			s.timeouts++
+		}
+	} else {
+		s.latency += ewmaAlpha * (elapsed.Seconds() - s.latency)
+	}
+	s.errorRate += ewmaAlpha * (failed - s.errorRate)
+
+	switch before {
+	case circuitOpen:
+		// Requests sent before the circuit opened.
+		return false
+	case circuitHalfOpen:
+		s.probing = false
+		if err != nil {
+			s.open(now)
+		} else {
+			s.circuit = circuitClosed
+			s.failures = 0
+		}
+		return true
+	}
+
+	if err == nil {
+		s.failures = 0
+		return false
+	}
+
+	s.failures++
+	if s.failures < circuitFailures {
+		return false
+	}
+
+	s.open(now)
+	return true
+}
+
+func (s *serverState) open(now time.Time) {
+	s.circuit = circuitOpen
+	s.openedAt = now
+	s.failures = 0
+}
+
+// weight is proportional to the chance the server is selected,
+// fast and healthy servers are preferred.
+func (s *serverState) weight(url string) float64 {
+	health := 1 - s.errorRate
+	w := health * health / (s.latency + 0.05)
+
+	// Prefer localhost rpc server.
+	if strings.Contains(url, "127.0.0.1") ||
+		strings.Contains(url, "localhost") {
+		w *= 2
+	}
+
+	if w < minWeight {
+		return minWeight
+	}
+
+	return w
+}
+
+// selectServer picks one of rpc servers whose height higher than minHeight and supporting caps by their weights,
+// servers with open circuits or in excluded list will not be selected.
+// The caller must hold sLock.
+func selectServer(minHeight int, caps capability, excluded []string, now time.Time) (string, bool) {
+	urls := []string{}
+	weights := []float64{}
+	total := 0.0
+
+	for url, s := range servers {
+		if s.disabled || s.height < minHeight || s.caps&caps != caps || isExcluded(url, excluded) {
+			continue
+		}
+
+		switch s.state(now) {
+		case circuitOpen:
+			continue
+		case circuitHalfOpen:
+			if s.probing {
+				continue
+			}
+		}
+
+		w := s.weight(url)
+		urls = append(urls, url)
+		weights = append(weights, w)
+		total += w
+	}
+
+	if len(urls) == 0 {
+		return "", false
+	}
+
+	url := urls[len(urls)-1]
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			url = urls[i]
+			break
+		}
+		r -= w
+	}
+
+	if s := servers[url]; s.circuit == circuitHalfOpen {
+		s.probing = true
+	}
+
+	return url, true
+}
+
+// recordRequest updates health of the rpc server with the result of a request.
+// It returns false if the url is neither in the pool nor configured, e.g. a peer being probed.
+func recordRequest(url string, elapsed time.Duration, err error) bool {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	s, ok := servers[url]
+	if !ok {
+		return isConfigured(url)
+	}
+
+	if !s.record(time.Now(), elapsed, err) {
+		return true
+	}
+
+	switch s.circuit {
+	case circuitOpen:
+		serverCircuitOpen.With(url).Set(1)
+		log.Printf("Rpc server %s failed repeatedly, circuit opened for %s: %v\n", url, circuitCooldown, err)
+	case circuitClosed:
+		serverCircuitOpen.With(url).Set(0)
+		log.Printf("Rpc server %s recovered, circuit closed\n", url)
+	}
+
+	return true
+}
+
+// abandonRequest records the elapsed time of a request cancelled before answered,
+// e.g. the slower one of hedged requests, as the lower bound of the server's latency.
+func abandonRequest(url string, elapsed time.Duration) {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	if s, ok := servers[url]; ok && elapsed.Seconds() > s.latency {
+		s.latency += ewmaAlpha * (elapsed.Seconds() - s.latency)
+	}
+}
+
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// ServerStatus is the height and health of a rpc server.
+type ServerStatus struct {
+	URL     string `json:"url"`
+	Height  int    `json:"height"`
+	Circuit string `json:"circuit"`
+	// Latency is the moving average in seconds.
+	Latency   float64 `json:"latency"`
+	ErrorRate float64 `json:"error_rate"`
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	Timeouts  uint64  `json:"timeouts"`
+
+	Version      string `json:"version"`
+	AppLog       bool   `json:"applog"`
+	InvokeScript bool   `json:"invokescript"`
+
+	Disabled bool `json:"disabled"`
+	// Added is true if the server is added by admin.
+	Added bool `json:"added"`
+	// DiscoveredFrom is the url of the server which advertised it.
+	DiscoveredFrom string `json:"discovered_from,omitempty"`
+}
+
+// ServerStatuses returns status of all rpc servers ordered by url.
+func ServerStatuses() []ServerStatus {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	now := time.Now()
+	statuses := make([]ServerStatus, 0, len(servers))
+	for url, s := range servers {
+		source := ""
+		if d, ok := discovered[url]; ok {
+			source = d.source
+		}
+
+		statuses = append(statuses, ServerStatus{
+			URL:       url,
+			Height:    s.height,
+			Circuit:   circuitNames[s.state(now)],
+			Latency:   s.latency,
+			ErrorRate: s.errorRate,
+			Requests:  s.requests,
+			Errors:    s.errors,
+			Timeouts:  s.timeouts,
+
+			Version:      s.version,
+			AppLog:       s.caps&capAppLog != 0,
+			InvokeScript: s.caps&capInvokeScript != 0,
+
+			Disabled:       s.disabled,
+			Added:          addedServers[url],
+			DiscoveredFrom: source,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].URL < statuses[j].URL
+	})
+
+	return statuses
+}
+
+// WriteServerStatus writes a table of rpc servers with their heights, health and capabilities to w.
+func WriteServerStatus(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tHEIGHT\tCIRCUIT\tLATENCY\tERROR RATE\tREQUESTS\tERRORS\tTIMEOUTS\tVERSION\tAPPLOG\tINVOKESCRIPT\tSOURCE")
+
+	for _, s := range ServerStatuses() {
+		height := fmt.Sprint(s.Height)
+		if s.Height < 0 {
+			height = "unavailable"
+		}
+
+		version := s.Version
+		if version == "" {
+			version = "-"
+		}
+
+		source := "config"
+		if s.Added {
+			source = "admin"
+		} else if s.DiscoveredFrom != "" {
+			source = "peer of " + s.DiscoveredFrom
+		}
+
+		circuit := s.Circuit
+		if s.Disabled {
+			circuit = "disabled"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.3fs\t%.1f%%\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			s.URL, height, circuit, s.Latency, s.ErrorRate*100, s.Requests, s.Errors, s.Timeouts,
+			version, yesNo(s.AppLog), yesNo(s.InvokeScript), source)
+	}
+
+	tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -0,0 +1,107 @@
+package rpc
+
+import (
+	"errors"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"testing"
+	"time"
+)
+
+func setServers(t *testing.T, states map[string]*serverState) {
+	sLock.Lock()
+	old := servers
+	servers = states
+	sLock.Unlock()
+
+	t.Cleanup(func() {
+		sLock.Lock()
+		servers = old
+		sLock.Unlock()
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	const url = "http://seed1"
+	s := newServerState()
+	s.height = 100
+	setServers(t, map[string]*serverState{url: s})
+
+	errFailed := errors.New("connection refused")
+	for i := 0; i < circuitFailures; i++ {
+		if _, ok := getServer(10, 0); !ok {
+			t.Fatalf("server not selected after %d failures", i)
+		}
+		recordRequest(url, time.Millisecond, errFailed)
+	}
+
+	if s.circuit != circuitOpen {
+		t.Fatalf("circuit = %s after %d failures, want open", circuitNames[s.circuit], circuitFailures)
+	}
+	if _, ok := getServer(10, 0); ok {
+		t.Error("server with open circuit selected")
+	}
+
+	// Results of requests sent before the circuit opened are ignored.
+	recordRequest(url, time.Millisecond, nil)
+	if s.circuit != circuitOpen {
+		t.Errorf("circuit = %s, want open until cooldown", circuitNames[s.circuit])
+	}
+
+	// Cooldown passed, a single probe request is allowed.
+	s.openedAt = time.Now().Add(-circuitCooldown)
+	if _, ok := getServer(10, 0); !ok {
+		t.Fatal("half-open server not selected for probing")
+	}
+	if _, ok := getServer(10, 0); ok {
+		t.Error("half-open server selected while probing")
+	}
+
+	recordRequest(url, time.Millisecond, errFailed)
+	if s.circuit != circuitOpen {
+		t.Fatalf("circuit = %s after failed probe, want open", circuitNames[s.circuit])
+	}
+
+	s.openedAt = time.Now().Add(-circuitCooldown)
+	getServer(10, 0)
+	recordRequest(url, time.Millisecond, nil)
+	if s.circuit != circuitClosed {
+		t.Errorf("circuit = %s after successful probe, want closed", circuitNames[s.circuit])
+	}
+}
+
+func TestGetServerPrefersHealthyServers(t *testing.T) {
+	fast := &serverState{height: 100, latency: 0.05}
+	slow := &serverState{height: 100, latency: 2}
+	failing := &serverState{height: 100, latency: 0.05, errorRate: 0.9}
+	behind := &serverState{height: 5, latency: 0.01}
+	setServers(t, map[string]*serverState{
+		"fast":    fast,
+		"slow":    slow,
+		"failing": failing,
+		"behind":  behind,
+	})
+
+	picked := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		url, ok := getServer(10, 0)
+		if !ok {
+			t.Fatal("no server selected")
+		}
+		picked[url]++
+	}
+
+	if picked["behind"] > 0 {
+		t.Errorf("server lower than minHeight selected %d times", picked["behind"])
+	}
+	if picked["fast"] <= picked["slow"] || picked["fast"] <= picked["failing"] {
+		t.Errorf("fast server not preferred: %v", picked)
+	}
+
+	if url, _ := getServer(10, 0, "fast", "slow"); url != "failing" {
+		t.Errorf("getServer with excluded = %s, want failing", url)
+	}
+}
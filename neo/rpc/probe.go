@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"context"
+	"neo_explorer/core/log"
+	"strings"
+	"time"
+)
+
+// capability is a set of optional rpc methods supported by a server.
+type capability uint8
+
+const (
+	// capAppLog means the server runs the ApplicationLogs plugin.
+	capAppLog capability = 1 << iota
+	// capInvokeScript means the server executes scripts with invokescript.
+	capInvokeScript
+)
+
+// methodCapability returns the capability a server must have to answer the method.
+func methodCapability(method string) capability {
+	switch method {
+	case "getapplicationlog":
+		return capAppLog
+	case "invokescript":
+		return capInvokeScript
+	}
+
+	return 0
+}
+
+func (c capability) String() string {
+	names := []string{}
+	if c&capAppLog != 0 {
+		names = append(names, "applog")
+	}
+	if c&capInvokeScript != 0 {
+		names = append(names, "invokescript")
+	}
+
+	if len(names) == 0 {
+		return "-"
+	}
+
+	return strings.Join(names, ",")
+}
+
+// appLogProbes are the first nep5 transfers of each network,
+// servers with the ApplicationLogs plugin return their logs.
+var appLogProbes = []string{
+	// mainnet, block 1444843.
+	"0xc920b2192e74eda4ca6140510813aa40fef1767d00c152aa6f8027c24bdf14f2",
+	// testnet, block 446369.
+	"0xd355c4cf3a58859cd72c28ce362d727ed7dc2d68ae049ca9356fc0a6c21a8f45",
+}
+
+// invokeScriptProbe pushes 1 onto the stack.
+const invokeScriptProbe = "51"
+
+// probeTimeout is the timeout of each probe request.
+const probeTimeout = 5 * time.Second
+
+// reprobeInterval is how often capabilities of a server are probed again,
+// servers are also probed as soon as they are added or back online.
+const reprobeInterval = 10 * time.Minute
+
+// allCaps are all optional methods probed.
+const allCaps = capAppLog | capInvokeScript
+
+// serverProbe is the result of probing a rpc server.
+type serverProbe struct {
+	version string
+	caps    capability
+	// known are the capabilities whose probes the server answered,
+	// others failed, e.g. timed out, and keep their previous value.
+	known capability
+}
+
+// probeServers probes capabilities of the given rpc servers concurrently.
+func probeServers(urls []string) map[string]serverProbe {
+	type result struct {
+		url   string
+		probe serverProbe
+	}
+
+	c := make(chan result, len(urls))
+	for _, url := range urls {
+		go func(url string) {
+			c <- result{url, probe(url)}
+		}(url)
+	}
+
+	probes := make(map[string]serverProbe, len(urls))
+	for range urls {
+		r := <-c
+		probes[r.url] = r.probe
+	}
+
+	return probes
+}
+
+// serversToProbe returns available servers of heights which are new, back online,
+// or probed at least reprobeInterval before now.
+func serversToProbe(heights map[string]int, now time.Time) []string {
+	sLock.Lock()
+	defer sLock.Unlock()
+
+	urls := []string{}
+	for url, height := range heights {
+		if height < 0 {
+			continue
+		}
+
+		s, ok := servers[url]
+		if !ok || !s.probed || s.height < 0 || now.Sub(s.probedAt) >= reprobeInterval {
+			urls = append(urls, url)
+		}
+	}
+
+	return urls
+}
+
+// probe checks version of the rpc server and which optional methods it supports.
+func probe(url string) serverProbe {
+	ctx := context.Background()
+	client := DefaultClient.WithTimeout(probeTimeout)
+	p := serverProbe{}
+
+	version := struct {
+		UserAgent string `json:"useragent"`
+	}{}
+	if err := client.CallServer(ctx, url, "getversion", nil, &version); err == nil {
+		p.version = version.UserAgent
+	}
+
+	var result *RawSmartContractCallResult
+	err := client.CallServer(ctx, url, "invokescript", []interface{}{invokeScriptProbe}, &result)
+	if err == nil && result != nil {
+		p.caps |= capInvokeScript
+	}
+	if answered(err) {
+		p.known |= capInvokeScript
+	}
+
+	for _, txID := range appLogProbes {
+		var appLog *RawApplicationLogResult
+		err := client.CallServer(ctx, url, "getapplicationlog", []interface{}{txID}, &appLog)
+		if err == nil && appLog != nil && len(appLog.Executions) > 0 {
+			p.caps |= capAppLog
+			p.known |= capAppLog
+			break
+		}
+		if !answered(err) {
+			break
+		}
+		// Every probe transaction is unknown to the server.
+		if txID == appLogProbes[len(appLogProbes)-1] {
+			p.known |= capAppLog
+		}
+	}
+
+	return p
+}
+
+// answered returns true if the server answered the probe, even with a rpc error.
+func answered(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	_, ok := err.(*Error)
+	return ok
+}
+
+// updateProbe records the probe result of the server. The caller must hold sLock.
+// Capabilities not known by the probe are kept, and the server is probed again on next refresh.
+func (s *serverState) updateProbe(url string, p serverProbe) {
+	caps := s.caps&^p.known | p.caps&p.known
+	if s.probed && s.caps != caps {
+		log.Printf("Capabilities of rpc server %s changed from %s to %s\n", url, s.caps, caps)
+	}
+
+	s.caps = caps
+	if p.version != "" {
+		s.version = p.version
+	}
+	if p.known == allCaps {
+		s.probed = true
+		s.probedAt = time.Now()
+	} else {
+		log.Printf("Probe of rpc server %s failed, capabilities %s kept\n", url, s.caps)
+	}
+}
@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newProbeServer starts a rpc server supporting optional methods of caps.
+func newProbeServer(t *testing.T, caps capability) string {
+	s := newTestServer(t, func(req request) interface{} {
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		methodNotFound := map[string]interface{}{"code": -32601, "message": "Method not found"}
+
+		switch req.Method {
+		case "getversion":
+			resp["result"] = map[string]interface{}{"port": 10333, "useragent": "/NEO:2.10.3/"}
+		case "invokescript":
+			if caps&capInvokeScript == 0 {
+				resp["error"] = methodNotFound
+				break
+			}
+			resp["result"] = map[string]interface{}{"script": req.Params[0], "state": "HALT", "stack": []interface{}{}}
+		case "getapplicationlog":
+			if caps&capAppLog == 0 {
+				resp["error"] = methodNotFound
+				break
+			}
+			// A testnet node.
+			if req.Params[0] != appLogProbes[1] {
+				resp["error"] = map[string]interface{}{"code": -100, "message": "Unknown transaction"}
+				break
+			}
+			resp["result"] = map[string]interface{}{
+				"txid":       req.Params[0],
+				"executions": []interface{}{map[string]interface{}{"trigger": "Application", "vmstate": "HALT"}},
+			}
+		}
+
+		return resp
+	})
+
+	return s.URL
+}
+
+func TestProbe(t *testing.T) {
+	tests := []capability{0, capInvokeScript, capAppLog | capInvokeScript}
+
+	for _, caps := range tests {
+		p := probe(newProbeServer(t, caps))
+		if p.caps != caps {
+			t.Errorf("probed capabilities = %s, want %s", p.caps, caps)
+		}
+		if p.version != "/NEO:2.10.3/" {
+			t.Errorf("probed version = %q, want /NEO:2.10.3/", p.version)
+		}
+	}
+}
+
+func TestProbeFailureKeepsCapabilities(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	// The server answers invokescript with an error, but getapplicationlog fails.
+	partial := newTestServer(t, func(req request) interface{} {
+		if req.Method == "getapplicationlog" {
+			return "not a response"
+		}
+		return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{"code": -32601, "message": "Method not found"}}
+	})
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for _, test := range []struct {
+		url  string
+		caps capability
+	}{
+		{partial.URL, capAppLog},
+		{down.URL, capAppLog | capInvokeScript},
+	} {
+		probedAt := time.Now().Add(-reprobeInterval)
+		s := &serverState{height: 100, probed: true, probedAt: probedAt, caps: capAppLog | capInvokeScript}
+		s.updateProbe(test.url, probe(test.url))
+
+		if s.caps != test.caps {
+			t.Errorf("capabilities of %s = %s after failed probe, want %s", test.url, s.caps, test.caps)
+		}
+		if s.probedAt != probedAt {
+			t.Errorf("failed probe of %s recorded, want it probed again on next refresh", test.url)
+		}
+	}
+}
+
+func TestCallRoutesByCapability(t *testing.T) {
+	full := newProbeServer(t, capAppLog|capInvokeScript)
+	plain := newProbeServer(t, 0)
+
+	probes := probeServers([]string{full, plain})
+	states := map[string]*serverState{}
+	for url, p := range probes {
+		s := &serverState{height: 500000, latency: initialLatency}
+		s.updateProbe(url, p)
+		states[url] = s
+	}
+	setServers(t, states)
+
+	c := NewClient(time.Second)
+	for i := 0; i < 10; i++ {
+		var appLog *RawApplicationLogResult
+		url, err := c.Call(context.Background(), 446369, "getapplicationlog", []interface{}{appLogProbes[1]}, &appLog)
+		if err != nil || url != full {
+			t.Fatalf("getapplicationlog answered by %s, %v, want %s", url, err, full)
+		}
+	}
+
+	delete(states, full)
+	var appLog *RawApplicationLogResult
+	if _, err := c.Call(context.Background(), 446369, "getapplicationlog", []interface{}{appLogProbes[1]}, &appLog); err != ErrNoServer {
+		t.Errorf("err = %v, want ErrNoServer without servers running ApplicationLogs", err)
+	}
+}
+
+func TestServersToProbe(t *testing.T) {
+	now := time.Now()
+	setServers(t, map[string]*serverState{
+		"fresh":     {height: 100, probed: true, probedAt: now.Add(-time.Minute)},
+		"stale":     {height: 100, probed: true, probedAt: now.Add(-reprobeInterval)},
+		"recovered": {height: -1, probed: true, probedAt: now.Add(-time.Minute)},
+		"unprobed":  {height: 100},
+		"down":      {height: 100, probed: true, probedAt: now.Add(-reprobeInterval)},
+	})
+
+	heights := map[string]int{"fresh": 100, "stale": 100, "recovered": 100, "unprobed": 100, "down": -1, "new": 100}
+	urls := serversToProbe(heights, now)
+	sort.Strings(urls)
+
+	want := []string{"new", "recovered", "stale", "unprobed"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("servers to probe = %v, want %v", urls, want)
+	}
+}
@@ -4,105 +4,86 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	eParser "github.com/go-errors/errors"
-	"github.com/valyala/fasthttp"
-	"neo_explorer/core/log"
-	"net/http"
-	"strings"
-	"time"
 )
 
-var (
-	client = &http.Client{Timeout: 20 * time.Second}
-)
+// ErrNoServer is returned if no rpc server's height is higher than or equal to the required height.
+var ErrNoServer = errors.New("no rpc server available")
 
-// JsonRPCResponse returns rpc response data.
-type jsonRPCResponse struct {
-	JSONRPC string `json:"jsonrpc"`
-	ID      int    `json:"id"`
+// Error is the error object of JSON-RPC response.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
-func getRPCRequestBody(method string, params []interface{}) string {
-	p := ""
-
-	for _, param := range params {
-		switch param.(type) {
-		case int8, uint8,
-			int16, uint16,
-			int, uint,
-			int32, uint32,
-			int64, uint64:
-			p += fmt.Sprintf("%d, ", param)
-		case string:
-			p += fmt.Sprintf("\"%s\", ", param)
-		default:
-			err := fmt.Errorf("the RPC parameter type must be integer or string. current type=%T, value=%v", param, param)
-			panic(err)
-		}
-	}
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
 
-	if p != "" {
-		p = p[:len(p)-2]
+// request is the JSON-RPC request object.
+type request struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	ID      int           `json:"id"`
+}
+
+func newRequest(method string, params []interface{}, id int) request {
+	if params == nil {
+		params = []interface{}{}
 	}
 
-	body := `{
-		"jsonrpc": "2.0",
-		"method": "` + method + `",
-		"params": [
-			` + p + `
-		],
-		"id": 1
+	return request{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      id,
 	}
-	`
-	return body
 }
 
-func rpcCall(minHeight int, params string, target interface{}) {
-	call(minHeight, params, target)
+// response is the JSON-RPC response object.
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
 }
 
-func call(minHeight int, params string, target interface{}) {
-	requestBody := []byte(params)
-	resp := fasthttp.AcquireResponse()
-	req := fasthttp.AcquireRequest()
-	req.Header.SetMethod("POST")
-	req.SetBody(requestBody)
-
-	client := &fasthttp.Client{}
-
-	for {
-		url, ok := getServer(minHeight)
-		if !ok {
-			if strings.Contains(params, `"getblock"`) {
-				// Exceed the highest block index, return nil target.
-				return
-			}
-			delay := 3
-			fmt.Printf("No server's height higher than or equal to %d\nWaiting for %d seconds before retry\n", minHeight, delay)
-			time.Sleep(time.Duration(delay) * time.Second)
-			PrintServerStatus()
-			continue
-		}
+// decode decodes the result into result, or returns the error object.
+func (r *response) decode(result interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
 
-		req.SetRequestURI(url)
-		err := client.Do(req, resp)
-		if err != nil {
-			log.Error.Println(err)
-			serverUnavailable(url)
-			time.Sleep(50 * time.Millisecond)
-			continue
-		}
+	if len(r.Result) == 0 {
+		return errors.New("response has neither result nor error")
+	}
+
+	return json.Unmarshal(r.Result, result)
+}
+
+// decodeResult decodes the response body of a single request into result.
+func decodeResult(url string, respBody []byte, result interface{}) error {
+	resp := response{}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("invalid response from %s: %v: %s", url, err, abbreviate(respBody))
+	}
 
-		break
+	if err := resp.decode(result); err != nil {
+		if _, ok := err.(*Error); ok {
+			return err
+		}
 
+		return fmt.Errorf("invalid result from %s: %v: %s", url, err, abbreviate(respBody))
 	}
 
-	bodyBytes := resp.Body()
+	return nil
+}
 
-	err := json.Unmarshal(bodyBytes, target)
-	if err != nil {
-		log.Error.Println(errors.New(eParser.Wrap(err, 0).ErrorStack()))
-		log.Error.Printf("Request body: %v\n", string(requestBody))
-		log.Error.Printf("Response: %v\n", string(bodyBytes))
+// abbreviate shortens response body in errors.
+func abbreviate(body []byte) string {
+	const max = 256
+	if len(body) > max {
+		return string(body[:max]) + "..."
 	}
+
+	return string(body)
 }
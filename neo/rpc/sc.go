@@ -1,16 +1,15 @@
 package rpc
 
 import (
+	"context"
+	"fmt"
 	"math/big"
+	"neo_explorer/core/log"
+	"os"
+	"time"
 )
 
-// SmartContractResponse is the struct of returning data from 'invokescript' rpc call.
-type SmartContractResponse struct {
-	jsonRPCResponse
-	Result *RawSmartContractCallResult `json:"result"`
-}
-
-// RawSmartContractCallResult is the inner struct of struct 'SmartContractResponse'.
+// RawSmartContractCallResult is the result of 'invokescript' rpc call.
 type RawSmartContractCallResult struct {
 	Script      string     `json:"script"`
 	State       string     `json:"state"`
@@ -56,13 +55,39 @@ type RawStack struct {
 	Value interface{} `json:"value"`
 }
 
-// SmartContractRPCCall returns result of 'invokescript' rpc call.
-func SmartContractRPCCall(minHeight int, scripts string) *RawSmartContractCallResult {
-	params := []interface{}{scripts}
-	args := getRPCRequestBody("invokescript", params)
+// SmartContractRPCCall returns result of 'invokescript' rpc call,
+// it waits until some server's height is higher than minHeight.
+// It returns nil if ctx is done.
+func SmartContractRPCCall(ctx context.Context, minHeight int, scripts string) *RawSmartContractCallResult {
+	var result *RawSmartContractCallResult
+
+	for {
+		_, err := DefaultClient.Call(ctx, minHeight, "invokescript", []interface{}{scripts}, &result)
+		if err == ErrNoServer {
+			if !waitForServer(ctx, minHeight) {
+				return nil
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Error.Printf("Failed to invoke script %s: %v\n", scripts, err)
+		}
+
+		return result
+	}
+}
 
-	respData := SmartContractResponse{}
-	rpcCall(minHeight, args, &respData)
+// waitForServer pauses before retry, it returns false if ctx is done.
+func waitForServer(ctx context.Context, minHeight int) bool {
+	delay := 3
+	fmt.Printf("No server's height higher than or equal to %d\nWaiting for %d seconds before retry\n", minHeight, delay)
+	if !sleep(ctx, time.Duration(delay)*time.Second) {
+		return false
+	}
+	WriteServerStatus(os.Stdout)
 
-	return respData.Result
+	return true
 }
@@ -1,24 +1,21 @@
 package rpc
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"math/rand"
-	"neo_explorer/core/config"
+	"neo_explorer/core/log"
 	"neo_explorer/core/util"
-	"strings"
+	"os"
 	"sync"
 	"time"
 )
 
 var (
-	// servers stores all neo rpc urls with its height
-	// For those (temporarily)unaccessable servers,
-	// their height will be set to -1.
-	// These servers' heights will be refreshed timely.
-	servers map[string]int
-	sLock   sync.RWMutex
+	// servers stores all neo rpc urls with their height and health.
+	// Heights of (temporarily)unaccessable servers are -1,
+	// and will be refreshed timely.
+	servers map[string]*serverState
+	sLock   sync.Mutex
 
 	// BestHeight indicates current highest height.
 	BestHeight util.SafeCounter
@@ -29,33 +26,72 @@ type ServerInfo struct {
 	height int
 }
 
-func TraceBestHeight() {
+// TraceBestHeight refreshes rpc servers every 3 seconds until ctx is done.
+func TraceBestHeight(ctx context.Context) {
 
-	RefreshServers()
-	PrintServerStatus()
+	RefreshServers(ctx)
+	WriteServerStatus(os.Stdout)
 
-	for {
-		RefreshServers()
+	go discoverPeriodically(ctx)
 
-		time.Sleep(3 * time.Second)
+	for sleep(ctx, 3*time.Second) {
+		RefreshServers(ctx)
 	}
 
 }
 
-// RefreshServers updates heights of all rpc servers.
-func RefreshServers() int {
+// RefreshServers updates heights of all rpc servers,
+// and capabilities of the ones returned by serversToProbe.
+func RefreshServers(ctx context.Context) int {
 	// It takes time to get heights.
-	serverInfos := getHeights()
+	serverInfos := getHeights(ctx)
+
+	probes := probeServers(serversToProbe(serverInfos, time.Now()))
 
 	sLock.Lock()
 
-	servers = serverInfos
+	// Keep health of servers still in the config.
+	states := make(map[string]*serverState, len(serverInfos))
 	bestHeight := 0
-	for _, height := range serverInfos {
+	for url, height := range serverInfos {
+		// Removed during this refresh.
+		if removedServers[url] {
+			continue
+		}
+
+		if d, ok := discovered[url]; ok {
+			if height >= 0 {
+				d.failures = 0
+			} else if d.failures++; d.failures >= maxDiscoveredFailures {
+				log.Printf("Discovered rpc server %s is unavailable, removed\n", url)
+				delete(discovered, url)
+				continue
+			}
+		}
+
+		s, ok := servers[url]
+		if !ok {
+			s = newServerState()
+		}
+		s.height = height
+		if p, ok := probes[url]; ok {
+			s.updateProbe(url, p)
+		}
+		states[url] = s
+
+		serverHeight.With(url).Set(float64(height))
 		if bestHeight < height {
 			bestHeight = height
 		}
 	}
+	// Servers discovered or added during this refresh.
+	for url, s := range servers {
+		if _, ok := states[url]; !ok && (discovered[url] != nil || addedServers[url]) {
+			states[url] = s
+		}
+	}
+
+	servers = states
 	BestHeight.Set(bestHeight)
 
 	sLock.Unlock()
@@ -63,40 +99,16 @@ func RefreshServers() int {
 	return bestHeight
 }
 
-func serverUnavailable(url string) {
-	sLock.Lock()
-	defer sLock.Unlock()
-
-	// Incase server changed(e.g., reloaded dut to config file change).
-	if _, ok := servers[url]; ok {
-		servers[url] = -1
-	}
-}
-
-// PrintServerStatus prints rpc host with its current best height.
-func PrintServerStatus() {
-	sLock.RLock()
-	defer sLock.RUnlock()
-
-	for host, height := range servers {
-		if height < 0 {
-			fmt.Printf("%s: %s\n", host, util.BRed("Failed to get server height"))
-		} else {
-			fmt.Printf("%s: %d\n", host, height)
-		}
-	}
-}
-
 // getHeights gets current height of all rpc servers
 // and returns best height from these servers.
-func getHeights() map[string]int {
+func getHeights(ctx context.Context) map[string]int {
 	// log.Printf("Checking all rpc servers...")
-	rpcs := config.GetRPCs()
+	rpcs := rpcURLs()
 	c := make(chan ServerInfo, len(rpcs))
 
 	for _, url := range rpcs {
 		go func(url string, c chan<- ServerInfo) {
-			height, _ := getHeightFrom(url)
+			height, _ := getHeightFrom(ctx, url)
 			c <- ServerInfo{
 				url:    url,
 				height: height,
@@ -116,52 +128,37 @@ func getHeights() map[string]int {
 	return serverInfos
 }
 
-// getServer randomly returns one of rpc servers whose height higher than minHeight.
-func getServer(minHeight int) (string, bool) {
+// getServer returns one of rpc servers whose height higher than minHeight and supporting caps,
+// fast and healthy servers are more likely to be selected.
+// Servers with open circuits or in excluded list will not be selected.
+func getServer(minHeight int, caps capability, excluded ...string) (string, bool) {
 	if minHeight < 0 {
 		err := fmt.Errorf("minHeight(%d) cannot lower than zero", minHeight)
 		panic(err)
 	}
 
-	sLock.RLock()
-	defer sLock.RUnlock()
-
-	// Suppose all servers are qualified.
-	candidates := []string{}
+	sLock.Lock()
+	defer sLock.Unlock()
 
-	for url, height := range servers {
-		if height >= int(minHeight) {
-			// Always select localhost rpc server if valid.
-			if strings.Contains(url, "127.0.0.1") ||
-				strings.Contains(url, "localhost") {
-				candidates = append(candidates, url)
-			}
+	return selectServer(minHeight, caps, excluded, time.Now())
+}
 
-			candidates = append(candidates, url)
+func isExcluded(url string, excluded []string) bool {
+	for _, e := range excluded {
+		if url == e {
+			return true
 		}
 	}
 
-	l := len(candidates)
-	if l == 0 {
-		return "", false
-	}
-
-	return candidates[rand.Intn(l)], true
+	return false
 }
 
 // getHeightFrom returns current block index of the given rpc server.
-func getHeightFrom(url string) (int, error) {
-	params := []interface{}{}
-	args := getRPCRequestBody("getblockcount", params)
-
-	respData := BlockCountRespponse{}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer([]byte(args)))
-	if err != nil {
+func getHeightFrom(ctx context.Context, url string) (int, error) {
+	var count int
+	if err := DefaultClient.CallServer(ctx, url, "getblockcount", nil, &count); err != nil {
 		return -1, err
 	}
-	defer resp.Body.Close()
-
-	json.NewDecoder(resp.Body).Decode(&respData)
 
-	return respData.Result - 1, nil
+	return count - 1, nil
 }
@@ -1,13 +1,14 @@
 package rpc
 
 import (
+	"context"
 	"fmt"
 	"neo_explorer/core/config"
 	"testing"
 )
 
 func Test_getHeightFrom(t *testing.T) {
-	count, err := getHeightFrom("https://explorer.o3node.org:443")
+	count, err := getHeightFrom(context.Background(), "https://explorer.o3node.org:443")
 	if err != nil {
 		t.Error(err)
 	}
@@ -17,7 +18,7 @@ func Test_getHeightFrom(t *testing.T) {
 
 func Test_getHeights(t *testing.T) {
 	config.Load()
-	heights := getHeights()
+	heights := getHeights(context.Background())
 
 	for url, height := range heights {
 		fmt.Printf("%s : %d\n", url, height)
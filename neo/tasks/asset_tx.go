@@ -1,10 +1,10 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"neo_explorer/core/log"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/tx"
 	"strconv"
 	"time"
@@ -19,21 +19,31 @@ var (
 	maxTxPKforAssetTx         uint
 )
 
-func startAssetTxTask() {
+func (tr *taskRunner) runAssetTxTask(ctx context.Context) error {
 	assetTxChan := make(chan *txInfo, assetTxChanSize)
 
-	go fetchAssetTx(assetTxChan)
-	go handleAssetTx(assetTxChan)
+	return runAll(ctx,
+		func(ctx context.Context) error { return tr.fetchAssetTx(ctx, assetTxChan) },
+		func(ctx context.Context) error { return tr.handleAssetTx(ctx, assetTxChan) },
+	)
 }
 
-func fetchAssetTx(assetTxChan chan<- *txInfo) {
-	nextPK := db.GetLastAssetTxPkCounter() + 1
+func (tr *taskRunner) fetchAssetTx(ctx context.Context, assetTxChan chan<- *txInfo) error {
+	epoch := chainEpoch.Get()
+	nextPK := tr.store.GetLastAssetTxPkCounter() + 1
 
 	for {
-		txs := db.GetTxs(nextPK, 50, "")
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			nextPK = tr.store.GetLastAssetTxPkCounter() + 1
+		}
+
+		txs := tr.store.GetTxs(nextPK, 50, "")
 		if len(txs) == 0 {
 			//log.Printf("Waiting for new transactions...[fetchAssetTx]\n")
-			time.Sleep(2 * time.Second)
+			if !sleep(ctx, 2*time.Second) {
+				return nil
+			}
 			continue
 		}
 
@@ -44,45 +54,92 @@ func fetchAssetTx(assetTxChan chan<- *txInfo) {
 			txIDs = append(txIDs, strconv.Itoa(int(tx.ID)))
 		}
 
-		vinMap, voutMap, err := db.GetVinVout(txIDs)
+		vinMap, voutMap, err := tr.store.GetVinVout(txIDs)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		for _, tx := range txs {
-			assetTxChan <- &txInfo{
+			info := &txInfo{
 				tx:    tx,
 				vins:  vinMap[tx.ID],
 				vouts: voutMap[tx.ID],
+				epoch: epoch,
+			}
+
+			select {
+			case assetTxChan <- info:
+			case <-ctx.Done():
+				return nil
 			}
 		}
 	}
 }
 
-func handleAssetTx(assetTxChan <-chan *txInfo) {
+func (tr *taskRunner) handleAssetTx(ctx context.Context, assetTxChan <-chan *txInfo) error {
 	records := []tx.AddrAssetIDTx{}
 	maxPK := uint64(0)
+	epoch := chainEpoch.Get()
+
+	var err error
 
 	for {
 		select {
+		case <-ctx.Done():
+			// Flush collected records before quit.
+			applyInEpoch(epoch, func() {
+				err = tr.recordAddrAssetIDTx(records, int64(maxPK))
+			})
+			return err
 		case t := <-assetTxChan:
-			maxPK = uint64(t.tx.ID)
-			records = processAssetTx(records, t)
+			if t.epoch != epoch {
+				// Pending records were collected before blocks rolled back.
+				epoch = t.epoch
+				records = records[:0]
+			}
+
+			if isQuarantined(assetTxTask, t.tx.ID) {
+				continue
+			}
+
+			err = handleTxPk(t.tx.ID, func() error {
+				applyInEpoch(epoch, func() {
+					maxPK = uint64(t.tx.ID)
+					records = tr.processAssetTx(records, t)
+				})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(records) >= 100 {
+				applyInEpoch(epoch, func() {
+					err = tr.recordAddrAssetIDTx(records, int64(maxPK))
+				})
+				records = records[:0]
+			}
 		case <-time.After(2 * time.Second):
-			recordAddrAssetIDTx(records, int64(maxPK))
+			applyInEpoch(epoch, func() {
+				err = tr.recordAddrAssetIDTx(records, int64(maxPK))
+			})
 			records = records[:0]
 		}
+
+		if err != nil {
+			return err
+		}
 	}
 }
 
-func processAssetTx(records []tx.AddrAssetIDTx, t *txInfo) []tx.AddrAssetIDTx {
+func (tr *taskRunner) processAssetTx(records []tx.AddrAssetIDTx, t *txInfo) []tx.AddrAssetIDTx {
 	if t != nil {
 		vins := t.vins
 		vouts := t.vouts
 		uniqueKey := make(map[string]bool)
 
 		for _, vin := range vins {
-			vinVout, err := db.GetVout(vin.TxID, vin.Vout)
+			vinVout, err := tr.store.GetVout(vin.TxID, vin.Vout)
 			if err != nil {
 				panic(err)
 			}
@@ -119,35 +176,29 @@ func processAssetTx(records []tx.AddrAssetIDTx, t *txInfo) []tx.AddrAssetIDTx {
 		}
 	}
 
-	if len(records) == 0 {
-		return nil
-	}
-
-	if len(records) >= 100 {
-		recordAddrAssetIDTx(records, int64(t.tx.ID))
-		return nil
-	}
-
 	return records
 }
 
-func recordAddrAssetIDTx(records []tx.AddrAssetIDTx, maxPK int64) {
+func (tr *taskRunner) recordAddrAssetIDTx(records []tx.AddrAssetIDTx, maxPK int64) error {
 	if len(records) == 0 {
-		return
+		return nil
 	}
 
-	err := db.RecordAddrAssetIDTx(records, maxPK)
+	err := tr.store.RecordAddrAssetIDTx(records, maxPK)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	showAssetTxProgress(uint(maxPK))
+	tr.showAssetTxProgress(uint(maxPK))
+	return nil
 }
 
-func showAssetTxProgress(currentTxPk uint) {
+func (tr *taskRunner) showAssetTxProgress(currentTxPk uint) {
+	taskTxPkGauge.With(assetTxTask).Set(float64(currentTxPk))
+
 	if maxTxPKforAssetTx == 0 || AssetTxMaxPkShouldRefresh {
 		AssetTxMaxPkShouldRefresh = false
-		maxTxPKforAssetTx = db.GetHighestTxPk()
+		maxTxPKforAssetTx = tr.store.GetHighestTxPk()
 	}
 
 	now := time.Now()
@@ -170,13 +221,4 @@ func showAssetTxProgress(currentTxPk uint) {
 		maxTxPKforAssetTx,
 		assetProgress.Percentage)
 	assetProgress.LastOutputTime = now
-
-	// Send mail if fully synced.
-	if assetProgress.Finished {
-		// If sync lasts shortly, do not send mail.
-		if time.Since(assetProgress.InitTime) < time.Minute*5 {
-			return
-		}
-		fmt.Sprintf("Init time: %v\nEnd Time: %v\n", assetProgress.InitTime, time.Now())
-	}
 }
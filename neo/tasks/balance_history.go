@@ -0,0 +1,191 @@
+package tasks
+
+import (
+	"context"
+	"math/big"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"time"
+)
+
+const balanceHistoryChanSize = 5000
+
+var (
+	balanceMaxPkShouldRefresh bool
+	balanceProgress           = Progress{}
+	maxTxPkForBalance         uint
+	// gasBalanceDropped is set once daily GAS balances of old versions are dropped,
+	// they are kept until balance history has caught up with transactions.
+	gasBalanceDropped bool
+)
+
+// runBalanceHistoryTask records balances of addresses in buckets of time,
+// for utxo assets from transactions and for nep5 assets from nep5 tx records.
+func (tr *taskRunner) runBalanceHistoryTask(ctx context.Context) error {
+	balanceChan := make(chan txInfo, balanceHistoryChanSize)
+
+	return runAll(ctx,
+		func(ctx context.Context) error { return tr.fetchTx(ctx, balanceChan, tr.store.GetLastTxPkForBalance) },
+		func(ctx context.Context) error { return tr.handleTxBalance(ctx, balanceChan) },
+		tr.handleNep5Balance,
+	)
+}
+
+func (tr *taskRunner) handleTxBalance(ctx context.Context, balanceChan <-chan txInfo) error {
+	for {
+		var info txInfo
+		var ok bool
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case info, ok = <-balanceChan:
+			if !ok {
+				return nil
+			}
+		}
+
+		if isQuarantined(balanceHistoryTask, info.tx.ID) {
+			continue
+		}
+
+		changed := false
+
+		err := handleTxPk(info.tx.ID, func() (err error) {
+			applyInEpoch(info.epoch, func() {
+				changes := tr.getBalanceChanges(info)
+
+				if len(changes) == 0 {
+					return
+				}
+
+				err = tr.store.ApplyTxBalanceChanges(info.tx.ID, changes)
+				changed = err == nil
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			tr.showBalanceHistoryProgress(info.tx.ID)
+		}
+	}
+}
+
+// getBalanceChanges returns balance changes of every utxo asset made by the transaction.
+func (tr *taskRunner) getBalanceChanges(info txInfo) []db.BalanceChange {
+	changes := []db.BalanceChange{}
+
+	for _, vin := range info.vins {
+		vinVout, err := tr.store.GetVout(vin.TxID, vin.Vout)
+		if err != nil {
+			panic(err)
+		}
+
+		changes = append(changes, db.BalanceChange{
+			AddressId: vinVout.AddressId,
+			AssetId:   vinVout.AssetID,
+			BlockTime: info.tx.BlockTime,
+			Value:     new(big.Float).Neg(vinVout.Value),
+		})
+	}
+
+	for _, vout := range info.vouts {
+		changes = append(changes, db.BalanceChange{
+			AddressId: vout.AddressId,
+			AssetId:   vout.AssetID,
+			BlockTime: info.tx.BlockTime,
+			Value:     vout.Value,
+		})
+	}
+
+	return changes
+}
+
+// handleNep5Balance applies nep5 tx records to balance history.
+func (tr *taskRunner) handleNep5Balance(ctx context.Context) error {
+	epoch := chainEpoch.Get()
+	lastPk := tr.store.GetNep5TxPkForBalance()
+
+	for {
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			lastPk = tr.store.GetNep5TxPkForBalance()
+		}
+
+		records, err := tr.store.GetNep5TxRecords(lastPk, 1000)
+		if err != nil {
+			return err
+		}
+
+		if len(records) > 0 {
+			applied := applyInEpoch(epoch, func() {
+				err = tr.store.ApplyNep5BalanceChanges(records)
+			})
+			if err != nil {
+				return err
+			}
+			if applied {
+				lastPk = records[len(records)-1].ID
+			}
+
+			if !sleep(ctx, time.Millisecond*10) {
+				return nil
+			}
+			continue
+		}
+
+		if !sleep(ctx, time.Second) {
+			return nil
+		}
+	}
+}
+
+func (tr *taskRunner) showBalanceHistoryProgress(currentTxPK uint) {
+	taskTxPkGauge.With(balanceHistoryTask).Set(float64(currentTxPK))
+
+	if maxTxPkForBalance == 0 || balanceMaxPkShouldRefresh {
+		balanceMaxPkShouldRefresh = false
+		maxTxPkForBalance = tr.store.GetHighestTxPk()
+	}
+
+	now := time.Now()
+	if balanceProgress.LastOutputTime == (time.Time{}) {
+		balanceProgress.LastOutputTime = now
+	}
+	if currentTxPK < maxTxPkForBalance && now.Sub(balanceProgress.LastOutputTime) < time.Second {
+		return
+	}
+
+	GetEstimatedRemainingTime(int64(currentTxPK), int64(maxTxPkForBalance), &balanceProgress)
+	if balanceProgress.Percentage.Cmp(big.NewFloat(100)) == 0 &&
+		bProgress.Finished {
+		balanceProgress.Finished = true
+	}
+
+	log.Printf("%sProgress of Addr-Balance-History: %d/%d, %.4f%%\n",
+		balanceProgress.RemainingTimeStr,
+		currentTxPK,
+		maxTxPkForBalance,
+		balanceProgress.Percentage)
+
+	balanceProgress.LastOutputTime = now
+	if currentTxPK >= maxTxPkForBalance && !gasBalanceDropped {
+		tr.dropGasBalanceHistory()
+	}
+}
+
+func (tr *taskRunner) dropGasBalanceHistory() {
+	dropped, err := tr.store.DropGasBalanceHistory()
+	if err != nil {
+		log.Error.Printf("Failed to drop addr_gas_balance: %v\n", err)
+		return
+	}
+
+	gasBalanceDropped = true
+	if dropped {
+		log.Printf("Balance history caught up, dropped addr_gas_balance of old versions\n")
+	}
+}
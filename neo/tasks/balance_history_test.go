@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"fmt"
+	"math/big"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+// voutStore returns output 0 of tx 1, 10 of asset 1 held by address 1.
+type voutStore struct {
+	db.Store
+}
+
+func (voutStore) GetVout(txId uint, n uint16) (*tx.TransactionVout, error) {
+	if txId != 1 || n != 0 {
+		return nil, fmt.Errorf("vout %d of tx %d not found", n, txId)
+	}
+
+	return &tx.TransactionVout{TxId: 1, N: 0, AssetID: 1, AddressId: 1, Value: big.NewFloat(10)}, nil
+}
+
+func TestGetBalanceChanges(t *testing.T) {
+	tr := &taskRunner{store: voutStore{}}
+
+	info := txInfo{
+		tx:   &tx.Transaction{ID: 2, BlockTime: 3600},
+		vins: []*tx.TransactionVin{{TxId: 2, TxID: 1, Vout: 0}},
+		vouts: []*tx.TransactionVout{
+			{TxId: 2, N: 0, AssetID: 1, AddressId: 2, Value: big.NewFloat(4)},
+			{TxId: 2, N: 1, AssetID: 2, AddressId: 1, Value: big.NewFloat(0.5)},
+		},
+	}
+
+	got := []string{}
+	for _, c := range tr.getBalanceChanges(info) {
+		got = append(got, fmt.Sprintf("%d/%d/%d/%s", c.AddressId, c.AssetId, c.BlockTime, c.Value.Text('f', 1)))
+	}
+	if want := "[1/1/3600/-10.0 2/1/3600/4.0 1/2/3600/0.5]"; fmt.Sprint(got) != want {
+		t.Errorf("tr.getBalanceChanges() = %v, want %s", got, want)
+	}
+}
@@ -1,13 +1,14 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"neo_explorer/core/buffer"
+	"neo_explorer/core/config"
 	"neo_explorer/core/log"
 	"neo_explorer/core/util"
 	"neo_explorer/neo/block"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/parse"
 	"neo_explorer/neo/rpc"
 	"time"
@@ -21,16 +22,16 @@ var (
 	bProgress    = Progress{}
 	blockBuffer  buffer.BlockBuffer
 	worker       Worker
-	blockChannel chan *rpc.RawBlock
 	lastTxPkId   = uint(0)
 	LastAddrPkId util.SafeCounter
 )
 
-func fetchBlock() {
-	worker.add()
+// fetchBlock is started by worker, which has counted it already.
+func fetchBlock(ctx context.Context) {
 	log.Printf("Create new worker to fetch blocks\n")
 
-	nextHeight := blockBuffer.GetNextPending()
+	batchSize := config.GetRPCBatchSize()
+	nextHeight := blockBuffer.ReservePending(batchSize)
 	waited := 0
 
 	defer func() {
@@ -41,13 +42,17 @@ func fetchBlock() {
 	for {
 		// Control size of the blockBuffer.
 		if blockBuffer.Size() > bufferSize {
-			time.Sleep(time.Millisecond * 20)
+			if !sleep(ctx, time.Millisecond*20) {
+				return
+			}
 			continue
 		}
 
 		// If fully synchronized.
 		if worker.num() == 1 && nextHeight == blockBuffer.GetHighest()+1 {
-			time.Sleep(time.Second)
+			if !sleep(ctx, time.Second) {
+				return
+			}
 			waited++
 			log.Printf("Waiting for block index: %d(%s)\n", nextHeight, util.SecondsToHuman(uint64(waited)))
 			// if waited >= 30 && waited%10 == 0 {
@@ -55,10 +60,14 @@ func fetchBlock() {
 			// }
 		}
 
-		b := rpc.DownloadBlock(nextHeight)
+		if ctx.Err() != nil {
+			return
+		}
+
+		blocks := rpc.DownloadBlocks(ctx, nextHeight, batchSize)
 
 		// Beyond the latest block.
-		if b == nil {
+		if blocks[0] == nil {
 			if nextHeight > rpc.BestHeight.Get()-50 &&
 				worker.shouldQuit() {
 				return
@@ -70,30 +79,45 @@ func fetchBlock() {
 		}
 
 		waited = 0
-		blockBuffer.Put(b)
+		for _, b := range blocks {
+			if b != nil {
+				blockBuffer.Put(b)
+			}
+		}
+
+		// Workers reduced at runtime, quit before reserving more heights.
+		if worker.exceeds() {
+			return
+		}
 
 		if worker.num() == 1 {
 			nextHeight = blockBuffer.GetHighest() + 1
 		} else {
-			nextHeight = blockBuffer.GetNextPending()
+			nextHeight = blockBuffer.ReservePending(batchSize)
 		}
 	}
 }
 
-func arrangeBlock(dbHeight int, queue chan<- *rpc.RawBlock) {
+func arrangeBlock(ctx context.Context, dbHeight int, queue chan<- *rpc.RawBlock) {
 	const sleepTime = 20
 	height := dbHeight + 1
 	delay := 0
 
 	for {
 		if b, ok := blockBuffer.Pop(height); ok {
-			queue <- b
+			select {
+			case queue <- b:
+			case <-ctx.Done():
+				return
+			}
 			height++
 			delay = 0
 			continue
 		}
 
-		time.Sleep(time.Millisecond * time.Duration(sleepTime))
+		if !sleep(ctx, time.Millisecond*time.Duration(sleepTime)) {
+			return
+		}
 		if blockBuffer.Size() == 0 {
 			continue
 		}
@@ -107,49 +131,114 @@ func arrangeBlock(dbHeight int, queue chan<- *rpc.RawBlock) {
 			err := fmt.Errorf("block height %d is missing while downloading blocks", height)
 			log.Println(err)
 
-			getMissingBlock(height)
+			getMissingBlock(ctx, height)
 		}
 	}
 }
 
-func getMissingBlock(height int) {
+func getMissingBlock(ctx context.Context, height int) {
 	log.Printf("Try fetching given block of height: %d\n", height)
 
-	b := rpc.DownloadBlock(height)
+	b := rpc.DownloadBlock(ctx, height)
 	if b != nil {
 		blockBuffer.Put(b)
 	}
 }
 
-func storeBlock(ch <-chan *rpc.RawBlock) {
+// runBlockTask stores blocks of blockBuffer in order, starting from the highest stored block.
+func (tr *taskRunner) runBlockTask(ctx context.Context) error {
+	// Pks may have been taken by blocks which failed to be stored.
+	lastTxPkId = tr.store.GetTxCount()
+	LastAddrPkId.Set(int(tr.store.GetVoutAddrCount()))
+
+	queue := make(chan *rpc.RawBlock, bufferSize)
+	dbHeight := tr.store.GetLastHeight()
+	setStoredHeight(dbHeight, lastTxPkId)
+
+	err := runAll(ctx,
+		func(ctx context.Context) error {
+			// get from blockBuffer and send to queue
+			arrangeBlock(ctx, dbHeight, queue)
+			return nil
+		},
+		func(ctx context.Context) error {
+			// save to database from queue
+			return tr.storeBlock(ctx, queue)
+		},
+	)
+
+	// Give queued blocks back for the next run.
+	for {
+		select {
+		case b := <-queue:
+			blockBuffer.Put(b)
+		default:
+			return err
+		}
+	}
+}
+
+func (tr *taskRunner) storeBlock(ctx context.Context, ch <-chan *rpc.RawBlock) error {
 	const size = 15
 	rawBlocks := []*rpc.RawBlock{}
 
-	for block := range ch {
+	defer func() {
+		// Give blocks failed to be stored back for the next run.
+		for _, b := range rawBlocks {
+			blockBuffer.Put(b)
+		}
+	}()
+
+	for {
+		var block *rpc.RawBlock
+
+		select {
+		case <-ctx.Done():
+			// Persist blocks collected so far.
+			if len(rawBlocks) > 0 {
+				if err := tr.persistBlocks(ctx, rawBlocks); err != nil {
+					return err
+				}
+				rawBlocks = nil
+			}
+			return nil
+		case block = <-ch:
+		}
+
 		rawBlocks = append(rawBlocks, block)
 		if block.Index%size == 0 ||
 			int(block.Index) == blockBuffer.GetHighest() {
-			store(rawBlocks)
+			if err := tr.persistBlocks(ctx, rawBlocks); err != nil {
+				return err
+			}
 			rawBlocks = nil
 		}
 	}
 }
 
-func store(rawBlocks []*rpc.RawBlock) {
+func (tr *taskRunner) persistBlocks(ctx context.Context, rawBlocks []*rpc.RawBlock) error {
+	// Shutting down, unlinked blocks are downloaded again on restart.
+	if rawBlocks = tr.linkBlocks(ctx, rawBlocks); rawBlocks == nil {
+		return nil
+	}
 	maxIndex := int(rawBlocks[len(rawBlocks)-1].Index)
 	blocks := block.ParseBlocks(rawBlocks)
-	txBulk := parse.Txs(rawBlocks, &lastTxPkId, &LastAddrPkId)
-
-	err := db.InsertBlock(maxIndex, blocks, txBulk)
+	txBulk, err := parse.Txs(tr.store, rawBlocks, &lastTxPkId, &LastAddrPkId)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if err := tr.store.InsertBlock(maxIndex, blocks, txBulk); err != nil {
+		return err
 	}
 
+	setStoredHeight(maxIndex, lastTxPkId)
+
 	// Auxiliary signal for tx task.
 	TxMaxPkShouldRefresh = true
 	AssetTxMaxPkShouldRefresh = true
 	//Nep5MaxPkShouldRefresh = true
-	//gasMaxPkShouldRefresh = true
+	//balanceMaxPkShouldRefresh = true
 	//scMaxPkShouldRefresh = true
 
 	bestHeight := rpc.BestHeight.Get()
@@ -161,6 +250,8 @@ func store(rawBlocks []*rpc.RawBlock) {
 	}
 
 	showBlockStorageProgress(int64(maxIndex), int64(bestHeight))
+
+	return nil
 }
 
 func showBlockStorageProgress(maxIndex int64, highestIndex int64) {
@@ -187,14 +278,4 @@ func showBlockStorageProgress(maxIndex int64, highestIndex int64) {
 		bProgress.Percentage,
 	)
 	bProgress.LastOutputTime = now
-
-	// Send mail if fully synced.
-	if bProgress.Finished {
-		// If sync lasts shortly, do not send mail.
-		if time.Since(bProgress.InitTime) < time.Minute*5 {
-			return
-		}
-
-		fmt.Sprintf("Block counts: %d", highestIndex)
-	}
 }
@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/rpc"
+	"neo_explorer/neo/tx"
+)
+
+// downloadBlock downloads a block from rpc servers, replaced in tests.
+var downloadBlock = rpc.DownloadBlock
+
+// runClaimsTask resolves claimed transactions of claims stored before tx_claims recorded them,
+// by downloading their claim transactions again. It returns once all claims are resolved.
+func (tr *taskRunner) runClaimsTask(ctx context.Context) error {
+	resolved := 0
+
+	for ctx.Err() == nil {
+		claimTxs, err := tr.store.GetUnresolvedClaimTxs(100)
+		if err != nil {
+			return err
+		}
+		if len(claimTxs) == 0 {
+			break
+		}
+
+		var rawBlock *rpc.RawBlock
+		for _, c := range claimTxs {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if rawBlock == nil || rawBlock.Index != c.BlockIndex {
+				rawBlock = downloadBlock(ctx, int(c.BlockIndex))
+				if rawBlock == nil && ctx.Err() != nil {
+					return nil
+				}
+				if rawBlock == nil {
+					return fmt.Errorf("failed to download block %d of claim tx %s", c.BlockIndex, c.TxID)
+				}
+			}
+
+			if err := tr.resolveClaims(rawBlock, c); err != nil {
+				return err
+			}
+			resolved++
+		}
+
+		log.Printf("Resolved claims of %d claim transactions\n", resolved)
+	}
+
+	return nil
+}
+
+func (tr *taskRunner) resolveClaims(rawBlock *rpc.RawBlock, c *db.UnresolvedClaimTx) error {
+	for _, rawTx := range rawBlock.Tx {
+		if rawTx.TxID != c.TxID {
+			continue
+		}
+
+		claims := []*tx.TransactionClaims{}
+		for _, rawClaim := range rawTx.Claims {
+			txID := tr.store.GetTx(rawClaim.TxID)
+			if txID == 0 {
+				return fmt.Errorf("claimed tx %s of claim tx %s not found", rawClaim.TxID, c.TxID)
+			}
+
+			claims = append(claims, &tx.TransactionClaims{TxId: c.TxPk, TxID: txID, Vout: rawClaim.Vout})
+		}
+
+		// Claims of rolled back transactions are not restored.
+		chainLock.RLock()
+		defer chainLock.RUnlock()
+
+		return tr.store.ResolveClaims(c.TxPk, claims)
+	}
+
+	return fmt.Errorf("claim tx %s not found in block %d", c.TxID, c.BlockIndex)
+}
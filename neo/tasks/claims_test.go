@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/rpc"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+// claimsStore has two unresolved claim transactions in block 5.
+type claimsStore struct {
+	db.Store
+	resolved map[uint][]*tx.TransactionClaims
+}
+
+func (s *claimsStore) GetUnresolvedClaimTxs(limit int) ([]*db.UnresolvedClaimTx, error) {
+	claimTxs := []*db.UnresolvedClaimTx{}
+	for _, c := range []*db.UnresolvedClaimTx{{TxPk: 10, TxID: "0xc1", BlockIndex: 5}, {TxPk: 11, TxID: "0xc2", BlockIndex: 5}} {
+		if _, ok := s.resolved[c.TxPk]; !ok {
+			claimTxs = append(claimTxs, c)
+		}
+	}
+
+	return claimTxs, nil
+}
+
+func (s *claimsStore) GetTx(txid string) uint {
+	return map[string]uint{"0xa1": 1, "0xa2": 2}[txid]
+}
+
+func (s *claimsStore) ResolveClaims(txPk uint, claims []*tx.TransactionClaims) error {
+	s.resolved[txPk] = claims
+	return nil
+}
+
+func TestRunClaimsTask(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	store := &claimsStore{resolved: make(map[uint][]*tx.TransactionClaims)}
+	tr := &taskRunner{store: store}
+
+	downloads := 0
+	downloadBlock = func(ctx context.Context, index int) *rpc.RawBlock {
+		downloads++
+
+		b := &rpc.RawBlock{}
+		const raw = `{"index": 5, "tx": [{"txid": "0xc1", "claims": [{"txid": "0xa1", "vout": 0}, {"txid": "0xa2", "vout": 1}]}, {"txid": "0xc2"}]}`
+		if err := json.Unmarshal([]byte(raw), b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	defer func() { downloadBlock = rpc.DownloadBlock }()
+
+	if err := tr.runClaimsTask(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 1 {
+		t.Errorf("downloaded block %d times, want once for both claim txs", downloads)
+	}
+
+	claims := store.resolved[10]
+	if len(claims) != 2 || claims[0].TxId != 10 || claims[0].TxID != 1 || claims[1].TxID != 2 || claims[1].Vout != 1 {
+		t.Errorf("claims of tx 10 = %+v, want outputs 0 of tx 1 and 1 of tx 2", claims)
+	}
+	if claims, ok := store.resolved[11]; !ok || len(claims) != 0 {
+		t.Errorf("claims of tx 11 = %+v, want resolved without claims", claims)
+	}
+}
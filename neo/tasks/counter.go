@@ -1,35 +1,44 @@
 package tasks
 
 import (
-	"neo_explorer/neo/db"
+	"context"
 	"time"
 )
 
-func startUpdateCounterTask() {
-	go insertNep5AddrTxRecord()
-}
-
-func insertNep5AddrTxRecord() {
-
-	lastPk := db.GetNep5TxPkForAddrTx()
+func (tr *taskRunner) insertNep5AddrTxRecord(ctx context.Context) error {
+	epoch := chainEpoch.Get()
+	lastPk := tr.store.GetNep5TxPkForAddrTx()
 
 	for {
-		Nep5TxRecs, err := db.GetNep5TxRecords(lastPk, 1000)
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			lastPk = tr.store.GetNep5TxPkForAddrTx()
+		}
+
+		Nep5TxRecs, err := tr.store.GetNep5TxRecords(lastPk, 1000)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		if len(Nep5TxRecs) > 0 {
-			lastPk = Nep5TxRecs[len(Nep5TxRecs)-1].ID
-			err = db.InsertNep5AddrTxRec(Nep5TxRecs, lastPk)
+			applied := applyInEpoch(epoch, func() {
+				err = tr.store.InsertNep5AddrTxRec(Nep5TxRecs, Nep5TxRecs[len(Nep5TxRecs)-1].ID)
+			})
 			if err != nil {
-				panic(err)
+				return err
+			}
+			if applied {
+				lastPk = Nep5TxRecs[len(Nep5TxRecs)-1].ID
 			}
 
-			time.Sleep(time.Millisecond * 10)
+			if !sleep(ctx, time.Millisecond*10) {
+				return nil
+			}
 			continue
 		}
 
-		time.Sleep(time.Second)
+		if !sleep(ctx, time.Second) {
+			return nil
+		}
 	}
 }
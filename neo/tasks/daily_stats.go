@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"context"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"time"
+)
+
+// dailyStatsInterval is how often the stats of the current day are aggregated again.
+var dailyStatsInterval = 10 * time.Second
+
+// runDailyStatsTask aggregates network stats of every day, from the genesis block on,
+// using data handled by the tx and nep5 tasks.
+func (tr *taskRunner) runDailyStatsTask(ctx context.Context) error {
+	for {
+		if err := tr.updateDailyStats(ctx); err != nil {
+			return err
+		}
+
+		if !sleep(ctx, dailyStatsInterval) {
+			return nil
+		}
+	}
+}
+
+// updateDailyStats aggregates stats of days from the last aggregated one
+// up to the time before which data is ready.
+func (tr *taskRunner) updateDailyStats(ctx context.Context) error {
+	epoch := chainEpoch.Get()
+
+	ready, err := tr.store.GetDailyStatsReadyTime()
+	if err != nil {
+		return err
+	}
+
+	day, ok, err := tr.store.GetNextDailyStatsDay()
+	if err != nil || !ok {
+		return err
+	}
+
+	completed := 0
+	var last int64
+	for ; day < ready; day += db.DaySeconds {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		end := day + db.DaySeconds
+		if end > ready {
+			end = ready
+		}
+
+		var s *db.DailyStats
+		applied := applyInEpoch(epoch, func() {
+			s, err = tr.store.UpdateDailyStats(day, end)
+		})
+		if err != nil {
+			return err
+		}
+		if !applied {
+			return nil
+		}
+
+		if s.Complete {
+			completed++
+			last = day
+		}
+	}
+
+	if completed > 0 {
+		log.Printf("Aggregated daily stats of %d days up to %s\n", completed, time.Unix(last, 0).UTC().Format("2006-01-02"))
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"testing"
+)
+
+// dailyStatsStore has stats up to day 10, and data is ready until the middle of day 12.
+type dailyStatsStore struct {
+	db.Store
+	updated []string
+}
+
+func (s *dailyStatsStore) GetDailyStatsReadyTime() (int64, error) {
+	return 12*db.DaySeconds + 100, nil
+}
+
+func (s *dailyStatsStore) GetNextDailyStatsDay() (int64, bool, error) {
+	return 10 * db.DaySeconds, true, nil
+}
+
+func (s *dailyStatsStore) UpdateDailyStats(dayTime int64, endTime int64) (*db.DailyStats, error) {
+	s.updated = append(s.updated, fmt.Sprintf("%d-%d", dayTime, endTime))
+	return &db.DailyStats{DayTime: dayTime, EndTime: endTime, Complete: endTime == dayTime+db.DaySeconds}, nil
+}
+
+func TestUpdateDailyStats(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+
+	store := &dailyStatsStore{}
+	tr := &taskRunner{store: store}
+
+	if err := tr.updateDailyStats(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last aggregated day is aggregated again, the current day up to the ready time.
+	want := fmt.Sprintf("[%d-%d %d-%d %d-%d]", 10*db.DaySeconds, 11*db.DaySeconds, 11*db.DaySeconds, 12*db.DaySeconds, 12*db.DaySeconds, 12*db.DaySeconds+100)
+	if got := fmt.Sprint(store.updated); got != want {
+		t.Errorf("updated days = %s, want %s", got, want)
+	}
+}
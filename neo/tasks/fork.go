@@ -0,0 +1,258 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/log"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/rpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRollbackDepth limits how many stored blocks can be rolled back automatically.
+	maxRollbackDepth = 2000
+	// maxLinkAttempts limits retries of linking one batch of blocks to the stored chain.
+	maxLinkAttempts = 10
+)
+
+var (
+	// chainLock is held for reading by tasks while they persist data derived from blocks,
+	// and held for writing while stored blocks are being rolled back.
+	chainLock sync.RWMutex
+	// chainEpoch increases after every rollback,
+	// tasks drop data fetched in previous epochs and restart from their counters.
+	chainEpoch util.SafeCounter
+)
+
+// applyInEpoch runs apply while no rollback is in progress.
+// It returns false without running apply if epoch is outdated.
+func applyInEpoch(epoch int, apply func()) bool {
+	chainLock.RLock()
+	defer chainLock.RUnlock()
+
+	if epoch != chainEpoch.Get() {
+		return false
+	}
+
+	apply()
+	return true
+}
+
+// linkBlocks makes sure every block links to its previous one,
+// starting from the highest stored block.
+// Bad blocks are replaced with blocks from other rpc servers,
+// and stored blocks on a stale fork are rolled back.
+// It returns the blocks which should be stored, or nil if ctx is done before they are linked.
+func (tr *taskRunner) linkBlocks(ctx context.Context, rawBlocks []*rpc.RawBlock) []*rpc.RawBlock {
+	for attempt := 0; ; attempt++ {
+		first := int(rawBlocks[0].Index)
+		storedHash := tr.store.GetBlockHash(first - 1)
+
+		i, expected := findUnlinked(storedHash, rawBlocks)
+		if i < 0 {
+			return rawBlocks
+		}
+
+		if attempt >= maxLinkAttempts {
+			err := fmt.Errorf("failed to link block %d to its previous block after %d attempts", rawBlocks[i].Index, attempt)
+			panic(err)
+		}
+
+		bad := rawBlocks[i]
+		log.Error.Printf("Block %d(%s) from %s does not link to previous block: previousblockhash=%s, expected=%s\n",
+			bad.Index, bad.Hash, bad.Server, bad.PreviousBlockHash, expected)
+
+		// Ask another server for a second opinion.
+		other := rpc.DownloadBlockExcluding(ctx, int(bad.Index), bad.Server)
+		if other == nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Error.Printf("No other rpc server can provide block %d, retry later\n", bad.Index)
+			if !sleep(ctx, 3*time.Second) {
+				return nil
+			}
+			continue
+		}
+
+		if other.PreviousBlockHash == expected {
+			log.Printf("Replaced bad block %d from %s with block %s from %s\n", bad.Index, bad.Server, other.Hash, other.Server)
+			rawBlocks[i] = other
+			continue
+		}
+
+		// Both servers disagree with what we have,
+		// take the whole batch from the second server.
+		batch, err := downloadBlocks(ctx, other.Server, first, int(rawBlocks[len(rawBlocks)-1].Index))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Error.Println(err)
+			continue
+		}
+
+		if first == 0 || batch[0].PreviousBlockHash == storedHash {
+			rawBlocks = batch
+			continue
+		}
+
+		// Stored blocks are on a stale fork.
+		forkHeight, err := tr.findForkHeight(ctx, other.Server, first-1)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		tr.rollback(forkHeight)
+
+		missing, err := downloadBlocks(ctx, other.Server, forkHeight, first-1)
+		if err != nil && ctx.Err() == nil {
+			log.Error.Println(err)
+			missing = redownloadBlocks(ctx, forkHeight, first-1)
+		}
+		// Stored blocks are rolled back already, the rest are downloaded again on restart.
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		rawBlocks = append(missing, batch...)
+	}
+}
+
+// findUnlinked returns position of the first block which does not link to its previous one,
+// together with the expected previous block hash. It returns -1 if all blocks are linked.
+func findUnlinked(storedHash string, rawBlocks []*rpc.RawBlock) (int, string) {
+	expected := storedHash
+
+	for i, b := range rawBlocks {
+		// Nothing to compare with for the genesis block.
+		if b.Index == 0 {
+			expected = b.Hash
+			continue
+		}
+
+		if b.PreviousBlockHash != expected {
+			return i, expected
+		}
+
+		expected = b.Hash
+	}
+
+	return -1, ""
+}
+
+// findForkHeight walks back from the given height and returns the lowest height
+// where the stored block differs from the one in the given rpc server.
+func (tr *taskRunner) findForkHeight(ctx context.Context, url string, height int) (int, error) {
+	for index := height; index >= 0 && height-index < maxRollbackDepth; index-- {
+		b, err := rpc.DownloadBlockFrom(ctx, url, index)
+		if err != nil {
+			return 0, err
+		}
+
+		if strings.EqualFold(b.Hash, tr.store.GetBlockHash(index)) {
+			return index + 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("fork of stored blocks from %s is deeper than %d blocks, manual intervention required", url, maxRollbackDepth)
+}
+
+// downloadBlocks downloads blocks of [from, to] from the given rpc server.
+func downloadBlocks(ctx context.Context, url string, from int, to int) ([]*rpc.RawBlock, error) {
+	blocks := []*rpc.RawBlock{}
+
+	for index := from; index <= to; index++ {
+		b, err := rpc.DownloadBlockFrom(ctx, url, index)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
+
+// redownloadBlocks downloads blocks of [from, to] from any rpc server, it returns nil if ctx is done.
+func redownloadBlocks(ctx context.Context, from int, to int) []*rpc.RawBlock {
+	blocks := []*rpc.RawBlock{}
+
+	for index := from; index <= to; index++ {
+		b := rpc.DownloadBlock(ctx, index)
+		for b == nil {
+			if !sleep(ctx, time.Second) {
+				return nil
+			}
+			b = rpc.DownloadBlock(ctx, index)
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+// rollback removes stored blocks from the given height and all their derived data,
+// then resets caches and running tasks.
+func (tr *taskRunner) rollback(height int) {
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
+	log.Printf("Rolling back stored blocks from height %d\n", height)
+
+	report, err := tr.store.RollbackBlocks(height)
+	if err != nil {
+		panic(err)
+	}
+
+	// Reset caches.
+	lastTxPkId = tr.store.GetTxCount()
+	LastAddrPkId.Set(int(tr.store.GetVoutAddrCount()))
+	cache.LoadAddrAssetInfo(tr.store.GetAddrAssetInfo())
+	forgetQuarantined(report.FirstTxPk)
+	setStoredHeight(height-1, lastTxPkId)
+
+	chainEpoch.Add(1)
+
+	TxMaxPkShouldRefresh = true
+	AssetTxMaxPkShouldRefresh = true
+
+	logRollbackReport(report)
+}
+
+// reloadAddrCache reloads cached addresses and their balances from db,
+// once no task is persisting data, so that the cache matches committed data.
+func (tr *taskRunner) reloadAddrCache() {
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
+	log.Printf("Reloading cached balances of addresses\n")
+	cache.LoadAddrAssetInfo(tr.store.GetAddrAssetInfo())
+}
+
+func logRollbackReport(report *db.RollbackReport) {
+	log.Printf("Rolled back blocks %d-%d\n", report.FromHeight, report.ToHeight)
+
+	if report.FirstTxPk > 0 {
+		log.Printf("\tremoved transactions: pk %d-%d\n", report.FirstTxPk, report.LastTxPk)
+	}
+
+	for _, rows := range report.Rows {
+		log.Printf("\t%s: %d rows %s\n", rows.Table, rows.Rows, rows.Action)
+	}
+
+	for _, note := range report.Notes {
+		log.Printf("\tnote: %s\n", note)
+	}
+
+	log.Printf("\tcaches reloaded, running tasks restart from their counters\n")
+}
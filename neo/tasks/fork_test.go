@@ -0,0 +1,39 @@
+package tasks
+
+import (
+	"neo_explorer/neo/rpc"
+	"testing"
+)
+
+func TestFindUnlinked(t *testing.T) {
+	newBlock := func(index uint, hash, prev string) *rpc.RawBlock {
+		return &rpc.RawBlock{Index: index, Hash: hash, PreviousBlockHash: prev}
+	}
+
+	blocks := []*rpc.RawBlock{
+		newBlock(10, "0x0a", "0x09"),
+		newBlock(11, "0x0b", "0x0a"),
+		newBlock(12, "0x0c", "0x0b"),
+	}
+
+	if i, _ := findUnlinked("0x09", blocks); i != -1 {
+		t.Errorf("linked blocks reported unlinked at %d", i)
+	}
+
+	if i, expected := findUnlinked("0xff", blocks); i != 0 || expected != "0xff" {
+		t.Errorf("findUnlinked() = %d, %s; want 0, 0xff", i, expected)
+	}
+
+	blocks[2] = newBlock(12, "0x0c", "0xbb")
+	if i, expected := findUnlinked("0x09", blocks); i != 2 || expected != "0x0b" {
+		t.Errorf("findUnlinked() = %d, %s; want 2, 0x0b", i, expected)
+	}
+
+	genesis := []*rpc.RawBlock{
+		newBlock(0, "0x00", ""),
+		newBlock(1, "0x01", "0x00"),
+	}
+	if i, _ := findUnlinked("", genesis); i != -1 {
+		t.Errorf("genesis blocks reported unlinked at %d", i)
+	}
+}
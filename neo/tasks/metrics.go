@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"neo_explorer/core/metrics"
+)
+
+var (
+	dbHeightGauge = metrics.NewGauge("neo_explorer_db_height",
+		"Height of the highest stored block.")
+	highestTxPkGauge = metrics.NewGauge("neo_explorer_highest_tx_pk",
+		"Pk of the latest stored transaction.")
+	taskTxPkGauge = metrics.NewGaugeVec("neo_explorer_task_last_tx_pk",
+		"Pk of the last transaction handled by each task.", "task")
+	taskRestarts = metrics.NewCounterVec("neo_explorer_task_restarts_total",
+		"Restarts of each task after failures.", "task")
+	quarantinedTxs = metrics.NewCounterVec("neo_explorer_task_quarantined_txs_total",
+		"Transactions quarantined by each task.", "task")
+	verifyMismatches = metrics.NewGaugeVec("neo_explorer_verify_mismatches",
+		"Mismatches found by the last balance verification, by kind of balance.", "kind")
+	nep5Corrections = metrics.NewCounterVec("neo_explorer_nep5_reconcile_corrections_total",
+		"Nep5 balances and total supplies corrected by reconciliation.", "kind")
+)
+
+func init() {
+	metrics.NewGaugeFunc("neo_explorer_block_buffer_size",
+		"Downloaded blocks waiting to be stored.", func() float64 {
+			return float64(blockBuffer.Size())
+		})
+}
+
+// setStoredHeight updates gauges of stored blocks and transactions.
+func setStoredHeight(height int, highestTxPk uint) {
+	dbHeightGauge.Set(float64(height))
+	highestTxPkGauge.Set(float64(highestTxPk))
+}
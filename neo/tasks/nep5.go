@@ -1,73 +1,32 @@
 /*
-To restart this task from beginning, execute the following sqls:
-
-DELETE FROM `addr_asset` WHERE LENGTH(`asset_id`) = 40;
-DELETE FROM `addr_tx` WHERE `asset_type` = 'nep5';
-UPDATE `address` SET `trans_nep5` = 0 WHERE 1=1;
-UPDATE `counter` SET
-	`last_tx_pk_for_nep5` = 0,
-	`app_log_idx` = -1
-WHERE `id` = 1;
-TRUNCATE TABLE `nep5`;
-TRUNCATE TABLE `nep5_reg_info`;
-TRUNCATE TABLE `nep5_tx`;
-TRUNCATE TABLE `nep5_migrate`;
-DELETE FROM `address` WHERE `trans_asset`=0 AND `trans_nep5`=0;
-UPDATE `counter` SET `nep5_tx_pk_for_addr_tx`=0 WHERE `id`=1;
-
-To check if rpc node has enabled smart contract log,
-check if the first nep5 transfer exists:
-mainnet:
-	txID: 0xc920b2192e74eda4ca6140510813aa40fef1767d00c152aa6f8027c24bdf14f2
-	blockIndex: 1444843
-testnet:
-	txID: 0xd355c4cf3a58859cd72c28ce362d727ed7dc2d68ae049ca9356fc0a6c21a8f45
-	blockIndex: 446369
-
-run the following curl command for mainnet(replace IP address):
-
-curl -X POST \
-  http://xxx.xxx.xxx.xxx:10332 \
-  -H 'Content-Type: application/json' \
-  -H 'cache-control: no-cache' \
-  -d '{
-    "jsonrpc": "2.0",
-    "method": "getapplicationlog",
-    "params": [
-        "0xc920b2192e74eda4ca6140510813aa40fef1767d00c152aa6f8027c24bdf14f2"
-    ],
-    "id": 1
-}'
-
-run the following curl command for testnet(replace IP address):
-
-curl -X POST \
-  http://xxx.xxx.xxx.xxx:10332 \
-  -H 'Content-Type: application/json' \
-  -H 'cache-control: no-cache' \
-  -d '{
-    "jsonrpc": "2.0",
-    "method": "getapplicationlog",
-    "params": [
-        "0xd355c4cf3a58859cd72c28ce362d727ed7dc2d68ae049ca9356fc0a6c21a8f45"
-    ],
-    "id": 1
-}'
+To restart this task from beginning, stop the explorer and run:
+
+	neo_explorer reset --task nep5
+
+which resets the nep5 addr_tx task as well. `neo_explorer rewind --task nep5 --to-tx-pk N`
+restarts it after transaction N.
+
+Application logs are only requested from rpc nodes running the ApplicationLogs plugin,
+rpc nodes are probed at startup and on each refresh with the first nep5 transfer of
+mainnet(0xc920b2192e74eda4ca6140510813aa40fef1767d00c152aa6f8027c24bdf14f2, block 1444843) and
+testnet(0xd355c4cf3a58859cd72c28ce362d727ed7dc2d68ae049ca9356fc0a6c21a8f45, block 446369).
+See the APPLOG column of server status printed at startup.
 
 */
 
 package tasks
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"math"
 	"math/big"
 	"neo_explorer/core/cache"
+	"neo_explorer/core/config"
 	"neo_explorer/core/log"
 	"neo_explorer/core/util"
 	"neo_explorer/neo/addr"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/nep5"
 	"neo_explorer/neo/rpc"
 	"neo_explorer/neo/smartcontract"
@@ -92,12 +51,18 @@ var (
 
 	// appLogs stores txid with its applicationlog rpc response
 	appLogs sync.Map
+
+	// nep5TxEpoch is the epoch of transaction being handled in handleNep5Tx.
+	nep5TxEpoch int
 )
 
 type nep5TxInfo struct {
 	tx           *tx.Transaction
 	dataStack    *smartcontract.DataStack
 	appLogResult *rpc.RawApplicationLogResult
+	// Last handled index of applicationlog notifications, -1 if not started yet.
+	applogIdx int
+	epoch     int
 }
 
 type nep5Store struct {
@@ -105,8 +70,9 @@ type nep5Store struct {
 	// 1: nep5 tx
 	// 2: nep5 addr balance and total supply
 	// 3: update counter(last_tx_pk_for_nep5, app_log_idx)
-	t int
-	d interface{}
+	t     int
+	d     interface{}
+	epoch int
 }
 
 type nep5AssetStore struct {
@@ -152,35 +118,41 @@ type nep5MigrateStore struct {
 	txID          string
 }
 
-func startNep5Task() {
-	nep5AssetDecimals = db.GetNep5AssetDecimals()
+func (tr *taskRunner) runNep5Task(ctx context.Context) error {
+	nep5AssetDecimals = tr.store.GetNep5AssetDecimals()
 	nep5TxChan := make(chan *nep5TxInfo, nep5ChanSize)
 	applogChan := make(chan *tx.Transaction, nep5ChanSize)
 	nep5StoreChan := make(chan *nep5Store, nep5ChanSize)
 
-	lastPk, applogIdx := db.GetLastTxPkForNep5()
-
-	go fetchNep5Tx(nep5TxChan, applogChan, lastPk, applogIdx)
-	go fetchAppLog(4, applogChan)
+	// Application logs are only kept in memory, no need to wait for them.
+	go fetchAppLog(ctx, 4, applogChan)
 
-	go handleNep5Tx(nep5TxChan, nep5StoreChan, applogIdx)
-	go handleNep5Store(nep5StoreChan)
+	return runAll(ctx,
+		func(ctx context.Context) error {
+			tr.fetchNep5Tx(ctx, nep5TxChan, applogChan)
+			return nil
+		},
+		func(ctx context.Context) error { return tr.handleNep5Tx(ctx, nep5TxChan, nep5StoreChan) },
+		func(ctx context.Context) error { return tr.handleNep5Store(ctx, nep5StoreChan) },
+	)
 }
 
-func fetchNep5Tx(nep5TxChan chan<- *nep5TxInfo, applogChan chan<- *tx.Transaction, lastPk uint, applogIdx int) {
-	// If there are some transfers in this transaction,
-	// this variable will be the last index(starts from 0).
-	// If this variable is -1,
-	// it means CURRENT TRANSACTION HAD BEEN HANDLED(zero transfers,
-	// is nep5 trgistration transfer, or non-transfer actions),
-	// so nextTxPK should be next pk, not the current pk.
-	nextTxPK := lastPk
-	if applogIdx == -1 {
-		nextTxPK++
-	}
+func (tr *taskRunner) fetchNep5Tx(ctx context.Context, nep5TxChan chan<- *nep5TxInfo, applogChan chan<- *tx.Transaction) {
+	// Stops fetchAppLog.
+	defer close(applogChan)
+
+	epoch := chainEpoch.Get()
+	nextTxPK, applogIdx := tr.getNextNep5TxPk()
+	resumedPk := nextTxPK
 
 	for {
-		txs := db.GetInvocationTxs(nextTxPK, 1000)
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			nextTxPK, applogIdx = tr.getNextNep5TxPk()
+			resumedPk = nextTxPK
+		}
+
+		txs := tr.store.GetInvocationTxs(nextTxPK, 1000)
 
 		for i := len(txs) - 1; i >= 0; i-- {
 			// cannot be app call
@@ -191,14 +163,20 @@ func fetchNep5Tx(nep5TxChan chan<- *nep5TxInfo, applogChan chan<- *tx.Transactio
 		}
 
 		if len(txs) == 0 {
-			time.Sleep(2 * time.Second)
+			if !sleep(ctx, 2*time.Second) {
+				return
+			}
 			continue
 		}
 
 		nextTxPK = txs[len(txs)-1].ID + 1
 
 		for _, tx := range txs {
-			applogChan <- tx
+			select {
+			case applogChan <- tx:
+			case <-ctx.Done():
+				return
+			}
 		}
 
 		for _, tx := range txs {
@@ -206,7 +184,9 @@ func fetchNep5Tx(nep5TxChan chan<- *nep5TxInfo, applogChan chan<- *tx.Transactio
 				// Get applicationlog from map.
 				appLogResult, ok := appLogs.Load(tx.ID)
 				if !ok {
-					time.Sleep(10 * time.Millisecond)
+					if !sleep(ctx, 10*time.Millisecond) {
+						return
+					}
 					continue
 				}
 
@@ -216,88 +196,217 @@ func fetchNep5Tx(nep5TxChan chan<- *nep5TxInfo, applogChan chan<- *tx.Transactio
 					tx:           tx,
 					dataStack:    smartcontract.ReadScript(tx.Script),
 					appLogResult: appLogResult.(*rpc.RawApplicationLogResult),
+					applogIdx:    -1,
+					epoch:        epoch,
+				}
+				// Only the resumed transaction has partially handled notifications.
+				if applogIdx != -1 && tx.ID == resumedPk {
+					nep5Info.applogIdx = applogIdx
+					applogIdx = -1
 				}
 
-				nep5TxChan <- &nep5Info
+				select {
+				case nep5TxChan <- &nep5Info:
+				case <-ctx.Done():
+					return
+				}
 				break
 			}
 		}
 	}
 }
 
-func fetchAppLog(goroutines int, applogChan <-chan *tx.Transaction) {
+// getNextNep5TxPk returns pk of the next transaction to handle,
+// and last handled index of its applicationlog notifications.
+func (tr *taskRunner) getNextNep5TxPk() (uint, int) {
+	lastPk, applogIdx := tr.store.GetLastTxPkForNep5()
+
+	// If there are some transfers in this transaction,
+	// this variable will be the last index(starts from 0).
+	// If this variable is -1,
+	// it means CURRENT TRANSACTION HAD BEEN HANDLED(zero transfers,
+	// is nep5 trgistration transfer, or non-transfer actions),
+	// so nextTxPK should be next pk, not the current pk.
+	if applogIdx == -1 {
+		return lastPk + 1, -1
+	}
+
+	return lastPk, applogIdx
+}
+
+func fetchAppLog(ctx context.Context, goroutines int, applogChan <-chan *tx.Transaction) {
+	batchSize := config.GetRPCBatchSize()
+
 	for i := 0; i < goroutines; i++ {
 		go func(ch <-chan *tx.Transaction) {
-			for tx := range ch {
-				appLogResult := rpc.GetApplicationLog(int(tx.BlockIndex), tx.TxID)
-				appLogs.Store(tx.ID, appLogResult)
+			for txs := nextAppLogBatch(ch, batchSize); len(txs) > 0; txs = nextAppLogBatch(ch, batchSize) {
+				maxIndex := 0
+				txIDs := make([]string, len(txs))
+				for i, tx := range txs {
+					txIDs[i] = tx.TxID
+					if maxIndex < int(tx.BlockIndex) {
+						maxIndex = int(tx.BlockIndex)
+					}
+				}
+
+				appLogResults := rpc.GetApplicationLogs(ctx, maxIndex, txIDs)
+				// Logs are missing once ctx is done, keep draining until fetchNep5Tx stops.
+				if ctx.Err() != nil {
+					continue
+				}
+				for i, tx := range txs {
+					appLogs.Store(tx.ID, appLogResults[i])
+				}
 			}
 		}(applogChan)
 	}
 }
 
-func handleNep5Tx(nep5TxChan <-chan *nep5TxInfo, nep5StoreChan chan<- *nep5Store, applogIdx int) {
-	for nep5Info := range nep5TxChan {
-		tx := nep5Info.tx
-		opCodeDataStack := nep5Info.dataStack
-		appLogResult := nep5Info.appLogResult
+// nextAppLogBatch waits for the next transaction and takes at most size transactions
+// which are already in the channel. It returns nothing after the channel closed.
+func nextAppLogBatch(ch <-chan *tx.Transaction, size int) []*tx.Transaction {
+	t, ok := <-ch
+	if !ok {
+		return nil
+	}
+
+	txs := []*tx.Transaction{t}
+	for len(txs) < size {
+		select {
+		case t, ok := <-ch:
+			if !ok {
+				return txs
+			}
+			txs = append(txs, t)
+		default:
+			return txs
+		}
+	}
+
+	return txs
+}
+
+func (tr *taskRunner) handleNep5Tx(ctx context.Context, nep5TxChan <-chan *nep5TxInfo, nep5StoreChan chan<- *nep5Store) error {
+	// Stops handleNep5Store.
+	defer close(nep5StoreChan)
+
+	for {
+		var nep5Info *nep5TxInfo
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case nep5Info = <-nep5TxChan:
+		}
+
+		if nep5Info.epoch != chainEpoch.Get() {
+			continue
+		}
 
-		if opCodeDataStack == nil || len(*opCodeDataStack) == 0 {
+		if nep5Info.epoch != nep5TxEpoch {
+			// Forget decimals of nep5 assets registered in rolled back blocks.
+			nep5TxEpoch = nep5Info.epoch
+			nep5AssetDecimals = tr.store.GetNep5AssetDecimals()
+		}
+
+		if isQuarantined(nep5Task, nep5Info.tx.ID) {
 			nep5StoreChan <- &nep5Store{
-				t: 3,
+				epoch: nep5TxEpoch,
+				t:     3,
 				d: nep5CounterStore{
-					txPK:      tx.ID,
+					txPK:      nep5Info.tx.ID,
 					applogIdx: -1,
 				},
 			}
 			continue
 		}
 
-		// It may be a nep5 registration transaction.
-		if applogIdx == -1 && isNep5RegistrationTx(tx.Script) {
-			handleNep5RegTx(nep5StoreChan, tx, opCodeDataStack.Copy())
-			if isNep5MigrateTx((tx.Script)) {
-				handleMigrate(opCodeDataStack, nep5StoreChan, tx)
+		err := handleTxPk(nep5Info.tx.ID, func() error {
+			tr.handleNep5TxInfo(ctx, nep5Info, nep5StoreChan)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (tr *taskRunner) handleNep5TxInfo(ctx context.Context, nep5Info *nep5TxInfo, nep5StoreChan chan<- *nep5Store) {
+	tx := nep5Info.tx
+	opCodeDataStack := nep5Info.dataStack
+	appLogResult := nep5Info.appLogResult
+	applogIdx := nep5Info.applogIdx
+
+	defer func() {
+		// Blocks rolled back while handling this transaction,
+		// its results will be dropped by handleNep5Store anyway.
+		if p := recover(); p != nil {
+			if nep5Info.epoch == chainEpoch.Get() {
+				panic(p)
 			}
-		} else if applogIdx == -1 && isNep5MigrateTx(tx.Script) {
-			handleMigrate(opCodeDataStack, nep5StoreChan, tx)
-		} else {
-			handleNep5NonTxCall(nep5StoreChan, tx, opCodeDataStack)
 
-			if len(appLogResult.Executions) > 0 {
-				notifs := []rpc.RawNotifications{}
+			log.Printf("Dropped nep5 transaction %s handled during rollback: %v\n", tx.TxID, p)
+		}
+	}()
 
-				for _, exec := range appLogResult.Executions {
-					if strings.Contains(exec.VMState, "FAULT") ||
-						len(exec.Notifications) == 0 {
-						continue
-					}
+	if opCodeDataStack == nil || len(*opCodeDataStack) == 0 {
+		nep5StoreChan <- &nep5Store{
+			epoch: nep5TxEpoch,
+			t:     3,
+			d: nep5CounterStore{
+				txPK:      tx.ID,
+				applogIdx: -1,
+			},
+		}
+		return
+	}
 
-					notifs = append(notifs, exec.Notifications...)
+	// It may be a nep5 registration transaction.
+	if applogIdx == -1 && isNep5RegistrationTx(tx.Script) {
+		tr.handleNep5RegTx(ctx, nep5StoreChan, tx, opCodeDataStack.Copy())
+		if isNep5MigrateTx((tx.Script)) {
+			tr.handleMigrate(ctx, opCodeDataStack, nep5StoreChan, tx)
+		}
+	} else if applogIdx == -1 && isNep5MigrateTx(tx.Script) {
+		tr.handleMigrate(ctx, opCodeDataStack, nep5StoreChan, tx)
+	} else {
+		tr.handleNep5NonTxCall(ctx, nep5StoreChan, tx, opCodeDataStack)
+
+		if len(appLogResult.Executions) > 0 {
+			notifs := []rpc.RawNotifications{}
+
+			for _, exec := range appLogResult.Executions {
+				if strings.Contains(exec.VMState, "FAULT") ||
+					len(exec.Notifications) == 0 {
+					continue
 				}
 
-				handleNep5TxCall(nep5StoreChan, tx, notifs, applogIdx)
+				notifs = append(notifs, exec.Notifications...)
 			}
 
-			// Set applogIdx to -1 to signify these transaction has been handled.
-			applogIdx = -1
-			nep5StoreChan <- &nep5Store{
-				t: 3,
-				d: nep5CounterStore{
-					txPK:      tx.ID,
-					applogIdx: applogIdx,
-				},
-			}
+			tr.handleNep5TxCall(ctx, nep5StoreChan, tx, notifs, applogIdx)
+		}
+
+		// Set applogIdx to -1 to signify these transaction has been handled.
+		applogIdx = -1
+		nep5StoreChan <- &nep5Store{
+			epoch: nep5TxEpoch,
+			t:     3,
+			d: nep5CounterStore{
+				txPK:      tx.ID,
+				applogIdx: applogIdx,
+			},
 		}
 	}
 }
 
-func handleMigrate(opCodeDataStack *smartcontract.DataStack, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction) {
+func (tr *taskRunner) handleMigrate(ctx context.Context, opCodeDataStack *smartcontract.DataStack, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction) {
 	scriptHash := opCodeDataStack.PopData()
 	oldAssetID := util.GetAssetIDFromScriptHash(scriptHash)
 	if len(oldAssetID) != 40 {
 		nep5StoreChan <- &nep5Store{
-			t: 3,
+			epoch: nep5TxEpoch,
+			t:     3,
 			d: nep5CounterStore{
 				txPK:      tx.ID,
 				applogIdx: -1,
@@ -306,10 +415,11 @@ func handleMigrate(opCodeDataStack *smartcontract.DataStack, nep5StoreChan chan<
 		return
 	}
 
-	newAssetAdmin, newAssetID, ok := handleNep5RegTx(nep5StoreChan, tx, opCodeDataStack)
+	newAssetAdmin, newAssetID, ok := tr.handleNep5RegTx(ctx, nep5StoreChan, tx, opCodeDataStack)
 	if !ok {
 		nep5StoreChan <- &nep5Store{
-			t: 3,
+			epoch: nep5TxEpoch,
+			t:     3,
 			d: nep5CounterStore{
 				txPK:      tx.ID,
 				applogIdx: -1,
@@ -319,7 +429,8 @@ func handleMigrate(opCodeDataStack *smartcontract.DataStack, nep5StoreChan chan<
 	}
 
 	nep5StoreChan <- &nep5Store{
-		t: 4,
+		epoch: nep5TxEpoch,
+		t:     4,
 		d: nep5MigrateStore{
 			newAssetAdmin: newAssetAdmin,
 			oldAssetID:    oldAssetID,
@@ -330,57 +441,90 @@ func handleMigrate(opCodeDataStack *smartcontract.DataStack, nep5StoreChan chan<
 	}
 }
 
-func handleNep5Store(nep5Store <-chan *nep5Store) {
+func (tr *taskRunner) handleNep5Store(ctx context.Context, nep5Store <-chan *nep5Store) error {
+	var failure error
+
 	for s := range nep5Store {
+		// Keep draining after shutdown or failure so that handleNep5Tx never blocks,
+		// dropped records are handled again from the counter on restart.
+		if ctx.Err() != nil || failure != nil {
+			continue
+		}
+
 		txPK := uint(0)
+		applied := false
+
+		failure = handleTxPk(s.txPK(), func() (err error) {
+			applied = applyInEpoch(s.epoch, func() {
+				switch s.t {
+				case 0:
+					txPK, err = tr.handleNep5AssetStore(s)
+				case 1:
+					txPK, err = tr.handleNep5TxStore(s)
+				case 2:
+					txPK, err = tr.handleNep5BalanceTotalSupplyStore(s)
+				case 3:
+					txPK, err = tr.handleNep5CounterStore(s)
+				case 4:
+					txPK, err = tr.handleNEP5Migrate(s)
+				default:
+					err = fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
+				}
+			})
+			return err
+		})
 
-		switch s.t {
-		case 0:
-			txPK = handleNep5AssetStore(s)
-		case 1:
-			txPK = handleNep5TxStore(s)
-		case 2:
-			txPK = handleNep5BalanceTotalSupplyStore(s)
-		case 3:
-			txPK = handleNep5CounterStore(s)
-		case 4:
-			txPK = handleNEP5Migrate(s)
-		default:
-			err := fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
-			panic(err)
+		if applied && failure == nil {
+			tr.showNep5Progress(txPK)
 		}
-
-		showNep5Progress(txPK)
 	}
+
+	return failure
 }
 
-func handleNep5AssetStore(s *nep5Store) uint {
+// txPK returns pk of the transaction which s is derived from.
+func (s *nep5Store) txPK() uint {
+	switch d := s.d.(type) {
+	case nep5AssetStore:
+		return d.tx.ID
+	case nep5TxStore:
+		return d.tx.ID
+	case nep5BalanceTSStore:
+		return d.txPK
+	case nep5CounterStore:
+		return d.txPK
+	case nep5MigrateStore:
+		return d.txPK
+	}
+
+	return 0
+}
+
+func (tr *taskRunner) handleNep5AssetStore(s *nep5Store) (uint, error) {
 	d, ok := s.d.(nep5AssetStore)
 	if !ok {
-		err := fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
-		panic(err)
+		return 0, fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
 	}
 
-	err := db.InsertNep5Asset(d.tx,
+	err := tr.store.InsertNep5Asset(d.tx,
 		d.nep5,
 		d.regInfo,
 		d.addrAsset,
 		d.atHeight)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	return d.tx.ID
+	return d.tx.ID, nil
 }
 
-func handleNep5TxStore(s *nep5Store) uint {
+func (tr *taskRunner) handleNep5TxStore(s *nep5Store) (uint, error) {
 	d, ok := s.d.(nep5TxStore)
 	if !ok {
-		err := fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
-		panic(err)
+		return 0, fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
 	}
 
-	err := db.InsertNep5transaction(d.tx,
+	err := tr.store.InsertNep5transaction(d.tx,
 		d.applogIdx,
 		d.assetID,
 		d.fromAddr,
@@ -390,20 +534,19 @@ func handleNep5TxStore(s *nep5Store) uint {
 		d.transferValue,
 		d.totalSupply)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	return d.tx.ID
+	return d.tx.ID, nil
 }
 
-func handleNep5BalanceTotalSupplyStore(s *nep5Store) uint {
+func (tr *taskRunner) handleNep5BalanceTotalSupplyStore(s *nep5Store) (uint, error) {
 	d, ok := s.d.(nep5BalanceTSStore)
 	if !ok {
-		err := fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
-		panic(err)
+		return 0, fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
 	}
 
-	err := db.UpdateNep5TotalSupplyAndAddrAsset(
+	err := tr.store.UpdateNep5TotalSupplyAndAddrAsset(
 		d.blockTime,
 		d.blockIndex,
 		d.addr,
@@ -411,29 +554,28 @@ func handleNep5BalanceTotalSupplyStore(s *nep5Store) uint {
 		d.assetID,
 		d.totalSupply)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	return d.txPK
+	return d.txPK, nil
 }
 
-func handleNep5CounterStore(s *nep5Store) uint {
+func (tr *taskRunner) handleNep5CounterStore(s *nep5Store) (uint, error) {
 	d, ok := s.d.(nep5CounterStore)
 	if !ok {
-		err := fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
-		panic(err)
+		return 0, fmt.Errorf("error nep5 store type %d: %+v", s.t, s.d)
 	}
 
-	err := db.UpdateLastTxPkForNep5(d.txPK, d.applogIdx)
+	err := tr.store.UpdateLastTxPkForNep5(d.txPK, d.applogIdx)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	return d.txPK
+	return d.txPK, nil
 }
 
-func handleNep5RegTx(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCodeDataStack *smartcontract.DataStack) (string, string, bool) {
-	adminAddr, ok := getCallerAddr(tx)
+func (tr *taskRunner) handleNep5RegTx(ctx context.Context, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCodeDataStack *smartcontract.DataStack) (string, string, bool) {
+	adminAddr, ok := tr.getCallerAddr(tx)
 	if !ok {
 		return "", "", false
 	}
@@ -453,7 +595,7 @@ func handleNep5RegTx(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCode
 	}
 
 	// Get nep5 definitions to make sure it is nep5.
-	nep5, addrAsset, atHeight, ok := queryNep5AssetInfo(tx, regInfo.ScriptHash, adminAddr)
+	nep5, addrAsset, atHeight, ok := queryNep5AssetInfo(ctx, tx, regInfo.ScriptHash, adminAddr)
 	if !ok {
 		return "", "", false
 	}
@@ -462,7 +604,8 @@ func handleNep5RegTx(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCode
 	cache.UpdateAssetTotalSupply(nep5.AssetID, nep5.TotalSupply, atHeight)
 
 	nep5StoreChan <- &nep5Store{
-		t: 0,
+		epoch: nep5TxEpoch,
+		t:     0,
 		d: nep5AssetStore{
 			tx:        tx,
 			nep5:      nep5,
@@ -476,22 +619,21 @@ func handleNep5RegTx(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCode
 	return util.GetAddressFromScriptHash(adminAddr), assetID, true
 }
 
-func handleNEP5Migrate(s *nep5Store) uint {
+func (tr *taskRunner) handleNEP5Migrate(s *nep5Store) (uint, error) {
 	d, ok := s.d.(nep5MigrateStore)
 	if !ok {
-		err := fmt.Errorf("err nep5 migrate store type %d: %+v", s.t, s.d)
-		panic(err)
+		return 0, fmt.Errorf("err nep5 migrate store type %d: %+v", s.t, s.d)
 	}
 
-	err := db.HandleNEP5Migrate(d.newAssetAdmin, d.oldAssetID, d.newAssetID, d.txPK)
+	err := tr.store.HandleNEP5Migrate(d.newAssetAdmin, d.oldAssetID, d.newAssetID, d.txPK)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
-	return d.txPK
+	return d.txPK, nil
 }
 
-func handleNep5NonTxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCodeDataStack *smartcontract.DataStack) {
+func (tr *taskRunner) handleNep5NonTxCall(ctx context.Context, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, opCodeDataStack *smartcontract.DataStack) {
 	// At least two commands are required(opCode and its related data).
 	for len(*opCodeDataStack) >= 2 {
 		opCode, data := opCodeDataStack.PopItem()
@@ -512,17 +654,17 @@ func handleNep5NonTxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, op
 		}
 
 		// Query totalSupply and caller's balance.
-		callerAddr, ok := getCallerAddr(tx)
+		callerAddr, ok := tr.getCallerAddr(tx)
 		if !ok {
 			continue
 		}
 
-		totalSupply, ok := queryNep5TotalSupply(tx.BlockIndex, tx.BlockTime, scriptHash)
+		totalSupply, ok := queryNep5TotalSupply(ctx, tx.BlockIndex, tx.BlockTime, scriptHash)
 		if !ok {
 			continue
 		}
 
-		callerBalance, ok := queryCallerBalance(tx.BlockIndex, tx.BlockTime, scriptHash, callerAddr)
+		callerBalance, ok := tr.queryCallerBalance(ctx, tx.BlockIndex, tx.BlockTime, scriptHash, callerAddr)
 		if !ok || callerBalance.Cmp(big.NewFloat(0)) != 1 {
 			continue
 		}
@@ -536,7 +678,8 @@ func handleNep5NonTxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, op
 		}
 
 		nep5StoreChan <- &nep5Store{
-			t: 2,
+			epoch: nep5TxEpoch,
+			t:     2,
 			d: nep5BalanceTSStore{
 				txPK:        tx.ID,
 				blockTime:   tx.BlockTime,
@@ -550,7 +693,7 @@ func handleNep5NonTxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, op
 	}
 }
 
-func handleNep5TxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, notifs []rpc.RawNotifications, applogIdx int) {
+func (tr *taskRunner) handleNep5TxCall(ctx context.Context, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, notifs []rpc.RawNotifications, applogIdx int) {
 	// Get all transfers.
 	for applogIdx++; applogIdx < len(notifs); applogIdx++ {
 		notification := notifs[applogIdx]
@@ -596,11 +739,11 @@ func handleNep5TxCall(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, notif
 			continue
 		}
 
-		recordNep5Transfer(nep5StoreChan, tx, assetID, fromSc, toSc, val, valType, applogIdx)
+		tr.recordNep5Transfer(ctx, nep5StoreChan, tx, assetID, fromSc, toSc, val, valType, applogIdx)
 	}
 }
 
-func recordNep5Transfer(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, assetID string, fromSc string, toSc string, val string, valType string, applogIdx int) {
+func (tr *taskRunner) recordNep5Transfer(ctx context.Context, nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, assetID string, fromSc string, toSc string, val string, valType string, applogIdx int) {
 	scriptHash := util.GetScriptHashFromAssetID(assetID)
 
 	assetId, err := cache.GetAssetId(assetID)
@@ -624,7 +767,7 @@ func recordNep5Transfer(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, ass
 	}
 
 	// Get nep5 asset balance of this two addresses.
-	balances, ok := queryBalances(tx.BlockIndex, scriptHash, assetId, [][]byte{from, to})
+	balances, ok := tr.queryBalances(ctx, tx.BlockIndex, scriptHash, assetId, [][]byte{from, to})
 	if !ok {
 		return
 	}
@@ -635,11 +778,12 @@ func recordNep5Transfer(nep5StoreChan chan<- *nep5Store, tx *tx.Transaction, ass
 	// Handle possibility of storage injection attack.
 	var totalSupply *big.Float
 	if toSc == "746f74616c537570706c79" {
-		totalSupply, _ = queryNep5TotalSupply(tx.BlockIndex, tx.BlockTime, scriptHash)
+		totalSupply, _ = queryNep5TotalSupply(ctx, tx.BlockIndex, tx.BlockTime, scriptHash)
 	}
 
 	nep5StoreChan <- &nep5Store{
-		t: 1,
+		epoch: nep5TxEpoch,
+		t:     1,
 		d: nep5TxStore{
 			tx:            tx,
 			applogIdx:     applogIdx,
@@ -694,8 +838,8 @@ func extractValue(val interface{}, valType string) (*big.Float, bool) {
 	}
 }
 
-func getCallerAddr(tx *tx.Transaction) ([]byte, bool) {
-	txScrpits, err := db.GetTxScripts(tx.ID)
+func (tr *taskRunner) getCallerAddr(tx *tx.Transaction) ([]byte, bool) {
+	txScrpits, err := tr.store.GetTxScripts(tx.ID)
 	if err != nil {
 		panic(err)
 	}
@@ -727,7 +871,7 @@ func isNep5MigrateTx(script string) bool {
 	return strings.Contains(script, keyword)
 }
 
-func queryNep5AssetInfo(tx *tx.Transaction, scriptHash []byte, addrBytes []byte) (*nep5.Nep5, *addr.Asset, uint, bool) {
+func queryNep5AssetInfo(ctx context.Context, tx *tx.Transaction, scriptHash []byte, addrBytes []byte) (*nep5.Nep5, *addr.Asset, uint, bool) {
 	assetID := util.GetAssetIDFromScriptHash(scriptHash)
 	adminAddr := util.GetAddressFromScriptHash(addrBytes)
 
@@ -743,7 +887,7 @@ func queryNep5AssetInfo(tx *tx.Transaction, scriptHash []byte, addrBytes []byte)
 	scripts += createSCSB(scriptHash, "balanceOf", [][]byte{addrBytes})
 
 	minHeight := getMinHeight(tx.BlockIndex)
-	result := rpc.SmartContractRPCCall(minHeight, scripts)
+	result := rpc.SmartContractRPCCall(ctx, minHeight, scripts)
 	if result == nil || strings.Contains(result.State, "FAULT") {
 		return nil, nil, 0, false
 	}
@@ -851,7 +995,7 @@ func createSCSB(scriptHash []byte, method string, params [][]byte) string {
 	return scsb.GetScript()
 }
 
-func queryCallerBalance(txBlockIndex uint, blockTime uint64, scriptHash []byte, callerAddrBytes []byte) (*big.Float, bool) {
+func (tr *taskRunner) queryCallerBalance(ctx context.Context, txBlockIndex uint, blockTime uint64, scriptHash []byte, callerAddrBytes []byte) (*big.Float, bool) {
 	assetID := util.GetAssetIDFromScriptHash(scriptHash)
 	callerAddr := util.GetAddressFromScriptHash(callerAddrBytes)
 
@@ -860,7 +1004,7 @@ func queryCallerBalance(txBlockIndex uint, blockTime uint64, scriptHash []byte,
 		panic(err)
 	}
 	// Query from cache.
-	addrId, err := db.GetVoutAddrID(callerAddr)
+	addrId, err := tr.store.GetVoutAddrID(callerAddr)
 	if err != nil {
 		panic(err)
 	}
@@ -879,7 +1023,7 @@ func queryCallerBalance(txBlockIndex uint, blockTime uint64, scriptHash []byte,
 	scripts := createSCSB(scriptHash, "balanceOf", [][]byte{callerAddrBytes})
 
 	minHeight := rpc.BestHeight.Get()
-	result := rpc.SmartContractRPCCall(minHeight, scripts)
+	result := rpc.SmartContractRPCCall(ctx, minHeight, scripts)
 	if result == nil ||
 		strings.Contains(result.State, "FAULT") ||
 		result.Stack == nil ||
@@ -896,7 +1040,7 @@ func queryCallerBalance(txBlockIndex uint, blockTime uint64, scriptHash []byte,
 	return callerBalance, true
 }
 
-func queryBalances(txBlockIndex uint, scriptHash []byte, assetId uint, addrBytesList [][]byte) ([]*big.Float, bool) {
+func (tr *taskRunner) queryBalances(ctx context.Context, txBlockIndex uint, scriptHash []byte, assetId uint, addrBytesList [][]byte) ([]*big.Float, bool) {
 	// Check if this is a valid assetID.
 	if _, ok := nep5AssetDecimals[assetId]; !ok {
 		return nil, false
@@ -912,7 +1056,7 @@ func queryBalances(txBlockIndex uint, scriptHash []byte, assetId uint, addrBytes
 		} else {
 			// Check cached value.
 			addr := util.GetAddressFromScriptHash(addrBytes)
-			addrId, err := db.GetVoutAddrID(addr)
+			addrId, err := tr.store.GetVoutAddrID(addr)
 			if err != nil {
 				panic(err)
 			}
@@ -930,7 +1074,7 @@ func queryBalances(txBlockIndex uint, scriptHash []byte, assetId uint, addrBytes
 	}
 
 	minHeight := rpc.BestHeight.Get()
-	result := rpc.SmartContractRPCCall(minHeight, scsb)
+	result := rpc.SmartContractRPCCall(ctx, minHeight, scsb)
 
 	// If this nep5 asset is broken(for example forgot to check 'need storage').
 	if result == nil || strings.Contains(result.State, "FAULT") {
@@ -957,7 +1101,7 @@ func queryBalances(txBlockIndex uint, scriptHash []byte, assetId uint, addrBytes
 	return balances, true
 }
 
-func queryNep5TotalSupply(txBlockIndex uint, blockTime uint64, scriptHash []byte) (*big.Float, bool) {
+func queryNep5TotalSupply(ctx context.Context, txBlockIndex uint, blockTime uint64, scriptHash []byte) (*big.Float, bool) {
 	assetID := util.GetAssetIDFromScriptHash(scriptHash)
 
 	assetId, err := cache.GetAssetId(assetID)
@@ -978,7 +1122,7 @@ func queryNep5TotalSupply(txBlockIndex uint, blockTime uint64, scriptHash []byte
 
 	totalSupplyScsb := createSCSB(scriptHash, "totalSupply", nil)
 	minHeight := rpc.BestHeight.Get()
-	result := rpc.SmartContractRPCCall(minHeight, totalSupplyScsb)
+	result := rpc.SmartContractRPCCall(ctx, minHeight, totalSupplyScsb)
 	if result == nil || strings.Contains(result.State, "FAULT") {
 		return nil, false
 	}
@@ -1028,16 +1172,18 @@ func getReadableValue(assetId uint, balance *big.Float) *big.Float {
 
 	decimals, ok := nep5AssetDecimals[assetId]
 	if !ok {
-		panic("Failed to get decimals of nep5 asset: " + string(assetId))
+		panic(fmt.Sprintf("Failed to get decimals of nep5 asset: %d", assetId))
 	}
 
 	return new(big.Float).Quo(balance, big.NewFloat(math.Pow10(int(decimals))))
 }
 
-func showNep5Progress(txPk uint) {
+func (tr *taskRunner) showNep5Progress(txPk uint) {
+	taskTxPkGauge.With(nep5Task).Set(float64(txPk))
+
 	if maxNep5PK == 0 || Nep5MaxPkShouldRefresh {
 		Nep5MaxPkShouldRefresh = false
-		maxNep5PK = db.GetMaxNonEmptyScriptTxPk()
+		maxNep5PK = tr.store.GetMaxNonEmptyScriptTxPk()
 	}
 
 	now := time.Now()
@@ -1060,16 +1206,6 @@ func showNep5Progress(txPk uint) {
 		maxNep5PK,
 		nProgress.Percentage)
 	nProgress.LastOutputTime = now
-
-	// Send mail if fully synced
-	if nProgress.Finished {
-		// If sync lasts shortly, do not send mail
-		if time.Since(nProgress.InitTime) < time.Minute*5 {
-			return
-		}
-
-		fmt.Sprintf("Init time: %v\nEnd Time: %v\n", nProgress.InitTime, time.Now())
-	}
 }
 
 func getMinHeight(blockHeight uint) int {
@@ -0,0 +1,181 @@
+package tasks
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"neo_explorer/core/util"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/nep5"
+	"neo_explorer/neo/rpc"
+	"neo_explorer/neo/smartcontract"
+	"strings"
+	"time"
+)
+
+// invokeScript runs scripts on a rpc server whose height >= minHeight, replaced in tests.
+var invokeScript = rpc.SmartContractRPCCall
+
+// runNep5ReconcileTask reconciles nep5 balances with contract state every 'nep5_reconcile.interval'.
+func (tr *taskRunner) runNep5ReconcileTask(ctx context.Context) error {
+	return runPeriodically(ctx,
+		func() time.Duration { return config.GetNep5Reconcile().Interval },
+		func() error { return tr.reconcileNep5(ctx, config.GetNep5Reconcile().BatchSize) })
+}
+
+// reconcileNep5 queries balanceOf of every known holder and totalSupply of every nep5 contract,
+// and corrects the stored values which differ.
+func (tr *taskRunner) reconcileNep5(ctx context.Context, batchSize int) error {
+	start := time.Now()
+
+	contracts, err := tr.store.GetNep5Contracts()
+	if err != nil {
+		return err
+	}
+
+	corrections := 0
+	for _, c := range contracts {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		r, err := tr.reconcileNep5Contract(ctx, c, batchSize)
+		if err != nil {
+			return err
+		}
+		if r == nil {
+			continue
+		}
+
+		corrections += len(r.Corrections)
+		logNep5Reconciliation(c, r)
+	}
+
+	log.Printf("Reconciled %d nep5 contracts in %s, corrected %d values\n", len(contracts), time.Since(start), corrections)
+	return nil
+}
+
+// reconcileNep5Contract returns nil if the contract can not be queried or ctx is done.
+func (tr *taskRunner) reconcileNep5Contract(ctx context.Context, c *db.Nep5Contract, batchSize int) (*db.Nep5Reconciliation, error) {
+	regInfo, ok := nep5.GetNep5RegInfo(c.TxId, smartcontract.ReadScript(c.Script))
+	if !ok {
+		log.Error.Printf("Failed to get script hash of nep5 %s from registration tx pk %d\n", c.Symbol, c.TxId)
+		return nil, nil
+	}
+
+	holders, err := tr.store.GetNep5Holders(c.AssetId)
+	if err != nil {
+		return nil, err
+	}
+
+	minHeight := rpc.BestHeight.Get()
+
+	addrs := make([][]byte, len(holders))
+	for i, h := range holders {
+		addrs[i] = util.GetScriptHashFromAddress(h.Address)
+	}
+
+	balances := make([]*big.Float, 0, len(holders))
+	for start := 0; start < len(addrs); start += batchSize {
+		end := start + batchSize
+		if end > len(addrs) {
+			end = len(addrs)
+		}
+
+		balances = append(balances, queryNep5BalancesAt(ctx, minHeight, regInfo.ScriptHash, c.Decimals, addrs[start:end])...)
+	}
+
+	totalSupply := queryNep5ValueAt(ctx, minHeight, createSCSB(regInfo.ScriptHash, "totalSupply", nil), c.Decimals)
+	// Values of cancelled queries are missing, not failed.
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	if totalSupply == nil {
+		log.Error.Printf("Failed to query total supply of nep5 %s\n", c.Symbol)
+	}
+
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
+	return tr.store.ReconcileNep5(c, holders, balances, totalSupply, uint(minHeight))
+}
+
+// queryNep5BalancesAt calls balanceOf of all addresses in one script.
+// If the script fails, every address is queried alone, balances failed to query are nil.
+func queryNep5BalancesAt(ctx context.Context, minHeight int, scriptHash []byte, decimals uint8, addrs [][]byte) []*big.Float {
+	balances := make([]*big.Float, len(addrs))
+
+	script := ""
+	for _, addrBytes := range addrs {
+		script += createNep5BalanceSCSB(scriptHash, addrBytes)
+	}
+
+	result := invokeScript(ctx, minHeight, script)
+	if result != nil && !strings.Contains(result.State, "FAULT") && len(result.Stack) == len(addrs) {
+		for i, stack := range result.Stack {
+			balances[i] = readableNep5Value(stack, decimals)
+		}
+
+		return balances
+	}
+
+	if len(addrs) == 1 {
+		return balances
+	}
+
+	for i, addrBytes := range addrs {
+		balances[i] = queryNep5ValueAt(ctx, minHeight, createNep5BalanceSCSB(scriptHash, addrBytes), decimals)
+	}
+
+	return balances
+}
+
+// queryNep5ValueAt returns the first value returned by script, or nil if the script fails.
+func queryNep5ValueAt(ctx context.Context, minHeight int, script string, decimals uint8) *big.Float {
+	result := invokeScript(ctx, minHeight, script)
+	if result == nil || strings.Contains(result.State, "FAULT") || len(result.Stack) == 0 {
+		return nil
+	}
+
+	return readableNep5Value(result.Stack[0], decimals)
+}
+
+func readableNep5Value(stack rpc.RawStack, decimals uint8) *big.Float {
+	value, ok := extractValue(stack.Value, stack.Type)
+	if !ok {
+		return nil
+	}
+
+	return new(big.Float).Quo(value, big.NewFloat(math.Pow10(int(decimals))))
+}
+
+func logNep5Reconciliation(c *db.Nep5Contract, r *db.Nep5Reconciliation) {
+	for i, m := range r.Corrections {
+		if i == maxLoggedMismatches {
+			log.Printf("... %d more corrections of nep5 %s\n", len(r.Corrections)-i, c.Symbol)
+			break
+		}
+
+		if m.AddressId == 0 {
+			log.Printf("Corrected total supply of nep5 %s at height %d: %s -> %s\n",
+				c.Symbol, r.BlockIndex, m.Old.Text('f', 8), m.New.Text('f', 8))
+			continue
+		}
+		log.Printf("Corrected balance of %s for nep5 %s at height %d: %s -> %s\n",
+			m.Address, c.Symbol, r.BlockIndex, m.Old.Text('f', 8), m.New.Text('f', 8))
+	}
+
+	if r.Skipped > 0 {
+		log.Printf("Skipped %d holders of nep5 %s whose balances changed during reconciliation\n", r.Skipped, c.Symbol)
+	}
+
+	for _, m := range r.Corrections {
+		if m.AddressId == 0 {
+			nep5Corrections.With("total_supply").Inc()
+		} else {
+			nep5Corrections.With("balance").Inc()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"context"
+	"neo_explorer/neo/rpc"
+	"strings"
+	"testing"
+)
+
+func TestQueryNep5BalancesAt(t *testing.T) {
+	scriptHash := make([]byte, 20)
+	good := []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
+	bad := []byte{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+	goodScript := createNep5BalanceSCSB(scriptHash, good)
+
+	calls := 0
+	invokeScript = func(ctx context.Context, minHeight int, script string) *rpc.RawSmartContractCallResult {
+		calls++
+
+		// balanceOf of the bad address faults.
+		if script != goodScript {
+			return &rpc.RawSmartContractCallResult{State: "HALT, BREAK, FAULT"}
+		}
+
+		return &rpc.RawSmartContractCallResult{
+			State: "HALT, BREAK",
+			Stack: []rpc.RawStack{{Type: "ByteArray", Value: "00e1f505"}},
+		}
+	}
+	defer func() { invokeScript = rpc.SmartContractRPCCall }()
+
+	balances := queryNep5BalancesAt(context.Background(), 0, scriptHash, 8, [][]byte{good, bad})
+	if calls != 3 {
+		t.Errorf("invoked %d scripts, want the batch and 2 single ones", calls)
+	}
+	if len(balances) != 2 || balances[0] == nil || balances[0].Text('f', 8) != "1.00000000" || balances[1] != nil {
+		t.Errorf("balances = %v, want [1 nil]", balances)
+	}
+
+	if !strings.HasPrefix(goodScript, "14"+strings.Repeat("01", 20)) {
+		t.Errorf("balanceOf script = %s, want address pushed first", goodScript)
+	}
+}
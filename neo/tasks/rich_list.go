@@ -0,0 +1,38 @@
+package tasks
+
+import (
+	"context"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"time"
+)
+
+// runRichListTask recomputes rich lists and distributions of all assets every 'rich_list.interval'.
+func (tr *taskRunner) runRichListTask(ctx context.Context) error {
+	return runPeriodically(ctx,
+		func() time.Duration { return config.GetRichList().Interval },
+		func() error { return tr.updateRichLists(ctx, config.GetRichList().Top) })
+}
+
+// updateRichLists recomputes the top holders and the distribution of every asset.
+func (tr *taskRunner) updateRichLists(ctx context.Context, top int) error {
+	start := time.Now()
+
+	assetIds, err := tr.store.GetRichListAssets()
+	if err != nil {
+		return err
+	}
+
+	for _, assetId := range assetIds {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if _, err := tr.store.UpdateRichList(assetId, top); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Updated rich lists of %d assets in %s\n", len(assetIds), time.Since(start))
+	return nil
+}
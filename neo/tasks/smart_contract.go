@@ -1,18 +1,18 @@
 /*
-To restart this task from beginning, execute the following sqls:
+To restart this task from beginning, stop the explorer and run:
 
-UPDATE `counter` SET `last_tx_pk_for_sc` = 0 WHERE `id` = 1 LIMIT 1;
-TRUNCATE TABLE `smartcontract_info`;
+	neo_explorer reset --task sc
+
+`neo_explorer rewind --task sc --to-tx-pk N` restarts it after transaction N.
 
 */
 
 package tasks
 
 import (
-	"fmt"
+	"context"
 	"math/big"
 	"neo_explorer/core/log"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/nep5"
 	"neo_explorer/neo/smartcontract"
 	"strings"
@@ -31,6 +31,7 @@ var (
 type scStore struct {
 	scriptInfoList []scriptInfo
 	txPK           uint
+	epoch          int
 }
 
 type scriptInfo struct {
@@ -38,20 +39,31 @@ type scriptInfo struct {
 	script string
 }
 
-func startSCTask() {
+func (tr *taskRunner) runSCTask(ctx context.Context) error {
 	scTxChan := make(chan scStore)
 
-	lastPk := db.GetLastTxPkForSC()
+	lastPk := tr.store.GetLastTxPkForSC()
 
-	go fetchSCTx(scTxChan, lastPk)
-	go handleScTx(scTxChan)
+	return runAll(ctx,
+		func(ctx context.Context) error {
+			tr.fetchSCTx(ctx, scTxChan, lastPk)
+			return nil
+		},
+		func(ctx context.Context) error { return tr.handleScTx(ctx, scTxChan) },
+	)
 }
 
-func fetchSCTx(scTxChan chan<- scStore, lastPk uint) {
+func (tr *taskRunner) fetchSCTx(ctx context.Context, scTxChan chan<- scStore, lastPk uint) {
+	epoch := chainEpoch.Get()
 	nextTxPK := lastPk + 1
 
 	for {
-		txs := db.GetInvocationTxs(nextTxPK, 1000)
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			nextTxPK = tr.store.GetLastTxPkForSC() + 1
+		}
+
+		txs := tr.store.GetInvocationTxs(nextTxPK, 1000)
 
 		for i := len(txs) - 1; i >= 0; i-- {
 			// cannot be app call
@@ -62,7 +74,9 @@ func fetchSCTx(scTxChan chan<- scStore, lastPk uint) {
 		}
 
 		if len(txs) == 0 {
-			time.Sleep(2 * time.Second)
+			if !sleep(ctx, 2*time.Second) {
+				return
+			}
 			continue
 		}
 
@@ -76,25 +90,50 @@ func fetchSCTx(scTxChan chan<- scStore, lastPk uint) {
 			})
 		}
 
-		scTxChan <- scStore{
+		info := scStore{
 			scriptInfoList: scriptInfoList,
 			txPK:           txs[len(txs)-1].ID + 1,
+			epoch:          epoch,
+		}
+
+		select {
+		case scTxChan <- info:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-func handleScTx(scTxChan <-chan scStore) {
-	for scInfo := range scTxChan {
-		scRegInfos := filterSC(scInfo.scriptInfoList)
-		if len(scRegInfos) > 0 {
-			db.InsertSCInfos(scRegInfos, scInfo.txPK)
+func (tr *taskRunner) handleScTx(ctx context.Context, scTxChan <-chan scStore) error {
+	for {
+		var scInfo scStore
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case scInfo = <-scTxChan:
+		}
+
+		var err error
+
+		applied := applyInEpoch(scInfo.epoch, func() {
+			var scRegInfos []*nep5.RegInfo
+			scRegInfos, err = filterSC(scInfo.scriptInfoList)
+			if err == nil && len(scRegInfos) > 0 {
+				err = tr.store.InsertSCInfos(scRegInfos, scInfo.txPK)
+			}
+		})
+		if err != nil {
+			return err
 		}
 
-		showSCProgress(scInfo.txPK)
+		if applied {
+			tr.showSCProgress(scInfo.txPK)
+		}
 	}
 }
 
-func filterSC(list []scriptInfo) []*nep5.RegInfo {
+func filterSC(list []scriptInfo) ([]*nep5.RegInfo, error) {
 	result := []*nep5.RegInfo{}
 
 	for _, info := range list {
@@ -104,26 +143,38 @@ func filterSC(list []scriptInfo) []*nep5.RegInfo {
 			continue
 		}
 
-		opCodeDataStack := smartcontract.ReadScript(info.script)
-		if opCodeDataStack == nil || len(*opCodeDataStack) == 0 {
+		if isQuarantined(scTask, info.txId) {
 			continue
 		}
 
-		regInfo, ok := nep5.GetNep5RegInfo(info.txId, opCodeDataStack.Copy())
-		if !ok {
-			continue
-		}
+		err := handleTxPk(info.txId, func() error {
+			opCodeDataStack := smartcontract.ReadScript(info.script)
+			if opCodeDataStack == nil || len(*opCodeDataStack) == 0 {
+				return nil
+			}
 
-		result = append(result, regInfo)
+			regInfo, ok := nep5.GetNep5RegInfo(info.txId, opCodeDataStack.Copy())
+			if ok {
+				result = append(result, regInfo)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return result
+	return result, nil
 }
 
-func showSCProgress(txPk uint) {
+func (tr *taskRunner) showSCProgress(txPk uint) {
+	// txPk is the next pk to handle.
+	taskTxPkGauge.With(scTask).Set(float64(txPk - 1))
+
 	if maxScPK == 0 || scMaxPkShouldRefresh {
 		scMaxPkShouldRefresh = false
-		maxScPK = db.GetMaxNonEmptyScriptTxPk()
+		maxScPK = tr.store.GetMaxNonEmptyScriptTxPk()
 	}
 
 	now := time.Now()
@@ -146,14 +197,4 @@ func showSCProgress(txPk uint) {
 		maxScPK,
 		scProgress.Percentage)
 	scProgress.LastOutputTime = now
-
-	// Send mail if fully synced
-	if scProgress.Finished {
-		// If sync lasts shortly, do not send mail
-		if time.Since(scProgress.InitTime) < time.Minute*5 {
-			return
-		}
-
-		fmt.Sprintf("Init time: %v\nEnd Time: %v\n", scProgress.InitTime, time.Now())
-	}
 }
@@ -0,0 +1,219 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"neo_explorer/core/log"
+	"sync"
+	"time"
+)
+
+// maxTxFailures is how many times a task may fail on the same transaction
+// before the transaction is quarantined.
+const maxTxFailures = 3
+
+var (
+	// Bounds of the backoff before restarting a failed task.
+	minRestartDelay = time.Second
+	maxRestartDelay = 5 * time.Minute
+)
+
+// Names of supervised tasks, also used in the `task_error` table.
+const (
+	blockTask          = "block"
+	txTask             = "tx"
+	assetTxTask        = "asset_tx"
+	balanceHistoryTask = "balance_history"
+	scTask             = "sc"
+	nep5Task           = "nep5"
+	nep5AddrTxTask     = "nep5_addr_tx"
+	verifyTask         = "verify"
+	nep5ReconcileTask  = "nep5_reconcile"
+	claimsTask         = "claims"
+	richListTask       = "rich_list"
+	dailyStatsTask     = "daily_stats"
+	webhookTask        = "webhook"
+)
+
+// cacheTasks change cached balances of addresses inside db transactions,
+// the cache is reloaded before they restart so that changes of rolled back db transactions are dropped.
+// The block task reloads its pk counters itself when it starts.
+var cacheTasks = map[string]bool{
+	txTask:            true,
+	nep5Task:          true,
+	nep5ReconcileTask: true,
+	verifyTask:        true,
+}
+
+// txFailure is returned by tasks which failed to handle a transaction.
+type txFailure struct {
+	pk  uint
+	err error
+}
+
+func (f *txFailure) Error() string {
+	return fmt.Sprintf("tx pk %d: %v", f.pk, f.err)
+}
+
+// quarantined holds pks of transactions skipped by each task.
+var quarantined = struct {
+	sync.RWMutex
+	pks map[string]map[uint]bool
+}{pks: make(map[string]map[uint]bool)}
+
+// supervise runs task until ctx is done.
+// Every time the task fails, it is restarted after an exponential backoff
+// and resumes from its counters. Transactions failing repeatedly are quarantined.
+func (tr *taskRunner) supervise(ctx context.Context, name string, task func(ctx context.Context) error) {
+	tr.loadQuarantined(name)
+
+	delay := minRestartDelay
+	failures := make(map[uint]int)
+
+	for {
+		started := time.Now()
+		err := protect(func() error { return task(ctx) })
+		if err != nil {
+			log.Error.Printf("Task %s failed: %v\n", name, err)
+		}
+		if ctx.Err() != nil || err == nil {
+			return
+		}
+
+		if f, ok := err.(*txFailure); ok {
+			failures[f.pk]++
+			if failures[f.pk] >= maxTxFailures {
+				tr.quarantine(name, f)
+				delete(failures, f.pk)
+			}
+		}
+
+		// The task has been running well for a while.
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		if cacheTasks[name] {
+			tr.reloadAddrCache()
+		}
+
+		taskRestarts.With(name).Inc()
+		log.Printf("Restart task %s in %s\n", name, delay)
+		if !sleep(ctx, delay) {
+			return
+		}
+
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
+
+// runAll runs all fns concurrently and waits for them to return.
+// The first error cancels the others and is returned.
+func runAll(ctx context.Context, fns ...func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(fns))
+	for _, fn := range fns {
+		go func(fn func(ctx context.Context) error) {
+			errs <- protect(func() error { return fn(ctx) })
+		}(fn)
+	}
+
+	var first error
+	for range fns {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			cancel()
+		}
+	}
+
+	return first
+}
+
+// protect turns panic of fn into an error.
+func protect(fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if e, ok := p.(error); ok {
+				err = e
+				return
+			}
+
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	return fn()
+}
+
+// handleTxPk handles the transaction with fn,
+// failures are returned as *txFailure so that the transaction can be quarantined.
+func handleTxPk(pk uint, fn func() error) error {
+	if err := protect(fn); err != nil {
+		return &txFailure{pk: pk, err: err}
+	}
+
+	return nil
+}
+
+// isQuarantined returns true if the task should skip the transaction.
+func isQuarantined(task string, pk uint) bool {
+	quarantined.RLock()
+	defer quarantined.RUnlock()
+
+	return quarantined.pks[task][pk]
+}
+
+func (tr *taskRunner) quarantine(task string, f *txFailure) {
+	log.Error.Printf("Task %s failed on tx pk %d %d times, quarantined: %v\n", task, f.pk, maxTxFailures, f.err)
+
+	quarantinedTxs.With(task).Inc()
+
+	if err := tr.store.QuarantineTx(task, f.pk, f.err.Error()); err != nil {
+		log.Error.Println(err)
+	}
+
+	quarantined.Lock()
+	defer quarantined.Unlock()
+
+	if quarantined.pks[task] == nil {
+		quarantined.pks[task] = make(map[uint]bool)
+	}
+	quarantined.pks[task][f.pk] = true
+}
+
+// loadQuarantined reloads quarantined transactions of the task from db.
+func (tr *taskRunner) loadQuarantined(task string) {
+	pks, err := tr.store.GetQuarantinedTxs(task)
+	if err != nil {
+		panic(err)
+	}
+
+	quarantined.Lock()
+	defer quarantined.Unlock()
+
+	quarantined.pks[task] = pks
+}
+
+// forgetQuarantined drops quarantined transactions whose pk >= firstPk,
+// they have been removed by rollback and their pks will be reused.
+func forgetQuarantined(firstPk uint) {
+	if firstPk == 0 {
+		return
+	}
+
+	quarantined.Lock()
+	defer quarantined.Unlock()
+
+	for _, pks := range quarantined.pks {
+		for pk := range pks {
+			if pk >= firstPk {
+				delete(pks, pk)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	stdlog "log"
+	"math/big"
+	"neo_explorer/core/cache"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/addr"
+	"neo_explorer/neo/tx"
+	"testing"
+	"time"
+)
+
+// failingStore fails to apply the transaction of pk bad,
+// after changing the cached balance of address 1 like a db transaction rolled back halfway.
+type failingStore struct {
+	fakeStore
+	bad         uint
+	quarantined []uint
+}
+
+func (s *failingStore) ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.TransactionVout) error {
+	if t.ID == s.bad {
+		if item, ok := cache.GetAddrAsset(1, 1); ok {
+			item.AddBalance(big.NewFloat(5), t.BlockIndex)
+		}
+		return errors.New("bad transaction")
+	}
+
+	return s.fakeStore.ApplyVinsVouts(t, vins, vouts)
+}
+
+func (s *failingStore) QuarantineTx(task string, txPk uint, reason string) error {
+	s.quarantined = append(s.quarantined, txPk)
+	return nil
+}
+
+func (s *failingStore) GetQuarantinedTxs(task string) (map[uint]bool, error) {
+	return map[uint]bool{}, nil
+}
+
+func (s *failingStore) GetAddrAssetInfo() []*addr.AssetInfo {
+	return []*addr.AssetInfo{{AddressId: 1, Address: "AddrA", AssetId: 1, Balance: big.NewFloat(10)}}
+}
+
+func TestRunAll(t *testing.T) {
+	err := runAll(context.Background(),
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		func(ctx context.Context) error {
+			panic("boom")
+		},
+	)
+
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("runAll() = %v, want boom", err)
+	}
+}
+
+func TestSuperviseQuarantinesFailingTx(t *testing.T) {
+	log.Log = stdlog.New(ioutil.Discard, "", 0)
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	store := &failingStore{bad: 2}
+	tr := &taskRunner{store: store}
+
+	minRestartDelay = time.Millisecond
+	defer func() { minRestartDelay = time.Second }()
+
+	cache.LoadAddrAssetInfo(store.GetAddrAssetInfo())
+
+	runs := 0
+	task := func(ctx context.Context) error {
+		runs++
+
+		txChan := make(chan txInfo, 3)
+		for pk := uint(1); pk <= 3; pk++ {
+			txChan <- txInfo{tx: &tx.Transaction{ID: pk}, epoch: chainEpoch.Get()}
+		}
+		close(txChan)
+
+		return tr.handleTx(ctx, txChan)
+	}
+
+	tr.supervise(context.Background(), txTask, task)
+
+	if runs != maxTxFailures+1 {
+		t.Errorf("task ran %d times, want %d", runs, maxTxFailures+1)
+	}
+	if len(store.quarantined) != 1 || store.quarantined[0] != 2 {
+		t.Errorf("quarantined transactions = %v, want [2]", store.quarantined)
+	}
+	if !isQuarantined(txTask, 2) || isQuarantined(txTask, 3) {
+		t.Errorf("only tx pk 2 should be skipped")
+	}
+	if last := store.applied[len(store.applied)-1]; last != 3 {
+		t.Errorf("last applied transaction = %d, want 3", last)
+	}
+	// Cached changes of the failed transaction are dropped before every restart.
+	if item, _ := cache.GetAddrAsset(1, 1); item.GetBalance().Text('f', 8) != "10.00000000" {
+		t.Errorf("cached balance = %s after restarts, want 10", item.GetBalance().Text('f', 8))
+	}
+
+	forgetQuarantined(2)
+	if isQuarantined(txTask, 2) {
+		t.Errorf("tx pk 2 is still quarantined after rollback")
+	}
+}
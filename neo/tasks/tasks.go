@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
 	"neo_explorer/core/buffer"
 	"neo_explorer/core/cache"
@@ -8,65 +9,140 @@ import (
 	"neo_explorer/core/log"
 	"neo_explorer/neo/db"
 	"neo_explorer/neo/rpc"
+	"sync"
 	"time"
 )
 
-func Run() {
+// running tracks goroutines which Run waits for.
+var running sync.WaitGroup
+
+// taskRunner runs tasks against the store which persists all their data.
+type taskRunner struct {
+	store db.Store
+}
+
+// Run starts all tasks with the given store and blocks until ctx is done
+// and every task has finished its current work.
+func Run(ctx context.Context, store db.Store) {
+	tr := &taskRunner{store: store}
+
 	log.Printf("Init cache.")
 	// Init cache to speed up db queries
-	assetInfo := db.GetAssetInfo()
+	assetInfo := tr.store.GetAssetInfo()
 	cache.LoadAssetsInfo(assetInfo)
 
-	addrAssetInfo := db.GetAddrAssetInfo()
+	addrAssetInfo := tr.store.GetAddrAssetInfo()
 	cache.LoadAddrAssetInfo(addrAssetInfo)
 
-	lastTxPkId = db.GetTxCount()
-	LastAddrPkId.Set(int(db.GetVoutAddrCount()))
-
-	dbHeight := db.GetLastHeight()
-	initTask(dbHeight)
+	if err := tr.store.CheckBalanceHistorySchema(); err != nil {
+		panic(err)
+	}
 
-	// download blocks from network , put in blockBuffer
-	for i := 0; i < config.GetGoroutines(); i++ {
-		go fetchBlock()
+	// Blocks stored before accumulated system fees were recorded.
+	if _, err := tr.store.BackfillBlockSysFees(); err != nil {
+		panic(err)
 	}
 
-	blockChannel = make(chan *rpc.RawBlock, bufferSize)
-	// get from blockBuffer and send blockChannel queue
-	go arrangeBlock(dbHeight, blockChannel)
-	// save to database from blockChannel queue
-	go storeBlock(blockChannel)
+	dbHeight := tr.store.GetLastHeight()
+	initTask(ctx, dbHeight)
 
-	go startNep5Task()
+	// download blocks from network , put in blockBuffer
+	worker.start(ctx, config.GetGoroutines())
 
+	// Each task restarts from its counters if it fails.
+	tr.supervised(ctx, blockTask, tr.runBlockTask)
+	tr.supervised(ctx, nep5Task, tr.runNep5Task)
 	// get utxo/addr_asset/asset from tx
-	go startTxTask()
+	tr.supervised(ctx, txTask, tr.runTxTask)
+	tr.supervised(ctx, nep5AddrTxTask, tr.insertNep5AddrTxRecord)
+	// get asset_tx from tx
+	tr.supervised(ctx, assetTxTask, tr.runAssetTxTask)
+	tr.supervised(ctx, balanceHistoryTask, tr.runBalanceHistoryTask)
+	tr.supervised(ctx, scTask, tr.runSCTask)
+	tr.supervised(ctx, verifyTask, tr.runVerifyTask)
+	tr.supervised(ctx, nep5ReconcileTask, tr.runNep5ReconcileTask)
+	tr.supervised(ctx, claimsTask, tr.runClaimsTask)
+	tr.supervised(ctx, richListTask, tr.runRichListTask)
+	tr.supervised(ctx, dailyStatsTask, tr.runDailyStatsTask)
+	tr.supervised(ctx, webhookTask, tr.runWebhookTask)
+
+	spawn(func() { tick(ctx) })
+
+	running.Wait()
+}
 
-	go startUpdateCounterTask()
+// spawn runs task in a new goroutine which Run waits for.
+func spawn(task func()) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		task()
+	}()
+}
 
-	// get asset_tx from tx
-	go startAssetTxTask()
+// supervised runs task under supervise in a new goroutine which Run waits for.
+func (tr *taskRunner) supervised(ctx context.Context, name string, task func(ctx context.Context) error) {
+	spawn(func() { tr.supervise(ctx, name, task) })
+}
+
+// sleep pauses for d, it returns false at once if ctx is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
 
-	go startGasBalanceTask()
+// scheduleCheckInterval is how often periodic tasks check whether they are due,
+// so that changes of their intervals take effect without restart.
+var scheduleCheckInterval = time.Minute
 
-	go startSCTask()
+// runPeriodically runs job every interval() until ctx is done, the job is paused while interval() is 0.
+func runPeriodically(ctx context.Context, interval func() time.Duration, job func() error) error {
+	last := time.Now()
 
-	go tick()
+	for {
+		if !sleep(ctx, scheduleCheckInterval) {
+			return nil
+		}
+
+		d := interval()
+		if d == 0 || time.Since(last) < d {
+			continue
+		}
+
+		last = time.Now()
+		if err := job(); err != nil {
+			return err
+		}
+	}
 }
 
-func initTask(dbHeight int) {
+func initTask(ctx context.Context, dbHeight int) {
 	blockBuffer = buffer.NewBuffer(dbHeight)
-	bestHeight := rpc.RefreshServers()
+	bestHeight := rpc.RefreshServers(ctx)
 
 	log.Printf("Current params for block persistance:\n")
 	log.Printf("\tdb block height = %d\n", dbHeight)
 	log.Printf("\trpc best height = %d\n", bestHeight)
 }
 
-func tick() {
+func tick(ctx context.Context) {
 	t := time.NewTicker(time.Second * 5)
+	defer t.Stop()
+
 	for {
-		<-t.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
 		fmt.Printf(" ticker blockBuffer Size : %d \n", blockBuffer.Size())
 		fmt.Printf(" ticker assetMap Size : %v,%v \n", cache.AssetMap, cache.AssetPairMap)
 	}
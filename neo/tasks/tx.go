@@ -1,34 +1,18 @@
 /*
-To restart this task from beginning, execute the following sqls:
-
-TRUNCATE TABLE `utxo`;
-DELETE FROM `addr_asset` WHERE LENGTH(`asset_id`) = 66;
-DELETE FROM `addr_tx` WHERE `asset_type` = 'asset';
-UPDATE `counter` SET
-    `last_tx_pk` = 0,
-    `cnt_tx_reg` = 0,
-    `cnt_tx_miner` = 0,
-    `cnt_tx_issue` = 0,
-    `cnt_tx_invocation` = 0,
-    `cnt_tx_contract` = 0,
-    `cnt_tx_claim` = 0,
-    `cnt_tx_publish` = 0,
-	`cnt_tx_enrollment` = 0
-WHERE `id` = 1;
-UPDATE `asset` SET `addresses` = 0, `available` = 0, `transactions` = 0;
-UPDATE `address` SET `trans_asset` = 0;
-TRUNCATE TABLE `asset_tx`;
-UPDATE `counter` SET `last_asset_tx_pk` = 0 WHERE `id` = 1;
+To restart this task from beginning, stop the explorer and run:
+
+	neo_explorer reset --task tx
+
+`neo_explorer rewind --task tx --to-tx-pk N` restarts it after transaction N.
 
 */
 
 package tasks
 
 import (
-	"fmt"
+	"context"
 	"math/big"
 	"neo_explorer/core/log"
-	"neo_explorer/neo/db"
 	"neo_explorer/neo/tx"
 	"strconv"
 	"time"
@@ -48,23 +32,36 @@ type txInfo struct {
 	tx    *tx.Transaction
 	vins  []*tx.TransactionVin
 	vouts []*tx.TransactionVout
+	epoch int
 }
 
-func startTxTask() {
+func (tr *taskRunner) runTxTask(ctx context.Context) error {
 	txChan := make(chan txInfo, txChanSize)
-	nextPK := db.GetLastTxPkCounter() + 1
 
-	go fetchTx(txChan, nextPK)
-	go handleTx(txChan)
+	return runAll(ctx,
+		func(ctx context.Context) error { return tr.fetchTx(ctx, txChan, tr.store.GetLastTxPkCounter) },
+		func(ctx context.Context) error { return tr.handleTx(ctx, txChan) },
+	)
 }
 
-func fetchTx(txChan chan<- txInfo, nextPK uint) {
+// fetchTx sends transactions after the pk returned by lastPk,
+// and restarts from lastPk after blocks rolled back.
+func (tr *taskRunner) fetchTx(ctx context.Context, txChan chan<- txInfo, lastPk func() uint) error {
+	epoch := chainEpoch.Get()
+	nextPK := lastPk() + 1
 
 	for {
-		txs := db.GetTxs(nextPK, 1000, "")
+		if e := chainEpoch.Get(); e != epoch {
+			epoch = e
+			nextPK = lastPk() + 1
+		}
+
+		txs := tr.store.GetTxs(nextPK, 1000, "")
 		if len(txs) == 0 {
 			//log.Printf("Waiting for new transactions...[fetchTx]\n")
-			time.Sleep(2 * time.Second)
+			if !sleep(ctx, 2*time.Second) {
+				return nil
+			}
 			continue
 		}
 
@@ -75,40 +72,73 @@ func fetchTx(txChan chan<- txInfo, nextPK uint) {
 			txIDs = append(txIDs, strconv.Itoa(int(tx.ID)))
 		}
 
-		vinMap, voutMap, err := db.GetVinVout(txIDs)
+		vinMap, voutMap, err := tr.store.GetVinVout(txIDs)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		for _, tx := range txs {
-			txChan <- txInfo{
+			info := txInfo{
 				tx:    tx,
 				vins:  vinMap[tx.ID],
 				vouts: voutMap[tx.ID],
+				epoch: epoch,
+			}
+
+			select {
+			case txChan <- info:
+			case <-ctx.Done():
+				return nil
 			}
 		}
 	}
 }
 
-func handleTx(txChan <-chan txInfo) {
-	for txInfo := range txChan {
+func (tr *taskRunner) handleTx(ctx context.Context, txChan <-chan txInfo) error {
+	for {
+		var txInfo txInfo
+		var ok bool
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case txInfo, ok = <-txChan:
+			if !ok {
+				return nil
+			}
+		}
+
 		tx := txInfo.tx
 		vins := txInfo.vins
 		vouts := txInfo.vouts
 
-		err := db.ApplyVinsVouts(tx, vins, vouts)
+		if isQuarantined(txTask, tx.ID) {
+			continue
+		}
+
+		applied := false
+		err := handleTxPk(tx.ID, func() (err error) {
+			applied = applyInEpoch(txInfo.epoch, func() {
+				err = tr.store.ApplyVinsVouts(tx, vins, vouts)
+			})
+			return err
+		})
 		if err != nil {
-			panic(err)
+			return err
 		}
 
-		showTxProgress(tx.ID)
+		if applied {
+			tr.showTxProgress(tx.ID)
+		}
 	}
 }
 
-func showTxProgress(currentTxPk uint) {
+func (tr *taskRunner) showTxProgress(currentTxPk uint) {
+	taskTxPkGauge.With(txTask).Set(float64(currentTxPk))
+
 	if maxTxPK == 0 || TxMaxPkShouldRefresh {
 		TxMaxPkShouldRefresh = false
-		maxTxPK = db.GetHighestTxPk()
+		maxTxPK = tr.store.GetHighestTxPk()
 	}
 
 	now := time.Now()
@@ -132,14 +162,4 @@ func showTxProgress(currentTxPk uint) {
 		tProgress.Percentage)
 
 	tProgress.LastOutputTime = now
-
-	// Send mail if fully synced.
-	if tProgress.Finished {
-		// If sync lasts shortly, do not send mail.
-		if time.Since(tProgress.InitTime) < time.Minute*5 {
-			return
-		}
-
-		fmt.Sprintf("Init time: %v\nEnd Time: %v\n", tProgress.InitTime, time.Now())
-	}
 }
@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"context"
+	"neo_explorer/neo/db"
+	"neo_explorer/neo/tx"
+	"testing"
+)
+
+// fakeStore records applied transactions without a real database.
+type fakeStore struct {
+	db.Store
+	applied []uint
+}
+
+func (s *fakeStore) ApplyVinsVouts(t *tx.Transaction, vins []*tx.TransactionVin, vouts []*tx.TransactionVout) error {
+	s.applied = append(s.applied, t.ID)
+	return nil
+}
+
+func (s *fakeStore) GetHighestTxPk() uint {
+	return 100
+}
+
+func TestHandleTxDropsStaleEpoch(t *testing.T) {
+	store := &fakeStore{}
+	tr := &taskRunner{store: store}
+
+	epoch := chainEpoch.Get()
+	txChan := make(chan txInfo, 3)
+	txChan <- txInfo{tx: &tx.Transaction{ID: 1}, epoch: epoch}
+	txChan <- txInfo{tx: &tx.Transaction{ID: 2}, epoch: epoch - 1}
+	txChan <- txInfo{tx: &tx.Transaction{ID: 3}, epoch: epoch}
+	close(txChan)
+
+	tr.handleTx(context.Background(), txChan)
+
+	if len(store.applied) != 2 || store.applied[0] != 1 || store.applied[1] != 3 {
+		t.Errorf("applied transactions = %v, want [1 3]", store.applied)
+	}
+}
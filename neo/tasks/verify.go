@@ -0,0 +1,83 @@
+package tasks
+
+import (
+	"context"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"time"
+)
+
+// maxLoggedMismatches limits mismatches logged by one verification.
+const maxLoggedMismatches = 20
+
+// runVerifyTask verifies balances every 'verify.interval', and repairs them if 'verify.repair' is set.
+func (tr *taskRunner) runVerifyTask(ctx context.Context) error {
+	return runPeriodically(ctx,
+		func() time.Duration { return config.GetVerify().Interval },
+		func() error {
+			_, err := tr.verifyBalances(config.GetVerify().Repair)
+			return err
+		})
+}
+
+// verifyBalances compares balances in db and cache with utxo.
+// Mismatches found by the scan are checked again while no task is writing,
+// since balances may change during the scan.
+func (tr *taskRunner) verifyBalances(repair bool) (*db.VerifyReport, error) {
+	start := time.Now()
+
+	report, err := tr.store.VerifyBalances(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.OK() {
+		chainLock.Lock()
+		report, err = tr.store.RecheckBalances(report, true)
+		if err == nil && repair && !report.OK() {
+			var repaired int
+			repaired, err = tr.store.RepairBalances(report)
+			if err == nil {
+				log.Printf("Repaired %d balances\n", repaired)
+			}
+		}
+		chainLock.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	verifyMismatches.With("addr_asset").Set(float64(len(report.Balances)))
+	verifyMismatches.With("asset_available").Set(float64(len(report.Available)))
+
+	logVerifyReport(report)
+	log.Printf("Verified %d address balances in %s\n", report.Checked, time.Since(start))
+
+	return report, nil
+}
+
+func logVerifyReport(report *db.VerifyReport) {
+	for i, m := range report.Balances {
+		if i == maxLoggedMismatches {
+			log.Error.Printf("... %d more balance mismatches\n", len(report.Balances)-i)
+			break
+		}
+
+		balance, cached := "missing", "missing"
+		if m.Balance != nil {
+			balance = m.Balance.Text('f', 8)
+		}
+		if m.Cached != nil {
+			cached = m.Cached.Text('f', 8)
+		}
+		log.Error.Printf("Balance mismatch: address_id=%d, asset_id=%d, addr_asset=%s, cache=%s, utxo=%s\n",
+			m.AddressId, m.AssetId, balance, cached, m.UTXO.Text('f', 8))
+	}
+
+	for _, m := range report.Available {
+		log.Error.Printf("Available mismatch: asset %s, available=%s, issued=%s\n",
+			m.AssetID, m.Available.Text('f', 8), m.Issued.Text('f', 8))
+	}
+}
@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"math/big"
+	"neo_explorer/neo/db"
+	"testing"
+	"time"
+)
+
+// verifyStore reports a mismatch on scan, only the second one is left on recheck.
+type verifyStore struct {
+	db.Store
+	rechecked bool
+	unlocked  bool
+	repaired  []db.BalanceMismatch
+}
+
+func (s *verifyStore) VerifyBalances(withCache bool) (*db.VerifyReport, error) {
+	return &db.VerifyReport{
+		Checked: 2,
+		Balances: []db.BalanceMismatch{
+			{AddressId: 1, AssetId: 1, Balance: big.NewFloat(1), UTXO: big.NewFloat(2)},
+			{AddressId: 2, AssetId: 1, Balance: big.NewFloat(3), UTXO: big.NewFloat(4)},
+		},
+	}, nil
+}
+
+func (s *verifyStore) RecheckBalances(r *db.VerifyReport, withCache bool) (*db.VerifyReport, error) {
+	s.rechecked = true
+
+	// Tasks must not be writing while mismatches are rechecked.
+	acquired := make(chan struct{})
+	go func() {
+		chainLock.RLock()
+		close(acquired)
+		chainLock.RUnlock()
+	}()
+	select {
+	case <-acquired:
+		s.unlocked = true
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	return &db.VerifyReport{Checked: r.Checked, Balances: r.Balances[1:]}, nil
+}
+
+func (s *verifyStore) RepairBalances(r *db.VerifyReport) (int, error) {
+	s.repaired = append(s.repaired, r.Balances...)
+	return len(r.Balances), nil
+}
+
+func TestVerifyBalances(t *testing.T) {
+	for _, repair := range []bool{false, true} {
+		store := &verifyStore{}
+		tr := &taskRunner{store: store}
+
+		report, err := tr.verifyBalances(repair)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !store.rechecked || store.unlocked {
+			t.Error("mismatches are not rechecked while chainLock is held")
+		}
+		if len(report.Balances) != 1 || report.Balances[0].AddressId != 2 {
+			t.Errorf("mismatches = %+v, want only address 2", report.Balances)
+		}
+
+		want := 0
+		if repair {
+			want = 1
+		}
+		if len(store.repaired) != want {
+			t.Errorf("repair=%t: repaired %+v", repair, store.repaired)
+		}
+	}
+}
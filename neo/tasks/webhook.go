@@ -0,0 +1,127 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// webhookInterval is how often due deliveries are looked up.
+	webhookInterval = 2 * time.Second
+	// webhookBatch is the max number of deliveries posted in one round.
+	webhookBatch = 100
+
+	// Failed deliveries are retried with exponential backoff, and given up after maxWebhookAttempts.
+	minWebhookRetryDelay = 10 * time.Second
+	maxWebhookRetryDelay = time.Hour
+	maxWebhookAttempts   = uint(10)
+
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// runWebhookTask posts payloads of watched movements to their webhooks.
+func (tr *taskRunner) runWebhookTask(ctx context.Context) error {
+	for {
+		if err := tr.deliverWebhooks(ctx); err != nil {
+			return err
+		}
+
+		if !sleep(ctx, webhookInterval) {
+			return nil
+		}
+	}
+}
+
+// deliverWebhooks posts every due delivery once and records the result.
+func (tr *taskRunner) deliverWebhooks(ctx context.Context) error {
+	deliveries, err := tr.store.GetDueWebhookDeliveries(time.Now().Unix(), webhookBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		now := time.Now()
+		d.Attempts++
+		if err := postWebhook(ctx, d); err != nil {
+			d.LastError = err.Error()
+			if d.Attempts >= maxWebhookAttempts {
+				d.Status = db.DeliveryFailed
+				log.Error.Printf("Webhook delivery %d of watch %d failed after %d attempts: %v\n", d.Id, d.WatchId, d.Attempts, err)
+			} else {
+				d.NextAttemptAt = now.Add(webhookRetryDelay(d.Attempts)).Unix()
+			}
+		} else {
+			d.Status = db.DeliveryDelivered
+			d.LastError = ""
+			d.DeliveredAt = now.Unix()
+		}
+
+		if err := tr.store.UpdateWebhookDelivery(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// webhookRetryDelay returns the delay before the next attempt after the given failed attempts.
+func webhookRetryDelay(attempts uint) time.Duration {
+	delay := minWebhookRetryDelay
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= maxWebhookRetryDelay {
+			return maxWebhookRetryDelay
+		}
+	}
+
+	return delay
+}
+
+// postWebhook posts the payload signed with the secret of the watch, any status other than 2xx fails.
+func postWebhook(ctx context.Context, d *db.WebhookDelivery) error {
+	payload := []byte(d.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, d.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sha256="+signWebhookPayload(d.Secret, payload))
+	req.Header.Set("X-Delivery-Id", strconv.FormatUint(uint64(d.Id), 10))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of the payload.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
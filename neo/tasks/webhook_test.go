@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"context"
+	"io/ioutil"
+	stdlog "log"
+	"neo_explorer/core/log"
+	"neo_explorer/neo/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookStore returns its pending deliveries as due.
+type webhookStore struct {
+	db.Store
+	deliveries []*db.WebhookDelivery
+}
+
+func (s *webhookStore) GetDueWebhookDeliveries(now int64, limit int) ([]*db.WebhookDelivery, error) {
+	due := []*db.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.Status == db.DeliveryPending {
+			copied := *d
+			due = append(due, &copied)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *webhookStore) UpdateWebhookDelivery(d *db.WebhookDelivery) error {
+	for i := range s.deliveries {
+		if s.deliveries[i].Id == d.Id {
+			s.deliveries[i] = d
+		}
+	}
+
+	return nil
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	log.Error = stdlog.New(ioutil.Discard, "", 0)
+
+	const payload = `{"watch_id":1,"txid":"0xaa"}`
+	const secret = "secret"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" || string(body) != payload ||
+			r.Header.Get("X-Signature") != "sha256="+signWebhookPayload(secret, body) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	store := &webhookStore{deliveries: []*db.WebhookDelivery{
+		{Id: 1, WatchId: 1, Webhook: server.URL + "/ok", Secret: secret, Payload: payload, Status: db.DeliveryPending},
+		{Id: 2, WatchId: 2, Webhook: server.URL + "/fail", Secret: secret, Payload: payload, Status: db.DeliveryPending},
+		{Id: 3, WatchId: 3, Webhook: server.URL + "/ok", Secret: "other", Payload: payload, Status: db.DeliveryPending},
+	}}
+	tr := &taskRunner{store: store}
+
+	if err := tr.deliverWebhooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := store.deliveries[0]; d.Status != db.DeliveryDelivered || d.Attempts != 1 || d.DeliveredAt == 0 {
+		t.Errorf("delivery with valid signature = %+v, want delivered", d)
+	}
+	for _, d := range store.deliveries[1:] {
+		if d.Status != db.DeliveryPending || d.Attempts != 1 || d.LastError == "" || d.NextAttemptAt <= time.Now().Unix() {
+			t.Errorf("failed delivery = %+v, want pending with a later attempt", d)
+		}
+	}
+
+	// Deliveries are given up after max attempts.
+	for i := 1; i < int(maxWebhookAttempts); i++ {
+		if err := tr.deliverWebhooks(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := store.deliveries[1]; d.Status != db.DeliveryFailed || d.Attempts != maxWebhookAttempts {
+		t.Errorf("delivery after %d failed attempts = %+v, want failed", maxWebhookAttempts, d)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	for attempts, want := range map[uint]time.Duration{
+		1:  minWebhookRetryDelay,
+		2:  2 * minWebhookRetryDelay,
+		4:  8 * minWebhookRetryDelay,
+		20: maxWebhookRetryDelay,
+	} {
+		if got := webhookRetryDelay(attempts); got != want {
+			t.Errorf("webhookRetryDelay(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package tasks
 
 import (
+	"context"
+	"fmt"
+	"neo_explorer/core/config"
+	"neo_explorer/core/log"
 	"sync"
 )
 
@@ -8,6 +12,10 @@ import (
 type Worker struct {
 	mu        sync.Mutex
 	threadCnt uint8
+	// target is the number of workers wanted, extra workers quit.
+	target uint8
+	// ctx is used by workers started at runtime, nil before tasks run.
+	ctx context.Context
 }
 
 func (manager *Worker) shouldQuit() bool {
@@ -28,11 +36,70 @@ func (manager *Worker) num() uint8 {
 	return manager.threadCnt
 }
 
-func (manager *Worker) add() uint8 {
+// exceeds returns true if the calling worker should quit
+// because there are more workers than the target.
+func (manager *Worker) exceeds() bool {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	manager.threadCnt++
+	if manager.threadCnt > manager.target && manager.threadCnt > 1 {
+		manager.threadCnt--
+		return true
+	}
+	return false
+}
 
-	return manager.threadCnt
+// start sets the target and starts that many workers fetching blocks until ctx is done.
+func (manager *Worker) start(ctx context.Context, target int) {
+	manager.mu.Lock()
+	manager.ctx = ctx
+	manager.mu.Unlock()
+
+	if err := manager.resize(target); err != nil {
+		panic(err)
+	}
+}
+
+// resize sets the target and spawns workers up to it once tasks run.
+// New workers are counted before they are spawned, so concurrent calls never exceed the target.
+func (manager *Worker) resize(n int) error {
+	if n < 1 || n > config.MaxWorkers {
+		return fmt.Errorf("number of workers must be between 1 and %d", config.MaxWorkers)
+	}
+
+	manager.mu.Lock()
+	manager.target = uint8(n)
+	ctx := manager.ctx
+	more := 0
+	if ctx != nil && ctx.Err() == nil && int(manager.threadCnt) < n {
+		more = n - int(manager.threadCnt)
+		manager.threadCnt = uint8(n)
+	}
+	manager.mu.Unlock()
+
+	for i := 0; i < more; i++ {
+		spawn(func() { fetchBlock(ctx) })
+	}
+
+	return nil
+}
+
+// SetWorkers changes the number of workers fetching blocks at runtime.
+// Extra workers quit after their current download.
+func SetWorkers(n int) error {
+	if err := worker.resize(n); err != nil {
+		return err
+	}
+
+	log.Printf("Number of workers fetching blocks set to %d\n", n)
+
+	return nil
+}
+
+// Workers returns the number of running workers fetching blocks and the target number.
+func Workers() (int, int) {
+	worker.mu.Lock()
+	defer worker.mu.Unlock()
+
+	return int(worker.threadCnt), int(worker.target)
 }
@@ -91,6 +91,8 @@ type TransactionClaims struct {
 	ID   uint
 	TxId uint
 	//TxMap string
+	// TxID is pk of the transaction whose output is claimed.
+	TxID uint
 	Vout uint16
 }
 
@@ -59,6 +59,9 @@ create table address
 create unique index uk_address
     on address(address);
 
+create index idx_address_created_at
+    on address(created_at);
+
 
 create table asset
 (
@@ -177,12 +180,16 @@ create table tx_claims
     id   int unsigned auto_increment primary key,
     tx_id   int         not null,
 --     txid char(66)     not null,
+    txid   int     not null,
     vout int unsigned not null
 ) engine = InnoDB default charset = 'utf8mb4';
 
 create index idx_tx_claims_txid
     on tx_claims(tx_id);
 
+create index idx_tx_claims_txid_vout
+    on tx_claims(txid, vout);
+
 
 create table tx_scripts
 (
@@ -274,7 +281,8 @@ create table counter
     app_log_idx            int          not null,
     last_tx_pk_for_sc      int unsigned not null,
     nep5_tx_pk_for_addr_tx int unsigned not null,
-    last_tx_pk_gas_balance int unsigned not null,
+    last_tx_pk_balance     int unsigned not null,
+    nep5_tx_pk_for_balance int unsigned not null,
     cnt_addr               int unsigned not null,
     cnt_tx_reg             int unsigned not null,
     cnt_tx_miner           int unsigned not null,
@@ -382,14 +390,213 @@ create table nep5_migrate
     migrate_tx_id int not null
 ) engine = InnoDB default charset = 'utf8mb4';
 
-create table addr_gas_balance
+-- bucket_time is the unix time the hour or day starts at, balance is the one at the end of it.
+create table addr_balance_history
+(
+    id          int unsigned auto_increment primary key,
+    address_id  int unsigned   not null,
+    asset_id    int unsigned   not null,
+    bucket_time bigint         not null,
+    balance     decimal(35, 8) not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_addr_balance_history`
+    on `addr_balance_history`(`address_id`, `asset_id`, `bucket_time`);
+
+create index `idx_addr_balance_history_bucket_time`
+    on `addr_balance_history`(`bucket_time`);
+
+create table task_error
 (
     id         int unsigned auto_increment primary key,
---     address    char(34)       not null,
-    address_id   int       not null,
-    date       date           not null,
-    balance    decimal(35, 8) not null
+    task       varchar(32)     not null,
+    tx_pk      int unsigned    not null,
+    error      text            not null,
+    created_at bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_task_error_task_tx_pk`
+    on `task_error`(`task`, `tx_pk`);
+
+-- address_id is 0 for total supply.
+create table nep5_reconcile
+(
+    id          int unsigned auto_increment primary key,
+    asset_id    int unsigned    not null,
+    address_id  int unsigned    not null,
+    old_value   decimal(35, 8)  not null,
+    new_value   decimal(35, 8)  not null,
+    block_index int unsigned    not null,
+    created_at  bigint unsigned not null
 ) engine = InnoDB default charset = 'utf8mb4';
 
-create index `idx_address_id_date`
-    on `addr_gas_balance`(`address_id`, `date`);
+create index `idx_nep5_reconcile_asset_id`
+    on `nep5_reconcile`(`asset_id`);
+
+-- total_sys_fee is the sum of system fees of blocks [0, block_index] in whole GAS.
+create table block_sys_fee
+(
+    id            int unsigned auto_increment primary key,
+    block_index   int unsigned    not null,
+    total_sys_fee bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_block_sys_fee_block_index`
+    on `block_sys_fee`(`block_index`);
+
+-- last_pk and end_pk are pks of tx for utxo assets or of nep5_tx for nep5 assets,
+-- records up to last_pk have been replayed, the snapshot is finished once last_pk reaches end_pk.
+create table snapshot
+(
+    id         int unsigned auto_increment primary key,
+    asset_id   int unsigned    not null,
+    height     int unsigned    not null,
+    last_pk    int unsigned    not null,
+    end_pk     int unsigned    not null,
+    created_at bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_snapshot_asset_id_height`
+    on `snapshot`(`asset_id`, `height`);
+
+create table snapshot_balance
+(
+    id          int unsigned auto_increment primary key,
+    snapshot_id int unsigned   not null,
+    address_id  int unsigned   not null,
+    balance     decimal(35, 8) not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_snapshot_balance_snapshot_id_address_id`
+    on `snapshot_balance`(`snapshot_id`, `address_id`);
+
+create index `idx_snapshot_balance_snapshot_id_balance`
+    on `snapshot_balance`(`snapshot_id`, `balance`);
+
+-- rich_list holds the largest holders of every asset, recomputed by the rich_list task,
+-- percentage is the share of supply in percent, label is 'contract' or 'multisig' when known.
+create table rich_list
+(
+    id         int unsigned auto_increment primary key,
+    asset_id   int unsigned   not null,
+    ranking    int unsigned   not null,
+    address_id int unsigned   not null,
+    balance    decimal(35, 8) not null,
+    percentage decimal(11, 8) not null,
+    label      varchar(16)    not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_rich_list_asset_id_ranking`
+    on `rich_list`(`asset_id`, `ranking`);
+
+create table asset_distribution
+(
+    id                int unsigned auto_increment primary key,
+    asset_id          int unsigned    not null,
+    supply            decimal(35, 8)  not null,
+    holders           bigint unsigned not null,
+    top10_percentage  decimal(11, 8)  not null,
+    top100_percentage decimal(11, 8)  not null,
+    gini              decimal(9, 8)   not null,
+    block_index       int unsigned    not null,
+    updated_at        bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_asset_distribution_asset_id`
+    on `asset_distribution`(`asset_id`);
+
+-- holders with balances in [lower_bound, lower_bound * 10), or in (0, 1) for the band of lower_bound 0.
+create table asset_balance_band
+(
+    id          int unsigned auto_increment primary key,
+    asset_id    int unsigned    not null,
+    lower_bound decimal(35, 8)  not null,
+    holders     bigint unsigned not null,
+    balance     decimal(35, 8)  not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create index `idx_asset_balance_band_asset_id`
+    on `asset_balance_band`(`asset_id`);
+
+-- daily_stats holds network statistics of every UTC day since the genesis block, day_time is the start of the day,
+-- data before end_time is aggregated, end_time is less than day_time + 86400 if the day is incomplete.
+create table daily_stats
+(
+    id                 int unsigned auto_increment primary key,
+    day_time           bigint unsigned not null,
+    end_time           bigint unsigned not null,
+    blocks             int unsigned    not null,
+    avg_block_interval decimal(12, 3)  not null,
+    txs                int unsigned    not null,
+    cnt_tx_reg         int unsigned    not null,
+    cnt_tx_miner       int unsigned    not null,
+    cnt_tx_issue       int unsigned    not null,
+    cnt_tx_invocation  int unsigned    not null,
+    cnt_tx_contract    int unsigned    not null,
+    cnt_tx_claim       int unsigned    not null,
+    cnt_tx_publish     int unsigned    not null,
+    cnt_tx_enrollment  int unsigned    not null,
+    sys_fee            decimal(27, 8)  not null,
+    net_fee            decimal(27, 8)  not null,
+    active_addrs       int unsigned    not null,
+    new_addrs          int unsigned    not null,
+    nep5_transfers     int unsigned    not null,
+    updated_at         bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_daily_stats_day_time`
+    on `daily_stats`(`day_time`);
+
+-- daily_asset_stats holds the total value of utxo outputs of every asset created in every day.
+create table daily_asset_stats
+(
+    id       int unsigned auto_increment primary key,
+    day_time bigint unsigned not null,
+    asset_id int unsigned    not null,
+    value    decimal(35, 8)  not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_daily_asset_stats_day_time_asset_id`
+    on `daily_asset_stats`(`day_time`, `asset_id`);
+
+-- watch is an address or a nep5 asset watched by a webhook, asset_id is 0 for addresses and address is '' for nep5 assets.
+create table watch
+(
+    id         int unsigned auto_increment primary key,
+    address    varchar(128)    not null,
+    asset_id   int unsigned    not null,
+    webhook    varchar(512)    not null,
+    secret     char(64)        not null,
+    created_at bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create index `idx_watch_address`
+    on `watch`(`address`);
+
+-- watch_delivery is the delivery log of webhooks, status is 'pending', 'delivered' or 'failed',
+-- event_idx is the index of the nep5 transfer in the transaction, or -1 for utxo movements.
+-- tx_pk is null once the transaction is rolled back, as its pk will be reused, and for deliveries which
+-- revert a delivered movement of a rolled back transaction, reverts is the id of the reverted delivery.
+create table watch_delivery
+(
+    id              int unsigned auto_increment primary key,
+    watch_id        int unsigned    not null,
+    tx_pk           int unsigned    null,
+    event_idx       int             not null,
+    address         varchar(128)    not null,
+    direction       varchar(8)      not null,
+    reverts         int unsigned    default 0 not null,
+    payload         text            not null,
+    status          varchar(16)     not null,
+    attempts        int unsigned    not null,
+    next_attempt_at bigint unsigned not null,
+    last_error      varchar(255)    not null,
+    created_at      bigint unsigned not null,
+    delivered_at    bigint unsigned not null
+) engine = InnoDB default charset = 'utf8mb4';
+
+create unique index `uk_watch_delivery_movement`
+    on `watch_delivery`(`watch_id`, `tx_pk`, `event_idx`, `address`, `direction`);
+
+create index `idx_watch_delivery_status_next_attempt_at`
+    on `watch_delivery`(`status`, `next_attempt_at`);
@@ -0,0 +1,596 @@
+-- createdb -E UTF8 blockchain_neo
+-- psql -d blockchain_neo -f sqls/create_table_postgres.sql
+
+create table addr_asset
+(
+    id           serial primary key,
+--     address      varchar(128)              not null,
+    address_id   int                       not null,
+    asset_id     int                       not null,
+    balance      numeric(35, 8)           not null,
+    transactions bigint                   not null,
+    last_transaction_time bigint          not null
+);
+
+create index addr_asset_asset_id_balance_index
+    on addr_asset(asset_id, balance);
+
+create unique index addr_asset_address_id_asset_id_uindex
+    on addr_asset(address_id, asset_id);
+
+
+create table addr_tx
+(
+    id         serial primary key,
+    tx_id      int         not null,
+--     txid       varchar(66)        not null,
+--     address    varchar(128)        not null,
+    address_id  int        not null,
+    block_time bigint          not null,
+    asset_type varchar(16)     not null
+);
+
+create unique index addr_tx_address_id_asset_type_txid_uindex
+    on addr_tx(address_id, asset_type, tx_id);
+
+create index addr_tx_txid
+    on addr_tx(tx_id);
+
+create index addr_tx_address_id
+    on addr_tx(address_id);
+
+
+create table address
+(
+    id                    serial primary key,
+    address               varchar(128)     not null,
+    created_at            bigint          not null,
+    last_transaction_time bigint          not null,
+    trans_asset           bigint          not null,
+    trans_nep5           bigint          not null
+);
+
+create unique index uk_address
+    on address(address);
+
+create index idx_address_created_at
+    on address(created_at);
+
+
+create table asset
+(
+    id           serial primary key,
+    block_index  bigint           not null,
+    block_time   bigint           not null,
+    version      bigint           not null,
+    asset_id     varchar(66)         not null,
+    type         varchar(32)      not null,
+    name         varchar(128)      not null,
+    amount       numeric(35, 8)   not null,
+    available    numeric(35, 8)   not null,
+    "precision"  smallint         not null,
+    owner        varchar(66)         not null,
+    admin        varchar(34)         not null,
+    issuer       varchar(66)         not null,
+    expiration   bigint           not null,
+    frozen       boolean          not null,
+    addresses    bigint           not null,
+    transactions bigint           not null
+);
+
+create index idx_asset_asset_id
+    on asset(asset_id);
+
+create index idx_asset_time
+    on asset(block_time);
+
+
+create table asset_tx
+(
+    id          serial primary key,
+    address_id  int       not null,
+    asset_id    int             not null,
+    tx_id       int             not null
+--     txid        varchar(66)        not null
+);
+
+create index idx_asset_tx_address_id_asset_id
+    on asset_tx(address_id, asset_id);
+
+create unique index idx_asset_tx_address_id_asset_id_txid
+    on asset_tx(address_id, asset_id, tx_id);
+
+
+create table block
+(
+    id                  serial primary key,
+    hash                varchar(66)        not null,
+    size                int             not null,
+    version             bigint          not null,
+    previousblockhash   varchar(66)        not null,
+    merkleroot          varchar(66)        not null,
+    time                bigint          not null,
+    "index"             bigint          not null,
+    nonce               varchar(16)        not null,
+    nextconsensus       varchar(34)        not null,
+    script_invocation   text            not null,
+    script_verification text            not null,
+    nextblockhash       varchar(66)        not null
+);
+
+create index idx_block_hash
+    on block(hash);
+
+create unique index idx_block_index
+    on block("index");
+
+create index idx_block_time
+    on block(time);
+
+create table tx
+(
+    id          serial primary key,
+    block_index bigint          not null,
+    block_time  bigint          not null,
+    txid        varchar(66)        not null,
+    size        bigint          not null,
+    type        varchar(32)     not null,
+    version     bigint          not null,
+    sys_fee     numeric(27, 8)  not null,
+    net_fee     numeric(27, 8)  not null,
+    nonce       bigint          not null,
+    script      text            not null,
+    gas         numeric(27, 8)  not null
+);
+
+create index idx_tx_block_index
+    on tx(block_index);
+
+create index idx_tx_txid
+    on tx(txid);
+
+create index idx_tx_type
+    on tx(type);
+
+
+create table tx_attr
+(
+    id      serial primary key,
+    tx_id   int         not null,
+--     txid    varchar(66)    not null,
+    "usage" varchar(32) not null,
+    data    text        not null
+);
+
+create index idx_tx_attr_txid
+    on tx_attr(tx_id);
+
+create index idx_tx_attr_usage
+    on tx_attr("usage");
+
+
+create table tx_claims
+(
+    id   serial primary key,
+    tx_id   int         not null,
+--     txid varchar(66)     not null,
+    txid   int     not null,
+    vout bigint       not null
+);
+
+create index idx_tx_claims_txid
+    on tx_claims(tx_id);
+
+create index idx_tx_claims_txid_vout
+    on tx_claims(txid, vout);
+
+
+create table tx_scripts
+(
+    id           serial primary key,
+    tx_id   int         not null,
+--     txid         varchar(66) not null,
+    invocation   text     not null,
+    verification text     not null
+);
+
+create index idx_tx_scripts_txid
+    on tx_scripts(tx_id);
+
+
+create table tx_vin
+(
+    id     serial primary key,
+    tx_id   int         not null,
+--     "from" varchar(66)     not null,
+    txid   int     not null,
+    vout   bigint       not null
+);
+
+create index idx_tx_vin_tx_id
+    on tx_vin(tx_id);
+
+create index idx_tx_vin_txid
+on tx_vin(txid);
+
+
+create table tx_vout
+(
+    id       serial primary key,
+    tx_id   int         not null,
+--     txid     varchar(66)       not null,
+    n        bigint         not null,
+    asset_id int            not null,
+    value    numeric(35, 8) not null,
+    address  varchar(34)       not null,
+    address_id  int         not null
+);
+
+create index idx_tx_vout_address
+    on tx_vout(address);
+
+create index idx_tx_vout_address_id
+    on tx_vout(address_id);
+
+create index idx_tx_vout_asset_id
+    on tx_vout(asset_id);
+
+create index idx_tx_vout_txid
+    on tx_vout(tx_id);
+
+
+create table utxo
+(
+    id         serial primary key,
+--     address    varchar(34)       not null,
+    address_id    int            not null,
+    tx_id      int            not null,
+--     txid       varchar(66)       not null,
+    n          bigint         not null,
+    asset_id   int           not null,
+    value      numeric(35, 8) not null,
+    used_in_tx int
+);
+
+create index idx_utxo_address_id
+    on utxo(address_id);
+
+create index idx_utxo_asset_id
+    on utxo(asset_id);
+
+create index idx_utxo_txid
+    on utxo(tx_id);
+
+create index idx_utxo_used_in_tx
+    on utxo(used_in_tx);
+
+
+create table counter
+(
+    id                     serial primary key,
+    last_block_index       int          not null,
+    last_tx_pk             bigint       not null,
+    last_asset_tx_pk       bigint       not null,
+    last_tx_pk_for_nep5    bigint       not null,
+    app_log_idx            int          not null,
+    last_tx_pk_for_sc      bigint       not null,
+    nep5_tx_pk_for_addr_tx bigint       not null,
+    last_tx_pk_balance     bigint       not null,
+    nep5_tx_pk_for_balance bigint       not null,
+    cnt_addr               bigint       not null,
+    cnt_tx_reg             bigint       not null,
+    cnt_tx_miner           bigint       not null,
+    cnt_tx_issue           bigint       not null,
+    cnt_tx_invocation      bigint       not null,
+    cnt_tx_contract        bigint       not null,
+    cnt_tx_claim           bigint       not null,
+    cnt_tx_publish         bigint       not null,
+    cnt_tx_enrollment      bigint       not null
+);
+
+create table smartcontract_info
+(
+    id             serial primary key,
+    tx_id          int          not null,
+--     txid           varchar(66)     not null,
+    script_hash    varchar(40)     not null,
+    name           varchar(255) not null,
+    version        varchar(255) not null,
+    author         varchar(255) not null,
+    email          varchar(255) not null,
+    description    varchar(255) not null,
+    need_storage   boolean      not null,
+    parameter_list varchar(255) not null,
+    return_type    varchar(255) not null
+);
+
+create index idx_script_hash
+    on smartcontract_info(script_hash);
+
+
+create table nep5
+(
+    id                serial primary key,
+    asset_id          int                  not null,
+    admin_address     varchar(40)             not null,
+    name              varchar(128)          not null,
+    symbol            varchar(16)          not null,
+    decimals          smallint             not null,
+    total_supply      numeric(35, 8)       not null,
+    tx_id             int                  not null,
+--     txid              varchar(66)             not null,
+    block_index       bigint               not null,
+    block_time        bigint               not null,
+    addresses         bigint               not null,
+    holding_addresses bigint               not null,
+    transfers         bigint               not null,
+    visible           boolean default true not null
+);
+
+create index idx_nep5_txid
+    on nep5(tx_id);
+
+
+create table nep5_reg_info
+(
+    id             serial primary key,
+    nep5_id        bigint       not null,
+    name           varchar(255) not null,
+    version        varchar(255) not null,
+    author         varchar(255) not null,
+    email          varchar(255) not null,
+    description    varchar(255) not null,
+    need_storage   boolean      not null,
+    parameter_list varchar(255) not null,
+    return_type    varchar(255) not null
+);
+
+create index idx_nep5_id
+    on nep5_reg_info(nep5_id);
+
+
+create table nep5_tx
+(
+    id          serial primary key,
+    tx_id       int             not null,
+--     txid        varchar(66)        not null,
+    asset_id    int             not null,
+    "from"      varchar(128)     not null,
+    "to"        varchar(128)     not null,
+    value       double precision      not null,
+    block_index bigint          not null,
+    block_time  bigint          not null
+);
+
+create index idx_nep5_tx_asset_id
+    on nep5_tx(asset_id);
+
+create index idx_nep5_tx_from
+    on nep5_tx("from");
+
+create index idx_nep5_tx_to
+    on nep5_tx("to");
+
+create index idx_nep5_tx_txid
+    on nep5_tx(tx_id);
+
+
+create table nep5_migrate
+(
+    id           serial primary key,
+    old_asset_id varchar(40) not null,
+    new_asset_id varchar(40) not null,
+--     migrate_txid varchar(66) not null
+    migrate_tx_id int not null
+);
+
+-- bucket_time is the unix time the hour or day starts at, balance is the one at the end of it.
+create table addr_balance_history
+(
+    id          serial primary key,
+    address_id  bigint         not null,
+    asset_id    bigint         not null,
+    bucket_time bigint         not null,
+    balance     numeric(35, 8) not null
+);
+
+create unique index "uk_addr_balance_history"
+    on "addr_balance_history"("address_id", "asset_id", "bucket_time");
+
+create index "idx_addr_balance_history_bucket_time"
+    on "addr_balance_history"("bucket_time");
+
+create table task_error
+(
+    id         serial primary key,
+    task       varchar(32) not null,
+    tx_pk      bigint      not null,
+    error      text        not null,
+    created_at bigint      not null
+);
+
+create unique index "uk_task_error_task_tx_pk"
+    on "task_error"("task", "tx_pk");
+
+-- address_id is 0 for total supply.
+create table nep5_reconcile
+(
+    id          serial primary key,
+    asset_id    bigint         not null,
+    address_id  bigint         not null,
+    old_value   decimal(35, 8) not null,
+    new_value   decimal(35, 8) not null,
+    block_index bigint         not null,
+    created_at  bigint         not null
+);
+
+create index "idx_nep5_reconcile_asset_id"
+    on "nep5_reconcile"("asset_id");
+
+-- total_sys_fee is the sum of system fees of blocks [0, block_index] in whole GAS.
+create table block_sys_fee
+(
+    id            serial primary key,
+    block_index   bigint not null,
+    total_sys_fee bigint not null
+);
+
+create unique index "uk_block_sys_fee_block_index"
+    on "block_sys_fee"("block_index");
+
+-- last_pk and end_pk are pks of tx for utxo assets or of nep5_tx for nep5 assets,
+-- records up to last_pk have been replayed, the snapshot is finished once last_pk reaches end_pk.
+create table snapshot
+(
+    id         serial primary key,
+    asset_id   bigint not null,
+    height     bigint not null,
+    last_pk    bigint not null,
+    end_pk     bigint not null,
+    created_at bigint not null
+);
+
+create unique index "uk_snapshot_asset_id_height"
+    on "snapshot"("asset_id", "height");
+
+create table snapshot_balance
+(
+    id          serial primary key,
+    snapshot_id bigint         not null,
+    address_id  bigint         not null,
+    balance     decimal(35, 8) not null
+);
+
+create unique index "uk_snapshot_balance_snapshot_id_address_id"
+    on "snapshot_balance"("snapshot_id", "address_id");
+
+create index "idx_snapshot_balance_snapshot_id_balance"
+    on "snapshot_balance"("snapshot_id", "balance");
+
+-- rich_list holds the largest holders of every asset, recomputed by the rich_list task,
+-- percentage is the share of supply in percent, label is 'contract' or 'multisig' when known.
+create table rich_list
+(
+    id         serial primary key,
+    asset_id   bigint         not null,
+    ranking    bigint         not null,
+    address_id bigint         not null,
+    balance    decimal(35, 8) not null,
+    percentage decimal(11, 8) not null,
+    label      varchar(16)    not null
+);
+
+create unique index "uk_rich_list_asset_id_ranking"
+    on "rich_list"("asset_id", "ranking");
+
+create table asset_distribution
+(
+    id                serial primary key,
+    asset_id          bigint         not null,
+    supply            decimal(35, 8) not null,
+    holders           bigint         not null,
+    top10_percentage  decimal(11, 8) not null,
+    top100_percentage decimal(11, 8) not null,
+    gini              decimal(9, 8)  not null,
+    block_index       bigint         not null,
+    updated_at        bigint         not null
+);
+
+create unique index "uk_asset_distribution_asset_id"
+    on "asset_distribution"("asset_id");
+
+-- holders with balances in [lower_bound, lower_bound * 10), or in (0, 1) for the band of lower_bound 0.
+create table asset_balance_band
+(
+    id          serial primary key,
+    asset_id    bigint         not null,
+    lower_bound decimal(35, 8) not null,
+    holders     bigint         not null,
+    balance     decimal(35, 8) not null
+);
+
+create index "idx_asset_balance_band_asset_id"
+    on "asset_balance_band"("asset_id");
+
+-- daily_stats holds network statistics of every UTC day since the genesis block, day_time is the start of the day,
+-- data before end_time is aggregated, end_time is less than day_time + 86400 if the day is incomplete.
+create table daily_stats
+(
+    id                 serial primary key,
+    day_time           bigint         not null,
+    end_time           bigint         not null,
+    blocks             bigint         not null,
+    avg_block_interval decimal(12, 3) not null,
+    txs                bigint         not null,
+    cnt_tx_reg         bigint         not null,
+    cnt_tx_miner       bigint         not null,
+    cnt_tx_issue       bigint         not null,
+    cnt_tx_invocation  bigint         not null,
+    cnt_tx_contract    bigint         not null,
+    cnt_tx_claim       bigint         not null,
+    cnt_tx_publish     bigint         not null,
+    cnt_tx_enrollment  bigint         not null,
+    sys_fee            decimal(27, 8) not null,
+    net_fee            decimal(27, 8) not null,
+    active_addrs       bigint         not null,
+    new_addrs          bigint         not null,
+    nep5_transfers     bigint         not null,
+    updated_at         bigint         not null
+);
+
+create unique index "uk_daily_stats_day_time"
+    on "daily_stats"("day_time");
+
+-- daily_asset_stats holds the total value of utxo outputs of every asset created in every day.
+create table daily_asset_stats
+(
+    id       serial primary key,
+    day_time bigint         not null,
+    asset_id bigint         not null,
+    value    decimal(35, 8) not null
+);
+
+create unique index "uk_daily_asset_stats_day_time_asset_id"
+    on "daily_asset_stats"("day_time", "asset_id");
+
+-- watch is an address or a nep5 asset watched by a webhook, asset_id is 0 for addresses and address is '' for nep5 assets.
+create table watch
+(
+    id         serial primary key,
+    address    varchar(128) not null,
+    asset_id   bigint       not null,
+    webhook    varchar(512) not null,
+    secret     char(64)     not null,
+    created_at bigint       not null
+);
+
+create index "idx_watch_address"
+    on "watch"("address");
+
+-- watch_delivery is the delivery log of webhooks, status is 'pending', 'delivered' or 'failed',
+-- event_idx is the index of the nep5 transfer in the transaction, or -1 for utxo movements.
+-- tx_pk is null once the transaction is rolled back, as its pk will be reused, and for deliveries which
+-- revert a delivered movement of a rolled back transaction, reverts is the id of the reverted delivery.
+create table watch_delivery
+(
+    id              serial primary key,
+    watch_id        bigint       not null,
+    tx_pk           bigint       null,
+    event_idx       int          not null,
+    address         varchar(128) not null,
+    direction       varchar(8)   not null,
+    reverts         bigint       default 0 not null,
+    payload         text         not null,
+    status          varchar(16)  not null,
+    attempts        bigint       not null,
+    next_attempt_at bigint       not null,
+    last_error      varchar(255) not null,
+    created_at      bigint       not null,
+    delivered_at    bigint       not null
+);
+
+create unique index "uk_watch_delivery_movement"
+    on "watch_delivery"("watch_id", "tx_pk", "event_idx", "address", "direction");
+
+create index "idx_watch_delivery_status_next_attempt_at"
+    on "watch_delivery"("status", "next_attempt_at");